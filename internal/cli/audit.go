@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/injector"
+	"github.com/spf13/cobra"
+)
+
+// auditTool pairs a tool name with the target file its instructions go into.
+type auditTool struct {
+	name   string
+	target string
+}
+
+// auditTools are the built-in targets in the order they are audited.
+var auditTools = []auditTool{
+	{config.ToolClaude, injector.ClaudeConfig(nil).Filename},
+	{config.ToolAgents, injector.AgentsConfig(nil).Filename},
+	{config.ToolCursor, injector.CursorConfig(nil).Filename},
+}
+
+func (a *App) newAuditCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "audit",
+		Short: "Show which tool files each installed stack's instructions go into",
+		Long:  "Prints a matrix of the installed stacks against CLAUDE.md, AGENTS.md and .cursorrules, showing which\nof each stack's files are referenced from each target, with totals per target.\nReads only the config; the registry is not contacted.",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runAudit()
+		},
+	}
+}
+
+func (a *App) runAudit() error {
+	if err := a.RequireProject(); err != nil {
+		return err
+	}
+
+	order, err := engine.ResolvedOrder(a.config.Resolved)
+	if err != nil {
+		return fmt.Errorf("ordering stacks: %w", err)
+	}
+	if len(order) == 0 {
+		a.output.Info("No stacks installed")
+		return nil
+	}
+
+	headers := []string{"STACK", "FILES"}
+	for _, t := range auditTools {
+		headers = append(headers, t.target)
+	}
+	a.output.Table(headers, auditRows(order, a.config.Resolved))
+
+	// The matrix shows what the stacks ask for; say where the project overrides that
+	if !a.config.InjectionEnabled() {
+		a.output.Info("\nInjection is disabled (inject: false): no target file gets a managed block.")
+		return nil
+	}
+	skip, err := config.SkippedTargets(a.projectDir, a.config)
+	if err != nil {
+		return err
+	}
+	var skipped []string
+	for _, t := range auditTools {
+		if skip[t.target] {
+			skipped = append(skipped, t.target)
+		}
+	}
+	if len(skipped) > 0 {
+		a.output.Info("\nOpted out of injection, so not written: %s", strings.Join(skipped, ", "))
+	}
+	var unused []string
+	for _, t := range auditTools {
+		if !a.config.ToolEnabled(t.name) {
+			unused = append(unused, t.target)
+		}
+	}
+	if len(unused) > 0 {
+		a.output.Info("\nFor tools the project doesn't use, so left without instructions: %s", strings.Join(unused, ", "))
+	}
+	return nil
+}
+
+// auditRows returns a row per stack with its file count and, for each built-in target,
+// "yes" if all of its files are included, "-" if none are, and "n/m" otherwise.
+// A final TOTAL row counts the files included in each target.
+func auditRows(order []string, resolved map[string]config.ResolvedStack) [][]string {
+	var rows [][]string
+	totalFiles := 0
+	totals := make([]int, len(auditTools))
+	for _, stackID := range order {
+		rs := resolved[stackID]
+		row := []string{stackID, strconv.Itoa(len(rs.Files))}
+		for i, t := range auditTools {
+			n := 0
+			for _, f := range rs.Files {
+				if rs.ToolsFor(f).Includes(t.name) {
+					n++
+				}
+			}
+			totals[i] += n
+			switch n {
+			case 0:
+				row = append(row, "-")
+			case len(rs.Files):
+				row = append(row, "yes")
+			default:
+				row = append(row, fmt.Sprintf("%d/%d", n, len(rs.Files)))
+			}
+		}
+		totalFiles += len(rs.Files)
+		rows = append(rows, row)
+	}
+
+	total := []string{"TOTAL", strconv.Itoa(totalFiles)}
+	for _, n := range totals {
+		total = append(total, strconv.Itoa(n))
+	}
+	return append(rows, total)
+}
@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+)
+
+func TestAuditRows(t *testing.T) {
+	resolved := map[string]config.ResolvedStack{
+		"php": {
+			Files:     []string{"coding-standards.md", "testing.md"},
+			Tools:     config.ToolsConfig{IncludeInClaudeMD: true, IncludeInAgentsMD: true},
+			FileTools: map[string]config.ToolsConfig{"testing.md": {IncludeInClaudeMD: true, IncludeInCursorRules: true}},
+		},
+		"secrets": {
+			Files: []string{"handling.md"},
+			Tools: config.ToolsConfig{IncludeInCursorRules: true},
+		},
+		"meta": {},
+	}
+
+	want := [][]string{
+		{"php", "2", "yes", "1/2", "1/2"},
+		{"secrets", "1", "-", "-", "yes"},
+		{"meta", "0", "-", "-", "-"},
+		{"TOTAL", "3", "2", "1", "2"},
+	}
+	got := auditRows([]string{"php", "secrets", "meta"}, resolved)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("auditRows() =\n%v\nwant\n%v", got, want)
+	}
+}
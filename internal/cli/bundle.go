@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newBundleCmd() *cobra.Command {
+	var output, tool string
+
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Concatenate installed instruction files into one document",
+		Long:  "Writes every resolved instruction file, in dependency order, into a single Markdown document\nwith a heading per file. Works offline from the installed files.\nUse --tool to bundle only the files a stack marks for that tool.",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runBundle(output, tool)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "file to write (default: stdout)")
+	cmd.Flags().StringVar(&tool, "tool", "", "only include files marked for claude, agents or cursor")
+	return cmd
+}
+
+func (a *App) runBundle(output, tool string) error {
+	switch tool {
+	case "", config.ToolClaude, config.ToolAgents, config.ToolCursor:
+	default:
+		return &ExitError{
+			Code:    exitcodes.UsageError,
+			Message: fmt.Sprintf("invalid tool %q: must be %s, %s or %s", tool, config.ToolClaude, config.ToolAgents, config.ToolCursor),
+		}
+	}
+
+	if err := a.RequireProject(); err != nil {
+		return err
+	}
+
+	order, err := engine.ResolvedOrder(a.config.Resolved)
+	if err != nil {
+		return fmt.Errorf("ordering stacks: %w", err)
+	}
+
+	bundle, stacks, err := buildBundle(filepath.Join(a.projectDir, a.getManagedDir()), order, a.config.Resolved, tool)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = os.Stdout.WriteString(bundle)
+		return err
+	}
+	if err := os.WriteFile(output, []byte(bundle), 0644); err != nil {
+		return fmt.Errorf("writing bundle: %w", err)
+	}
+	a.output.Success("Bundled %d stacks into %s", stacks, output)
+	return nil
+}
+
+// buildBundle concatenates the stacks' files from managedPath under "## <stack>/<file>" headings.
+// With a tool set, only files included in that tool's target are bundled. It also returns
+// the number of stacks with at least one bundled file.
+func buildBundle(managedPath string, order []string, resolved map[string]config.ResolvedStack, tool string) (string, int, error) {
+	var b strings.Builder
+	b.WriteString("# Company AI Instructions\n")
+
+	stacks := 0
+	for _, stackID := range order {
+		rs := resolved[stackID]
+		bundled := false
+		for _, f := range rs.Files {
+			if !rs.ToolsFor(f).Includes(tool) {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(managedPath, stackID, f))
+			if err != nil {
+				return "", 0, fmt.Errorf("reading %s/%s: %w", stackID, f, err)
+			}
+			fmt.Fprintf(&b, "\n## %s/%s\n\n", stackID, f)
+			b.WriteString(strings.TrimRight(string(data), "\n"))
+			b.WriteString("\n")
+			bundled = true
+		}
+		if bundled {
+			stacks++
+		}
+	}
+	return b.String(), stacks, nil
+}
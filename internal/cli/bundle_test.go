@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+)
+
+func TestBuildBundle(t *testing.T) {
+	managed := t.TempDir()
+	write := func(stack, file, content string) {
+		os.MkdirAll(filepath.Join(managed, stack), 0755)
+		os.WriteFile(filepath.Join(managed, stack, file), []byte(content), 0644)
+	}
+	write("php", "coding-standards.md", "Use PSR-12.\n")
+	write("laravel", "conventions.md", "Use form requests.\n\n")
+	write("cursor-only", "rules.md", "Cursor rules.\n")
+
+	resolved := map[string]config.ResolvedStack{
+		"php":         {Files: []string{"coding-standards.md"}, Tools: config.ToolsConfig{IncludeInClaudeMD: true, IncludeInCursorRules: true}},
+		"laravel":     {Files: []string{"conventions.md"}, Tools: config.ToolsConfig{IncludeInClaudeMD: true}},
+		"cursor-only": {Files: []string{"rules.md"}, Tools: config.ToolsConfig{IncludeInCursorRules: true}},
+	}
+	order := []string{"php", "laravel", "cursor-only"}
+
+	tests := []struct {
+		tool   string
+		want   string
+		stacks int
+	}{
+		{
+			tool:   "",
+			want:   "# Company AI Instructions\n\n## php/coding-standards.md\n\nUse PSR-12.\n\n## laravel/conventions.md\n\nUse form requests.\n\n## cursor-only/rules.md\n\nCursor rules.\n",
+			stacks: 3,
+		},
+		{
+			tool:   config.ToolClaude,
+			want:   "# Company AI Instructions\n\n## php/coding-standards.md\n\nUse PSR-12.\n\n## laravel/conventions.md\n\nUse form requests.\n",
+			stacks: 2,
+		},
+		{
+			tool:   config.ToolCursor,
+			want:   "# Company AI Instructions\n\n## php/coding-standards.md\n\nUse PSR-12.\n\n## cursor-only/rules.md\n\nCursor rules.\n",
+			stacks: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("tool="+tt.tool, func(t *testing.T) {
+			got, stacks, err := buildBundle(managed, order, resolved, tt.tool)
+			if err != nil {
+				t.Fatalf("buildBundle: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("buildBundle() =\n%s\nwant:\n%s", got, tt.want)
+			}
+			if stacks != tt.stacks {
+				t.Errorf("buildBundle() bundled %d stacks, want %d", stacks, tt.stacks)
+			}
+		})
+	}
+
+	if _, _, err := buildBundle(managed, []string{"missing"}, map[string]config.ResolvedStack{"missing": {Files: []string{"x.md"}}}, ""); err == nil {
+		t.Error("buildBundle should fail when a file is missing")
+	}
+}
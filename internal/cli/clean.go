@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/injector"
+	"github.com/cego/ai-instructions/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newCleanCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove all files managed by ai-instructions",
+		Long:  "Removes the managed instructions directory, strips managed blocks from CLAUDE.md, AGENTS.md, .cursorrules and any custom targets, and deletes the config file.",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runClean(cmd.Context(), yes)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "skip the confirmation prompt")
+	return cmd
+}
+
+func (a *App) runClean(ctx context.Context, yes bool) error {
+	managedDir := a.getManagedDir()
+
+	if !yes && !ui.IsCI() {
+		ok, err := a.output.Confirm(ctx, "This removes "+managedDir+"/, the managed blocks and "+a.configName()+". Continue?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			a.output.Info("Aborted, nothing was removed")
+			return nil
+		}
+	}
+
+	var removed []string
+
+	managedPath := filepath.Join(a.projectDir, managedDir)
+	if _, err := os.Stat(managedPath); err == nil {
+		if err := os.RemoveAll(managedPath); err != nil {
+			return err
+		}
+		removed = append(removed, managedDir+"/")
+	}
+
+	// Remove the instructions dir too if nothing else lives there
+	instrPath := filepath.Join(a.projectDir, a.getInstructionsDir())
+	if entries, err := os.ReadDir(instrPath); err == nil && len(entries) == 0 {
+		if err := os.Remove(instrPath); err != nil {
+			return err
+		}
+	}
+
+	configs, err := engine.InjectorConfigs(a.projectDir, a.config, nil)
+	if err != nil {
+		return err
+	}
+	stripped, err := injector.StripAll(a.projectDir, configs)
+	if err != nil {
+		return err
+	}
+	removed = append(removed, stripped...)
+
+	files := []struct{ name, path string }{
+		{a.configName(), a.configPath()},
+		{config.OldSettingsFile, filepath.Join(a.projectDir, config.OldSettingsFile)},
+		{config.LockFile, filepath.Join(a.projectDir, config.LockFile)},
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f.path); err != nil {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+		removed = append(removed, f.name)
+	}
+
+	if len(removed) == 0 {
+		a.output.Success("Nothing to clean")
+		return nil
+	}
+
+	a.output.Success("Removed ai-instructions from this project:")
+	for _, f := range removed {
+		a.output.Println("  %s", f)
+	}
+
+	return nil
+}
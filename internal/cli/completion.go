@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// completionTimeout bounds the registry fetch behind a tab completion, so a slow or
+// unreachable registry doesn't hang the shell.
+const completionTimeout = 3 * time.Second
+
+// completeRegistryStacks completes stack IDs from the registry. When the registry can't
+// be reached it offers nothing rather than printing an error into the shell.
+func (a *App) completeRegistryStacks(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := a.loadCompletionConfig(); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	client, err := a.newRegistryClient()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, completionTimeout)
+	defer cancel()
+
+	reg, err := client.FetchRegistry(ctx)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	ids := make([]string, 0, len(reg.Stacks))
+	for id := range reg.Stacks {
+		ids = append(ids, id)
+	}
+	return stackCompletions(ids, args, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeInstalledStacks completes the IDs of the installed stacks from the config,
+// without contacting the registry.
+func (a *App) completeInstalledStacks(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := a.loadCompletionConfig(); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	if a.config == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	ids := make([]string, 0, len(a.config.Resolved))
+	for id := range a.config.Resolved {
+		ids = append(ids, id)
+	}
+	return stackCompletions(ids, args, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeOneInstalledStack is completeInstalledStacks for commands taking a single stack.
+func (a *App) completeOneInstalledStack(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return a.completeInstalledStacks(cmd, args, toComplete)
+}
+
+// loadCompletionConfig reloads the project config. Cobra parses the completed command's
+// flags after the root's pre-run, so --dir and --config only take effect here. A config
+// that fails to load offers no completions.
+func (a *App) loadCompletionConfig() error {
+	return a.LoadProjectConfig()
+}
+
+// stackCompletions returns the sorted IDs starting with toComplete, leaving out the
+// stacks already given as arguments.
+func stackCompletions(ids, args []string, toComplete string) []string {
+	given := make(map[string]bool, len(args))
+	for _, arg := range args {
+		given[arg] = true
+	}
+
+	var matches []string
+	for _, id := range ids {
+		if strings.HasPrefix(id, toComplete) && !given[id] {
+			matches = append(matches, id)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+func TestStackCompletions(t *testing.T) {
+	ids := []string{"vue", "laravel", "php", "nuxt", "nuxt-ui"}
+
+	tests := []struct {
+		name       string
+		args       []string
+		toComplete string
+		want       []string
+	}{
+		{name: "everything", want: []string{"laravel", "nuxt", "nuxt-ui", "php", "vue"}},
+		{name: "prefix", toComplete: "nu", want: []string{"nuxt", "nuxt-ui"}},
+		{name: "already given", args: []string{"nuxt"}, toComplete: "nu", want: []string{"nuxt-ui"}},
+		{name: "no match", toComplete: "rust", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stackCompletions(ids, tt.args, tt.toComplete); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stackCompletions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// cobraCompleteCmd is the hidden command shells call for completions.
+const cobraCompleteCmd = "__complete"
+
+// complete runs the shell completion of args and returns the offered values.
+func complete(t *testing.T, projectDir, serverURL string, client *http.Client, args ...string) []string {
+	t.Helper()
+	t.Setenv("CI", "true")
+
+	app := NewApp("test", "none", "unknown")
+	app.registryOpts = []registry.Option{
+		registry.WithBaseURL(serverURL),
+		registry.WithHTTPClient(client),
+	}
+	var out bytes.Buffer
+	app.rootCmd.SetOut(&out)
+	app.rootCmd.SetErr(&bytes.Buffer{})
+	app.rootCmd.SetArgs(append([]string{cobraCompleteCmd, "--dir", projectDir}, args...))
+	if err := app.Execute(); err != nil {
+		t.Fatalf("completing %v: %v", args, err)
+	}
+
+	// The values come first, then a line with the directive
+	var values []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, ":") {
+			break
+		}
+		values = append(values, line)
+	}
+	return values
+}
+
+func TestCompletion(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	projectDir := t.TempDir()
+	if err := runApp(t, projectDir, server.URL, server.Client(), "init", "laravel"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	if got, want := complete(t, projectDir, server.URL, server.Client(), "init", "nu"), []string{"nuxt", "nuxt-ui"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("init completions = %v, want %v", got, want)
+	}
+	if got, want := complete(t, projectDir, server.URL, server.Client(), "update", "laravel", ""), []string{"php"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("update completions = %v, want %v", got, want)
+	}
+	if got := complete(t, projectDir, server.URL, server.Client(), "why", "php", ""); len(got) != 0 {
+		t.Errorf("why completions after its argument = %v, want none", got)
+	}
+
+	broken := t.TempDir()
+	if err := os.WriteFile(filepath.Join(broken, config.ConfigFile), []byte("stacks: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := complete(t, broken, server.URL, server.Client(), "init", ""); len(got) != 0 {
+		t.Errorf("completions with a broken config = %v, want none", got)
+	}
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	if got := complete(t, projectDir, down.URL, down.Client(), "init", ""); len(got) != 0 {
+		t.Errorf("completions with the registry down = %v, want none", got)
+	}
+}
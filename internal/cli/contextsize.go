@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/cego/ai-instructions/internal/injector"
+)
+
+// targetSize is the amount of instruction text a tool loads through one target file.
+type targetSize struct {
+	filename string
+	files    int   // the target file plus the instruction files its block references
+	bytes    int64 // their combined size
+}
+
+// targetSizes sums, for each injected target, the size of the target file and of every
+// instruction file its managed block references. Files that don't exist count as empty,
+// and inlined files are already part of the target.
+func targetSizes(projectDir string, configs []injector.FileConfig) ([]targetSize, error) {
+	var sizes []targetSize
+	for _, cfg := range configs {
+		if cfg.Skip {
+			continue
+		}
+		s := targetSize{filename: cfg.Filename}
+		for _, path := range append([]string{cfg.Filename}, cfg.Files...) {
+			if _, inlined := cfg.Inline[path]; inlined {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(projectDir, path))
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("sizing %s: %w", path, err)
+			}
+			s.files++
+			s.bytes += info.Size()
+		}
+		sizes = append(sizes, s)
+	}
+	return sizes, nil
+}
+
+// contextWarning returns the warning for a target over limit bytes, or "" if it fits.
+func contextWarning(s targetSize, limit int64) string {
+	if s.bytes <= limit {
+		return ""
+	}
+	return fmt.Sprintf("%s: managed instructions total %s across %d files, which may exceed tool context limits",
+		s.filename, formatBytes(s.bytes), s.files)
+}
+
+// warnContextSize warns about the targets of a sync whose instructions are over the
+// project's context limit. Sizing is best effort and never fails the sync.
+func (a *App) warnContextSize(configs []injector.FileConfig) {
+	sizes, err := targetSizes(a.projectDir, configs)
+	if err != nil {
+		a.output.Warning("Could not check instruction sizes: %v", err)
+		return
+	}
+	for _, s := range sizes {
+		if w := contextWarning(s, a.config.ContextLimit()); w != "" {
+			a.output.Warning("%s", w)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/injector"
+)
+
+func TestTargetSizes(t *testing.T) {
+	dir := t.TempDir()
+	for path, size := range map[string]int{
+		"CLAUDE.md":             100,
+		"ai-instructions/a.md":  2000,
+		"ai-instructions/b.md":  500,
+		"ai-instructions/c.md":  40,
+		"ai-instructions/x.bin": 9999,
+	} {
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(strings.Repeat("x", size)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configs := []injector.FileConfig{
+		{Filename: "CLAUDE.md", Files: []string{"ai-instructions/a.md", "ai-instructions/b.md"}},
+		// AGENTS.md isn't written yet, so only the referenced file counts
+		{Filename: "AGENTS.md", Files: []string{"ai-instructions/c.md", "ai-instructions/missing.md"}},
+		{Filename: ".cursorrules", Files: []string{"ai-instructions/x.bin"}, Skip: true},
+	}
+
+	got, err := targetSizes(dir, configs)
+	if err != nil {
+		t.Fatalf("targetSizes() error: %v", err)
+	}
+	want := []targetSize{
+		{filename: "CLAUDE.md", files: 3, bytes: 2600},
+		{filename: "AGENTS.md", files: 1, bytes: 40},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("targetSizes() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("targetSizes()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestContextWarning(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  targetSize
+		limit int64
+		want  string
+	}{
+		{name: "under", size: targetSize{filename: "CLAUDE.md", files: 3, bytes: 1000}, limit: 1024, want: ""},
+		{name: "at limit", size: targetSize{filename: "CLAUDE.md", files: 3, bytes: 1024}, limit: 1024, want: ""},
+		{
+			name:  "over",
+			size:  targetSize{filename: "AGENTS.md", files: 12, bytes: 150 << 10},
+			limit: 100 << 10,
+			want:  "AGENTS.md: managed instructions total 150.0 KB across 12 files, which may exceed tool context limits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contextWarning(tt.size, tt.limit); got != tt.want {
+				t.Errorf("contextWarning() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/cego/ai-instructions/internal/filemanager"
+	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/spf13/cobra"
+)
+
+// doctorCheck is a single diagnostic.
+type doctorCheck struct {
+	name string
+	run  func(ctx context.Context) (doctorResult, error)
+}
+
+// doctorResult is the outcome of a check. Problems fail the check; notes are informational.
+type doctorResult struct {
+	problems []string
+	notes    []string
+}
+
+func (a *App) newDoctorCmd() *cobra.Command {
+	var fix, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose local installation problems",
+		Long:  "Checks the config, instruction files and managed blocks for problems.\nThe registry is fetched to check that it is reachable and, with layered registries,\nwhich stacks a layer overrides.\nWith --fix, problems are reconciled by running sync, which asks before overwriting\nlocally modified files or switching registry branches unless --yes is given.",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runDoctor(cmd.Context(), fix, yes)
+		},
+	}
+
+	cmd.Flags().BoolVar(&fix, "fix", false, "run sync to fix the problems found")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "with --fix, overwrite modified files and switch registry branches without asking")
+	return cmd
+}
+
+func (a *App) runDoctor(ctx context.Context, fix, yes bool) error {
+	if err := a.RequireProject(); err != nil {
+		return err
+	}
+
+	failed, err := a.runDoctorChecks(ctx)
+	if err != nil {
+		return err
+	}
+	if failed == 0 {
+		a.output.Success("No problems found")
+		return nil
+	}
+
+	if !fix {
+		a.output.Println("\nRun: ai-instructions sync (or ai-instructions doctor --fix)")
+		return &ExitError{Code: exitcodes.VerificationFailed, Message: fmt.Sprintf("%d check(s) failed", failed)}
+	}
+
+	a.output.Info("\nFixing by running sync...")
+	if err := a.runSync(ctx, syncOptions{force: yes}); err != nil {
+		return err
+	}
+
+	a.output.Println("")
+	failed, err = a.runDoctorChecks(ctx)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return &ExitError{Code: exitcodes.VerificationFailed, Message: fmt.Sprintf("%d check(s) still failing after sync", failed)}
+	}
+	a.output.Success("All problems fixed")
+	return nil
+}
+
+// runDoctorChecks prints the result of every check and returns how many failed.
+func (a *App) runDoctorChecks(ctx context.Context) (int, error) {
+	failed := 0
+	for _, check := range a.doctorChecks() {
+		result, err := check.run(ctx)
+		if err != nil {
+			return failed, fmt.Errorf("%s: %w", strings.ToLower(check.name), err)
+		}
+		if len(result.problems) == 0 {
+			a.output.Success("%s", check.name)
+		} else {
+			failed++
+			a.output.Error("%s", check.name)
+		}
+		for _, p := range result.problems {
+			a.output.Println("  %s", p)
+		}
+		for _, n := range result.notes {
+			a.output.Println("  %s", n)
+		}
+	}
+	return failed, nil
+}
+
+func (a *App) doctorChecks() []doctorCheck {
+	return []doctorCheck{
+		{name: "Stacks list matches resolved stacks", run: a.checkStackDrift},
+		{name: "Resolved section unedited", run: a.checkResolvedEdited},
+		{name: "Instruction files intact", run: a.checkInstructionFiles},
+		{name: "Managed blocks present", run: a.checkManagedBlocks},
+		{name: "Registry reachable", run: a.checkRegistry},
+		{name: "Disk usage", run: a.checkDiskUsage},
+		{name: "Instruction size", run: a.checkContextSize},
+	}
+}
+
+func (a *App) checkStackDrift(ctx context.Context) (doctorResult, error) {
+	drift := config.StackDrift(a.config)
+
+	var r doctorResult
+	for _, id := range drift.Unresolved {
+		r.problems = append(r.problems, fmt.Sprintf("listed but not resolved: %s", id))
+	}
+	for _, id := range drift.Unlisted {
+		r.problems = append(r.problems, fmt.Sprintf("resolved as explicit but not listed in stacks: %s", id))
+	}
+	return r, nil
+}
+
+func (a *App) checkResolvedEdited(ctx context.Context) (doctorResult, error) {
+	var r doctorResult
+	if a.config.ResolvedEdited() {
+		r.problems = append(r.problems, fmt.Sprintf("the resolved section of %s was edited by hand; run sync to re-download and re-lock the stacks", a.configName()))
+	}
+	return r, nil
+}
+
+func (a *App) checkInstructionFiles(ctx context.Context) (doctorResult, error) {
+	infos := make(map[string]filemanager.StackVerifyInfo, len(a.config.Resolved))
+	for stackID, rs := range a.config.Resolved {
+		infos[stackID] = filemanager.StackVerifyInfo{
+			Hash:       rs.Hash,
+			Files:      rs.Files,
+			FileHashes: rs.FileHashes,
+		}
+	}
+
+	var r doctorResult
+	for _, v := range filemanager.VerifyAll(a.projectDir, a.getManagedDir(), infos) {
+		for _, f := range v.Missing {
+			r.problems = append(r.problems, fmt.Sprintf("missing: %s/%s", v.Stack, f))
+		}
+		for _, f := range v.Tampered {
+			r.problems = append(r.problems, fmt.Sprintf("tampered: %s", f))
+		}
+	}
+	sort.Strings(r.problems)
+	return r, nil
+}
+
+func (a *App) checkManagedBlocks(ctx context.Context) (doctorResult, error) {
+	if !a.config.InjectionEnabled() {
+		return doctorResult{notes: []string{"injection disabled (inject: false), target files not checked"}}, nil
+	}
+
+	results, err := a.verifyManagedBlocks()
+	if err != nil {
+		return doctorResult{}, err
+	}
+
+	var r doctorResult
+	for _, v := range results {
+		switch {
+		case v.Skipped:
+		case !v.HasBlock:
+			r.problems = append(r.problems, fmt.Sprintf("missing managed block: %s", v.Filename))
+		case v.Damaged:
+			r.problems = append(r.problems, fmt.Sprintf("merge conflict markers in managed block: %s", v.Filename))
+		case v.Stale:
+			r.problems = append(r.problems, fmt.Sprintf("managed block out of date: %s", v.Filename))
+		}
+	}
+	return r, nil
+}
+
+// largeFileSize is the size above which a managed file is probably not instruction text.
+const largeFileSize = 1 << 20 // 1 MB
+
+// checkDiskUsage reports the size of the managed directory and any unusually large files in it.
+func (a *App) checkDiskUsage(ctx context.Context) (doctorResult, error) {
+	managedDir := a.getManagedDir()
+	u, err := filemanager.DiskUsage(a.projectDir, managedDir, largeFileSize)
+	if err != nil {
+		return doctorResult{}, err
+	}
+
+	var r doctorResult
+	r.notes = append(r.notes, fmt.Sprintf("%d files, %s in %s", u.Files, formatBytes(u.Bytes), managedDir))
+	for _, f := range u.Large {
+		r.notes = append(r.notes, fmt.Sprintf("large file: %s (%s), probably not instruction text", f.Path, formatBytes(f.Bytes)))
+	}
+	return r, nil
+}
+
+// checkContextSize reports how much instruction text each target makes a tool load,
+// noting the targets over the context limit. Large instructions don't fail the check.
+func (a *App) checkContextSize(ctx context.Context) (doctorResult, error) {
+	if !a.config.InjectionEnabled() {
+		return doctorResult{notes: []string{"injection disabled (inject: false), no managed instructions"}}, nil
+	}
+	order, err := engine.InjectionOrder(a.config)
+	if err != nil {
+		return doctorResult{}, err
+	}
+	configs, err := engine.InjectorConfigs(a.projectDir, a.config, order)
+	if err != nil {
+		return doctorResult{}, err
+	}
+	sizes, err := targetSizes(a.projectDir, configs)
+	if err != nil {
+		return doctorResult{}, err
+	}
+
+	var r doctorResult
+	for _, s := range sizes {
+		if w := contextWarning(s, a.config.ContextLimit()); w != "" {
+			r.notes = append(r.notes, "warning: "+w)
+			continue
+		}
+		r.notes = append(r.notes, fmt.Sprintf("%s: %s across %d files", s.filename, formatBytes(s.bytes), s.files))
+	}
+	return r, nil
+}
+
+// formatBytes renders a size in B, KB or MB.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// checkRegistry reports whether the registry can be fetched and, with layered registries,
+// the stacks a layer overrides.
+func (a *App) checkRegistry(ctx context.Context) (doctorResult, error) {
+	var r doctorResult
+	client, err := a.newRegistryClient()
+	if err != nil {
+		return r, err
+	}
+	reg, err := client.FetchRegistry(ctx)
+	if errors.Is(err, registry.ErrOffline) {
+		r.notes = append(r.notes, "not checked (offline)")
+		return r, nil
+	}
+	if err != nil {
+		r.problems = append(r.problems, registryProblem(err))
+		return r, nil
+	}
+
+	if len(a.config.Registries) == 0 {
+		r.notes = append(r.notes, fmt.Sprintf("single registry, %d stacks", len(reg.Stacks)))
+		return r, nil
+	}
+	r.notes = append(r.notes, fmt.Sprintf("%d registries, %d stacks", len(a.config.Registries)+1, len(reg.Stacks)))
+	for _, o := range reg.Overrides {
+		r.notes = append(r.notes, fmt.Sprintf("collision: %s from %s is overridden by %s", o.Stack, o.Overridden, o.By))
+	}
+	return r, nil
+}
+
+// registryProblem describes a failed registry fetch, with a hint at the likely cause.
+func registryProblem(err error) string {
+	msg := fmt.Sprintf("fetching the registry: %v", err)
+	if hint := registryHint(err); hint != "" {
+		msg += "\n    " + hint
+	}
+	return msg
+}
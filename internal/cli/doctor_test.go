@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+func TestRegistryProblem(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	_, connErr := registry.NewClient(registry.WithBaseURL(down.URL)).FetchRegistry(context.Background())
+	if connErr == nil {
+		t.Fatal("fetching from a closed server should fail")
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "unauthorized", err: &registry.HTTPStatusError{Code: 401, URL: "https://x/registry.json"}, want: "Check your token"},
+		{name: "wrapped not found", err: fmt.Errorf("layer 2: %w", &registry.HTTPStatusError{Code: 404, URL: "https://x/registry.json"}), want: "Check the registry URL and branch"},
+		{name: "connection refused", err: connErr, want: "Cego Warp"},
+		{name: "server error", err: &registry.HTTPStatusError{Code: 500, URL: "https://x/registry.json"}, want: "fetching the registry: HTTP 500: https://x/registry.json"},
+		{name: "other", err: errors.New("boom"), want: "fetching the registry: boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registryProblem(tt.err); !strings.Contains(got, tt.want) {
+				t.Errorf("registryProblem() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryErrorHint(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		want     string
+		wantCode int
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, want: "Check your token", wantCode: exitcodes.ConfigError},
+		{name: "not found", status: http.StatusNotFound, want: "Check the registry URL and branch", wantCode: exitcodes.ConfigError},
+		{name: "invalid json", status: http.StatusOK, body: "<html>Sign in</html>", want: "check the registry URL and branch", wantCode: exitcodes.ConfigError},
+		{name: "server error", status: http.StatusBadGateway, want: "HTTP 502", wantCode: exitcodes.NetworkError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status == http.StatusOK {
+					w.Write([]byte(tt.body))
+					return
+				}
+				http.Error(w, http.StatusText(tt.status), tt.status)
+			}))
+			defer server.Close()
+
+			err := runApp(t, t.TempDir(), server.URL, server.Client(), "init", "php")
+			if got := exitCode(err); got != tt.wantCode {
+				t.Fatalf("exit code = %d, want %d (err: %v)", got, tt.wantCode, err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/diff"
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/cego/ai-instructions/internal/resolver"
+	"github.com/cego/ai-instructions/internal/ui"
+)
+
+// newEngine creates an engine for the project that draws download progress and debug output.
+func (a *App) newEngine(client *registry.Client) *engine.Engine {
+	var progress *ui.Progress
+	var current string
+	report := func(stackID, filename string, done, total int) {
+		if stackID != current {
+			if progress != nil {
+				progress.Done()
+			}
+			progress = a.output.NewProgress(stackID)
+			current = stackID
+		}
+		progress.Update(filename, done, total)
+		if done == total {
+			progress.Done()
+		}
+	}
+	return engine.New(client, a.projectDir,
+		engine.WithConfigFile(a.configPath()),
+		engine.WithProgress(report),
+		engine.WithDebug(a.debugf),
+	)
+}
+
+// overwriteConfirmer asks before locally modified stacks are overwritten.
+// Outside an interactive terminal it returns nil, so such a sync fails instead.
+func (a *App) overwriteConfirmer() func(ctx context.Context, stackID string, files []string) (bool, error) {
+	if !ui.IsInteractive() {
+		return nil
+	}
+	return func(ctx context.Context, stackID string, files []string) (bool, error) {
+		a.output.Warning("%s has local modifications:", stackID)
+		for _, f := range files {
+			a.output.Println("  %s", f)
+		}
+		return a.output.Confirm(ctx, "Overwrite them with the registry version?")
+	}
+}
+
+// engineError maps engine failures to exit errors.
+func engineError(err error) error {
+	var fetchErr *engine.FetchError
+	if errors.As(err, &fetchErr) {
+		return registryError(err)
+	}
+	var modErr *engine.LocalModificationError
+	if errors.As(err, &modErr) {
+		return &ExitError{
+			Code:    exitcodes.VerificationFailed,
+			Message: err.Error() + "\nRerun with --force to overwrite them.",
+		}
+	}
+	var missingStack *resolver.MissingStackError
+	var missingDep *resolver.MissingDependencyError
+	var cycle *resolver.CircularDependencyError
+	if errors.As(err, &missingStack) || errors.As(err, &missingDep) || errors.As(err, &cycle) {
+		return resolutionError(err)
+	}
+	return err
+}
+
+// printPostInstallMessages prints the post-install messages of the newly installed stacks
+// as one group, in dependency order.
+func (a *App) printPostInstallMessages(result *engine.Result, installed map[string]bool) {
+	lines := postInstallLines(result.Order, result.Messages, installed)
+	if len(lines) == 0 {
+		return
+	}
+	a.output.Info("\nNotes from the installed stacks:")
+	for _, line := range lines {
+		a.output.Info("%s", line)
+	}
+}
+
+// warnDisabledTools warns about the installed stacks whose files only target AI tools the
+// project doesn't use, so none of their instructions are injected.
+func (a *App) warnDisabledTools(cfg *config.Config, order []string, installed map[string]bool) {
+	for _, id := range disabledToolStacks(cfg, order, installed) {
+		a.output.Warning("%s only targets %s, which tools in %s doesn't include; its instructions are not injected",
+			id, strings.Join(stackTools(cfg.Resolved[id]), ", "), a.configName())
+	}
+}
+
+// disabledToolStacks returns the installed stacks, in order, that target at least one tool
+// but none the project uses.
+func disabledToolStacks(cfg *config.Config, order []string, installed map[string]bool) []string {
+	var ids []string
+	for _, id := range order {
+		if !installed[id] {
+			continue
+		}
+		rs := cfg.Resolved[id]
+		enabled := false
+		for _, f := range rs.Files {
+			if len(cfg.EnabledTools(rs.ToolsFor(f)).Names()) > 0 {
+				enabled = true
+				break
+			}
+		}
+		if !enabled && len(stackTools(rs)) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// stackTools returns the tools any file of the stack targets.
+func stackTools(rs config.ResolvedStack) []string {
+	var merged config.ToolsConfig
+	for _, f := range rs.Files {
+		t := rs.ToolsFor(f)
+		merged.IncludeInClaudeMD = merged.IncludeInClaudeMD || t.IncludeInClaudeMD
+		merged.IncludeInAgentsMD = merged.IncludeInAgentsMD || t.IncludeInAgentsMD
+		merged.IncludeInCursorRules = merged.IncludeInCursorRules || t.IncludeInCursorRules
+	}
+	return merged.Names()
+}
+
+// postInstallLines formats the messages of the installed stacks in order, indenting
+// continuation lines under the stack ID.
+func postInstallLines(order []string, messages map[string]string, installed map[string]bool) []string {
+	var lines []string
+	for _, id := range order {
+		msg, ok := messages[id]
+		if !ok || !installed[id] {
+			continue
+		}
+		msg = strings.ReplaceAll(strings.TrimSpace(msg), "\n", "\n    ")
+		lines = append(lines, fmt.Sprintf("  %s: %s", id, msg))
+	}
+	return lines
+}
+
+// newStacks returns the stacks a sync or update installed for the first time.
+func newStacks(result *engine.Result) map[string]bool {
+	installed := make(map[string]bool)
+	for _, u := range result.Updates {
+		if u.OldVersion == "" {
+			installed[u.Stack] = true
+		}
+	}
+	return installed
+}
+
+// printUpdateSummary prints the result of a sync or update.
+func (a *App) printUpdateSummary(result *engine.Result) {
+	a.warnStaleManagedDir(result)
+	for _, id := range result.Missing {
+		a.output.Warning("Stack %q no longer exists in registry, skipping", id)
+	}
+	for _, id := range result.Pruned {
+		a.output.Warning("Pruned stack %q, which no longer exists in registry", id)
+	}
+	for _, id := range result.Kept {
+		a.output.Warning("Kept local modifications to %s at %s", id, a.config.Resolved[id].Version)
+	}
+	if len(result.Updates) > 0 {
+		a.output.Success("Synced %d updated stack(s):", len(result.Updates))
+		for _, u := range result.Updates {
+			branch := ""
+			if u.Branch != "" {
+				branch = fmt.Sprintf(" (branch %s)", u.Branch)
+			}
+			if u.OldVersion != "" {
+				a.output.Println("  %s   %s → %s%s", u.Stack, u.OldVersion, u.NewVersion, branch)
+			} else {
+				a.output.Println("  %s   (new) %s%s", u.Stack, u.NewVersion, branch)
+			}
+		}
+	}
+	if len(result.Unchanged) > 0 {
+		a.output.Println("\n%d stack(s) unchanged: %v", len(result.Unchanged), result.Unchanged)
+	}
+	if len(result.Updates) == 0 {
+		a.output.Success("Everything is up to date")
+	}
+	switch {
+	case !result.Injected:
+		a.output.Println("Managed blocks not updated (injection disabled)")
+	case len(result.Rewritten) > 0:
+		a.output.Println("Rewrote %d target file(s): %s", len(result.Rewritten), strings.Join(result.Rewritten, ", "))
+	default:
+		a.output.Println("Target files unchanged")
+	}
+	a.warnContextSize(result.Targets)
+}
+
+// warnStaleManagedDir warns about the previous managed directory when a changed
+// managed_dir couldn't be moved to because it already existed.
+func (a *App) warnStaleManagedDir(result *engine.Result) {
+	if result.StaleManagedDir != "" {
+		a.output.Warning("Previous managed directory %s was left in place because the new one already exists; remove it once nothing in it is needed", result.StaleManagedDir)
+	}
+}
+
+// printStackDiff prints a per-file summary and unified diff of a stack's changes.
+func (a *App) printStackDiff(d engine.StackDiff) {
+	changes := diff.Files(d.Before, d.After)
+	a.output.Println("\n%s: %d added, %d removed, %d modified", d.Stack, len(changes.Added), len(changes.Removed), len(changes.Modified))
+	if changes.Empty() {
+		return
+	}
+
+	for _, f := range changes.Added {
+		a.output.Println("  + %s", f)
+	}
+	for _, f := range changes.Removed {
+		a.output.Println("  - %s", f)
+	}
+	for _, f := range changes.Modified {
+		a.output.Println("  ~ %s", f)
+	}
+	for _, f := range changes.Modified {
+		a.output.Println("")
+		a.output.Println("%s", strings.TrimRight(diff.Unified(
+			"a/"+d.Stack+"/"+f,
+			"b/"+d.Stack+"/"+f,
+			string(d.Before[f]),
+			string(d.After[f]),
+			3,
+		), "\n"))
+	}
+}
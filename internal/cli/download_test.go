@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+)
+
+func TestPostInstallLines(t *testing.T) {
+	messages := map[string]string{
+		"php":     "Enable strict_types in php.ini.\n",
+		"laravel": "Run php artisan optimize.\nThen restart the queue.",
+	}
+	order := []string{"php", "laravel", "vue"}
+
+	tests := []struct {
+		name      string
+		installed map[string]bool
+		want      []string
+	}{
+		{
+			name:      "all new",
+			installed: map[string]bool{"php": true, "laravel": true, "vue": true},
+			want: []string{
+				"  php: Enable strict_types in php.ini.",
+				"  laravel: Run php artisan optimize.\n    Then restart the queue.",
+			},
+		},
+		{name: "only new stacks", installed: map[string]bool{"laravel": true}, want: []string{"  laravel: Run php artisan optimize.\n    Then restart the queue."}},
+		{name: "none new", installed: map[string]bool{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postInstallLines(order, messages, tt.installed); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("postInstallLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisabledToolStacks(t *testing.T) {
+	cfg := &config.Config{
+		Tools: []string{config.ToolClaude},
+		Resolved: map[string]config.ResolvedStack{
+			"php":          {Files: []string{"rules.md"}, Tools: config.ToolsConfig{IncludeInClaudeMD: true, IncludeInCursorRules: true}},
+			"cursor-rules": {Files: []string{"rules.md"}, Tools: config.ToolsConfig{IncludeInCursorRules: true}},
+			"mixed": {
+				Files:     []string{"a.md", "b.md"},
+				Tools:     config.ToolsConfig{IncludeInCursorRules: true},
+				FileTools: map[string]config.ToolsConfig{"b.md": {IncludeInClaudeMD: true}},
+			},
+			"bundle": {},
+		},
+	}
+	order := []string{"bundle", "cursor-rules", "mixed", "php"}
+	installed := map[string]bool{"bundle": true, "cursor-rules": true, "mixed": true, "php": true}
+
+	if got, want := disabledToolStacks(cfg, order, installed), []string{"cursor-rules"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("disabledToolStacks() = %v, want %v", got, want)
+	}
+	if got := disabledToolStacks(cfg, order, map[string]bool{"php": true}); len(got) != 0 {
+		t.Errorf("disabledToolStacks() = %v, want only installed stacks", got)
+	}
+	cfg.Tools = nil
+	if got := disabledToolStacks(cfg, order, installed); len(got) != 0 {
+		t.Errorf("disabledToolStacks() = %v, want none when every tool is enabled", got)
+	}
+}
@@ -0,0 +1,556 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+// runApp executes the CLI with the given args against a project dir and registry server URL.
+// It runs as in CI, so prompts never wait for input.
+func runApp(t *testing.T, projectDir, serverURL string, client *http.Client, args ...string) error {
+	t.Helper()
+	t.Setenv("CI", "true")
+	// Keep the developer's own user config out of the tests
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	app := NewApp("test", "none", "unknown")
+	app.registryOpts = []registry.Option{
+		registry.WithBaseURL(serverURL),
+		registry.WithHTTPClient(client),
+	}
+	app.rootCmd.SetArgs(append([]string{"--dir", projectDir}, args...))
+	return app.Execute()
+}
+
+func exitCode(err error) int {
+	if err == nil {
+		return exitcodes.Success
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return 1
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	// A closed server gives a reliable connection-refused error
+	down := setupTestRegistry(t)
+	downURL := down.URL
+	down.Close()
+
+	initialized := func(t *testing.T) string {
+		t.Helper()
+		dir := t.TempDir()
+		if err := runApp(t, dir, server.URL, server.Client(), "init", "php"); err != nil {
+			t.Fatalf("init: %v", err)
+		}
+		return dir
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T) string
+		url      string
+		args     []string
+		wantCode int
+	}{
+		{
+			name:     "init succeeds",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"init", "laravel"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "init without stacks",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"init"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "init stacks and preset",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"init", "php", "--from", "preset.yml"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "init missing preset",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"init", "--from", filepath.Join(t.TempDir(), "preset.yml")},
+			wantCode: exitcodes.ConfigError,
+		},
+		{
+			name:     "unknown flag",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"sync", "--no-such-flag"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "init unknown stack",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"init", "cobol"},
+			wantCode: exitcodes.StackNotFound,
+		},
+		{
+			name:     "init registry unreachable",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			url:      downURL,
+			args:     []string{"init", "php"},
+			wantCode: exitcodes.NetworkError,
+		},
+		{
+			name:     "init invalid project ID",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"init", "php", "--project-id", "cego/instructions"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "graph invalid format",
+			setup:    initialized,
+			args:     []string{"graph", "--format", "svg"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "graph without config",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"graph"},
+			wantCode: exitcodes.ConfigError,
+		},
+		{
+			name:     "sync without config",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"sync"},
+			wantCode: exitcodes.ConfigError,
+		},
+		{
+			name:     "sync registry unreachable",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"sync"},
+			wantCode: exitcodes.NetworkError,
+		},
+		{
+			name:     "sync offline",
+			setup:    initialized,
+			args:     []string{"sync", "--offline"},
+			wantCode: exitcodes.NetworkError,
+		},
+		{
+			name:     "list offline",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"list", "--offline"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "list installed offline",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"list", "--offline", "--installed"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "list category offline",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"list", "--offline", "--category", "backend"},
+			wantCode: exitcodes.NetworkError,
+		},
+		{
+			name:     "outdated offline",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"outdated", "--offline"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "verify strict offline",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"verify", "--strict", "--offline"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "files",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"files", "php"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "files of a stack not installed",
+			setup:    initialized,
+			args:     []string{"files", "laravel"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "audit offline from the config",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"audit"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "audit without a project",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"audit"},
+			wantCode: exitcodes.ConfigError,
+		},
+		{
+			name:     "import a missing dir",
+			setup:    initialized,
+			args:     []string{"import", "does-not-exist"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "import over a registry stack",
+			setup:    initialized,
+			args:     []string{"import", ".", "--name", "php"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "resolve",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"resolve", "laravel"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "resolve unknown stack",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"resolve", "nonexistent"},
+			wantCode: exitcodes.StackNotFound,
+		},
+		{
+			name:     "status",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"status"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "status without config",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"status"},
+			wantCode: exitcodes.ConfigError,
+		},
+		{
+			name:     "status check registry unreachable",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"status", "--check"},
+			wantCode: exitcodes.NetworkError,
+		},
+		{
+			name:     "sync only and exclude",
+			setup:    initialized,
+			args:     []string{"sync", "--only", "php", "--exclude", "php"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "sync only stack not installed",
+			setup:    initialized,
+			args:     []string{"sync", "--only", "vue"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name: "sync local modifications",
+			setup: func(t *testing.T) string {
+				dir := initialized(t)
+				path := filepath.Join(dir, config.DefaultInstructionsDir, config.DefaultManagedDir, "php", "coding-standards.md")
+				os.WriteFile(path, []byte("edited"), 0644)
+				return dir
+			},
+			args:     []string{"sync"},
+			wantCode: exitcodes.VerificationFailed,
+		},
+		{
+			name:     "update stack not installed",
+			setup:    initialized,
+			args:     []string{"update", "laravel"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "verify without config",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"verify"},
+			wantCode: exitcodes.ConfigError,
+		},
+		{
+			name:     "verify succeeds",
+			setup:    initialized,
+			args:     []string{"verify"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name: "verify tampered file",
+			setup: func(t *testing.T) string {
+				dir := initialized(t)
+				path := filepath.Join(dir, config.DefaultInstructionsDir, config.DefaultManagedDir, "php", "coding-standards.md")
+				os.WriteFile(path, []byte("tampered"), 0644)
+				return dir
+			},
+			args:     []string{"verify"},
+			wantCode: exitcodes.VerificationFailed,
+		},
+		{
+			name:     "verify strict registry unreachable",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"verify", "--strict"},
+			wantCode: exitcodes.NetworkError,
+		},
+		{
+			name:     "verify no freshness registry unreachable",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"verify", "--no-freshness"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name: "verify no freshness tampered file",
+			setup: func(t *testing.T) string {
+				dir := initialized(t)
+				path := filepath.Join(dir, config.DefaultInstructionsDir, config.DefaultManagedDir, "php", "coding-standards.md")
+				os.WriteFile(path, []byte("tampered"), 0644)
+				return dir
+			},
+			args:     []string{"verify", "--no-freshness"},
+			wantCode: exitcodes.VerificationFailed,
+		},
+		{
+			name:     "verify strict and no freshness",
+			setup:    initialized,
+			args:     []string{"verify", "--strict", "--no-freshness"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name: "verify fix tampered file",
+			setup: func(t *testing.T) string {
+				dir := initialized(t)
+				path := filepath.Join(dir, config.DefaultInstructionsDir, config.DefaultManagedDir, "php", "coding-standards.md")
+				os.WriteFile(path, []byte("tampered"), 0644)
+				return dir
+			},
+			args:     []string{"verify", "--fix"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "doctor",
+			setup:    initialized,
+			args:     []string{"doctor"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "doctor registry unreachable",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"doctor"},
+			wantCode: exitcodes.VerificationFailed,
+		},
+		{
+			name:     "doctor offline",
+			setup:    initialized,
+			url:      downURL,
+			args:     []string{"doctor", "--offline"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name: "verify fix tampered file registry unreachable",
+			setup: func(t *testing.T) string {
+				dir := initialized(t)
+				path := filepath.Join(dir, config.DefaultInstructionsDir, config.DefaultManagedDir, "php", "coding-standards.md")
+				os.WriteFile(path, []byte("tampered"), 0644)
+				return dir
+			},
+			url:      downURL,
+			args:     []string{"verify", "--fix"},
+			wantCode: exitcodes.NetworkError,
+		},
+		{
+			name: "verify fix missing block registry unreachable",
+			setup: func(t *testing.T) string {
+				dir := initialized(t)
+				os.WriteFile(filepath.Join(dir, "CLAUDE.md"), []byte("# Hand-written\n"), 0644)
+				return dir
+			},
+			url:      downURL,
+			args:     []string{"verify", "--fix"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "verify strict and fix",
+			setup:    initialized,
+			args:     []string{"verify", "--strict", "--fix"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "outdated json offline",
+			setup:    initialized,
+			args:     []string{"outdated", "--json", "--offline"},
+			wantCode: exitcodes.NetworkError,
+		},
+		{
+			name:     "outdated json",
+			setup:    initialized,
+			args:     []string{"outdated", "--json"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "outdated exit code offline",
+			setup:    initialized,
+			args:     []string{"outdated", "--exit-code", "--offline"},
+			wantCode: exitcodes.NetworkError,
+		},
+		{
+			name:     "outdated exit code up to date",
+			setup:    initialized,
+			args:     []string{"outdated", "--exit-code"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "list invalid format",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"list", "--format", "xml"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "invalid credentials source",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"list", "--credentials-from", "keychain"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "invalid timeout",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"list", "--timeout", "soon"},
+			wantCode: exitcodes.UsageError,
+		},
+		{
+			name:     "list with timeout",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			args:     []string{"list", "--timeout", "5s"},
+			wantCode: exitcodes.Success,
+		},
+		{
+			name:     "list registry unreachable",
+			setup:    func(t *testing.T) string { return t.TempDir() },
+			url:      downURL,
+			args:     []string{"list"},
+			wantCode: exitcodes.NetworkError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tt.setup(t)
+			url := tt.url
+			if url == "" {
+				url = server.URL
+			}
+
+			err := runApp(t, dir, url, server.Client(), tt.args...)
+			if got := exitCode(err); got != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (err: %v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := runApp(t, dir, server.URL, server.Client(), "init", "php"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	// Capture stdout; the UI writes to os.Stdout directly
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	err = runApp(t, dir, server.URL, server.Client(), "--quiet", "sync")
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+
+	if err != nil {
+		t.Fatalf("sync --quiet: %v", err)
+	}
+	if len(out) != 0 {
+		t.Errorf("sync --quiet printed to stdout:\n%s", out)
+	}
+}
+
+func TestQuietVerifyListsIssues(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := runApp(t, dir, server.URL, server.Client(), "init", "php"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	path := filepath.Join(dir, config.DefaultInstructionsDir, config.DefaultManagedDir, "php", "coding-standards.md")
+	if err := os.WriteFile(path, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Capture stderr, where errors and their details go
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	err = runApp(t, dir, server.URL, server.Client(), "--quiet", "verify")
+	os.Stderr = stderr
+	w.Close()
+	out, _ := io.ReadAll(r)
+
+	if got := exitCode(err); got != exitcodes.VerificationFailed {
+		t.Fatalf("verify --quiet exit code = %d, want %d", got, exitcodes.VerificationFailed)
+	}
+	if !strings.Contains(string(out), "coding-standards.md") {
+		t.Errorf("verify --quiet should still list the tampered file, got:\n%s", out)
+	}
+}
+
+func TestVerifyNoFreshnessSkipsRegistry(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := runApp(t, dir, server.URL, server.Client(), "init", "php"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	requests := 0
+	counting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer counting.Close()
+
+	if err := runApp(t, dir, counting.URL, counting.Client(), "verify", "--no-freshness"); err != nil {
+		t.Fatalf("verify --no-freshness: %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("verify --no-freshness made %d registry requests, want 0", requests)
+	}
+}
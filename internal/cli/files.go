@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newFilesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "files [stack]",
+		Short: "List the instruction files of the installed stacks",
+		Long:  "Lists every installed instruction file with the tools whose target file references it and its path,\ngrouped by stack in dependency order. Reads only the config; the registry is not contacted.",
+		Args:  usageArgs(cobra.MaximumNArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stack := ""
+			if len(args) == 1 {
+				stack = args[0]
+			}
+			return a.runFiles(stack)
+		},
+	}
+	cmd.ValidArgsFunction = a.completeOneInstalledStack
+	return cmd
+}
+
+func (a *App) runFiles(stackID string) error {
+	if err := a.RequireProject(); err != nil {
+		return err
+	}
+
+	order, err := engine.ResolvedOrder(a.config.Resolved)
+	if err != nil {
+		return fmt.Errorf("ordering stacks: %w", err)
+	}
+	if stackID != "" {
+		if _, ok := a.config.Resolved[stackID]; !ok {
+			return &ExitError{Code: exitcodes.UsageError, Message: fmt.Sprintf("stack %q is not installed", stackID)}
+		}
+		order = []string{stackID}
+	}
+
+	rows := fileRows(a.getManagedDir(), order, a.config.Resolved)
+	if len(rows) == 0 {
+		a.output.Info("No instruction files installed")
+		return nil
+	}
+	a.output.Table([]string{"STACK", "FILE", "TOOLS", "PATH"}, rows)
+	return nil
+}
+
+// fileRows returns a table row per file of the given stacks: stack, file, target tools and
+// the path relative to the project.
+func fileRows(managedDir string, order []string, resolved map[string]config.ResolvedStack) [][]string {
+	var rows [][]string
+	for _, stackID := range order {
+		rs := resolved[stackID]
+		for _, f := range rs.Files {
+			tools := "-"
+			if names := rs.ToolsFor(f).Names(); len(names) > 0 {
+				tools = strings.Join(names, ", ")
+			}
+			rows = append(rows, []string{stackID, f, tools, path.Join(managedDir, stackID, f)})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+)
+
+func TestFileRows(t *testing.T) {
+	resolved := map[string]config.ResolvedStack{
+		"php": {
+			Files:     []string{"coding-standards.md", "testing.md"},
+			Tools:     config.ToolsConfig{IncludeInClaudeMD: true, IncludeInAgentsMD: true},
+			FileTools: map[string]config.ToolsConfig{"testing.md": {IncludeInCursorRules: true}},
+		},
+		"docker": {Files: []string{"conventions.md"}},
+	}
+
+	want := [][]string{
+		{"php", "coding-standards.md", "claude, agents", "ai-instructions/company-instructions/php/coding-standards.md"},
+		{"php", "testing.md", "cursor", "ai-instructions/company-instructions/php/testing.md"},
+		{"docker", "conventions.md", "-", "ai-instructions/company-instructions/docker/conventions.md"},
+	}
+	got := fileRows("ai-instructions/company-instructions", []string{"php", "docker"}, resolved)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fileRows() =\n%v\nwant\n%v", got, want)
+	}
+}
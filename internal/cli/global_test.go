@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/registry"
+
+	"github.com/cego/ai-instructions/internal/config"
+)
+
+func TestRegistrySettingsPrecedence(t *testing.T) {
+	const globalYAML = "registry:\n  url: https://global.example.com/ai\n  branch: global-branch\ntoken: global-token\n"
+	const projectYAML = "version: 1\nregistry:\n  url: https://project.example.com/ai\n  branch: project-branch\nstacks: [php]\n"
+
+	tests := []struct {
+		name       string
+		global     string
+		project    string
+		env        bool
+		flags      []string
+		wantURL    string
+		wantBranch string
+		wantToken  string
+	}{
+		{
+			name:       "built-in defaults",
+			wantURL:    config.DefaultRegistryURL,
+			wantBranch: config.DefaultBranch,
+		},
+		{
+			name:       "global config over defaults",
+			global:     globalYAML,
+			wantURL:    "https://global.example.com/ai",
+			wantBranch: "global-branch",
+			wantToken:  "global-token",
+		},
+		{
+			name:       "project config over global config",
+			global:     globalYAML,
+			project:    projectYAML,
+			wantURL:    "https://project.example.com/ai",
+			wantBranch: "project-branch",
+			wantToken:  "global-token",
+		},
+		{
+			name:       "global branch under a project config without one",
+			global:     globalYAML,
+			project:    "version: 1\nregistry:\n  url: https://project.example.com/ai\nstacks: [php]\n",
+			wantURL:    "https://project.example.com/ai",
+			wantBranch: "global-branch",
+			wantToken:  "global-token",
+		},
+		{
+			name:       "env over project config",
+			global:     globalYAML,
+			project:    projectYAML,
+			env:        true,
+			wantURL:    "https://env.example.com/ai",
+			wantBranch: "env-branch",
+			wantToken:  "env-token",
+		},
+		{
+			name:       "flags over env",
+			global:     globalYAML,
+			project:    projectYAML,
+			env:        true,
+			flags:      []string{"--registry", "https://flag.example.com/ai", "--branch", "flag-branch", "--token", "flag-token"},
+			wantURL:    "https://flag.example.com/ai",
+			wantBranch: "flag-branch",
+			wantToken:  "flag-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xdg := t.TempDir()
+			t.Setenv("XDG_CONFIG_HOME", xdg)
+			env := map[string]string{"AI_INSTRUCTIONS_REGISTRY": "", "AI_INSTRUCTIONS_BRANCH": "", "AI_INSTRUCTIONS_TOKEN": ""}
+			if tt.env {
+				env = map[string]string{
+					"AI_INSTRUCTIONS_REGISTRY": "https://env.example.com/ai",
+					"AI_INSTRUCTIONS_BRANCH":   "env-branch",
+					"AI_INSTRUCTIONS_TOKEN":    "env-token",
+				}
+			}
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+
+			if tt.global != "" {
+				path := filepath.Join(xdg, config.GlobalConfigFile)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tt.global), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dir := t.TempDir()
+			if tt.project != "" {
+				if err := os.WriteFile(filepath.Join(dir, config.ConfigFile), []byte(tt.project), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			app := NewApp("test", "none", "unknown")
+			app.rootCmd.SetArgs(append(append([]string{"--dir", dir}, tt.flags...), "version"))
+			if err := app.Execute(); err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+
+			if got := app.getProjectURL(); got != tt.wantURL {
+				t.Errorf("registry URL = %q, want %q", got, tt.wantURL)
+			}
+			if got := app.getBranch(); got != tt.wantBranch {
+				t.Errorf("branch = %q, want %q", got, tt.wantBranch)
+			}
+			if got := app.getToken(); got != tt.wantToken {
+				t.Errorf("token = %q, want %q", got, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestCredentialsFromOverUserConfigToken(t *testing.T) {
+	var gotToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get("PRIVATE-TOKEN")
+		w.Write([]byte(`{"version": 1, "stacks": {}}`))
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv("AI_INSTRUCTIONS_TOKEN", "")
+	t.Setenv("AI_INSTRUCTIONS_CREDENTIALS_FROM", "")
+	path := filepath.Join(xdg, config.GlobalConfigFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("token: global-token\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(netrc, []byte("machine "+u.Hostname()+" password netrc-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", netrc)
+
+	tests := []struct {
+		name  string
+		flags []string
+		want  string
+	}{
+		{name: "user config token", want: "global-token"},
+		{name: "credentials-from over user config", flags: []string{"--credentials-from", "netrc"}, want: "netrc-token"},
+		{name: "token flag over credentials-from", flags: []string{"--credentials-from", "netrc", "--token", "flag-token"}, want: "flag-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewApp("test", "none", "unknown")
+			app.registryOpts = []registry.Option{registry.WithBaseURL(server.URL), registry.WithHTTPClient(server.Client())}
+			app.rootCmd.SetArgs(append(append([]string{"--dir", t.TempDir()}, tt.flags...), "version"))
+			if err := app.Execute(); err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			client, err := app.newRegistryClient()
+			if err != nil {
+				t.Fatalf("newRegistryClient: %v", err)
+			}
+			if _, err := client.FetchRegistry(context.Background()); err != nil {
+				t.Fatalf("FetchRegistry: %v", err)
+			}
+			if gotToken != tt.want {
+				t.Errorf("PRIVATE-TOKEN = %q, want %q", gotToken, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitWritesOnlyAGivenBranch(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+	t.Setenv("AI_INSTRUCTIONS_BRANCH", "")
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "no branch", args: []string{"init", "php"}},
+		{name: "branch flag", args: []string{"--branch", "feature", "init", "php"}, want: "feature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := runApp(t, dir, server.URL, server.Client(), tt.args...); err != nil {
+				t.Fatalf("init: %v", err)
+			}
+			cfg, err := config.LoadConfig(dir)
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if cfg.Registry.Branch != tt.want {
+				t.Errorf("registry branch = %q, want %q", cfg.Registry.Branch, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/cego/ai-instructions/internal/resolver"
+	"github.com/spf13/cobra"
+)
+
+// Output formats for graph.
+const (
+	formatDOT     = "dot"
+	formatMermaid = "mermaid"
+)
+
+// stackGraph is a dependency graph: nodes are stacks, and an edge points from a stack
+// to a stack it depends on.
+type stackGraph struct {
+	nodes    []string
+	edges    []graphEdge
+	explicit map[string]bool
+}
+
+// graphEdge is a dependency of one stack on another. Optional edges are suggested
+// companions or conditional deps rather than requirements.
+type graphEdge struct {
+	from, to string
+	optional bool
+}
+
+func (a *App) newGraphCmd() *cobra.Command {
+	var (
+		format string
+		all    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Print the stack dependency graph as DOT or Mermaid",
+		Long:  "Prints the installed stacks and the dependencies recorded in the config as a Graphviz DOT or Mermaid\ngraph, for pasting into docs. With --all, the graph shows every registry stack and all declared\ndependencies, with optional ones dashed. Explicitly installed stacks are drawn in bold.",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runGraph(cmd.Context(), format, all)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", formatDOT, "output format: dot or mermaid")
+	cmd.Flags().BoolVar(&all, "all", false, "graph every registry stack instead of the installed ones")
+	return cmd
+}
+
+func (a *App) runGraph(ctx context.Context, format string, all bool) error {
+	if format != formatDOT && format != formatMermaid {
+		return &ExitError{
+			Code:    exitcodes.UsageError,
+			Message: fmt.Sprintf("invalid format %q: must be %s or %s", format, formatDOT, formatMermaid),
+		}
+	}
+
+	var g *stackGraph
+	if all {
+		// Works without init; explicit stacks are only highlighted in a project
+		client, err := a.newRegistryClient()
+		if err != nil {
+			return err
+		}
+		reg, err := a.fetchRegistry(ctx, client)
+		if err != nil {
+			return err
+		}
+		var resolved map[string]config.ResolvedStack
+		if a.config != nil {
+			resolved = a.config.Resolved
+		}
+		g = registryGraph(engine.StackInfos(reg), resolved)
+	} else {
+		if err := a.RequireProject(); err != nil {
+			return err
+		}
+		g = installedGraph(a.config.Resolved)
+	}
+
+	out := g.dot()
+	if format == formatMermaid {
+		out = g.mermaid()
+	}
+	_, err := fmt.Fprint(os.Stdout, out)
+	return err
+}
+
+// installedGraph builds the graph of the installed stacks from their recorded
+// dependencies. The dependency_of attribution adds an edge from the stack that pulled a
+// dependency in, which is the only one known for configs locked before dependencies were
+// recorded.
+func installedGraph(resolved map[string]config.ResolvedStack) *stackGraph {
+	g := &stackGraph{explicit: make(map[string]bool)}
+	linked := make(map[[2]string]bool)
+	addEdge := func(from, to string) {
+		if _, ok := resolved[from]; !ok || linked[[2]string{from, to}] {
+			return
+		}
+		if _, ok := resolved[to]; !ok {
+			return
+		}
+		linked[[2]string{from, to}] = true
+		g.edges = append(g.edges, graphEdge{from: from, to: to})
+	}
+	for id, rs := range resolved {
+		g.nodes = append(g.nodes, id)
+		if rs.Explicit {
+			g.explicit[id] = true
+		} else {
+			addEdge(rs.DependencyOf, id)
+		}
+		for _, dep := range rs.Depends {
+			addEdge(id, dep)
+		}
+	}
+	g.sort()
+	return g
+}
+
+// registryGraph builds the graph of all registry stacks and their declared dependencies.
+// Stacks explicit in resolved are highlighted. Dependencies on stacks missing from the
+// registry are drawn too, so broken references stand out.
+func registryGraph(stacks map[string]resolver.StackInfo, resolved map[string]config.ResolvedStack) *stackGraph {
+	g := &stackGraph{explicit: make(map[string]bool)}
+	nodes := make(map[string]bool)
+	// A stack can name the same dependency more than once, e.g. plainly and under a
+	// trigger; it gets one edge, solid if any declaration is required.
+	linked := make(map[[2]string]bool)
+	addEdge := func(from, to string, optional bool) {
+		nodes[to] = true
+		if linked[[2]string{from, to}] {
+			return
+		}
+		linked[[2]string{from, to}] = true
+		g.edges = append(g.edges, graphEdge{from: from, to: to, optional: optional})
+	}
+	for id, info := range stacks {
+		nodes[id] = true
+		for _, dep := range info.Depends {
+			addEdge(id, dep, false)
+		}
+		for _, dep := range info.OptionalDepends {
+			addEdge(id, dep, true)
+		}
+		for _, deps := range info.ConditionalDepends {
+			for _, dep := range deps {
+				addEdge(id, dep, true)
+			}
+		}
+	}
+	for id := range nodes {
+		g.nodes = append(g.nodes, id)
+		if resolved[id].Explicit {
+			g.explicit[id] = true
+		}
+	}
+	g.sort()
+	return g
+}
+
+// sort orders nodes and edges so the output is stable between runs.
+func (g *stackGraph) sort() {
+	sort.Strings(g.nodes)
+	sort.Slice(g.edges, func(i, j int) bool {
+		if g.edges[i].from != g.edges[j].from {
+			return g.edges[i].from < g.edges[j].from
+		}
+		return g.edges[i].to < g.edges[j].to
+	})
+}
+
+// dot renders the graph in Graphviz DOT.
+func (g *stackGraph) dot() string {
+	var b strings.Builder
+	b.WriteString("digraph stacks {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, id := range g.nodes {
+		if g.explicit[id] {
+			fmt.Fprintf(&b, "  %q [style=bold];\n", id)
+		} else {
+			fmt.Fprintf(&b, "  %q;\n", id)
+		}
+	}
+	for _, e := range g.edges {
+		if e.optional {
+			fmt.Fprintf(&b, "  %q -> %q [style=dashed];\n", e.from, e.to)
+		} else {
+			fmt.Fprintf(&b, "  %q -> %q;\n", e.from, e.to)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// mermaid renders the graph as a Mermaid flowchart. Stack IDs may contain characters
+// Mermaid reads as syntax, so nodes get positional IDs and the stack ID as label.
+func (g *stackGraph) mermaid() string {
+	ids := make(map[string]string, len(g.nodes))
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	var explicit []string
+	for i, id := range g.nodes {
+		ids[id] = fmt.Sprintf("s%d", i)
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[id], id)
+		if g.explicit[id] {
+			explicit = append(explicit, ids[id])
+		}
+	}
+	for _, e := range g.edges {
+		arrow := "-->"
+		if e.optional {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", ids[e.from], arrow, ids[e.to])
+	}
+	if len(explicit) > 0 {
+		b.WriteString("  classDef explicit stroke-width:3px,font-weight:bold\n")
+		fmt.Fprintf(&b, "  class %s explicit\n", strings.Join(explicit, ","))
+	}
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/resolver"
+)
+
+func TestGraphRendering(t *testing.T) {
+	installed := installedGraph(map[string]config.ResolvedStack{
+		"nuxt-ui": {Explicit: true},
+		"nuxt":    {DependencyOf: "nuxt-ui"},
+		"vue":     {DependencyOf: "nuxt"},
+		"orphan":  {DependencyOf: "gone"},
+	})
+	recorded := installedGraph(map[string]config.ResolvedStack{
+		"laravel": {Explicit: true, Depends: []string{"pest", "php"}},
+		"php":     {Explicit: true},
+		"pest":    {DependencyOf: "laravel", Depends: []string{"php", "removed"}},
+	})
+	registry := registryGraph(map[string]resolver.StackInfo{
+		"laravel": {
+			ID:                 "laravel",
+			Depends:            []string{"php"},
+			OptionalDepends:    []string{"pest"},
+			ConditionalDepends: map[string][]string{"php": {"php", "pest"}},
+		},
+		"php": {ID: "php"},
+	}, map[string]config.ResolvedStack{"laravel": {Explicit: true}})
+
+	tests := []struct {
+		name  string
+		graph *stackGraph
+		dot   string
+		mmd   string
+	}{
+		{
+			name:  "installed",
+			graph: installed,
+			dot: `digraph stacks {
+  rankdir=LR;
+  "nuxt";
+  "nuxt-ui" [style=bold];
+  "orphan";
+  "vue";
+  "nuxt" -> "vue";
+  "nuxt-ui" -> "nuxt";
+}
+`,
+			mmd: `flowchart LR
+  s0["nuxt"]
+  s1["nuxt-ui"]
+  s2["orphan"]
+  s3["vue"]
+  s0 --> s3
+  s1 --> s0
+  classDef explicit stroke-width:3px,font-weight:bold
+  class s1 explicit
+`,
+		},
+		{
+			name:  "installed with recorded dependencies",
+			graph: recorded,
+			dot: `digraph stacks {
+  rankdir=LR;
+  "laravel" [style=bold];
+  "pest";
+  "php" [style=bold];
+  "laravel" -> "pest";
+  "laravel" -> "php";
+  "pest" -> "php";
+}
+`,
+			mmd: `flowchart LR
+  s0["laravel"]
+  s1["pest"]
+  s2["php"]
+  s0 --> s1
+  s0 --> s2
+  s1 --> s2
+  classDef explicit stroke-width:3px,font-weight:bold
+  class s0,s2 explicit
+`,
+		},
+		{
+			name:  "registry",
+			graph: registry,
+			dot: `digraph stacks {
+  rankdir=LR;
+  "laravel" [style=bold];
+  "pest";
+  "php";
+  "laravel" -> "pest" [style=dashed];
+  "laravel" -> "php";
+}
+`,
+			mmd: `flowchart LR
+  s0["laravel"]
+  s1["pest"]
+  s2["php"]
+  s0 -.-> s1
+  s0 --> s2
+  classDef explicit stroke-width:3px,font-weight:bold
+  class s0 explicit
+`,
+		},
+		{
+			name:  "empty",
+			graph: installedGraph(nil),
+			dot:   "digraph stacks {\n  rankdir=LR;\n}\n",
+			mmd:   "flowchart LR\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.graph.dot(); got != tt.dot {
+				t.Errorf("dot() =\n%s\nwant\n%s", got, tt.dot)
+			}
+			if got := tt.graph.mermaid(); got != tt.mmd {
+				t.Errorf("mermaid() =\n%s\nwant\n%s", got, tt.mmd)
+			}
+		})
+	}
+}
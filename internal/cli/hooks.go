@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/ui"
+)
+
+// Hook names, as used in the hooks section of the config.
+const (
+	hookPostInit = "post_init"
+	hookPostSync = "post_sync"
+)
+
+// runHook runs cfg's hook command of the given name with sh in the project dir. The hook
+// gets the changed stacks and the managed dir in its environment; a non-zero exit fails
+// the command. Hooks are skipped with --no-hooks, and in CI unless the config opts in.
+func (a *App) runHook(ctx context.Context, cfg *config.Config, name string, changed []string) error {
+	command := cfg.Hooks.PostSync
+	if name == hookPostInit {
+		command = cfg.Hooks.PostInit
+	}
+	if command == "" || a.noHooks {
+		return nil
+	}
+	if ui.IsCI() && !cfg.Hooks.RunInCI {
+		a.output.Info("Skipping %s hook in CI (set hooks.run_in_ci to run it)", name)
+		return nil
+	}
+
+	a.output.Info("Running %s hook...", name)
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = a.projectDir
+	cmd.Env = append(os.Environ(),
+		"AI_INSTRUCTIONS_HOOK="+name,
+		"AI_INSTRUCTIONS_CHANGED_STACKS="+strings.Join(changed, ","),
+		"AI_INSTRUCTIONS_MANAGED_DIR="+engine.ManagedDir(cfg),
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %w", name, err)
+	}
+	return nil
+}
+
+// updatedStacks returns the stacks a sync or update downloaded.
+func updatedStacks(result *engine.Result) []string {
+	stacks := make([]string, len(result.Updates))
+	for i, u := range result.Updates {
+		stacks[i] = u.Stack
+	}
+	return stacks
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+)
+
+func TestHooks(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		hooks   config.HooksConfig
+		args    []string
+		wantOut string // "" expects the hook not to run
+		wantErr bool
+	}{
+		{
+			name:    "post_sync",
+			hooks:   config.HooksConfig{PostSync: `echo "$AI_INSTRUCTIONS_HOOK $AI_INSTRUCTIONS_MANAGED_DIR" > hook.out`, RunInCI: true},
+			args:    []string{"sync"},
+			wantOut: "post_sync ai-instructions/company-instructions\n",
+		},
+		{
+			name:    "post_init gets the changed stacks",
+			hooks:   config.HooksConfig{PostInit: `echo "$AI_INSTRUCTIONS_CHANGED_STACKS" > hook.out`, RunInCI: true},
+			args:    []string{"init", "laravel"},
+			wantOut: "php,laravel\n",
+		},
+		{
+			name:  "skipped in CI",
+			hooks: config.HooksConfig{PostSync: `echo ran > hook.out`},
+			args:  []string{"sync"},
+		},
+		{
+			name:  "no-hooks",
+			hooks: config.HooksConfig{PostSync: `echo ran > hook.out`, RunInCI: true},
+			args:  []string{"sync", "--no-hooks"},
+		},
+		{
+			name:    "failing hook",
+			hooks:   config.HooksConfig{PostSync: `exit 3`, RunInCI: true},
+			args:    []string{"sync"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := runApp(t, dir, server.URL, server.Client(), "init", "php"); err != nil {
+				t.Fatalf("init: %v", err)
+			}
+			cfg, err := config.LoadConfig(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.Hooks = tt.hooks
+			if err := config.SaveConfig(dir, cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			err = runApp(t, dir, server.URL, server.Client(), tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("%s error = %v, wantErr %v", strings.Join(tt.args, " "), err, tt.wantErr)
+			}
+
+			out, _ := os.ReadFile(filepath.Join(dir, "hook.out"))
+			if string(out) != tt.wantOut {
+				t.Errorf("hook output = %q, want %q", out, tt.wantOut)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newImportCmd() *cobra.Command {
+	var name string
+
+	cmd := &cobra.Command{
+		Use:   "import <dir>",
+		Short: "Adopt existing instruction files as a local stack",
+		Long:  "Copies the .md files under <dir> into the managed directory as a local stack, named after the\ndirectory unless --name is given, and lists them in the managed blocks. Hidden and dependency\ndirectories, the target files and the managed directory are skipped. Local stacks have no\nregistry version: sync leaves them alone and verify checks them against their recorded hashes.\nRun import again to pick up changes to the files.",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runImport(args[0], name)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "stack ID to import the files as (default: the directory name)")
+	return cmd
+}
+
+func (a *App) runImport(dir, name string) error {
+	if err := a.RequireProject(); err != nil {
+		return err
+	}
+
+	srcDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(srcDir); err != nil || !info.IsDir() {
+		return &ExitError{Code: exitcodes.UsageError, Message: fmt.Sprintf("%s is not a directory", dir)}
+	}
+	if name == "" {
+		name = filepath.Base(srcDir)
+	}
+	if err := registry.ValidatePathComponent(name, "stack ID"); err != nil || filepath.Base(name) != name {
+		return &ExitError{Code: exitcodes.UsageError, Message: fmt.Sprintf("invalid stack ID %q, pass another with --name", name)}
+	}
+	if rs, ok := a.config.Resolved[name]; (ok && !rs.Local) || slices.Contains(a.config.Stacks, name) {
+		return &ExitError{Code: exitcodes.UsageError, Message: fmt.Sprintf("stack %q is installed from the registry, pass another name with --name", name)}
+	}
+
+	result, err := a.newEngine(nil).Import(a.config, name, srcDir)
+	if err != nil {
+		return engineError(err)
+	}
+
+	a.output.Success("Imported %d files as local stack %s", len(a.config.Resolved[name].Files), name)
+	if len(result.Rewritten) > 0 {
+		a.output.Println("Rewrote %d target file(s): %s", len(result.Rewritten), strings.Join(result.Rewritten, ", "))
+	}
+	a.warnContextSize(result.Targets)
+	return nil
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+)
+
+func TestImport(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := runApp(t, dir, server.URL, server.Client(), "init", "php"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	src := filepath.Join(t.TempDir(), "handbook")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "deploys.md"), []byte("# Deploys"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runApp(t, dir, server.URL, server.Client(), "import", src); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	claude, err := os.ReadFile(filepath.Join(dir, "CLAUDE.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(claude), "/handbook/deploys.md") {
+		t.Errorf("CLAUDE.md doesn't list the imported file:\n%s", claude)
+	}
+
+	// The local stack survives a sync, passes verify and is reported as tampered once edited
+	for _, args := range [][]string{{"sync"}, {"verify"}, {"doctor"}, {"list", "--installed"}} {
+		if err := runApp(t, dir, server.URL, server.Client(), args...); err != nil {
+			t.Fatalf("%s: %v", args[0], err)
+		}
+	}
+	cfg, err := config.LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs := cfg.Resolved["handbook"]; !rs.Local || len(rs.Files) != 1 {
+		t.Errorf("Resolved[handbook] = %+v after sync, want the local stack kept", rs)
+	}
+
+	imported := filepath.Join(dir, config.DefaultInstructionsDir, config.DefaultManagedDir, "handbook", "deploys.md")
+	if err := os.WriteFile(imported, []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runApp(t, dir, server.URL, server.Client(), "verify"); exitCode(err) != 1 {
+		t.Errorf("verify after editing an imported file: exit code %d, want 1", exitCode(err))
+	}
+
+	// Importing again takes the files from the source directory again
+	if err := runApp(t, dir, server.URL, server.Client(), "import", src); err != nil {
+		t.Fatalf("re-import: %v", err)
+	}
+	if err := runApp(t, dir, server.URL, server.Client(), "verify"); err != nil {
+		t.Errorf("verify after re-import: %v", err)
+	}
+}
+
+func TestLocalStackList(t *testing.T) {
+	entries := localStackList([]string{"team", "handbook"})
+	if len(entries) != 2 || entries[0].ID != "handbook" || entries[1].ID != "team" {
+		t.Fatalf("localStackList() = %+v, want handbook then team", entries)
+	}
+	for _, e := range entries {
+		if !e.Local || !e.Installed || e.Category != localCategory || e.Version != config.LocalVersion {
+			t.Errorf("entry %+v, want an installed local entry", e)
+		}
+	}
+}
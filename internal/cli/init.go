@@ -3,31 +3,73 @@ package cli
 import (
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/engine"
 	"github.com/cego/ai-instructions/internal/exitcodes"
 	"github.com/cego/ai-instructions/internal/filemanager"
-	"github.com/cego/ai-instructions/internal/injector"
 	"github.com/cego/ai-instructions/internal/registry"
 	"github.com/cego/ai-instructions/internal/resolver"
+	"github.com/cego/ai-instructions/internal/ui"
 	"github.com/spf13/cobra"
 )
 
+// initOptions holds the flags for init.
+type initOptions struct {
+	withRecommended  bool
+	from             string
+	gitignoreManaged bool
+	noInject         bool
+	locale           string
+}
+
 func (a *App) newInitCmd() *cobra.Command {
-	return &cobra.Command{
+	var opts initOptions
+
+	cmd := &cobra.Command{
 		Use:   "init <stack> [stack...]",
 		Short: "Initialize AI instructions for this project",
-		Long:  "Set up AI instruction stacks for the current project.\nPass stack names as arguments (e.g. ai-instructions init php laravel).",
-		Args:  cobra.MinimumNArgs(1),
+		Long:  "Set up AI instruction stacks for the current project.\nPass stack names as arguments (e.g. ai-instructions init php laravel), or a preset file\nwith --from that lists the stacks, registry and mode.\nStacks recommended by the selected ones are offered interactively, or installed with --with-recommended.",
+		Args:  usageArgs(cobra.ArbitraryArgs),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return a.runInit(cmd.Context(), args)
+			return a.runInit(cmd.Context(), args, opts)
 		},
 	}
+	cmd.ValidArgsFunction = a.completeRegistryStacks
+
+	cmd.Flags().BoolVar(&opts.withRecommended, "with-recommended", false, "also install stacks recommended by the selected stacks")
+	cmd.Flags().StringVar(&opts.from, "from", "", "read stacks, registry and mode from a preset file instead of arguments")
+	cmd.Flags().BoolVar(&opts.gitignoreManaged, "gitignore-managed", false, "add the managed directory to .gitignore instead of committing it")
+	cmd.Flags().StringVar(&opts.locale, "locale", "", "language of the instruction files, for stacks that offer several (e.g. da)")
+	cmd.Flags().BoolVar(&opts.noInject, "no-inject", false, "only download instruction files; record inject: false and leave CLAUDE.md and the other targets alone")
+	return cmd
 }
 
-func (a *App) runInit(ctx context.Context, stacks []string) error {
+func (a *App) runInit(ctx context.Context, stacks []string, opts initOptions) error {
+	var preset *config.Preset
+	switch {
+	case opts.from != "" && len(stacks) > 0:
+		return &ExitError{Code: exitcodes.UsageError, Message: "pass either stack names or --from, not both"}
+	case opts.from != "":
+		var err error
+		preset, err = config.LoadPreset(opts.from)
+		if err != nil {
+			return &ExitError{Code: exitcodes.ConfigError, Message: err.Error()}
+		}
+		stacks = preset.Stacks
+		// The preset sits between flags/env and the existing config
+		if a.registryURL == "" {
+			a.registryURL = preset.Registry.URL
+		}
+		if a.branch == "" {
+			a.branch = preset.Registry.Branch
+		}
+	case len(stacks) == 0:
+		return &ExitError{Code: exitcodes.UsageError, Message: "requires at least 1 stack, or a preset file with --from"}
+	}
+
 	if a.config != nil && len(a.config.Stacks) > 0 {
 		a.output.Warning("Existing config found with stacks: %v", a.config.Stacks)
 		a.output.Info("Re-initializing will replace the current configuration.")
@@ -38,159 +80,221 @@ func (a *App) runInit(ctx context.Context, stacks []string) error {
 		return err
 	}
 
+	eng := a.newEngine(client)
+
 	a.output.Info("Fetching registry...")
-	reg, err := client.FetchRegistry(ctx)
+	reg, err := eng.FetchRegistry(ctx)
+	if err != nil && registry.IsNotFound(err) && a.branch == "" && a.config == nil && a.global.Registry.Branch == "" {
+		// No branch was chosen anywhere; the registry may use another default than master
+		if branch, ok := a.inferBranch(ctx, client); ok {
+			a.branch = branch
+			if client, err = a.newRegistryClient(); err != nil {
+				return err
+			}
+			eng = a.newEngine(client)
+			reg, err = eng.FetchRegistry(ctx)
+		}
+	}
 	if err != nil {
-		return err
+		return engineError(err)
 	}
 
 	// Validate provided stacks exist in registry
 	for _, s := range stacks {
 		if _, ok := reg.Stacks[s]; !ok {
-			return &ExitError{Code: exitcodes.UsageError, Message: fmt.Sprintf("stack %q not found in registry", s)}
+			return &ExitError{Code: exitcodes.StackNotFound, Message: fmt.Sprintf("stack %q not found in registry", s)}
 		}
 	}
 
 	// Resolve dependencies
-	stackInfoMap := buildStackInfoMap(reg)
-	res, err := resolver.NewResolver(stackInfoMap).Resolve(stacks)
+	res, err := engine.Resolve(reg, stacks)
 	if err != nil {
-		return fmt.Errorf("dependency resolution: %w", err)
+		return resolutionError(err)
+	}
+
+	if len(res.Suggested) > 0 {
+		// A preset run never prompts
+		interactive := preset == nil && ui.IsInteractive()
+		accepted, promptErr := a.acceptRecommended(ctx, res, opts.withRecommended, interactive)
+		if promptErr != nil {
+			return promptErr
+		}
+		if len(accepted) > 0 {
+			stacks = append(stacks, accepted...)
+			res, err = engine.Resolve(reg, stacks)
+			if err != nil {
+				return resolutionError(err)
+			}
+		}
 	}
 
 	// Build config and download files
 	instrDir := config.DefaultInstructionsDir
-	managedDir := instrDir + "/" + config.ManagedDir
-	registryURL := a.registryURL
-	if registryURL == "" {
-		registryURL = config.DefaultRegistryURL
+	// Same precedence as the client: flag/env, then the existing config, then the default
+	registryURL := a.getProjectURL()
+	// Only a branch given for this project is written, so the user config's branch and the
+	// default still apply to projects that don't set one
+	projectBranch := a.branch
+	if projectBranch == "" && a.config != nil {
+		projectBranch = a.config.Registry.Branch
 	}
 	cfg := &config.Config{
 		Version: 1,
 		Registry: config.RegistryConfig{
-			URL:    registryURL,
-			Branch: a.getBranch(),
+			URL:       registryURL,
+			Branch:    projectBranch,
+			ProjectID: a.getProjectID(),
 		},
 		InstructionsDir: instrDir,
 		Mode:            "platform",
 		Stacks:          stacks,
 		Resolved:        make(map[string]config.ResolvedStack),
 	}
-
-	// Clear managed directory for a fresh start
-	os.RemoveAll(filepath.Join(a.projectDir, managedDir))
-
-	fm := filemanager.NewManager(client, a.projectDir, managedDir)
-
-	a.output.Info("Downloading instruction files...")
-	for _, stackID := range res.Order {
-		manifest, fetchErr := client.FetchStackManifest(ctx, stackID)
-		if fetchErr != nil {
-			return fmt.Errorf("downloading stacks: %w", fetchErr)
+	cfg.LastSyncedBranch = a.getBranch()
+	if a.config != nil {
+		if a.config.Registry.URL == registryURL {
+			// Keep a ${VAR} reference in the URL when the registry didn't change
+			cfg.Registry = a.config.Registry
+			cfg.Registry.Branch = projectBranch
+			cfg.Registry.ProjectID = a.getProjectID()
+		}
+		// Keep registry layers, the managed dir and injection preferences across re-initialization
+		cfg.Registries = a.config.Registries
+		cfg.StackBranches = a.config.StackBranches
+		cfg.ManagedDir = a.config.ManagedDir
+		cfg.LastManagedDir = a.config.LastManagedDir
+		cfg.VerifyRegistry = a.config.VerifyRegistry
+		cfg.SkipInjection = a.config.SkipInjection
+		cfg.Tools = a.config.Tools
+		cfg.Inject = a.config.Inject
+		cfg.Placement = a.config.Placement
+		cfg.Targets = a.config.Targets
+		cfg.Block = a.config.Block
+		cfg.ContextLimitKB = a.config.ContextLimitKB
+		cfg.Locale = a.config.Locale
+		cfg.Hooks = a.config.Hooks
+		cfg.Variables = a.config.Variables
+		// Imported stacks aren't in the registry; keep them unless a registry stack takes the name
+		for id, rs := range a.config.Resolved {
+			if rs.Local && !slices.Contains(res.Order, id) {
+				cfg.Resolved[id] = rs
+			}
+		}
+	}
+	if preset != nil && preset.Mode != "" {
+		cfg.Mode = preset.Mode
+	}
+	if opts.locale != "" {
+		cfg.Locale = opts.locale
+	} else if cfg.Locale == "" && preset == nil && ui.IsInteractive() {
+		if cfg.Locale, err = a.askLocale(ctx, eng, res.Order); err != nil {
+			return err
 		}
+	}
+	if opts.noInject {
+		inject := false
+		cfg.Inject = &inject
+	}
 
-		files := manifest.Files
+	a.output.Info("Downloading instruction files...")
+	result, err := eng.Init(ctx, cfg, reg, res)
+	if err != nil {
+		return engineError(err)
+	}
 
-		if downloadErr := fm.DownloadStack(ctx, stackID, files); downloadErr != nil {
-			return fmt.Errorf("downloading stacks: %w", downloadErr)
-		}
+	a.output.Success("Initialized with %d stacks, %d instruction files", len(result.Order), countResolvedFiles(cfg.Resolved))
+	a.warnStaleManagedDir(result)
 
-		// Compute hashes of downloaded files
-		hash, hashErr := filemanager.HashDir(fm.StackDir(stackID))
-		if hashErr != nil {
-			return fmt.Errorf("downloading stacks: %w", hashErr)
+	managedDir := engine.ManagedDir(cfg)
+	if opts.gitignoreManaged {
+		changed, err := filemanager.EnsureGitignored(a.projectDir, managedDir)
+		if err != nil {
+			return err
 		}
-		fileHashes, hashErr := filemanager.HashFilesInStack(fm.StackDir(stackID), files)
-		if hashErr != nil {
-			return fmt.Errorf("downloading stacks: %w", hashErr)
+		if changed {
+			a.output.Info("Added %s/ to %s", managedDir, filemanager.GitignoreFile)
 		}
+	}
 
-		rs := config.ResolvedStack{
-			Version:    reg.Stacks[stackID].Version,
-			Hash:       hash,
-			Files:      files,
-			FileHashes: fileHashes,
-			Tools:      toolsConfigFromManifest(manifest.Tools),
-		}
-		if res.Explicit[stackID] {
-			rs.Explicit = true
-		} else {
-			rs.DependencyOf = res.DependencyOf[stackID]
+	a.output.Info("\nRemember to commit the following files:")
+	a.output.Info("  - %s", a.configName())
+	if opts.gitignoreManaged {
+		a.output.Info("  - %s", filemanager.GitignoreFile)
+	} else {
+		a.output.Info("  - %s/", managedDir)
+	}
+	for _, c := range result.Targets {
+		if !c.Skip {
+			a.output.Info("  - %s", c.Filename)
 		}
-		cfg.Resolved[stackID] = rs
 	}
 
-	// Save config
-	if err := config.SaveConfig(a.projectDir, cfg); err != nil {
-		return err
+	if opts.gitignoreManaged {
+		a.output.Info("\n%s/ is not committed; run 'ai-instructions sync' after cloning and in CI to download it.", managedDir)
 	}
 
-	// Cleanup old files
-	if config.OldSettingsExists(a.projectDir) {
-		os.Remove(filepath.Join(a.projectDir, config.OldSettingsFile))
-	}
-	if config.OldLockfileExists(a.projectDir) {
-		os.Remove(filepath.Join(a.projectDir, config.LockFile))
+	// Re-initializing only shows the messages of stacks that weren't installed before
+	var previous map[string]config.ResolvedStack
+	if a.config != nil {
+		previous = a.config.Resolved
 	}
-
-	// Inject managed blocks
-	configs := buildInjectorConfigs(res.Order, cfg.Resolved, managedDir)
-	if err := injector.InjectAll(a.projectDir, res.Order, configs, managedDir); err != nil {
-		return err
+	installed := make(map[string]bool, len(result.Order))
+	for _, id := range result.Order {
+		if _, ok := previous[id]; !ok {
+			installed[id] = true
+		}
 	}
+	a.warnDisabledTools(cfg, result.Order, installed)
+	a.printPostInstallMessages(result, installed)
 
-	a.output.Success("Initialized with %d stacks, %d instruction files", len(res.Order), countResolvedFiles(cfg.Resolved))
-	a.output.Info("\nRemember to commit the following files:")
-	a.output.Info("  - %s", config.ConfigFile)
-	a.output.Info("  - %s/", managedDir)
-	a.output.Info("  - CLAUDE.md")
-	a.output.Info("  - AGENTS.md")
-	a.output.Info("  - .cursorrules")
-
-	return nil
+	return a.runHook(ctx, cfg, hookPostInit, result.Order)
 }
 
-func buildStackInfoMap(reg *registry.Registry) map[string]resolver.StackInfo {
-	m := make(map[string]resolver.StackInfo)
-	for id, meta := range reg.Stacks {
-		m[id] = resolver.StackInfo{ID: id, Depends: meta.Depends}
+// acceptRecommended lists the stacks suggested by a resolution and returns those the user accepts.
+// When not interactive they are only listed, unless accept is set.
+func (a *App) acceptRecommended(ctx context.Context, res *resolver.Resolution, accept, interactive bool) ([]string, error) {
+	a.output.Info("Recommended stacks:")
+	for _, id := range res.Suggested {
+		a.output.Info("  - %s (recommended by %s)", id, strings.Join(res.SuggestedBy[id], ", "))
 	}
-	return m
-}
 
-func buildInjectorConfigs(order []string, resolved map[string]config.ResolvedStack, instrDir string) []injector.FileConfig {
-	var claudeFiles, agentsFiles, cursorFiles []string
-
-	for _, stackID := range order {
-		rs := resolved[stackID]
-		for _, f := range rs.Files {
-			path := fmt.Sprintf("%s/%s/%s", instrDir, stackID, f)
-			if rs.Tools.IncludeInClaudeMD {
-				claudeFiles = append(claudeFiles, path)
-			}
-			if rs.Tools.IncludeInAgentsMD {
-				agentsFiles = append(agentsFiles, path)
-			}
-			if rs.Tools.IncludeInCursorRules {
-				cursorFiles = append(cursorFiles, path)
-			}
-		}
+	if accept {
+		return res.Suggested, nil
+	}
+	if !interactive {
+		a.output.Info("Pass --with-recommended to install them.")
+		return nil, nil
 	}
 
-	return []injector.FileConfig{
-		injector.ClaudeConfig(claudeFiles),
-		injector.AgentsConfig(agentsFiles),
-		injector.CursorConfig(cursorFiles),
+	ok, err := a.output.Confirm(ctx, "Install recommended stacks?")
+	if err != nil || !ok {
+		return nil, err
 	}
+	return res.Suggested, nil
 }
 
-// toolsConfigFromManifest converts registry ToolsConfig to config ToolsConfig.
-func toolsConfigFromManifest(tools registry.ToolsConfig) config.ToolsConfig {
-	return config.ToolsConfig{
-		IncludeInClaudeMD:    tools.Claude.IncludeInClaudeMD,
-		IncludeInAgentsMD:    tools.Claude.IncludeInAgentsMD,
-		IncludeInCursorRules: tools.Cursor.IncludeInCursorRules,
+// askLocale offers the locales of the stacks being installed and returns the chosen one,
+// or "" for the stacks' default when they offer no choice.
+func (a *App) askLocale(ctx context.Context, eng *engine.Engine, stacks []string) (string, error) {
+	locales, err := eng.StackLocales(ctx, stacks)
+	if err != nil {
+		return "", engineError(err)
+	}
+	if len(locales) < 2 {
+		return "", nil
 	}
+	def := engine.DefaultLocale
+	if !slices.Contains(locales, def) {
+		def = locales[0]
+	}
+	locale, err := a.output.Ask(ctx, fmt.Sprintf("Instruction language (%s)?", strings.Join(locales, ", ")), def)
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(locales, locale) {
+		return "", &ExitError{Code: exitcodes.UsageError, Message: fmt.Sprintf("unknown locale %q: must be one of %s", locale, strings.Join(locales, ", "))}
+	}
+	return locale, nil
 }
 
 func countResolvedFiles(resolved map[string]config.ResolvedStack) int {
@@ -200,3 +304,18 @@ func countResolvedFiles(resolved map[string]config.ResolvedStack) int {
 	}
 	return total
 }
+
+// inferBranch looks up the registry project's default branch after registry.json wasn't
+// found on the implicit default, and reports whether it is a different branch worth retrying.
+func (a *App) inferBranch(ctx context.Context, client *registry.Client) (string, bool) {
+	branch, err := client.DefaultBranch(ctx)
+	if err != nil {
+		a.debugf("looking up the default branch: %v", err)
+		return "", false
+	}
+	if branch == config.DefaultBranch {
+		return "", false
+	}
+	a.output.Info("registry.json not found on %s, using the registry's default branch %s", config.DefaultBranch, branch)
+	return branch, true
+}
@@ -2,14 +2,20 @@ package cli
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/exitcodes"
 	"github.com/cego/ai-instructions/internal/filemanager"
 	"github.com/cego/ai-instructions/internal/injector"
 	"github.com/cego/ai-instructions/internal/registry"
@@ -45,7 +51,7 @@ func TestFullInitAddSyncVerifyFlow(t *testing.T) {
 
 	projectDir := t.TempDir()
 	ctx := context.Background()
-	managedDir := config.DefaultInstructionsDir + "/" + config.ManagedDir
+	managedDir := config.DefaultInstructionsDir + "/" + config.DefaultManagedDir
 
 	client := registry.NewClient(
 		registry.WithBaseURL(server.URL),
@@ -131,7 +137,7 @@ func TestFullInitAddSyncVerifyFlow(t *testing.T) {
 		injector.AgentsConfig(allFiles),
 		injector.CursorConfig(allFiles),
 	}
-	if err := injector.InjectAll(projectDir, res.Order, configs, managedDir); err != nil {
+	if _, err := injector.InjectAll(projectDir, res.Order, configs, managedDir); err != nil {
 		t.Fatalf("InjectAll: %v", err)
 	}
 
@@ -271,3 +277,701 @@ func TestVerifyExitCodes(t *testing.T) {
 		t.Errorf("expected 1 resolved stack, got %d", len(loadedCfg.Resolved))
 	}
 }
+
+func TestVerifyStaleBlock(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	projectDir := t.TempDir()
+	if err := runApp(t, projectDir, server.URL, server.Client(), "init", "php"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	path := filepath.Join(projectDir, "CLAUDE.md")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading CLAUDE.md: %v", err)
+	}
+	edited := strings.Replace(string(data), "php", "go", 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = runApp(t, projectDir, server.URL, server.Client(), "verify")
+	if got := exitCode(err); got != exitcodes.VerificationFailed {
+		t.Fatalf("verify after editing the block: exit code = %d, want %d (err: %v)", got, exitcodes.VerificationFailed, err)
+	}
+
+	if err := runApp(t, projectDir, server.URL, server.Client(), "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if err := runApp(t, projectDir, server.URL, server.Client(), "verify"); err != nil {
+		t.Errorf("verify after sync: %v", err)
+	}
+}
+
+func TestNoInject(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	projectDir := t.TempDir()
+	if err := runApp(t, projectDir, server.URL, server.Client(), "init", "--no-inject", "php"); err != nil {
+		t.Fatalf("init --no-inject: %v", err)
+	}
+
+	cfg, err := config.LoadConfig(projectDir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.InjectionEnabled() {
+		t.Error("init --no-inject should record inject: false")
+	}
+	if _, ok := cfg.Resolved["php"]; !ok {
+		t.Error("init --no-inject should still resolve and download php")
+	}
+	for _, name := range []string{"CLAUDE.md", "AGENTS.md"} {
+		if _, err := os.Stat(filepath.Join(projectDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should not be created with --no-inject", name)
+		}
+	}
+
+	for _, args := range [][]string{{"sync"}, {"verify"}, {"doctor"}} {
+		if err := runApp(t, projectDir, server.URL, server.Client(), args...); err != nil {
+			t.Errorf("%s with inject: false: %v", args[0], err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, "CLAUDE.md")); !os.IsNotExist(err) {
+		t.Error("sync should not create CLAUDE.md with inject: false")
+	}
+}
+
+func TestSyncNoInject(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	projectDir := t.TempDir()
+	if err := runApp(t, projectDir, server.URL, server.Client(), "init", "php"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	path := filepath.Join(projectDir, "CLAUDE.md")
+	handWritten := "# Maintained by hand\n"
+	if err := os.WriteFile(path, []byte(handWritten), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Capture stdout; the UI writes to os.Stdout directly
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	err = runApp(t, projectDir, server.URL, server.Client(), "sync", "--no-inject")
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("sync --no-inject: %v", err)
+	}
+	if !strings.Contains(string(out), "Managed blocks not updated (injection disabled)") || strings.Contains(string(out), "Target files unchanged") {
+		t.Errorf("sync --no-inject should report that injection is disabled, got:\n%s", out)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != handWritten {
+		t.Errorf("sync --no-inject changed CLAUDE.md:\n%s", data)
+	}
+
+	// The flag is for a single run: the config still injects
+	cfg, err := config.LoadConfig(projectDir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !cfg.InjectionEnabled() {
+		t.Error("sync --no-inject should not change the inject setting")
+	}
+}
+
+func TestCustomTargets(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	projectDir := t.TempDir()
+	if err := runApp(t, projectDir, server.URL, server.Client(), "init", "laravel"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	cfg, err := config.LoadConfig(projectDir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	cfg.Targets = []config.TargetConfig{
+		{Filename: ".windsurfrules", MarkerStyle: config.MarkerStyleHash, Stacks: []string{"laravel"}},
+		{Filename: "docs/zed.md"},
+	}
+	if err := config.SaveConfig(projectDir, cfg); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+
+	if err := runApp(t, projectDir, server.URL, server.Client(), "sync"); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	windsurf, err := os.ReadFile(filepath.Join(projectDir, ".windsurfrules"))
+	if err != nil {
+		t.Fatalf("reading .windsurfrules: %v", err)
+	}
+	if !strings.Contains(string(windsurf), injector.HashMarkerStart) {
+		t.Error(".windsurfrules should use hash markers")
+	}
+	if !strings.Contains(string(windsurf), "/laravel/") || strings.Contains(string(windsurf), "/php/") {
+		t.Errorf(".windsurfrules should only list laravel files, got:\n%s", windsurf)
+	}
+
+	zed, err := os.ReadFile(filepath.Join(projectDir, "docs", "zed.md"))
+	if err != nil {
+		t.Fatalf("reading docs/zed.md: %v", err)
+	}
+	if !strings.Contains(string(zed), injector.MarkerStart) || !strings.Contains(string(zed), "/php/") {
+		t.Errorf("docs/zed.md should list all stacks with default markers, got:\n%s", zed)
+	}
+
+	if err := runApp(t, projectDir, server.URL, server.Client(), "verify"); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+
+	os.Remove(filepath.Join(projectDir, ".windsurfrules"))
+	if err := runApp(t, projectDir, server.URL, server.Client(), "verify"); err == nil {
+		t.Error("verify should fail when a custom target's block is missing")
+	}
+
+	if err := runApp(t, projectDir, server.URL, server.Client(), "clean", "--yes"); err != nil {
+		t.Fatalf("clean: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, "docs", "zed.md")); !os.IsNotExist(err) {
+		t.Error("clean should remove docs/zed.md")
+	}
+}
+
+func TestInitRecommendedStacks(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+	t.Setenv("CI", "true")
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantDocker bool
+	}{
+		{name: "listed only", args: []string{"init", "go"}, wantDocker: false},
+		{name: "accepted", args: []string{"init", "go", "--with-recommended"}, wantDocker: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectDir := t.TempDir()
+			if err := runApp(t, projectDir, server.URL, server.Client(), tt.args...); err != nil {
+				t.Fatalf("init: %v", err)
+			}
+
+			cfg, err := config.LoadConfig(projectDir)
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			rs, ok := cfg.Resolved["docker"]
+			if ok != tt.wantDocker {
+				t.Fatalf("docker installed = %v, want %v", ok, tt.wantDocker)
+			}
+			if ok && !rs.Explicit {
+				t.Error("accepted recommendation should be recorded as explicit")
+			}
+		})
+	}
+}
+
+func TestInitFromPreset(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	projectDir := t.TempDir()
+	preset := filepath.Join(t.TempDir(), "preset.yml")
+	content := "registry:\n  url: https://gitlab.example.com/team/ai\n  branch: develop\nmode: platform\nstacks: [laravel]\n"
+	if err := os.WriteFile(preset, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runApp(t, projectDir, server.URL, server.Client(), "init", "--from", preset); err != nil {
+		t.Fatalf("init --from: %v", err)
+	}
+
+	cfg, err := config.LoadConfig(projectDir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Registry.URL != "https://gitlab.example.com/team/ai" || cfg.Registry.Branch != "develop" {
+		t.Errorf("Registry = %+v, want the preset's registry", cfg.Registry)
+	}
+	if len(cfg.Stacks) != 1 || cfg.Stacks[0] != "laravel" {
+		t.Errorf("Stacks = %v, want [laravel]", cfg.Stacks)
+	}
+	if _, ok := cfg.Resolved["php"]; !ok {
+		t.Error("dependency php should be resolved")
+	}
+}
+
+func TestSyncOnlyExclude(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	managedDir := filepath.Join(config.DefaultInstructionsDir, config.DefaultManagedDir)
+	phpFile := filepath.Join(managedDir, "php", "coding-standards.md")
+	vueFile := filepath.Join(managedDir, "vue", "coding-standards.md")
+
+	tests := []struct {
+		name         string
+		args         []string
+		wantPHPFixed bool
+		wantVueFixed bool
+	}{
+		{name: "only includes dependencies", args: []string{"sync", "--force", "--only", "laravel"}, wantPHPFixed: true, wantVueFixed: false},
+		{name: "exclude", args: []string{"sync", "--force", "--exclude", "php"}, wantPHPFixed: false, wantVueFixed: true},
+		{name: "all", args: []string{"sync", "--force"}, wantPHPFixed: true, wantVueFixed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectDir := t.TempDir()
+			if err := runApp(t, projectDir, server.URL, server.Client(), "init", "laravel", "vue"); err != nil {
+				t.Fatalf("init: %v", err)
+			}
+			for _, f := range []string{phpFile, vueFile} {
+				os.WriteFile(filepath.Join(projectDir, f), []byte("tampered"), 0644)
+			}
+
+			if err := runApp(t, projectDir, server.URL, server.Client(), tt.args...); err != nil {
+				t.Fatalf("sync: %v", err)
+			}
+
+			for f, wantFixed := range map[string]bool{phpFile: tt.wantPHPFixed, vueFile: tt.wantVueFixed} {
+				data, _ := os.ReadFile(filepath.Join(projectDir, f))
+				if fixed := string(data) != "tampered"; fixed != wantFixed {
+					t.Errorf("%s restored = %v, want %v", f, fixed, wantFixed)
+				}
+			}
+
+			claude, _ := os.ReadFile(filepath.Join(projectDir, "CLAUDE.md"))
+			if !strings.Contains(string(claude), "/vue/") || !strings.Contains(string(claude), "/php/") {
+				t.Error("CLAUDE.md should still list every stack")
+			}
+		})
+	}
+}
+
+func TestDoctorStackDrift(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	projectDir := t.TempDir()
+	if err := runApp(t, projectDir, server.URL, server.Client(), "init", "laravel"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if err := runApp(t, projectDir, server.URL, server.Client(), "doctor"); err != nil {
+		t.Fatalf("doctor on a fresh project: %v", err)
+	}
+
+	// Hand-edit: list vue without syncing, and leave a resolved entry nobody asked for
+	cfg, err := config.LoadConfig(projectDir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	cfg.Stacks = append(cfg.Stacks, "vue")
+	cfg.Resolved["docker"] = config.ResolvedStack{Version: "1.0.0", Explicit: true}
+	if err := config.SaveConfig(projectDir, cfg); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+
+	if got := exitCode(runApp(t, projectDir, server.URL, server.Client(), "doctor")); got != exitcodes.VerificationFailed {
+		t.Fatalf("doctor exit code = %d, want %d", got, exitcodes.VerificationFailed)
+	}
+
+	if err := runApp(t, projectDir, server.URL, server.Client(), "doctor", "--fix"); err != nil {
+		t.Fatalf("doctor --fix: %v", err)
+	}
+
+	cfg, err = config.LoadConfig(projectDir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if drift := config.StackDrift(cfg); !drift.Empty() {
+		t.Errorf("drift after --fix = %+v, want none", drift)
+	}
+	if _, ok := cfg.Resolved["vue"]; !ok {
+		t.Error("vue should be resolved after --fix")
+	}
+	if _, ok := cfg.Resolved["docker"]; ok {
+		t.Error("unlisted docker entry should be removed after --fix")
+	}
+}
+
+func TestDoctorFixAsksBeforeOverwriting(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	projectDir := t.TempDir()
+	if err := runApp(t, projectDir, server.URL, server.Client(), "init", "php"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	path := filepath.Join(projectDir, config.DefaultInstructionsDir, config.DefaultManagedDir, "php", "coding-standards.md")
+	if err := os.WriteFile(path, []byte("local edits"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Outside a terminal the overwrite can't be confirmed, so the edits survive
+	if got := exitCode(runApp(t, projectDir, server.URL, server.Client(), "doctor", "--fix")); got != exitcodes.VerificationFailed {
+		t.Fatalf("doctor --fix exit code = %d, want %d", got, exitcodes.VerificationFailed)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "local edits" {
+		t.Fatalf("doctor --fix without --yes changed the modified file: %q, %v", data, err)
+	}
+
+	if err := runApp(t, projectDir, server.URL, server.Client(), "doctor", "--fix", "--yes"); err != nil {
+		t.Fatalf("doctor --fix --yes: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) == "local edits" {
+		t.Errorf("doctor --fix --yes should restore the modified file, got %q, %v", data, err)
+	}
+}
+
+// setupGitLabRegistries serves testdata registries through the GitLab raw file API,
+// keyed by project path (e.g. "cego/instructions").
+func setupGitLabRegistries(t *testing.T, projects map[string]string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// /api/v4/projects/<project>/repository/files/<file>/raw
+		parts := strings.Split(r.URL.EscapedPath(), "/")
+		if len(parts) != 9 || parts[3] != "projects" {
+			http.Error(w, "not found", 404)
+			return
+		}
+		project, _ := url.PathUnescape(parts[4])
+		file, _ := url.PathUnescape(parts[7])
+
+		dir, ok := projects[project]
+		if !ok {
+			http.Error(w, "not found", 404)
+			return
+		}
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			http.Error(w, "not found", 404)
+			return
+		}
+		w.Write(data)
+	}))
+}
+
+func TestInitInfersDefaultBranch(t *testing.T) {
+	gitlab := setupGitLabRegistries(t, map[string]string{
+		"cego/instructions": filepath.Join("..", "..", "testdata", "registry"),
+	})
+	defer gitlab.Close()
+
+	// A registry whose files only exist on main
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() == "/api/v4/projects/cego%2Finstructions" {
+			w.Write([]byte(`{"default_branch": "main"}`))
+			return
+		}
+		if r.URL.Query().Get("ref") != "main" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		gitlab.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	t.Setenv("CI", "true")
+
+	projectDir := t.TempDir()
+	app := NewApp("test", "none", "unknown")
+	app.registryOpts = []registry.Option{registry.WithHTTPClient(server.Client())}
+	app.rootCmd.SetArgs([]string{"--dir", projectDir, "--registry", server.URL + "/cego/instructions", "init", "php"})
+	if err := app.Execute(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	cfg, err := config.LoadConfig(projectDir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Registry.Branch != "main" {
+		t.Errorf("Registry.Branch = %q, want the inferred main", cfg.Registry.Branch)
+	}
+
+	// An explicit branch is never replaced
+	app = NewApp("test", "none", "unknown")
+	app.registryOpts = []registry.Option{registry.WithHTTPClient(server.Client())}
+	app.rootCmd.SetArgs([]string{"--dir", t.TempDir(), "--registry", server.URL + "/cego/instructions", "--branch", "master", "init", "php"})
+	if err := app.Execute(); exitCode(err) != exitcodes.ConfigError {
+		t.Errorf("init --branch master: exit code = %d, want %d (err: %v)", exitCode(err), exitcodes.ConfigError, err)
+	}
+}
+
+func TestLayeredRegistries(t *testing.T) {
+	server := setupGitLabRegistries(t, map[string]string{
+		"cego/instructions": filepath.Join("..", "..", "testdata", "registry"),
+		"team/instructions": filepath.Join("..", "..", "testdata", "registry-team"),
+	})
+	defer server.Close()
+
+	projectDir := t.TempDir()
+	cfg := &config.Config{
+		Version:    1,
+		Registry:   config.RegistryConfig{URL: server.URL + "/cego/instructions"},
+		Registries: []config.RegistryConfig{{URL: server.URL + "/team/instructions"}},
+		Stacks:     []string{"php"},
+	}
+	if err := config.SaveConfig(projectDir, cfg); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+
+	run := func(args ...string) error {
+		app := NewApp("test", "none", "unknown")
+		app.registryOpts = []registry.Option{registry.WithHTTPClient(server.Client())}
+		app.rootCmd.SetArgs(append([]string{"--dir", projectDir}, args...))
+		return app.Execute()
+	}
+
+	if err := run("init", "team-rules"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	loaded, err := config.LoadConfig(projectDir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	// team-rules (team) → laravel (company) → php (team override)
+	for stack, want := range map[string]string{"team-rules": "1.0.0", "laravel": "1.4.0", "php": "9.0.0"} {
+		if got := loaded.Resolved[stack].Version; got != want {
+			t.Errorf("%s version = %q, want %q", stack, got, want)
+		}
+	}
+
+	managedDir := filepath.Join(projectDir, config.DefaultInstructionsDir, config.DefaultManagedDir)
+	data, err := os.ReadFile(filepath.Join(managedDir, "php", "coding-standards.md"))
+	if err != nil {
+		t.Fatalf("reading php file: %v", err)
+	}
+	if !strings.Contains(string(data), "Team PHP") {
+		t.Error("php should be downloaded from the team registry")
+	}
+	if _, err := os.Stat(filepath.Join(managedDir, "laravel", "eloquent.md")); err != nil {
+		t.Error("laravel should be downloaded from the company registry")
+	}
+
+	if len(loaded.Registries) != 1 || loaded.Registry.URL != server.URL+"/cego/instructions" {
+		t.Errorf("init should keep the configured registries, got %+v / %+v", loaded.Registry, loaded.Registries)
+	}
+
+	if err := run("doctor"); err != nil {
+		t.Errorf("doctor: %v", err)
+	}
+}
+
+func TestInitAbortLeavesNoPartialState(t *testing.T) {
+	registryServer := setupTestRegistry(t)
+	defer registryServer.Close()
+
+	// Cancel the run as soon as the first instruction file is requested
+	var cancel context.CancelFunc
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".md") {
+			cancel()
+		}
+		resp, err := registryServer.Client().Get(registryServer.URL + r.URL.Path)
+		if err != nil {
+			http.Error(w, err.Error(), 502)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, projectDir string) []byte
+	}{
+		{
+			name:  "first init",
+			setup: func(t *testing.T, projectDir string) []byte { return nil },
+		},
+		{
+			name: "re-init",
+			setup: func(t *testing.T, projectDir string) []byte {
+				if err := runApp(t, projectDir, registryServer.URL, registryServer.Client(), "init", "php"); err != nil {
+					t.Fatalf("init: %v", err)
+				}
+				data, _ := os.ReadFile(filepath.Join(projectDir, config.ConfigFile))
+				return data
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectDir := t.TempDir()
+			before := tt.setup(t, projectDir)
+
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+
+			app := NewApp("test", "none", "unknown")
+			app.registryOpts = []registry.Option{
+				registry.WithBaseURL(server.URL),
+				registry.WithHTTPClient(server.Client()),
+			}
+			app.rootCmd.SetArgs([]string{"--dir", projectDir, "init", "laravel"})
+			if err := app.rootCmd.ExecuteContext(ctx); err == nil {
+				t.Fatal("init should fail once cancelled")
+			}
+
+			after, _ := os.ReadFile(filepath.Join(projectDir, config.ConfigFile))
+			if string(after) != string(before) {
+				t.Errorf("config changed by aborted init:\n%s", after)
+			}
+
+			managedDir := filepath.Join(projectDir, config.DefaultInstructionsDir, config.DefaultManagedDir)
+			if before == nil {
+				if _, err := os.Stat(managedDir); !os.IsNotExist(err) {
+					t.Error("aborted first init should not leave a managed dir behind")
+				}
+				return
+			}
+			if err := runApp(t, projectDir, registryServer.URL, registryServer.Client(), "verify"); err != nil {
+				t.Errorf("previous install should still verify after an aborted re-init: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRegistryChecksum(t *testing.T) {
+	const registryJSON = `{"version":1,"stacks":{"php":{"name":"PHP","version":"1.0.0","category":"language"}}}`
+	sum := sha256.Sum256([]byte(registryJSON))
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantCode int
+	}{
+		{name: "match", checksum: hex.EncodeToString(sum[:]) + "  registry.json\n", wantCode: exitcodes.Success},
+		{name: "mismatch", checksum: strings.Repeat("0", 64) + "  registry.json\n", wantCode: exitcodes.VerificationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeRegistry(t, map[string]string{
+				"registry.json":        registryJSON,
+				"registry.json.sha256": tt.checksum,
+				"php/stack.json":       `{"name":"PHP","version":"1.0.0","files":["rules.md"]}`,
+				"php/rules.md":         "rules",
+			})
+			server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+			defer server.Close()
+
+			err := runApp(t, t.TempDir(), server.URL, server.Client(), "init", "php", "--verify-registry")
+			if got := exitCode(err); got != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (err: %v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestConfigFlag(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+	dir := t.TempDir()
+
+	if err := runApp(t, dir, server.URL, server.Client(), "--config", "frontend.yml", "init", "php"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if config.ConfigExists(dir) {
+		t.Errorf("init --config should not write %s", config.ConfigFile)
+	}
+	cfg, err := config.LoadFile(filepath.Join(dir, "frontend.yml"))
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if _, ok := cfg.Resolved["php"]; !ok {
+		t.Errorf("frontend.yml resolved = %v, want php", cfg.Resolved)
+	}
+
+	if err := runApp(t, dir, server.URL, server.Client(), "--config", "frontend.yml", "sync"); err != nil {
+		t.Errorf("sync --config: %v", err)
+	}
+	if err := runApp(t, dir, server.URL, server.Client(), "verify"); exitCode(err) != exitcodes.ConfigError {
+		t.Errorf("verify without --config: exit code %d, want %d", exitCode(err), exitcodes.ConfigError)
+	}
+}
+
+func TestInitGitignoreManaged(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+	dir := t.TempDir()
+
+	for i := 0; i < 2; i++ {
+		if err := runApp(t, dir, server.URL, server.Client(), "init", "--gitignore-managed", "php"); err != nil {
+			t.Fatalf("init --gitignore-managed (run %d): %v", i+1, err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		t.Fatalf("reading .gitignore: %v", err)
+	}
+	cfg, _ := config.LoadConfig(dir)
+	if want := "/" + engine.ManagedDir(cfg) + "/\n"; string(data) != want {
+		t.Errorf(".gitignore = %q, want %q", data, want)
+	}
+}
+
+func TestSyncBranchChange(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+	dir := t.TempDir()
+
+	if err := runApp(t, dir, server.URL, server.Client(), "init", "php"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	// A teammate switches the committed config to a feature branch
+	cfg, err := config.LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.LastSyncedBranch != "master" {
+		t.Errorf("LastSyncedBranch after init = %q, want master", cfg.LastSyncedBranch)
+	}
+	cfg.Registry.Branch = "feature/x"
+	if err := config.SaveConfig(dir, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runApp(t, dir, server.URL, server.Client(), "sync"); exitCode(err) != exitcodes.VerificationFailed {
+		t.Fatalf("sync after branch change: exit code %d, want %d (err: %v)", exitCode(err), exitcodes.VerificationFailed, err)
+	}
+	if err := runApp(t, dir, server.URL, server.Client(), "sync", "--force"); err != nil {
+		t.Fatalf("sync --force: %v", err)
+	}
+	if cfg, _ := config.LoadConfig(dir); cfg.LastSyncedBranch != "feature/x" {
+		t.Errorf("LastSyncedBranch after sync = %q, want feature/x", cfg.LastSyncedBranch)
+	}
+	if err := runApp(t, dir, server.URL, server.Client(), "sync"); err != nil {
+		t.Errorf("sync on the recorded branch: %v", err)
+	}
+}
@@ -2,113 +2,312 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"sort"
 	"strings"
 
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/cego/ai-instructions/internal/registry"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
+// Output formats for list.
+const (
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+	formatTable = "table"
+)
+
+// stackListEntry is one registry stack as emitted by list --format json|yaml.
+type stackListEntry struct {
+	ID           string   `json:"id" yaml:"id"`
+	Name         string   `json:"name" yaml:"name"`
+	Description  string   `json:"description" yaml:"description"`
+	Version      string   `json:"version" yaml:"version"`
+	Category     string   `json:"category" yaml:"category"`
+	Depends      []string `json:"depends" yaml:"depends"`
+	Installed    bool     `json:"installed" yaml:"installed"`
+	LocalVersion string   `json:"local_version,omitempty" yaml:"local_version,omitempty"`
+	Local        bool     `json:"local,omitempty" yaml:"local,omitempty"` // imported from local files, not in the registry
+	Owner        string   `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Maintainers  []string `json:"maintainers,omitempty" yaml:"maintainers,omitempty"`
+}
+
+// listOptions holds the flags for list.
+type listOptions struct {
+	format    string
+	category  string
+	installed bool
+	verbose   bool
+}
+
 func (a *App) newListCmd() *cobra.Command {
-	return &cobra.Command{
+	var opts listOptions
+
+	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all available stacks from the registry",
-		Long:  "Shows all registry stacks grouped by category. Installed stacks are marked with a checkmark and show local vs registry version.",
+		Long:  "Shows all registry stacks grouped by category. Installed stacks are marked with a checkmark and show local vs registry version.\nUse --format json|yaml|table for machine-readable output,\nand --category or --installed to show only some stacks. --verbose adds who owns and maintains each stack.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return a.runList(cmd.Context())
+			return a.runList(cmd.Context(), opts)
 		},
 	}
-}
 
-func (a *App) runList(ctx context.Context) error {
-	client, err := a.newRegistryClient()
-	if err != nil {
-		return err
-	}
+	cmd.Flags().StringVar(&opts.format, "format", "", "output format: json, yaml or table (default: grouped by category)")
+	cmd.Flags().StringVar(&opts.category, "category", "", "only show stacks in this category")
+	cmd.Flags().BoolVar(&opts.installed, "installed", false, "only show installed stacks")
+	cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "show the owner and maintainers of each stack")
+	return cmd
+}
 
-	reg, err := client.FetchRegistry(ctx)
-	if err != nil {
-		return err
+func (a *App) runList(ctx context.Context, opts listOptions) error {
+	format := opts.format
+	switch format {
+	case "", formatJSON, formatYAML, formatTable:
+	default:
+		return &ExitError{
+			Code:    exitcodes.UsageError,
+			Message: fmt.Sprintf("invalid format %q: must be %s, %s or %s", format, formatJSON, formatYAML, formatTable),
+		}
 	}
 
 	// Load project config if available (works without init)
 	_ = a.LoadProjectConfig()
 
 	installed := make(map[string]string) // stack ID -> local version
+	var imported []string
 	if a.config != nil && a.config.Resolved != nil {
 		for id, rs := range a.config.Resolved {
+			if rs.Local {
+				imported = append(imported, id)
+				continue
+			}
 			installed[id] = rs.Version
 		}
 	}
 
-	// Group by category
-	type stackEntry struct {
-		id            string
-		description   string
-		version       string
-		depends       []string
-		localVersion  string
-		isInstalled   bool
+	if a.offline && opts.category != "" {
+		return &ExitError{Code: exitcodes.NetworkError, Message: "--category needs the registry, which --offline disables"}
 	}
 
-	categories := make(map[string][]stackEntry)
+	var entries []stackListEntry
+	if a.offline {
+		if format == "" {
+			a.output.Info("Offline, showing installed stacks only")
+		}
+		entries = installedStackList(installed)
+	} else {
+		client, err := a.newRegistryClient()
+		if err != nil {
+			return err
+		}
+		reg, err := a.fetchRegistry(ctx, client)
+		if err != nil {
+			return err
+		}
+		entries = buildStackList(reg, installed)
+	}
+	entries = append(entries, localStackList(imported)...)
+	entries = filterStackList(entries, opts.category, opts.installed)
+
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case formatYAML:
+		data, err := yaml.Marshal(entries)
+		if err != nil {
+			return fmt.Errorf("marshaling stacks: %w", err)
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	case formatTable:
+		headers := []string{"STACK", "CATEGORY", "VERSION", "INSTALLED", "DEPENDS"}
+		if opts.verbose {
+			headers = append(headers, "OWNER", "MAINTAINERS")
+		}
+		rows := make([][]string, 0, len(entries))
+		for _, e := range entries {
+			installedCol := ""
+			if e.Installed {
+				installedCol = e.LocalVersion
+			}
+			row := []string{e.ID, e.Category, e.Version, installedCol, strings.Join(e.Depends, ", ")}
+			if opts.verbose {
+				row = append(row, e.Owner, strings.Join(e.Maintainers, ", "))
+			}
+			rows = append(rows, row)
+		}
+		a.output.Table(headers, rows)
+		return nil
+	}
+
+	if len(entries) == 0 && opts.category != "" {
+		a.output.Info("No stacks in category %q", opts.category)
+		return nil
+	}
+	installedCount := len(installed) + len(imported)
+	if opts.category != "" {
+		installedCount = 0
+		for _, e := range entries {
+			if e.Installed {
+				installedCount++
+			}
+		}
+	}
+	a.printStackList(entries, installedCount, opts.verbose)
+	return nil
+}
+
+// buildStackList returns every registry stack sorted by category, then ID.
+func buildStackList(reg *registry.Registry, installed map[string]string) []stackListEntry {
+	entries := make([]stackListEntry, 0, len(reg.Stacks))
 	for id, meta := range reg.Stacks {
 		localVersion, isInstalled := installed[id]
-		categories[meta.Category] = append(categories[meta.Category], stackEntry{
-			id:           id,
-			description:  meta.Description,
-			version:      meta.Version,
-			depends:      meta.Depends,
-			localVersion: localVersion,
-			isInstalled:  isInstalled,
+		depends := meta.Depends
+		if depends == nil {
+			depends = []string{}
+		}
+		entries = append(entries, stackListEntry{
+			ID:           id,
+			Name:         meta.Name,
+			Description:  meta.Description,
+			Version:      meta.Version,
+			Category:     meta.Category,
+			Depends:      depends,
+			Installed:    isInstalled,
+			LocalVersion: localVersion,
+			Owner:        meta.Owner,
+			Maintainers:  meta.Maintainers,
 		})
 	}
 
-	catNames := make([]string, 0, len(categories))
-	for c := range categories {
-		catNames = append(catNames, c)
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Category != entries[j].Category {
+			return entries[i].Category < entries[j].Category
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// filterStackList keeps the entries in category (case-insensitively), and only the
+// installed ones if installedOnly is set. An empty category keeps every category.
+func filterStackList(entries []stackListEntry, category string, installedOnly bool) []stackListEntry {
+	if category == "" && !installedOnly {
+		return entries
 	}
-	sort.Strings(catNames)
+	filtered := make([]stackListEntry, 0, len(entries))
+	for _, e := range entries {
+		if category != "" && !strings.EqualFold(e.Category, category) {
+			continue
+		}
+		if installedOnly && !e.Installed {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered
+}
 
-	for _, cat := range catNames {
-		entries := categories[cat]
-		sort.Slice(entries, func(i, j int) bool {
-			return entries[i].id < entries[j].id
+// installedStackList returns the installed stacks sorted by ID, as far as the config
+// knows them: registry-only details such as name and category are left empty.
+func installedStackList(installed map[string]string) []stackListEntry {
+	entries := make([]stackListEntry, 0, len(installed))
+	for id, version := range installed {
+		entries = append(entries, stackListEntry{
+			ID:           id,
+			Version:      version,
+			Depends:      []string{},
+			Installed:    true,
+			LocalVersion: version,
 		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
 
-		label := cat
-		if len(cat) > 0 {
-			label = strings.ToUpper(cat[:1]) + cat[1:]
-		}
-		a.output.Println("%s:", label)
+// localCategory is the category imported stacks are listed under.
+const localCategory = "local"
 
-		for _, e := range entries {
-			status := "  "
-			versionInfo := e.version
-			if e.isInstalled {
-				status = "* "
-				if e.localVersion != e.version {
-					versionInfo = fmt.Sprintf("%s (local: %s)", e.version, e.localVersion)
-				}
+// localStackList returns the imported stacks sorted by ID, in their own category after
+// the registry's stacks.
+func localStackList(ids []string) []stackListEntry {
+	sort.Strings(ids)
+	entries := make([]stackListEntry, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, stackListEntry{
+			ID:           id,
+			Description:  "imported from local files",
+			Version:      config.LocalVersion,
+			Category:     localCategory,
+			Depends:      []string{},
+			Installed:    true,
+			LocalVersion: config.LocalVersion,
+			Local:        true,
+		})
+	}
+	return entries
+}
+
+// ownership describes who owns and maintains a stack, or is empty if the registry doesn't say.
+func ownership(e stackListEntry) string {
+	var parts []string
+	if e.Owner != "" {
+		parts = append(parts, "owner: "+e.Owner)
+	}
+	if len(e.Maintainers) > 0 {
+		parts = append(parts, "maintainers: "+strings.Join(e.Maintainers, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// printStackList prints the default human layout, grouped by category. With verbose, each
+// stack the registry names an owner or maintainers for gets a line saying who.
+func (a *App) printStackList(entries []stackListEntry, installedCount int, verbose bool) {
+	for i, e := range entries {
+		if i == 0 || entries[i-1].Category != e.Category {
+			if i > 0 {
+				a.output.Println("")
 			}
+			label := e.Category
+			if len(label) > 0 {
+				label = strings.ToUpper(label[:1]) + label[1:]
+				a.output.Println("%s:", label)
+			}
+		}
 
-			deps := ""
-			if len(e.depends) > 0 {
-				deps = fmt.Sprintf(" (depends: %s)", strings.Join(e.depends, ", "))
+		status := "  "
+		versionInfo := e.Version
+		if e.Installed {
+			status = "* "
+			if e.LocalVersion != e.Version {
+				versionInfo = fmt.Sprintf("%s (local: %s)", e.Version, e.LocalVersion)
 			}
+		}
+
+		deps := ""
+		if len(e.Depends) > 0 {
+			deps = fmt.Sprintf(" (depends: %s)", strings.Join(e.Depends, ", "))
+		}
 
-			a.output.Println("  %s%-14s %s  %s%s", status, e.id, versionInfo, e.description, deps)
+		a.output.Println("  %s%-14s %s  %s%s", status, e.ID, versionInfo, e.Description, deps)
+		if owner := ownership(e); verbose && owner != "" {
+			a.output.Println("    %-14s %s", "", owner)
 		}
+	}
+	if len(entries) > 0 {
 		a.output.Println("")
 	}
 
-	installedCount := len(installed)
-	totalCount := len(reg.Stacks)
 	if installedCount > 0 {
-		a.output.Println("* = installed (%d/%d)", installedCount, totalCount)
+		a.output.Println("* = installed (%d/%d)", installedCount, len(entries))
 	} else {
-		a.output.Println("%d stacks available", totalCount)
+		a.output.Println("%d stacks available", len(entries))
 	}
-
-	return nil
 }
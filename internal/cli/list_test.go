@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+func TestBuildStackList(t *testing.T) {
+	reg := &registry.Registry{
+		Stacks: map[string]registry.StackMeta{
+			"vue":     {Version: "1.0.0", Category: "frontend"},
+			"php":     {Version: "1.2.0", Category: "backend"},
+			"laravel": {Version: "2.0.0", Category: "backend", Depends: []string{"php"}},
+		},
+	}
+
+	entries := buildStackList(reg, map[string]string{"php": "1.1.0"})
+
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	want := []string{"laravel", "php", "vue"}
+	if len(ids) != len(want) {
+		t.Fatalf("ids = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("ids = %v, want %v", ids, want)
+		}
+	}
+
+	if !entries[1].Installed || entries[1].LocalVersion != "1.1.0" {
+		t.Errorf("php entry = %+v, want installed at 1.1.0", entries[1])
+	}
+	if entries[0].Installed {
+		t.Error("laravel should not be installed")
+	}
+
+	data, err := json.Marshal(entries[2])
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want2 := `{"id":"vue","name":"","description":"","version":"1.0.0","category":"frontend","depends":[],"installed":false}`
+	if string(data) != want2 {
+		t.Errorf("JSON = %s, want %s", data, want2)
+	}
+}
+
+func TestBuildStackListOwner(t *testing.T) {
+	reg := &registry.Registry{
+		Stacks: map[string]registry.StackMeta{
+			"php": {Version: "1.2.0", Category: "backend", Owner: "team-backend", Maintainers: []string{"alice", "bob"}},
+		},
+	}
+
+	entries := buildStackList(reg, nil)
+	data, err := json.Marshal(entries[0])
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"id":"php","name":"","description":"","version":"1.2.0","category":"backend","depends":[],"installed":false,"owner":"team-backend","maintainers":["alice","bob"]}`
+	if string(data) != want {
+		t.Errorf("JSON = %s, want %s", data, want)
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry stackListEntry
+		want  string
+	}{
+		{name: "none", entry: stackListEntry{ID: "php"}},
+		{name: "owner", entry: stackListEntry{Owner: "team-backend"}, want: "owner: team-backend"},
+		{name: "maintainers", entry: stackListEntry{Maintainers: []string{"alice", "bob"}}, want: "maintainers: alice, bob"},
+		{
+			name:  "both",
+			entry: stackListEntry{Owner: "team-backend", Maintainers: []string{"alice"}},
+			want:  "owner: team-backend; maintainers: alice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ownership(tt.entry); got != tt.want {
+				t.Errorf("ownership() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterStackList(t *testing.T) {
+	entries := []stackListEntry{
+		{ID: "laravel", Category: "backend"},
+		{ID: "php", Category: "backend", Installed: true},
+		{ID: "vue", Category: "frontend", Installed: true},
+	}
+
+	tests := []struct {
+		name      string
+		category  string
+		installed bool
+		want      []string
+	}{
+		{name: "no filter", want: []string{"laravel", "php", "vue"}},
+		{name: "category", category: "backend", want: []string{"laravel", "php"}},
+		{name: "category ignores case", category: "Frontend", want: []string{"vue"}},
+		{name: "installed", installed: true, want: []string{"php", "vue"}},
+		{name: "category and installed", category: "backend", installed: true, want: []string{"php"}},
+		{name: "unknown category", category: "mobile", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []string{}
+			for _, e := range filterStackList(entries, tt.category, tt.installed) {
+				ids = append(ids, e.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("filterStackList() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
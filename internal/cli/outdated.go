@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/spf13/cobra"
+)
+
+// outdatedStack is an installed stack whose locked version differs from the registry.
+type outdatedStack struct {
+	ID     string
+	Locked string
+	Latest string
+}
+
+// Statuses of an installed stack in outdated --json.
+const (
+	statusOutdated = "outdated"
+	statusCurrent  = "current"
+	statusRemoved  = "removed" // no longer in the registry
+	statusLocal    = "local"   // imported, not from the registry
+)
+
+// outdatedEntry is one installed stack as emitted by outdated --json.
+type outdatedEntry struct {
+	Stack   string   `json:"stack"`
+	Locked  string   `json:"locked"`
+	Latest  string   `json:"latest,omitempty"`
+	Status  string   `json:"status"`
+	Added   []string `json:"added,omitempty"`   // with --verbose, files new in latest
+	Removed []string `json:"removed,omitempty"` // with --verbose, files dropped in latest
+}
+
+// outdatedOptions holds the flags for outdated.
+type outdatedOptions struct {
+	verbose  bool
+	json     bool
+	exitCode bool
+}
+
+func (a *App) newOutdatedCmd() *cobra.Command {
+	var opts outdatedOptions
+
+	cmd := &cobra.Command{
+		Use:   "outdated",
+		Short: "Show installed stacks with a newer registry version",
+		Long:  "Compares the locked version of each installed stack with the registry.\nUse --verbose to also fetch the latest manifests and list the files added or removed since the locked version.\nWith --json, every installed stack is printed with its status: outdated, current, removed or local.\nWith --exit-code, the exit code is 1 if any stack is outdated or removed, for scripts.",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runOutdated(cmd.Context(), opts)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "list files added or removed in the latest version")
+	cmd.Flags().BoolVar(&opts.json, "json", false, "print every installed stack and its status as JSON")
+	cmd.Flags().BoolVar(&opts.exitCode, "exit-code", false, "exit with 1 if a stack is outdated or no longer in the registry")
+	return cmd
+}
+
+func (a *App) runOutdated(ctx context.Context, opts outdatedOptions) error {
+	if err := a.RequireProject(); err != nil {
+		return err
+	}
+	if a.offline && (opts.json || opts.exitCode) {
+		flag := "--json"
+		if !opts.json {
+			flag = "--exit-code"
+		}
+		return &ExitError{Code: exitcodes.NetworkError, Message: "outdated " + flag + " needs the registry, which --offline disables"}
+	}
+	if a.offline {
+		a.output.Warning("Offline — cannot check for newer versions")
+		return nil
+	}
+
+	client, err := a.newRegistryClient()
+	if err != nil {
+		return err
+	}
+	reg, err := a.fetchRegistry(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	entries := outdatedEntries(reg, a.config.Resolved)
+	if opts.json {
+		if err := a.printOutdatedJSON(ctx, client, entries, opts.verbose); err != nil {
+			return err
+		}
+	} else {
+		a.printOutdated(ctx, client, findOutdated(reg, a.config.Resolved), removedStacks(entries), opts.verbose)
+	}
+
+	if opts.exitCode {
+		return outdatedExitError(entries)
+	}
+	return nil
+}
+
+// printOutdated prints the outdated stacks as a table, with their file changes if verbose,
+// and warns about the installed stacks that are no longer in the registry.
+func (a *App) printOutdated(ctx context.Context, client *registry.Client, stacks []outdatedStack, removed []string, verbose bool) {
+	if len(stacks) == 0 && len(removed) == 0 {
+		a.output.Success("All stacks are up to date")
+		return
+	}
+	if len(removed) > 0 {
+		a.output.Warning("No longer in the registry: %s", strings.Join(removed, ", "))
+	}
+	if len(stacks) == 0 {
+		return
+	}
+
+	rows := make([][]string, 0, len(stacks))
+	for _, s := range stacks {
+		rows = append(rows, []string{s.ID, s.Locked, s.Latest})
+	}
+	a.output.Table([]string{"STACK", "LOCKED", "LATEST"}, rows)
+
+	if !verbose {
+		return
+	}
+	for _, s := range stacks {
+		manifest, err := client.FetchStackManifest(ctx, s.ID)
+		if err != nil {
+			a.output.Warning("%s: fetching manifest: %v", s.ID, err)
+			continue
+		}
+		added, removed := config.FileChanges(a.config.Resolved[s.ID].Files, manifest.Files)
+
+		a.output.Println("")
+		a.output.Println("%s %s → %s:", s.ID, s.Locked, s.Latest)
+		if len(added) == 0 && len(removed) == 0 {
+			a.output.Println("  no files added or removed")
+		}
+		for _, f := range added {
+			a.output.Println("  + %s", f)
+		}
+		for _, f := range removed {
+			a.output.Println("  - %s", f)
+		}
+	}
+}
+
+// printOutdatedJSON prints every installed stack and its status as JSON, with the file
+// changes of the outdated ones if verbose.
+func (a *App) printOutdatedJSON(ctx context.Context, client *registry.Client, entries []outdatedEntry, verbose bool) error {
+	if verbose {
+		for i, e := range entries {
+			if e.Status != statusOutdated {
+				continue
+			}
+			manifest, err := client.FetchStackManifest(ctx, e.Stack)
+			if err != nil {
+				return registryError(err)
+			}
+			entries[i].Added, entries[i].Removed = config.FileChanges(a.config.Resolved[e.Stack].Files, manifest.Files)
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// removedStacks returns the stacks of entries that are no longer in the registry.
+func removedStacks(entries []outdatedEntry) []string {
+	var removed []string
+	for _, e := range entries {
+		if e.Status == statusRemoved {
+			removed = append(removed, e.Stack)
+		}
+	}
+	return removed
+}
+
+// outdatedExitError returns the error outdated --exit-code fails with when a stack is
+// outdated or no longer in the registry, or nil if every stack is current.
+func outdatedExitError(entries []outdatedEntry) error {
+	var outdated []string
+	for _, e := range entries {
+		if e.Status == statusOutdated {
+			outdated = append(outdated, e.Stack)
+		}
+	}
+	removed := removedStacks(entries)
+	if len(outdated) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	var parts []string
+	if len(outdated) > 0 {
+		parts = append(parts, "outdated: "+strings.Join(outdated, ", "))
+	}
+	if len(removed) > 0 {
+		parts = append(parts, "no longer in registry: "+strings.Join(removed, ", "))
+	}
+	return &ExitError{Code: exitcodes.VerificationFailed, Message: strings.Join(parts, "; ")}
+}
+
+// findOutdated returns the installed stacks whose registry version differs from the
+// locked one, sorted by ID. Stacks no longer in the registry and imported stacks are skipped.
+func findOutdated(reg *registry.Registry, resolved map[string]config.ResolvedStack) []outdatedStack {
+	var stacks []outdatedStack
+	for id, rs := range resolved {
+		meta, ok := reg.Stacks[id]
+		if !ok || rs.Local || meta.Version == rs.Version {
+			continue
+		}
+		stacks = append(stacks, outdatedStack{ID: id, Locked: rs.Version, Latest: meta.Version})
+	}
+	sort.Slice(stacks, func(i, j int) bool { return stacks[i].ID < stacks[j].ID })
+	return stacks
+}
+
+// outdatedEntries returns every installed stack with its status against the registry,
+// sorted by ID.
+func outdatedEntries(reg *registry.Registry, resolved map[string]config.ResolvedStack) []outdatedEntry {
+	entries := make([]outdatedEntry, 0, len(resolved))
+	for id, rs := range resolved {
+		e := outdatedEntry{Stack: id, Locked: rs.Version}
+		meta, ok := reg.Stacks[id]
+		switch {
+		case rs.Local:
+			e.Status = statusLocal
+		case !ok:
+			e.Status = statusRemoved
+		case meta.Version != rs.Version:
+			e.Latest, e.Status = meta.Version, statusOutdated
+		default:
+			e.Latest, e.Status = meta.Version, statusCurrent
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Stack < entries[j].Stack })
+	return entries
+}
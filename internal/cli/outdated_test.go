@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+func TestFindOutdated(t *testing.T) {
+	reg := &registry.Registry{
+		Stacks: map[string]registry.StackMeta{
+			"php":     {Version: "1.2.0"},
+			"laravel": {Version: "1.4.0"},
+			"vue":     {Version: "1.0.0"},
+		},
+	}
+	resolved := map[string]config.ResolvedStack{
+		"php":     {Version: "1.1.0"},
+		"laravel": {Version: "1.3.0"},
+		"vue":     {Version: "1.0.0"},
+		"removed": {Version: "0.1.0"},
+	}
+
+	got := findOutdated(reg, resolved)
+	want := []outdatedStack{
+		{ID: "laravel", Locked: "1.3.0", Latest: "1.4.0"},
+		{ID: "php", Locked: "1.1.0", Latest: "1.2.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findOutdated() = %+v, want %+v", got, want)
+	}
+}
+
+func TestOutdatedEntries(t *testing.T) {
+	reg := &registry.Registry{
+		Stacks: map[string]registry.StackMeta{
+			"php": {Version: "1.2.0"},
+			"vue": {Version: "1.0.0"},
+		},
+	}
+	resolved := map[string]config.ResolvedStack{
+		"php":     {Version: "1.1.0"},
+		"vue":     {Version: "1.0.0"},
+		"removed": {Version: "0.1.0"},
+		"team":    {Version: config.LocalVersion, Local: true},
+	}
+
+	got := outdatedEntries(reg, resolved)
+	want := []outdatedEntry{
+		{Stack: "php", Locked: "1.1.0", Latest: "1.2.0", Status: statusOutdated},
+		{Stack: "removed", Locked: "0.1.0", Status: statusRemoved},
+		{Stack: "team", Locked: config.LocalVersion, Status: statusLocal},
+		{Stack: "vue", Locked: "1.0.0", Latest: "1.0.0", Status: statusCurrent},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("outdatedEntries() = %+v, want %+v", got, want)
+	}
+}
+
+func TestOutdatedExitError(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []outdatedEntry
+		want    string
+	}{
+		{
+			name: "current",
+			entries: []outdatedEntry{
+				{Stack: "vue", Status: statusCurrent},
+				{Stack: "team", Status: statusLocal},
+			},
+		},
+		{
+			name: "outdated",
+			entries: []outdatedEntry{
+				{Stack: "laravel", Status: statusOutdated},
+				{Stack: "php", Status: statusOutdated},
+				{Stack: "vue", Status: statusCurrent},
+			},
+			want: "outdated: laravel, php",
+		},
+		{
+			name: "outdated and removed",
+			entries: []outdatedEntry{
+				{Stack: "php", Status: statusOutdated},
+				{Stack: "removed", Status: statusRemoved},
+			},
+			want: "outdated: php; no longer in registry: removed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := outdatedExitError(tt.entries)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("outdatedExitError() = %v, want nil", err)
+				}
+				return
+			}
+			var exitErr *ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("outdatedExitError() = %v, want *ExitError", err)
+			}
+			if exitErr.Code != exitcodes.VerificationFailed || exitErr.Message != tt.want {
+				t.Errorf("outdatedExitError() = {%d %q}, want {%d %q}", exitErr.Code, exitErr.Message, exitcodes.VerificationFailed, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutdatedReportsRemovedStacks(t *testing.T) {
+	server := setupTestRegistry(t)
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := runApp(t, dir, server.URL, server.Client(), "init", "vue"); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	// Serve the same registry without vue
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "registry", "company-instructions", "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reg map[string]any
+	if err := json.Unmarshal(data, &reg); err != nil {
+		t.Fatal(err)
+	}
+	delete(reg["stacks"].(map[string]any), "vue")
+	withoutVue, err := json.Marshal(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pruned := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(withoutVue)
+	}))
+	defer pruned.Close()
+
+	// Capture stdout and stderr; the UI writes to them directly
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	err = runApp(t, dir, pruned.URL, pruned.Client(), "outdated", "--exit-code")
+	os.Stdout, os.Stderr = stdout, stderr
+	w.Close()
+	out, readErr := io.ReadAll(r)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+
+	if got := exitCode(err); got != exitcodes.VerificationFailed {
+		t.Errorf("outdated --exit-code exit code = %d, want %d", got, exitcodes.VerificationFailed)
+	}
+	if strings.Contains(string(out), "up to date") {
+		t.Errorf("outdated should not report success with a removed stack, got:\n%s", out)
+	}
+	if !strings.Contains(string(out), "No longer in the registry: vue") {
+		t.Errorf("outdated should list the removed stack, got:\n%s", out)
+	}
+}
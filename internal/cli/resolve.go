@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/resolver"
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newResolveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "resolve <stack> [stack...]",
+		Short:  "Show how stacks resolve against the registry",
+		Long:   "Resolves the given stacks against the registry and prints the install order, the explicit stacks and\nthe stack each dependency is attributed to. Nothing in the project is read or written.\nUseful for debugging dependency problems in a registry.",
+		Hidden: true,
+		Args:   usageArgs(cobra.MinimumNArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runResolve(cmd.Context(), args)
+		},
+	}
+	cmd.ValidArgsFunction = a.completeRegistryStacks
+	return cmd
+}
+
+func (a *App) runResolve(ctx context.Context, stacks []string) error {
+	client, err := a.newRegistryClient()
+	if err != nil {
+		return err
+	}
+
+	reg, err := a.fetchRegistry(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	res, err := engine.Resolve(reg, stacks)
+	if err != nil {
+		return resolutionError(err)
+	}
+
+	for _, line := range resolutionLines(res) {
+		a.output.Println("%s", line)
+	}
+	return nil
+}
+
+// resolutionLines formats a resolution: the numbered install order, the explicit stacks
+// and the dependency_of attribution of every other stack, in install order.
+func resolutionLines(res *resolver.Resolution) []string {
+	lines := []string{"Order:"}
+	for i, id := range res.Order {
+		lines = append(lines, fmt.Sprintf("  %d. %s", i+1, id))
+	}
+
+	explicit := make([]string, 0, len(res.Explicit))
+	for id := range res.Explicit {
+		explicit = append(explicit, id)
+	}
+	sort.Strings(explicit)
+	lines = append(lines, "Explicit: "+strings.Join(explicit, ", "))
+
+	lines = append(lines, "Dependency of:")
+	if len(res.DependencyOf) == 0 {
+		return append(lines, "  (none)")
+	}
+	for _, id := range res.Order {
+		if parent, ok := res.DependencyOf[id]; ok {
+			lines = append(lines, fmt.Sprintf("  %s → %s", id, parent))
+		}
+	}
+	return lines
+}
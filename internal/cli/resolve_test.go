@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/resolver"
+)
+
+func TestResolutionLines(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *resolver.Resolution
+		want []string
+	}{
+		{
+			name: "with dependencies",
+			res: &resolver.Resolution{
+				Order:        []string{"php", "laravel", "vue"},
+				Explicit:     map[string]bool{"vue": true, "laravel": true},
+				DependencyOf: map[string]string{"php": "laravel"},
+			},
+			want: []string{
+				"Order:",
+				"  1. php",
+				"  2. laravel",
+				"  3. vue",
+				"Explicit: laravel, vue",
+				"Dependency of:",
+				"  php → laravel",
+			},
+		},
+		{
+			name: "no dependencies",
+			res: &resolver.Resolution{
+				Order:        []string{"go"},
+				Explicit:     map[string]bool{"go": true},
+				DependencyOf: map[string]string{},
+			},
+			want: []string{"Order:", "  1. go", "Explicit: go", "Dependency of:", "  (none)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolutionLines(tt.res); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolutionLines() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,29 +1,65 @@
 package cli
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/engine"
 	"github.com/cego/ai-instructions/internal/exitcodes"
 	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/cego/ai-instructions/internal/resolver"
 	"github.com/cego/ai-instructions/internal/ui"
 	"github.com/spf13/cobra"
 )
 
+// Credential sources for --credentials-from.
+const (
+	credentialsNetrc = "netrc"
+	credentialsGit   = "git"
+)
+
 // App is the dependency container for all CLI commands.
 type App struct {
-	rootCmd  *cobra.Command
-	version  string
-	commit   string
-	date     string
-	config   *config.Config
-	output   *ui.Output
+	rootCmd     *cobra.Command
+	version     string
+	commit      string
+	date        string
+	config      *config.Config
+	global      *config.GlobalConfig
+	output      *ui.Output
 	projectDir  string
+	configFile  string // --config, "" for the default
 	registryURL string
+	projectID   string
 	branch      string
 	token       string
+	credsFrom   string
+	timeout     string // --timeout, "" for the client default
 	debug       bool
+	offline     bool
+
+	// stackBranches are per-stack branch overrides given on the command line,
+	// taking precedence over the config's stack_branches.
+	stackBranches map[string]string
+
+	// noHooks skips the config's hooks for this run.
+	noHooks bool
+
+	// verifyRegistry requires registry.json checksums, in addition to the config's verify_registry.
+	verifyRegistry bool
+
+	// registryOpts are appended to every registry client (used by tests).
+	registryOpts []registry.Option
 }
 
 // NewApp creates the root command and registers all subcommands.
@@ -33,8 +69,10 @@ func NewApp(version, commit, date string) *App {
 		commit:  commit,
 		date:    date,
 		output:  ui.NewOutput(),
+		global:  &config.GlobalConfig{},
 	}
 
+	var quiet bool
 	root := &cobra.Command{
 		Use:   "ai-instructions",
 		Short: "Package manager for AI coding instruction files",
@@ -43,19 +81,41 @@ func NewApp(version, commit, date string) *App {
 			if envURL := os.Getenv("AI_INSTRUCTIONS_REGISTRY"); envURL != "" && app.registryURL == "" {
 				app.registryURL = envURL
 			}
+			if envID := os.Getenv("AI_INSTRUCTIONS_PROJECT_ID"); envID != "" && app.projectID == "" {
+				app.projectID = envID
+			}
 			if envBranch := os.Getenv("AI_INSTRUCTIONS_BRANCH"); envBranch != "" && app.branch == "" {
 				app.branch = envBranch
 			}
 			if envToken := os.Getenv("AI_INSTRUCTIONS_TOKEN"); envToken != "" && app.token == "" {
 				app.token = envToken
 			}
+			if envCreds := os.Getenv("AI_INSTRUCTIONS_CREDENTIALS_FROM"); envCreds != "" && app.credsFrom == "" {
+				app.credsFrom = envCreds
+			}
+			if envTimeout := os.Getenv("AI_INSTRUCTIONS_TIMEOUT"); envTimeout != "" && app.timeout == "" {
+				app.timeout = envTimeout
+			}
 			if os.Getenv("AI_INSTRUCTIONS_DEBUG") != "" {
 				app.debug = true
 			}
+			if os.Getenv("AI_INSTRUCTIONS_OFFLINE") != "" {
+				app.offline = true
+			}
+			if os.Getenv("AI_INSTRUCTIONS_QUIET") != "" {
+				quiet = true
+			}
+			app.output.SetQuiet(quiet)
 			if os.Getenv("AI_INSTRUCTIONS_NO_COLOR") != "" || os.Getenv("NO_COLOR") != "" {
 				app.output.SetNoColor(true)
 			}
 
+			if g, err := config.LoadGlobalConfig(); err != nil {
+				app.output.Warning("Ignoring user config: %v", err)
+			} else {
+				app.global = g
+			}
+
 			// Eagerly load config (ignore errors — commands that need it will call RequireProject)
 			_ = app.LoadProjectConfig()
 		},
@@ -63,17 +123,43 @@ func NewApp(version, commit, date string) *App {
 		SilenceErrors: true,
 	}
 
+	root.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &ExitError{Code: exitcodes.UsageError, Message: err.Error()}
+	})
+
 	root.PersistentFlags().StringVar(&app.registryURL, "registry", "", "registry URL (overrides AI_INSTRUCTIONS_REGISTRY)")
+	root.PersistentFlags().StringVar(&app.projectID, "project-id", "", "numeric GitLab project ID of the registry, for when its path doesn't work (overrides AI_INSTRUCTIONS_PROJECT_ID)")
 	root.PersistentFlags().StringVar(&app.branch, "branch", "", "registry branch (default: master, overrides AI_INSTRUCTIONS_BRANCH)")
 	root.PersistentFlags().StringVar(&app.token, "token", "", "auth token (overrides AI_INSTRUCTIONS_TOKEN)")
+	root.PersistentFlags().StringVar(&app.credsFrom, "credentials-from", "", "look up the token in netrc or git unless --token or AI_INSTRUCTIONS_TOKEN is set (overrides AI_INSTRUCTIONS_CREDENTIALS_FROM)")
+	root.PersistentFlags().StringVar(&app.timeout, "timeout", "", "timeout of each registry request, e.g. 10s; 0 disables it (default 30s, overrides AI_INSTRUCTIONS_TIMEOUT)")
 	root.PersistentFlags().BoolVar(&app.debug, "debug", false, "enable debug logging")
+	root.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "only print warnings and errors (or AI_INSTRUCTIONS_QUIET)")
+	root.PersistentFlags().BoolVar(&app.offline, "offline", false, "never contact the registry; work from the locked config (or AI_INSTRUCTIONS_OFFLINE)")
+	root.PersistentFlags().BoolVar(&app.verifyRegistry, "verify-registry", false, "require registry.json to match its published registry.json.sha256")
+	root.PersistentFlags().BoolVar(&app.noHooks, "no-hooks", false, "don't run the hooks configured in ai-instructions.yml")
 	root.PersistentFlags().StringVar(&app.projectDir, "dir", ".", "project directory")
+	root.PersistentFlags().StringVar(&app.configFile, "config", "", "config file, relative to the project directory (default "+config.ConfigFile+")")
 
 	root.AddCommand(
 		app.newInitCmd(),
 		app.newSyncCmd(),
+		app.newUpdateCmd(),
+		app.newImportCmd(),
 		app.newVerifyCmd(),
+		app.newValidateCmd(),
 		app.newListCmd(),
+		app.newOutdatedCmd(),
+		app.newSearchCmd(),
+		app.newWhyCmd(),
+		app.newGraphCmd(),
+		app.newResolveCmd(),
+		app.newFilesCmd(),
+		app.newAuditCmd(),
+		app.newBundleCmd(),
+		app.newStatusCmd(),
+		app.newDoctorCmd(),
+		app.newCleanCmd(),
 		app.newVersionCmd(),
 	)
 
@@ -81,17 +167,25 @@ func NewApp(version, commit, date string) *App {
 	return app
 }
 
-// Execute runs the root command.
+// Execute runs the root command. Ctrl-C cancels the command's context, and
+// the command then exits with the aborted code.
 func (a *App) Execute() error {
-	return a.rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := a.rootCmd.ExecuteContext(ctx)
+	if err != nil && (errors.Is(err, ui.ErrAborted) || ctx.Err() != nil) {
+		return &ExitError{Code: exitcodes.Aborted, Message: "aborted"}
+	}
+	return err
 }
 
 // LoadProjectConfig loads the config file. Falls back to migration from old settings.
 // If a separate old lockfile exists and the config has no resolved data, absorbs it.
 // Returns nil error if no config is found.
 func (a *App) LoadProjectConfig() error {
-	if config.ConfigExists(a.projectDir) {
-		c, err := config.LoadConfig(a.projectDir)
+	if config.FileExists(a.configPath()) {
+		c, err := config.LoadFile(a.configPath())
 		if err != nil {
 			return err
 		}
@@ -107,8 +201,8 @@ func (a *App) LoadProjectConfig() error {
 		return nil
 	}
 
-	// Try migrating from old settings
-	if config.OldSettingsExists(a.projectDir) {
+	// Try migrating from old settings, which only ever used the default config name
+	if a.configFile == "" && config.OldSettingsExists(a.projectDir) {
 		c, err := config.MigrateFromOldSettings(a.projectDir)
 		if err != nil {
 			return err
@@ -130,7 +224,7 @@ func (a *App) RequireProject() error {
 	if a.config == nil {
 		return &ExitError{
 			Code:    exitcodes.ConfigError,
-			Message: "no " + config.ConfigFile + " found — run 'ai-instructions init' first",
+			Message: "no " + a.configName() + " found — run 'ai-instructions init' first",
 		}
 	}
 
@@ -144,7 +238,8 @@ func (a *App) RequireProject() error {
 	return nil
 }
 
-// getBranch returns the effective branch name.
+// getBranch returns the effective branch name: --branch or AI_INSTRUCTIONS_BRANCH, then
+// the project config, then the user config, then the default.
 func (a *App) getBranch() string {
 	if a.branch != "" {
 		return a.branch
@@ -152,15 +247,22 @@ func (a *App) getBranch() string {
 	if a.config != nil && a.config.Registry.Branch != "" {
 		return a.config.Registry.Branch
 	}
+	if a.global.Registry.Branch != "" {
+		return a.global.Registry.Branch
+	}
 	return config.DefaultBranch
 }
 
-// getProjectURL returns the effective GitLab project URL (without branch path).
+// getProjectURL returns the effective GitLab project URL (without branch path), with the
+// same precedence as getBranch.
 func (a *App) getProjectURL() string {
 	base := a.registryURL
 	if base == "" && a.config != nil {
 		base = a.config.Registry.URL
 	}
+	if base == "" {
+		base = a.global.Registry.URL
+	}
 	if base == "" {
 		base = config.DefaultRegistryURL
 	}
@@ -168,6 +270,57 @@ func (a *App) getProjectURL() string {
 	return strings.TrimRight(base, "/")
 }
 
+// getToken returns the registry token: --token or AI_INSTRUCTIONS_TOKEN, then the user
+// config. Project configs are committed, so they never hold a token.
+func (a *App) getToken() string {
+	if a.token != "" {
+		return a.token
+	}
+	return a.global.Token
+}
+
+// getProjectID returns the registry's numeric GitLab project ID, if one is set:
+// --project-id or AI_INSTRUCTIONS_PROJECT_ID, then the project config.
+func (a *App) getProjectID() string {
+	if a.projectID != "" {
+		return a.projectID
+	}
+	if a.config != nil {
+		return a.config.Registry.ProjectID
+	}
+	return ""
+}
+
+// isProjectID reports whether id is a numeric GitLab project ID.
+func isProjectID(id string) bool {
+	_, err := strconv.ParseUint(id, 10, 64)
+	return err == nil
+}
+
+// registryHost returns the scheme and host of a registry URL.
+func registryHost(projectURL string) string {
+	u, err := url.Parse(projectURL)
+	if err != nil {
+		return projectURL
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// getStackBranches returns the per-stack branch overrides: the config's stack_branches
+// with command-line overrides applied on top.
+func (a *App) getStackBranches() map[string]string {
+	branches := make(map[string]string)
+	if a.config != nil {
+		for id, b := range a.config.StackBranches {
+			branches[id] = b
+		}
+	}
+	for id, b := range a.stackBranches {
+		branches[id] = b
+	}
+	return branches
+}
+
 // getInstructionsDir returns the effective top-level instructions directory.
 func (a *App) getInstructionsDir() string {
 	if a.config != nil && a.config.InstructionsDir != "" {
@@ -176,10 +329,30 @@ func (a *App) getInstructionsDir() string {
 	return config.DefaultInstructionsDir
 }
 
+// configPath returns the path of the config file: --config, taken relative to the
+// project dir, or ai-instructions.yml in the project dir.
+func (a *App) configPath() string {
+	if a.configFile == "" {
+		return filepath.Join(a.projectDir, config.ConfigFile)
+	}
+	if filepath.IsAbs(a.configFile) {
+		return a.configFile
+	}
+	return filepath.Join(a.projectDir, a.configFile)
+}
+
+// configName returns the config file as the user refers to it, for messages.
+func (a *App) configName() string {
+	if a.configFile == "" {
+		return config.ConfigFile
+	}
+	return a.configFile
+}
+
 // getManagedDir returns the managed subdirectory path within the instructions dir.
 // This is where registry-downloaded files live and can be safely wiped on sync.
 func (a *App) getManagedDir() string {
-	return a.getInstructionsDir() + "/" + config.ManagedDir
+	return engine.ManagedDir(a.config)
 }
 
 // newRegistryClient creates a registry client with the current settings.
@@ -191,14 +364,162 @@ func (a *App) newRegistryClient() (*registry.Client, error) {
 			Message: "registry URL not set — use --registry flag or AI_INSTRUCTIONS_REGISTRY env var",
 		}
 	}
+	switch a.credsFrom {
+	case "", credentialsNetrc, credentialsGit:
+	default:
+		return nil, &ExitError{
+			Code:    exitcodes.UsageError,
+			Message: fmt.Sprintf("invalid --credentials-from %q: must be %s or %s", a.credsFrom, credentialsNetrc, credentialsGit),
+		}
+	}
+	timeout, hasTimeout, err := a.requestTimeout()
+	if err != nil {
+		return nil, err
+	}
+	var timeoutOpts []registry.Option
+	if hasTimeout {
+		timeoutOpts = append(timeoutOpts, registry.WithTimeout(timeout))
+	}
+
+	if id := a.getProjectID(); id != "" && !isProjectID(id) {
+		return nil, &ExitError{Code: exitcodes.UsageError, Message: fmt.Sprintf("invalid project ID %q: must be numeric", id)}
+	}
+
+	primary := a.registryClientFor(projectURL, a.getProjectID(), a.getBranch(), timeoutOpts...)
+	if a.config == nil || len(a.config.Registries) == 0 {
+		return primary, nil
+	}
+
+	layers := []*registry.Client{primary}
+	for _, r := range a.config.Registries {
+		branch := r.Branch
+		if branch == "" {
+			branch = config.DefaultBranch
+		}
+		layers = append(layers, a.registryClientFor(strings.TrimRight(r.URL, "/"), r.ProjectID, branch, timeoutOpts...))
+	}
+	opts := []registry.Option{registry.WithLayers(layers...), registry.WithStackBranches(a.getStackBranches())}
+	if a.offline {
+		opts = append(opts, registry.WithOffline())
+	}
+	return registry.NewClient(append(opts, a.registryOpts...)...), nil
+}
+
+// registryClientFor creates a client for a single registry project. With a projectID,
+// only the host of projectURL is used. timeoutOpts carry the already validated --timeout.
+func (a *App) registryClientFor(projectURL, projectID, branch string, timeoutOpts ...registry.Option) *registry.Client {
 	opts := []registry.Option{
 		registry.WithProjectURL(projectURL),
-		registry.WithBranch(a.getBranch()),
+		registry.WithBranch(branch),
 	}
-	if a.token != "" {
-		opts = append(opts, registry.WithToken(a.token))
+	if projectID != "" {
+		opts = []registry.Option{registry.WithProjectID(registryHost(projectURL), projectID, branch)}
+	}
+	if dir, ok := strings.CutPrefix(projectURL, "file://"); ok {
+		opts = []registry.Option{registry.WithLocalDir(dir)}
+	}
+	if branches := a.getStackBranches(); len(branches) > 0 {
+		opts = append(opts, registry.WithStackBranches(branches))
+	}
+	if a.offline {
+		opts = append(opts, registry.WithOffline())
+	}
+	opts = append(opts, registry.WithLogger(a.output.Warning))
+	if a.verifyRegistry || (a.config != nil && a.config.VerifyRegistry) {
+		opts = append(opts, registry.WithRegistryChecksum())
+	}
+	opts = append(opts, timeoutOpts...)
+	// An explicit token wins over a lookup, and a lookup over the user config's token
+	switch {
+	case a.token == "" && a.credsFrom == credentialsNetrc:
+		opts = append(opts, registry.WithCredentialsFromNetrc())
+	case a.token == "" && a.credsFrom == credentialsGit:
+		opts = append(opts, registry.WithCredentialsFromGit())
+	case a.getToken() != "":
+		opts = append(opts, registry.WithToken(a.getToken()))
+	}
+	opts = append(opts, a.registryOpts...)
+	return registry.NewClient(opts...)
+}
+
+// requestTimeout parses --timeout. ok is false when none was given.
+func (a *App) requestTimeout() (timeout time.Duration, ok bool, err error) {
+	if a.timeout == "" {
+		return 0, false, nil
+	}
+	timeout, err = time.ParseDuration(a.timeout)
+	if err != nil || timeout < 0 {
+		return 0, false, &ExitError{
+			Code:    exitcodes.UsageError,
+			Message: fmt.Sprintf("invalid --timeout %q: must be a duration such as 10s or 2m, or 0 for none", a.timeout),
+		}
+	}
+	return timeout, true, nil
+}
+
+// fetchRegistry fetches the registry, reporting failures with registryError's exit codes.
+func (a *App) fetchRegistry(ctx context.Context, client *registry.Client) (*registry.Registry, error) {
+	reg, err := client.FetchRegistry(ctx)
+	if err != nil {
+		return nil, registryError(err)
+	}
+	return reg, nil
+}
+
+// registryError maps a failed registry request to an exit error. Rejected credentials and a
+// missing or invalid registry are config errors, since retrying won't help; other failures
+// are network errors, pointing at --offline when that is what prevented the request.
+func registryError(err error) error {
+	if errors.Is(err, registry.ErrOffline) {
+		return &ExitError{Code: exitcodes.NetworkError, Message: "this command needs the registry, which --offline disables"}
+	}
+	var checksumErr *registry.ChecksumError
+	if errors.As(err, &checksumErr) {
+		return &ExitError{Code: exitcodes.VerificationFailed, Message: err.Error()}
+	}
+	msg := err.Error()
+	if hint := registryHint(err); hint != "" {
+		msg += "\n" + hint
+	}
+	if registry.IsUnauthorized(err) || registry.IsNotFound(err) || registry.IsInvalidResponse(err) {
+		return &ExitError{Code: exitcodes.ConfigError, Message: msg}
+	}
+	return &ExitError{Code: exitcodes.NetworkError, Message: msg}
+}
+
+// registryHint suggests the likely cause of a failed registry request: rejected
+// credentials, a wrong URL or branch, or no connection. It returns "" for other errors.
+func registryHint(err error) string {
+	var netErr net.Error
+	switch {
+	case registry.IsUnauthorized(err):
+		return "Check your token (--token or AI_INSTRUCTIONS_TOKEN)."
+	case registry.IsNotFound(err):
+		return "Check the registry URL and branch."
+	case errors.As(err, &netErr):
+		return "Are you connected to Cego Warp?"
+	}
+	return ""
+}
+
+// usageArgs wraps a cobra argument validator so violations exit with the usage error code.
+func usageArgs(validate cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := validate(cmd, args); err != nil {
+			return &ExitError{Code: exitcodes.UsageError, Message: err.Error()}
+		}
+		return nil
+	}
+}
+
+// resolutionError maps resolver failures to exit errors.
+func resolutionError(err error) error {
+	var missingStack *resolver.MissingStackError
+	var missingDep *resolver.MissingDependencyError
+	if errors.As(err, &missingStack) || errors.As(err, &missingDep) {
+		return &ExitError{Code: exitcodes.StackNotFound, Message: "dependency resolution: " + err.Error()}
 	}
-	return registry.NewClient(opts...), nil
+	return fmt.Errorf("dependency resolution: %w", err)
 }
 
 func (a *App) newVersionCmd() *cobra.Command {
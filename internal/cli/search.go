@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/spf13/cobra"
+)
+
+// Relevance scores for search matches, best first.
+const (
+	scoreExactID     = 100
+	scoreIDPrefix    = 80
+	scoreIDContains  = 60
+	scoreName        = 40
+	scoreDescription = 20
+	scoreCategory    = 10
+)
+
+// searchMatch is a registry stack matching a search query.
+type searchMatch struct {
+	id    string
+	meta  registry.StackMeta
+	score int
+}
+
+func (a *App) newSearchCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search registry stacks",
+		Long:  "Matches the query against stack IDs, names, descriptions and categories.\nResults are ordered by relevance: exact ID, ID prefix, name, then description.",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runSearch(cmd.Context(), args[0])
+		},
+	}
+}
+
+func (a *App) runSearch(ctx context.Context, query string) error {
+	client, err := a.newRegistryClient()
+	if err != nil {
+		return err
+	}
+
+	reg, err := a.fetchRegistry(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	matches := rankStacks(reg, query)
+	if len(matches) == 0 {
+		a.output.Info("No stacks match %q", query)
+		return nil
+	}
+
+	for _, m := range matches {
+		pad := ""
+		if len(m.id) < 14 {
+			pad = strings.Repeat(" ", 14-len(m.id))
+		}
+		a.output.Println("  %s%s %s  %s", a.output.Highlight(m.id, query), pad, m.meta.Version, a.output.Highlight(m.meta.Description, query))
+	}
+	return nil
+}
+
+// rankStacks returns the stacks matching query, most relevant first and by ID within a score.
+// Matching is case-insensitive; each stack is scored by its best matching field.
+func rankStacks(reg *registry.Registry, query string) []searchMatch {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" {
+		return nil
+	}
+
+	var matches []searchMatch
+	for id, meta := range reg.Stacks {
+		if score := relevance(strings.ToLower(id), meta, q); score > 0 {
+			matches = append(matches, searchMatch{id: id, meta: meta, score: score})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].id < matches[j].id
+	})
+	return matches
+}
+
+// relevance scores a stack against a lowercased query; 0 means no match.
+func relevance(id string, meta registry.StackMeta, q string) int {
+	switch {
+	case id == q:
+		return scoreExactID
+	case strings.HasPrefix(id, q):
+		return scoreIDPrefix
+	case strings.Contains(id, q):
+		return scoreIDContains
+	case strings.Contains(strings.ToLower(meta.Name), q):
+		return scoreName
+	case strings.Contains(strings.ToLower(meta.Description), q):
+		return scoreDescription
+	case strings.Contains(strings.ToLower(meta.Category), q):
+		return scoreCategory
+	}
+	return 0
+}
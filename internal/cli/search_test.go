@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+func TestRankStacks(t *testing.T) {
+	reg := &registry.Registry{Stacks: map[string]registry.StackMeta{
+		"testing":     {Name: "Testing", Description: "General test practices", Category: "practice"},
+		"test-utils":  {Name: "Test utilities", Description: "Helpers", Category: "tooling"},
+		"pest":        {Name: "Pest", Description: "Pest test runner conventions", Category: "testing"},
+		"unit-test":   {Name: "Unit", Description: "Unit tests", Category: "practice"},
+		"go":          {Name: "Go", Description: "Go conventions", Category: "language"},
+		"contest":     {Name: "Contest", Description: "Nothing", Category: "misc"},
+		"phpunit":     {Name: "PHPUnit Test Suite", Description: "PHPUnit", Category: "framework"},
+		"laravel-e2e": {Name: "Dusk", Description: "Browser automation", Category: "testing"},
+	}}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "test", want: []string{"test-utils", "testing", "contest", "unit-test", "phpunit", "pest", "laravel-e2e"}},
+		{query: "TESTING", want: []string{"testing", "laravel-e2e", "pest"}},
+		{query: "go", want: []string{"go"}},
+		{query: "cobol", want: nil},
+		{query: "  ", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var got []string
+			for _, m := range rankStacks(reg, tt.query) {
+				got = append(got, m.id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankStacks(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
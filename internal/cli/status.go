@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/filemanager"
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newStatusCmd() *cobra.Command {
+	var check bool
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Summarize the project's instruction setup",
+		Long:  "Prints the registry, installed stacks, the state of the instruction files and the managed target files.\nWorks offline; use --check to also compare locked versions with the registry.\nSee doctor for detailed diagnostics.",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runStatus(cmd.Context(), check)
+		},
+	}
+
+	cmd.Flags().BoolVar(&check, "check", false, "check the registry for newer versions")
+	return cmd
+}
+
+func (a *App) runStatus(ctx context.Context, check bool) error {
+	if err := a.RequireProject(); err != nil {
+		return err
+	}
+
+	a.output.Println("Registry:  %s (branch %s)", a.getProjectURL(), a.getBranch())
+
+	explicit, deps := countStacks(a.config.Resolved)
+	a.output.Println("Stacks:    %d (%d explicit, %d dependencies)", explicit+deps, explicit, deps)
+
+	infos := make(map[string]filemanager.StackVerifyInfo, len(a.config.Resolved))
+	for stackID, rs := range a.config.Resolved {
+		infos[stackID] = filemanager.StackVerifyInfo{Hash: rs.Hash, Files: rs.Files, FileHashes: rs.FileHashes}
+	}
+	var missing, tampered int
+	for _, v := range filemanager.VerifyAll(a.projectDir, a.getManagedDir(), infos) {
+		missing += len(v.Missing)
+		tampered += len(v.Tampered)
+	}
+	files := fmt.Sprintf("%d instruction files", countResolvedFiles(a.config.Resolved))
+	if missing == 0 && tampered == 0 {
+		a.output.Println("Files:     %s, matching the locked versions", files)
+	} else {
+		a.output.Println("Files:     %s, %d missing, %d modified (run: ai-instructions sync)", files, missing, tampered)
+	}
+
+	targets, err := a.statusTargets()
+	if err != nil {
+		return err
+	}
+	a.output.Println("Targets:   %s", targets)
+
+	if !check {
+		a.output.Println("Versions:  not checked (use --check)")
+		return nil
+	}
+	client, err := a.newRegistryClient()
+	if err != nil {
+		return err
+	}
+	reg, err := a.fetchRegistry(ctx, client)
+	if err != nil {
+		return err
+	}
+	if outdated := findOutdated(reg, a.config.Resolved); len(outdated) > 0 {
+		a.output.Println("Versions:  %d stack(s) outdated (run: ai-instructions outdated)", len(outdated))
+	} else {
+		a.output.Println("Versions:  up to date")
+	}
+	return nil
+}
+
+// countStacks returns how many resolved stacks were requested explicitly and how many
+// were pulled in as dependencies.
+func countStacks(resolved map[string]config.ResolvedStack) (explicit, deps int) {
+	for _, rs := range resolved {
+		if rs.Explicit {
+			explicit++
+		} else {
+			deps++
+		}
+	}
+	return explicit, deps
+}
+
+// statusTargets describes each managed target file in one line.
+func (a *App) statusTargets() (string, error) {
+	if !a.config.InjectionEnabled() {
+		return "none (injection disabled)", nil
+	}
+
+	results, err := a.verifyManagedBlocks()
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, v := range results {
+		switch {
+		case v.Skipped:
+			parts = append(parts, v.Filename+" (skipped)")
+		case !v.HasBlock:
+			parts = append(parts, v.Filename+" (no managed block)")
+		case v.Damaged:
+			parts = append(parts, v.Filename+" (damaged)")
+		case v.Stale:
+			parts = append(parts, v.Filename+" (out of date)")
+		default:
+			parts = append(parts, v.Filename)
+		}
+	}
+	return strings.Join(parts, ", "), nil
+}
@@ -0,0 +1,20 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+)
+
+func TestCountStacks(t *testing.T) {
+	resolved := map[string]config.ResolvedStack{
+		"laravel": {Explicit: true},
+		"vue":     {Explicit: true},
+		"php":     {DependencyOf: "laravel"},
+	}
+
+	explicit, deps := countStacks(resolved)
+	if explicit != 2 || deps != 1 {
+		t.Errorf("countStacks() = %d, %d, want 2, 1", explicit, deps)
+	}
+}
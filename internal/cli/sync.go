@@ -2,187 +2,133 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"slices"
 
-	"github.com/cego/ai-instructions/internal/config"
-	"github.com/cego/ai-instructions/internal/filemanager"
-	"github.com/cego/ai-instructions/internal/injector"
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/exitcodes"
 	"github.com/cego/ai-instructions/internal/resolver"
+	"github.com/cego/ai-instructions/internal/ui"
 	"github.com/spf13/cobra"
 )
 
+// syncOptions holds the flags for sync.
+type syncOptions struct {
+	showDiff bool
+	only     []string
+	exclude  []string
+	force    bool
+	noInject bool
+	prune    bool
+}
+
 func (a *App) newSyncCmd() *cobra.Command {
-	return &cobra.Command{
+	var opts syncOptions
+
+	cmd := &cobra.Command{
 		Use:   "sync",
 		Short: "Sync instruction files from registry",
-		Long:  "Downloads latest instruction files and updates managed blocks.",
+		Long:  "Downloads latest instruction files and updates managed blocks.\nUse --only or --exclude to restrict which stacks are checked; managed blocks always list every stack.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return a.runSync(cmd.Context())
+			return a.runSync(cmd.Context(), opts)
 		},
 	}
+
+	cmd.Flags().BoolVar(&opts.showDiff, "show-diff", false, "print a diff of instruction content for each updated stack")
+	cmd.Flags().StringSliceVar(&opts.only, "only", nil, "only sync these stacks (and their dependencies)")
+	cmd.Flags().StringSliceVar(&opts.exclude, "exclude", nil, "sync every stack except these")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "overwrite locally modified instruction files and sync from a changed registry branch without asking")
+	cmd.Flags().BoolVar(&opts.noInject, "no-inject", false, "download instruction files without updating the managed blocks in the target files")
+	cmd.Flags().BoolVar(&opts.prune, "prune", false, "remove stacks that no longer exist in the registry, with their files")
+	cmd.Flags().StringToStringVar(&a.stackBranches, "stack-branch", nil, "fetch a stack from another branch for this run, e.g. laravel=feature/x")
+	return cmd
 }
 
-func (a *App) runSync(ctx context.Context) error {
-	if err := a.RequireProject(); err != nil {
-		return err
+func (a *App) runSync(ctx context.Context, opts syncOptions) error {
+	if len(opts.only) > 0 && len(opts.exclude) > 0 {
+		return &ExitError{Code: exitcodes.UsageError, Message: "--only and --exclude cannot be used together"}
 	}
 
-	managedDir := a.getManagedDir()
-
-	client, err := a.newRegistryClient()
-	if err != nil {
+	if err := a.RequireProject(); err != nil {
 		return err
 	}
 
-	reg, err := client.FetchRegistry(ctx)
-	if err != nil {
-		return err
+	for _, s := range append(append([]string{}, opts.only...), opts.exclude...) {
+		if _, ok := a.config.Resolved[s]; !ok {
+			return &ExitError{Code: exitcodes.UsageError, Message: fmt.Sprintf("stack %q is not installed", s)}
+		}
 	}
 
-	// Re-resolve dependencies (in case registry has changed)
-	stackInfoMap := buildStackInfoMap(reg)
-	res, err := resolver.NewResolver(stackInfoMap).Resolve(a.config.Stacks)
-	if err != nil {
-		return fmt.Errorf("dependency resolution: %w", err)
+	if !opts.force {
+		proceed, err := a.confirmBranchChange(ctx)
+		if err != nil || !proceed {
+			return err
+		}
 	}
 
-	fm := filemanager.NewManager(client, a.projectDir, managedDir)
-
-	var unchanged []string
-	type updateInfo struct {
-		stack      string
-		oldVersion string
-		newVersion string
+	client, err := a.newRegistryClient()
+	if err != nil {
+		return err
 	}
-	var updates []updateInfo
 
+	a.config.LastSyncedBranch = a.getBranch()
 	a.output.Info("Syncing instruction files...")
-	for _, stackID := range res.Order {
-		regMeta, exists := reg.Stacks[stackID]
-		if !exists {
-			a.output.Warning("Stack %q no longer exists in registry, skipping", stackID)
-			continue
-		}
-
-		currentResolved, hasExisting := a.config.Resolved[stackID]
-		a.debugf("sync %s: registry=%s local=%s", stackID, regMeta.Version, currentResolved.Version)
-
-		// Skip download if version matches and local files are intact
-		if hasExisting && currentResolved.Version == regMeta.Version {
-			vInfo := filemanager.StackVerifyInfo{
-				Hash:       currentResolved.Hash,
-				Files:      currentResolved.Files,
-				FileHashes: currentResolved.FileHashes,
-			}
-			result := filemanager.VerifyStack(a.projectDir, managedDir, stackID, vInfo)
-			if result.OK {
-				a.debugf("sync %s: version match + files intact, skipping", stackID)
-				unchanged = append(unchanged, stackID)
-				// Still update explicit/dependency_of in case it changed
-				rs := currentResolved
-				if res.Explicit[stackID] {
-					rs.Explicit = true
-					rs.DependencyOf = ""
-				} else {
-					rs.Explicit = false
-					rs.DependencyOf = res.DependencyOf[stackID]
-				}
-				a.config.Resolved[stackID] = rs
-				continue
+	syncOpts := engine.SyncOptions{
+		Only:             opts.only,
+		Exclude:          opts.exclude,
+		Diff:             opts.showDiff,
+		Force:            opts.force,
+		NoInject:         opts.noInject,
+		Prune:            opts.prune,
+		ConfirmOverwrite: a.overwriteConfirmer(),
+	}
+	result, err := a.newEngine(client).Sync(ctx, a.config, syncOpts)
+	if err != nil {
+		var missing *resolver.MissingStackError
+		if errors.As(err, &missing) && slices.Contains(a.config.Stacks, missing.Stack) {
+			return &ExitError{
+				Code:    exitcodes.StackNotFound,
+				Message: fmt.Sprintf("stack %q no longer exists in registry\nRerun with --prune to remove it from the project.", missing.Stack),
 			}
-			// Files tampered — re-download below
-		}
-
-		manifest, fetchErr := client.FetchStackManifest(ctx, stackID)
-		if fetchErr != nil {
-			return fmt.Errorf("syncing: %w", fetchErr)
-		}
-
-		files := manifest.Files
-
-		if downloadErr := fm.DownloadStack(ctx, stackID, files); downloadErr != nil {
-			return fmt.Errorf("syncing: %w", downloadErr)
-		}
-
-		hash, hashErr := filemanager.HashDir(fm.StackDir(stackID))
-		if hashErr != nil {
-			return fmt.Errorf("syncing: %w", hashErr)
-		}
-		fileHashes, hashErr := filemanager.HashFilesInStack(fm.StackDir(stackID), files)
-		if hashErr != nil {
-			return fmt.Errorf("syncing: %w", hashErr)
-		}
-
-		oldVersion := ""
-		if hasExisting {
-			oldVersion = currentResolved.Version
-		}
-		updates = append(updates, updateInfo{
-			stack:      stackID,
-			oldVersion: oldVersion,
-			newVersion: regMeta.Version,
-		})
-
-		rs := config.ResolvedStack{
-			Version:    regMeta.Version,
-			Hash:       hash,
-			Files:      files,
-			FileHashes: fileHashes,
-			Tools:      toolsConfigFromManifest(manifest.Tools),
 		}
-		if res.Explicit[stackID] {
-			rs.Explicit = true
-		} else {
-			rs.DependencyOf = res.DependencyOf[stackID]
-		}
-		a.config.Resolved[stackID] = rs
-	}
-
-	// Cleanup stale stacks
-	resolvedSet := make(map[string]bool)
-	for _, id := range res.Order {
-		resolvedSet[id] = true
-	}
-	staleRemoved, _ := filemanager.CleanupStaleStacks(a.projectDir, managedDir, resolvedSet)
-	for _, id := range staleRemoved {
-		delete(a.config.Resolved, id)
+		return engineError(err)
 	}
 
-	// Save config
-	if err := config.SaveConfig(a.projectDir, a.config); err != nil {
-		return err
+	a.printUpdateSummary(result)
+	for _, d := range result.Diffs {
+		a.printStackDiff(d)
 	}
+	a.warnDisabledTools(a.config, result.Order, newStacks(result))
+	a.printPostInstallMessages(result, newStacks(result))
 
-	// Cleanup old lockfile if present
-	if config.OldLockfileExists(a.projectDir) {
-		os.Remove(filepath.Join(a.projectDir, config.LockFile))
-	}
+	return a.runHook(ctx, a.config, hookPostSync, updatedStacks(result))
+}
 
-	// Re-inject managed blocks
-	configs := buildInjectorConfigs(res.Order, a.config.Resolved, managedDir)
-	if err := injector.InjectAll(a.projectDir, res.Order, configs, managedDir); err != nil {
-		return err
+// confirmBranchChange reports whether sync may proceed when the registry branch differs
+// from the one the project was last synced from, e.g. after a teammate committed a switch
+// to a feature branch. Outside a terminal the change must be accepted with --force.
+func (a *App) confirmBranchChange(ctx context.Context) (bool, error) {
+	last, branch := a.config.LastSyncedBranch, a.getBranch()
+	if last == "" || last == branch {
+		return true, nil
 	}
 
-	// Print summary
-	if len(updates) > 0 {
-		a.output.Success("Synced %d updated stack(s):", len(updates))
-		for _, u := range updates {
-			if u.oldVersion != "" {
-				a.output.Println("  %s   %s → %s", u.stack, u.oldVersion, u.newVersion)
-			} else {
-				a.output.Println("  %s   (new) %s", u.stack, u.newVersion)
-			}
+	msg := fmt.Sprintf("registry branch changed from %s to %s since the last sync", last, branch)
+	if !ui.IsInteractive() {
+		return false, &ExitError{
+			Code:    exitcodes.VerificationFailed,
+			Message: msg + "\nRerun with --force to sync from " + branch + ".",
 		}
 	}
-	if len(unchanged) > 0 {
-		a.output.Println("\n%d stack(s) unchanged: %v", len(unchanged), unchanged)
+
+	a.output.Warning("The %s", msg)
+	ok, err := a.output.Confirm(ctx, "Sync from "+branch+"?")
+	if err != nil {
+		return false, err
 	}
-	if len(updates) == 0 {
-		a.output.Success("Everything is up to date")
+	if !ok {
+		a.output.Info("Aborted, nothing was synced")
 	}
-
-	return nil
+	return ok, nil
 }
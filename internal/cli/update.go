@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newUpdateCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "update <stack> [stack...]",
+		Short: "Update specific stacks to their latest registry version",
+		Long:  "Downloads the latest version of the named stacks (and any newly required dependencies).\nAll other stacks stay at their locked versions.",
+		Args:  usageArgs(cobra.MinimumNArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runUpdate(cmd.Context(), args, force)
+		},
+	}
+	cmd.ValidArgsFunction = a.completeInstalledStacks
+
+	cmd.Flags().BoolVar(&force, "force", false, "overwrite locally modified instruction files without asking")
+	return cmd
+}
+
+func (a *App) runUpdate(ctx context.Context, stacks []string, force bool) error {
+	if err := a.RequireProject(); err != nil {
+		return err
+	}
+
+	for _, s := range stacks {
+		rs, ok := a.config.Resolved[s]
+		if !ok {
+			return &ExitError{Code: exitcodes.UsageError, Message: fmt.Sprintf("stack %q is not installed", s)}
+		}
+		if rs.Local {
+			return &ExitError{Code: exitcodes.UsageError, Message: fmt.Sprintf("stack %q was imported from local files; run import again to update it", s)}
+		}
+	}
+
+	client, err := a.newRegistryClient()
+	if err != nil {
+		return err
+	}
+
+	a.config.LastSyncedBranch = a.getBranch()
+	a.output.Info("Updating %v...", stacks)
+	result, err := a.newEngine(client).Update(ctx, a.config, stacks, engine.SyncOptions{
+		Force:            force,
+		ConfirmOverwrite: a.overwriteConfirmer(),
+	})
+	if err != nil {
+		return engineError(err)
+	}
+
+	a.printUpdateSummary(result)
+	a.warnDisabledTools(a.config, result.Order, newStacks(result))
+	a.printPostInstallMessages(result, newStacks(result))
+
+	return a.runHook(ctx, a.config, hookPostSync, updatedStacks(result))
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/engine"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/cego/ai-instructions/internal/resolver"
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Check a registry for broken stacks before publishing",
+		Long: "Lints the registry given by --registry for authors: every stack manifest must load, list files that download,\n" +
+			"match the version and conditional dependencies in registry.json, and depend only on existing stacks without cycles.\n" +
+			"Use --registry file://. to check a local checkout of the registry repository.",
+		Args: usageArgs(cobra.NoArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runValidate(cmd.Context())
+		},
+	}
+}
+
+func (a *App) runValidate(ctx context.Context) error {
+	client, err := a.newRegistryClient()
+	if err != nil {
+		return err
+	}
+	reg, err := a.fetchRegistry(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	problems := lintRegistry(ctx, client, reg)
+	if len(problems) == 0 {
+		a.output.Success("Registry is valid (%d stacks)", len(reg.Stacks))
+		return nil
+	}
+
+	a.output.Error("Registry has %d problem(s):", len(problems))
+	for _, p := range problems {
+		a.output.Println("  %s", p)
+	}
+	return &ExitError{Code: exitcodes.VerificationFailed, Message: "registry validation failed"}
+}
+
+// lintRegistry returns every problem found in the registry's stacks: manifests that
+// don't load, versions that disagree with registry.json, files that don't download,
+// and dependencies that are unknown or cyclic.
+func lintRegistry(ctx context.Context, client *registry.Client, reg *registry.Registry) []string {
+	ids := make([]string, 0, len(reg.Stacks))
+	for id := range reg.Stacks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var problems []string
+	depsKnown := true
+	for _, id := range ids {
+		meta := reg.Stacks[id]
+
+		for _, dep := range meta.Depends {
+			if _, ok := reg.Stacks[dep]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: depends on unknown stack %s", id, dep))
+				depsKnown = false
+			}
+		}
+		for _, dep := range meta.OptionalDepends {
+			if _, ok := reg.Stacks[dep]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: recommends unknown stack %s", id, dep))
+			}
+		}
+		triggers := make([]string, 0, len(meta.ConditionalDepends))
+		for trigger := range meta.ConditionalDepends {
+			triggers = append(triggers, trigger)
+		}
+		sort.Strings(triggers)
+		for _, trigger := range triggers {
+			if _, ok := reg.Stacks[trigger]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: conditional dependency on unknown trigger stack %s", id, trigger))
+			}
+			for _, dep := range meta.ConditionalDepends[trigger] {
+				if _, ok := reg.Stacks[dep]; !ok {
+					problems = append(problems, fmt.Sprintf("%s: depends on unknown stack %s if %s is installed", id, dep, trigger))
+					depsKnown = false
+				}
+			}
+		}
+
+		manifest, err := client.FetchStackManifest(ctx, id)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", id, err))
+			continue
+		}
+		if manifest.Version != meta.Version {
+			problems = append(problems, fmt.Sprintf("%s: registry.json has version %s, stack.json has %s", id, meta.Version, manifest.Version))
+		}
+		if !maps.EqualFunc(meta.ConditionalDepends, manifest.ConditionalDepends, slices.Equal[[]string]) {
+			problems = append(problems, fmt.Sprintf("%s: conditional_depends differ between registry.json and stack.json", id))
+		}
+		files, err := engine.ManifestFiles(manifest)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", id, err))
+			files = manifest.Files
+		}
+		listed := make(map[string]bool, len(files))
+		for _, f := range files {
+			listed[f] = true
+			data, err := client.DownloadFile(ctx, id, f)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: file %s: %v", id, f, err))
+				continue
+			}
+			if slices.Contains(manifest.Templates, f) {
+				if err := engine.ParseTemplate(f, data); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: template %s: %v", id, f, err))
+				}
+			}
+		}
+		fileToolFiles := make([]string, 0, len(manifest.FileTools))
+		for f := range manifest.FileTools {
+			fileToolFiles = append(fileToolFiles, f)
+		}
+		sort.Strings(fileToolFiles)
+		for _, f := range fileToolFiles {
+			if !listed[f] {
+				problems = append(problems, fmt.Sprintf("%s: file_tools names %s, which is not in files", id, f))
+			}
+			if _, err := config.ToolsFromNames(manifest.FileTools[f]); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: file_tools for %s: %v", id, f, err))
+			}
+		}
+		for _, f := range manifest.Inline {
+			if !listed[f] {
+				problems = append(problems, fmt.Sprintf("%s: inline names %s, which is not in files", id, f))
+			}
+		}
+		for _, f := range manifest.Templates {
+			if !listed[f] {
+				problems = append(problems, fmt.Sprintf("%s: templates names %s, which is not in files", id, f))
+			}
+		}
+	}
+
+	// Cycles can only be checked once every dependency exists
+	if depsKnown {
+		if _, err := resolver.NewResolver(engine.StackInfos(reg)).Resolve(ids); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
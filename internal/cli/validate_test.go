@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+// writeRegistry lays out files under dir/company-instructions like a registry repository.
+func writeRegistry(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, "company-instructions", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLintRegistry(t *testing.T) {
+	const phpManifest = `{"name":"PHP","version":"1.0.0","files":["rules.md"]}`
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "valid",
+			files: map[string]string{
+				"registry.json":  `{"version":1,"stacks":{"php":{"name":"PHP","version":"1.0.0","category":"language"}}}`,
+				"php/stack.json": phpManifest,
+				"php/rules.md":   "rules",
+			},
+		},
+		{
+			name: "missing file",
+			files: map[string]string{
+				"registry.json":  `{"version":1,"stacks":{"php":{"name":"PHP","version":"1.0.0","category":"language"}}}`,
+				"php/stack.json": phpManifest,
+			},
+			want: []string{"php: file rules.md: HTTP 404: file:///company-instructions/php/rules.md"},
+		},
+		{
+			name: "version mismatch",
+			files: map[string]string{
+				"registry.json":  `{"version":1,"stacks":{"php":{"name":"PHP","version":"1.1.0","category":"language"}}}`,
+				"php/stack.json": phpManifest,
+				"php/rules.md":   "rules",
+			},
+			want: []string{"php: registry.json has version 1.1.0, stack.json has 1.0.0"},
+		},
+		{
+			name: "unknown dependency",
+			files: map[string]string{
+				"registry.json":  `{"version":1,"stacks":{"php":{"name":"PHP","version":"1.0.0","category":"language","depends":["composer"]}}}`,
+				"php/stack.json": phpManifest,
+				"php/rules.md":   "rules",
+			},
+			want: []string{"php: depends on unknown stack composer"},
+		},
+		{
+			name: "conditional dependencies differ",
+			files: map[string]string{
+				"registry.json": `{"version":1,"stacks":{
+					"php":{"name":"PHP","version":"1.0.0","category":"language","conditional_depends":{"laravel":["pest"]}},
+					"laravel":{"name":"Laravel","version":"1.0.0","category":"framework"},
+					"pest":{"name":"Pest","version":"1.0.0","category":"tool"}}}`,
+				"php/stack.json":     `{"name":"PHP","version":"1.0.0","files":[]}`,
+				"laravel/stack.json": `{"name":"Laravel","version":"1.0.0","files":[]}`,
+				"pest/stack.json":    `{"name":"Pest","version":"1.0.0","files":[]}`,
+			},
+			want: []string{"php: conditional_depends differ between registry.json and stack.json"},
+		},
+		{
+			name: "missing translation",
+			files: map[string]string{
+				"registry.json":   `{"version":1,"stacks":{"php":{"name":"PHP","version":"1.0.0","category":"language"}}}`,
+				"php/stack.json":  `{"name":"PHP","version":"1.0.0","locales":{"en":["rules.md"],"da":["rules.md"]}}`,
+				"php/en/rules.md": "rules",
+			},
+			want: []string{"php: file da/rules.md: HTTP 404: file:///company-instructions/php/da/rules.md"},
+		},
+		{
+			name: "bad file_tools",
+			files: map[string]string{
+				"registry.json":  `{"version":1,"stacks":{"php":{"name":"PHP","version":"1.0.0","category":"language"}}}`,
+				"php/stack.json": `{"name":"PHP","version":"1.0.0","files":["rules.md"],"file_tools":{"rules.md":["vim"],"old.md":["claude"]}}`,
+				"php/rules.md":   "rules",
+			},
+			want: []string{
+				"php: file_tools names old.md, which is not in files",
+				`php: file_tools for rules.md: unknown tool "vim"`,
+			},
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"registry.json": `{"version":1,"stacks":{
+					"a":{"name":"A","version":"1.0.0","category":"language","depends":["b"]},
+					"b":{"name":"B","version":"1.0.0","category":"language","depends":["a"]}}}`,
+				"a/stack.json": `{"name":"A","version":"1.0.0","files":[]}`,
+				"b/stack.json": `{"name":"B","version":"1.0.0","files":[]}`,
+			},
+			want: []string{"circular dependency: a → b → a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := registry.NewClient(registry.WithLocalDir(writeRegistry(t, tt.files)))
+			reg, err := client.FetchRegistry(context.Background())
+			if err != nil {
+				t.Fatalf("FetchRegistry: %v", err)
+			}
+
+			got := lintRegistry(context.Background(), client, reg)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lintRegistry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	t.Setenv("CI", "true")
+	valid, err := filepath.Abs(filepath.Join("..", "..", "testdata", "registry"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := writeRegistry(t, map[string]string{
+		"registry.json": `{"version":1,"stacks":{"php":{"name":"PHP","version":"1.0.0","category":"language"}}}`,
+	})
+
+	for dir, want := range map[string]int{valid: exitcodes.Success, broken: exitcodes.VerificationFailed} {
+		app := NewApp("test", "none", "unknown")
+		app.rootCmd.SetArgs([]string{"--dir", t.TempDir(), "--registry", "file://" + dir, "validate"})
+		if got := exitCode(app.Execute()); got != want {
+			t.Errorf("validate %s: exit code = %d, want %d", dir, got, want)
+		}
+	}
+}
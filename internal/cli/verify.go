@@ -2,9 +2,11 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sort"
+	"strings"
 
+	"github.com/cego/ai-instructions/internal/engine"
 	"github.com/cego/ai-instructions/internal/exitcodes"
 	"github.com/cego/ai-instructions/internal/filemanager"
 	"github.com/cego/ai-instructions/internal/injector"
@@ -12,23 +14,43 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// verifyOptions holds the flags for verify.
+type verifyOptions struct {
+	strict      bool
+	noFreshness bool
+	fix         bool
+	fixed       bool // the check after a --fix repair
+}
+
 func (a *App) newVerifyCmd() *cobra.Command {
-	var strict bool
+	var opts verifyOptions
 
 	cmd := &cobra.Command{
 		Use:   "verify",
 		Short: "Verify instruction files are up to date and intact",
-		Long:  "CI command: verifies freshness, integrity, and managed blocks. Exit 0 = OK, exit 1 = failed.",
+		Long:  "CI command: verifies freshness, integrity, and managed blocks. Exit 0 = OK, exit 1 = failed.\nWith --no-freshness the registry is not contacted, for network-free integrity checks.\nWith --fix, tampered or missing stacks are downloaded again at their locked version and the managed\nblocks rewritten, without checking freshness; the exit code is 0 once the repair verifies.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return a.runVerify(cmd.Context(), strict)
+			return a.runVerify(cmd.Context(), opts)
 		},
 	}
 
-	cmd.Flags().BoolVar(&strict, "strict", false, "fail on registry unreachable (default: warn only)")
+	cmd.Flags().BoolVar(&opts.strict, "strict", false, "fail on registry unreachable (default: warn only)")
+	cmd.Flags().BoolVar(&opts.noFreshness, "no-freshness", false, "skip the registry and check only local files and managed blocks")
+	cmd.Flags().BoolVar(&opts.fix, "fix", false, "repair tampered files and managed blocks at the locked versions")
 	return cmd
 }
 
-func (a *App) runVerify(ctx context.Context, strict bool) error {
+func (a *App) runVerify(ctx context.Context, opts verifyOptions) error {
+	if opts.strict && (opts.noFreshness || opts.fix) {
+		flag := "--no-freshness"
+		if opts.fix {
+			flag = "--fix"
+		}
+		return &ExitError{Code: exitcodes.UsageError, Message: "--strict and " + flag + " cannot be used together"}
+	}
+	strict := opts.strict
+	// A fix restores the locked versions, so whether they are the latest doesn't matter
+	noFreshness := opts.noFreshness || opts.fix
 	if err := a.RequireProject(); err != nil {
 		return err
 	}
@@ -41,22 +63,31 @@ func (a *App) runVerify(ctx context.Context, strict bool) error {
 
 	// 1. Check freshness against registry
 	registryReachable := true
-	client, clientErr := a.newRegistryClient()
-	if clientErr == nil {
+	if noFreshness {
+		registryReachable = false
+	} else if client, clientErr := a.newRegistryClient(); clientErr == nil {
 		var fetchErr error
 		reg, fetchErr = client.FetchRegistry(ctx)
-		if fetchErr != nil {
+		if errors.Is(fetchErr, registry.ErrOffline) {
 			registryReachable = false
+			a.output.Info("Offline, checking local files against the locked hashes only")
+		} else if fetchErr != nil {
+			registryReachable = false
+			hint := registryHint(fetchErr)
 			if strict {
-				return &ExitError{
-					Code:    exitcodes.NetworkError,
-					Message: fmt.Sprintf("registry unreachable (strict mode): %v", fetchErr),
+				msg := fmt.Sprintf("registry unreachable (strict mode): %v", fetchErr)
+				if hint != "" {
+					msg += "\n" + hint
 				}
+				return &ExitError{Code: exitcodes.NetworkError, Message: msg}
 			}
 			a.output.Warning("Registry unreachable, skipping freshness check: %v", fetchErr)
+			if hint != "" {
+				a.output.Info("%s", hint)
+			}
 		} else {
 			for stackID, resolved := range a.config.Resolved {
-				if regMeta, ok := reg.Stacks[stackID]; ok {
+				if regMeta, ok := reg.Stacks[stackID]; ok && !resolved.Local {
 					if regMeta.Version != resolved.Version {
 						outdatedStacks = append(outdatedStacks, stackID)
 						issues = append(issues, fmt.Sprintf(
@@ -88,48 +119,75 @@ func (a *App) runVerify(ctx context.Context, strict bool) error {
 	}
 
 	results := filemanager.VerifyAll(a.projectDir, managedDir, verifyInfos)
-	var tampered []string
+	var tampered, brokenStacks []string
 	for _, r := range results {
 		if !r.OK {
+			brokenStacks = append(brokenStacks, r.Stack)
 			for _, f := range r.Missing {
 				issues = append(issues, fmt.Sprintf("missing: %s/%s", r.Stack, f))
 			}
-			tampered = append(tampered, r.Tampered...)
+			for _, f := range r.Tampered {
+				tampered = append(tampered, f)
+				issues = append(issues, fmt.Sprintf("tampered: %s", f))
+			}
 		}
 	}
 
 	// 3. Verify managed blocks in target files
-	var stackOrder []string
-	for stackID := range a.config.Resolved {
-		stackOrder = append(stackOrder, stackID)
+	blockResults, err := a.verifyManagedBlocks()
+	if err != nil {
+		return err
 	}
-	sort.Strings(stackOrder)
-	injectorConfigs := buildInjectorConfigs(stackOrder, a.config.Resolved, managedDir)
-
-	blockResults := injector.VerifyAll(a.projectDir, injectorConfigs)
-	var missingBlocks []string
+	var missingBlocks, damagedBlocks, staleBlocks, skippedBlocks []string
 	for _, r := range blockResults {
+		if r.Skipped {
+			skippedBlocks = append(skippedBlocks, r.Filename)
+			continue
+		}
 		if !r.HasBlock {
 			missingBlocks = append(missingBlocks, r.Filename)
 			issues = append(issues, fmt.Sprintf("missing managed block: %s", r.Filename))
+		} else if r.Damaged {
+			damagedBlocks = append(damagedBlocks, r.Filename)
+			issues = append(issues, fmt.Sprintf("damaged managed block: %s", r.Filename))
+		} else if r.Stale {
+			staleBlocks = append(staleBlocks, r.Filename)
+			issues = append(issues, fmt.Sprintf("managed block out of date: %s", r.Filename))
 		}
 	}
 
+	if opts.fix && len(issues) > 0 {
+		return a.repair(ctx, brokenStacks)
+	}
+
 	// Print results
+	if !a.config.InjectionEnabled() {
+		a.output.Info("Skipped managed block checks (inject: false)")
+	}
+	for _, f := range skippedBlocks {
+		a.output.Info("Skipped managed block check: %s (opted out of injection)", f)
+	}
+
 	if len(issues) == 0 {
 		totalFiles := countResolvedFiles(a.config.Resolved)
 		a.output.Success("All %d stacks verified, %d instruction files up to date", len(a.config.Resolved), totalFiles)
-		if !registryReachable {
+		if opts.fixed {
+			a.output.Info("Freshness not checked (--fix restores the locked versions)")
+		} else if noFreshness {
+			a.output.Info("Freshness not checked (--no-freshness)")
+		} else if a.offline {
+			a.output.Warning("Freshness not verified (offline)")
+		} else if !registryReachable {
 			a.output.Warning("Freshness could not be verified (registry unreachable)")
 		}
 		return nil
 	}
 
 	a.output.Error("Verification failed")
-	a.output.Println("")
+	a.output.ErrorDetail("")
 
 	if len(outdatedStacks) > 0 {
-		a.output.Println("Outdated stacks (registry has newer version):")
+		a.output.ErrorDetail("Outdated stacks (registry has newer version):")
 		for _, s := range outdatedStacks {
 			regVersion := "?"
 			if reg != nil {
@@ -137,28 +195,95 @@ func (a *App) runVerify(ctx context.Context, strict bool) error {
 					regVersion = meta.Version
 				}
 			}
-			a.output.Println("  %s   %s → %s", s, a.config.Resolved[s].Version, regVersion)
+			a.output.ErrorDetail("  %s   %s → %s", s, a.config.Resolved[s].Version, regVersion)
 		}
-		a.output.Println("")
+		a.output.ErrorDetail("")
 	}
 
 	if len(tampered) > 0 {
-		a.output.Println("Tampered files (local files don't match resolved hashes):")
+		a.output.ErrorDetail("Tampered files (local files don't match resolved hashes):")
 		for _, f := range tampered {
-			a.output.Println("  %s", f)
+			a.output.ErrorDetail("  %s", f)
 		}
-		a.output.Println("")
+		a.output.ErrorDetail("")
 	}
 
 	if len(missingBlocks) > 0 {
-		a.output.Println("Missing managed blocks:")
+		a.output.ErrorDetail("Missing managed blocks:")
 		for _, f := range missingBlocks {
-			a.output.Println("  %s — AI-INSTRUCTIONS markers not found", f)
+			a.output.ErrorDetail("  %s — AI-INSTRUCTIONS markers not found", f)
+		}
+		a.output.ErrorDetail("")
+	}
+
+	if len(damagedBlocks) > 0 {
+		a.output.ErrorDetail("Damaged managed blocks:")
+		for _, f := range damagedBlocks {
+			a.output.ErrorDetail("  %s — merge conflict markers inside the block", f)
 		}
-		a.output.Println("")
+		a.output.ErrorDetail("")
 	}
 
-	a.output.Println("Run: ai-instructions sync")
+	if len(staleBlocks) > 0 {
+		a.output.ErrorDetail("Out-of-date managed blocks (content doesn't match the installed stacks):")
+		for _, f := range staleBlocks {
+			a.output.ErrorDetail("  %s", f)
+		}
+		a.output.ErrorDetail("")
+	}
+
+	a.output.ErrorDetail("Run: ai-instructions sync")
+	if len(outdatedStacks) == 0 {
+		a.output.ErrorDetail("Or, to repair only these problems at the locked versions: ai-instructions verify --fix")
+	}
 
 	return &ExitError{Code: exitcodes.VerificationFailed, Message: "verification failed"}
 }
+
+// repair downloads the given stacks again at their locked version, rewrites the managed
+// blocks and verifies the result. The registry is only needed if there are stacks to fetch.
+func (a *App) repair(ctx context.Context, stacks []string) error {
+	var client *registry.Client
+	if len(stacks) > 0 {
+		var err error
+		client, err = a.newRegistryClient()
+		if err != nil {
+			return err
+		}
+		a.output.Info("Restoring %s at the locked version...", strings.Join(stacks, ", "))
+	}
+
+	result, err := a.newEngine(client).Repair(ctx, a.config, stacks)
+	if err != nil {
+		var gone *engine.LockedVersionGoneError
+		if errors.As(err, &gone) {
+			return &ExitError{Code: exitcodes.VerificationFailed, Message: err.Error() + "\nRun: ai-instructions sync"}
+		}
+		return engineError(err)
+	}
+	for _, u := range result.Updates {
+		a.output.Success("Restored %s %s", u.Stack, u.NewVersion)
+	}
+	if len(result.Rewritten) > 0 {
+		a.output.Success("Rewrote %s", strings.Join(result.Rewritten, ", "))
+	}
+
+	return a.runVerify(ctx, verifyOptions{noFreshness: true, fixed: true})
+}
+
+// verifyManagedBlocks checks the managed block of every target file against the block
+// injection would write for the resolved stacks. With injection disabled there is nothing to check.
+func (a *App) verifyManagedBlocks() ([]injector.VerifyResult, error) {
+	if !a.config.InjectionEnabled() {
+		return nil, nil
+	}
+	order, err := engine.InjectionOrder(a.config)
+	if err != nil {
+		return nil, err
+	}
+	configs, err := engine.InjectorConfigs(a.projectDir, a.config, order)
+	if err != nil {
+		return nil, err
+	}
+	return injector.VerifyAll(a.projectDir, order, configs, a.getManagedDir()), nil
+}
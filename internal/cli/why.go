@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/exitcodes"
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newWhyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "why <stack>",
+		Short: "Explain why a stack is installed",
+		Long:  "Follows the dependency chain recorded in the config from the stack up to the explicitly requested stack that pulled it in.",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.runWhy(args[0])
+		},
+	}
+	cmd.ValidArgsFunction = a.completeOneInstalledStack
+	return cmd
+}
+
+func (a *App) runWhy(stackID string) error {
+	if err := a.RequireProject(); err != nil {
+		return err
+	}
+
+	if _, ok := a.config.Resolved[stackID]; !ok {
+		return &ExitError{Code: exitcodes.UsageError, Message: fmt.Sprintf("stack %q is not installed", stackID)}
+	}
+
+	chain, root := dependencyChain(a.config.Resolved, stackID)
+	if len(chain) == 1 && root {
+		a.output.Println("%s is installed explicitly", stackID)
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString(stackID)
+	if len(chain) > 1 {
+		fmt.Fprintf(&b, " is required by %s", chain[1])
+		for _, id := range chain[2:] {
+			fmt.Fprintf(&b, ", which is required by %s", id)
+		}
+	} else {
+		b.WriteString(" is installed")
+	}
+
+	last := chain[len(chain)-1]
+	switch _, installed := a.config.Resolved[last]; {
+	case root:
+		b.WriteString(" (explicit)")
+	case !installed:
+		b.WriteString(" (not installed)")
+	default:
+		fmt.Fprintf(&b, ", but %s is not an explicit stack (run sync to fix)", last)
+	}
+	a.output.Println("%s", b.String())
+	return nil
+}
+
+// dependencyChain follows dependency_of from stackID and returns the stacks passed through,
+// starting with stackID. root reports whether the chain ends at an explicit stack; it is
+// false if the chain ends at a stack that isn't installed or loops back on itself.
+func dependencyChain(resolved map[string]config.ResolvedStack, stackID string) (chain []string, root bool) {
+	seen := make(map[string]bool)
+	for id := stackID; ; {
+		chain = append(chain, id)
+		seen[id] = true
+
+		rs, ok := resolved[id]
+		if !ok {
+			return chain, false
+		}
+		if rs.Explicit {
+			return chain, true
+		}
+		if rs.DependencyOf == "" || seen[rs.DependencyOf] {
+			return chain, false
+		}
+		id = rs.DependencyOf
+	}
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+)
+
+func TestDependencyChain(t *testing.T) {
+	resolved := map[string]config.ResolvedStack{
+		"nuxt-ui": {Explicit: true},
+		"nuxt":    {DependencyOf: "nuxt-ui"},
+		"vue":     {DependencyOf: "nuxt"},
+		"php":     {DependencyOf: "laravel"},
+		"a":       {DependencyOf: "b"},
+		"b":       {DependencyOf: "a"},
+		"orphan":  {},
+	}
+
+	tests := []struct {
+		stack     string
+		wantChain []string
+		wantRoot  bool
+	}{
+		{stack: "nuxt-ui", wantChain: []string{"nuxt-ui"}, wantRoot: true},
+		{stack: "vue", wantChain: []string{"vue", "nuxt", "nuxt-ui"}, wantRoot: true},
+		{stack: "php", wantChain: []string{"php", "laravel"}, wantRoot: false},
+		{stack: "a", wantChain: []string{"a", "b"}, wantRoot: false},
+		{stack: "orphan", wantChain: []string{"orphan"}, wantRoot: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.stack, func(t *testing.T) {
+			chain, root := dependencyChain(resolved, tt.stack)
+			if !reflect.DeepEqual(chain, tt.wantChain) || root != tt.wantRoot {
+				t.Errorf("dependencyChain(%q) = %v, %v; want %v, %v", tt.stack, chain, root, tt.wantChain, tt.wantRoot)
+			}
+		})
+	}
+}
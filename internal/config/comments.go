@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// preserveComments returns userBytes, the freshly marshaled user section, carrying over
+// the comments users wrote in the user section of the existing file at path. Comments
+// follow their key, or their list item, so they survive the values around them changing;
+// comments on settings that were removed are dropped. The flow or block style of mappings
+// and lists is kept too. Without an existing file or comments, userBytes is returned as is.
+func preserveComments(path string, userBytes []byte) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return userBytes
+	}
+	userSection, _, _ := strings.Cut(string(data), resolvedSeparator)
+
+	var existing yaml.Node
+	if err := yaml.Unmarshal([]byte(userSection), &existing); err != nil || !hasComments(&existing) {
+		return userBytes
+	}
+	var updated yaml.Node
+	if err := yaml.Unmarshal(userBytes, &updated); err != nil {
+		return userBytes
+	}
+
+	copyComments(&updated, &existing)
+	out, err := yaml.Marshal(&updated)
+	if err != nil {
+		return userBytes
+	}
+	return out
+}
+
+// hasComments reports whether n or any node below it has a comment.
+func hasComments(n *yaml.Node) bool {
+	if n.HeadComment != "" || n.LineComment != "" || n.FootComment != "" {
+		return true
+	}
+	for _, c := range n.Content {
+		if hasComments(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyComments copies the comments of src, and of the nodes below it, to the
+// corresponding nodes of dst: mapping entries by key, list items by value for scalars
+// and by position otherwise.
+func copyComments(dst, src *yaml.Node) {
+	dst.HeadComment = src.HeadComment
+	dst.LineComment = src.LineComment
+	dst.FootComment = src.FootComment
+	if dst.Kind != src.Kind {
+		return
+	}
+	if dst.Kind != yaml.ScalarNode || dst.Value == src.Value {
+		dst.Style = src.Style
+	}
+
+	switch dst.Kind {
+	case yaml.DocumentNode:
+		if len(dst.Content) > 0 && len(src.Content) > 0 {
+			copyComments(dst.Content[0], src.Content[0])
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			for j := 0; j+1 < len(src.Content); j += 2 {
+				if dst.Content[i].Value == src.Content[j].Value {
+					copyComments(dst.Content[i], src.Content[j])
+					copyComments(dst.Content[i+1], src.Content[j+1])
+					break
+				}
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range dst.Content {
+			if match := matchingItem(item, i, src.Content); match != nil {
+				copyComments(item, match)
+			}
+		}
+	}
+}
+
+// matchingItem returns the item of items that corresponds to item at index i of the
+// new list: the scalar with the same value, or for other nodes the one at the same index.
+func matchingItem(item *yaml.Node, i int, items []*yaml.Node) *yaml.Node {
+	if item.Kind == yaml.ScalarNode {
+		for _, candidate := range items {
+			if candidate.Kind == yaml.ScalarNode && candidate.Value == item.Value {
+				return candidate
+			}
+		}
+		return nil
+	}
+	if i < len(items) && items[i].Kind == item.Kind {
+		return items[i]
+	}
+	return nil
+}
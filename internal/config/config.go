@@ -1,10 +1,15 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,47 +21,165 @@ const LockFile = "ai-instructions.lock"
 
 const resolvedSeparator = "\n# Resolved dependencies — auto-generated, do not edit below this line\n"
 
+// resolvedChecksumPrefix starts the trailing comment holding the checksum of the resolved section.
+const resolvedChecksumPrefix = "# resolved checksum: "
+
 // Config represents the ai-instructions.yml file, including resolved state.
 type Config struct {
-	Version         int            `yaml:"version"`
-	Registry        RegistryConfig `yaml:"registry"`
-	InstructionsDir string         `yaml:"instructions_dir,omitempty"`
-	Mode            string         `yaml:"mode,omitempty"`
-	Stacks          []string       `yaml:"stacks"`
+	Version         int               `yaml:"version"`
+	Registry        RegistryConfig    `yaml:"registry"`
+	Registries      []RegistryConfig  `yaml:"registries,omitempty"`
+	StackBranches   map[string]string `yaml:"stack_branches,omitempty"`
+	VerifyRegistry  bool              `yaml:"verify_registry,omitempty"`
+	InstructionsDir string            `yaml:"instructions_dir,omitempty"`
+	ManagedDir      string            `yaml:"managed_dir,omitempty"`
+	Mode            string            `yaml:"mode,omitempty"`
+	Locale          string            `yaml:"locale,omitempty"`
+	Stacks          []string          `yaml:"stacks"`
+	SkipInjection   []string          `yaml:"skip_injection,omitempty"`
+	Tools           []string          `yaml:"tools,omitempty"` // AI tools the project uses; all when empty
+	Inject          *bool             `yaml:"inject,omitempty"`
+	Placement       string            `yaml:"placement,omitempty"`
+	Targets         []TargetConfig    `yaml:"targets,omitempty"`
+	Block           BlockConfig       `yaml:"block,omitempty"`
+	ContextLimitKB  int               `yaml:"context_limit_kb,omitempty"`
+	Hooks           HooksConfig       `yaml:"hooks,omitempty"`
+	// Variables are the values stack templates read with {{ .Var "name" }}.
+	Variables map[string]string `yaml:"variables,omitempty"`
 
 	Resolved map[string]ResolvedStack `yaml:"resolved,omitempty"`
+	// LastSyncedBranch is the registry branch of the last successful init, sync or update.
+	LastSyncedBranch string `yaml:"last_synced_branch,omitempty"`
+	// LastManagedDir is the managed_dir of the last successful init, sync or update. The
+	// next sync after managed_dir changes moves the old directory.
+	LastManagedDir string `yaml:"last_managed_dir,omitempty"`
+
+	resolvedEdited bool // set by LoadConfig when the resolved section doesn't match its checksum
+}
+
+// ResolvedEdited reports whether the resolved section was changed since ai-instructions
+// last wrote it, e.g. a version bumped by hand. Configs written before the checksum
+// existed are never reported.
+func (c *Config) ResolvedEdited() bool {
+	return c.resolvedEdited
+}
+
+// PreviousManagedDir returns the managed_dir of the last init, sync or update if it
+// differs from the current one, or "" if it doesn't or wasn't recorded.
+func (c *Config) PreviousManagedDir() string {
+	current := c.ManagedDir
+	if current == "" {
+		current = DefaultManagedDir
+	}
+	if c.LastManagedDir == current {
+		return ""
+	}
+	return c.LastManagedDir
+}
+
+// RecordManagedDir records the current managed_dir as the one the project was synced into.
+func (c *Config) RecordManagedDir() {
+	c.LastManagedDir = c.ManagedDir
+	if c.LastManagedDir == "" {
+		c.LastManagedDir = DefaultManagedDir
+	}
+}
+
+// InjectionEnabled reports whether managed blocks are written into the target files.
+// It is on unless the config sets inject: false, for projects that maintain CLAUDE.md
+// and the other targets by hand and only want the instruction files downloaded.
+func (c *Config) InjectionEnabled() bool {
+	return c.Inject == nil || *c.Inject
+}
+
+// ToolEnabled reports whether the project uses the named AI tool. Every tool is enabled
+// unless tools lists a subset.
+func (c *Config) ToolEnabled(tool string) bool {
+	return len(c.Tools) == 0 || slices.Contains(c.Tools, tool)
+}
+
+// EnabledTools returns t limited to the tools the project uses.
+func (c *Config) EnabledTools(t ToolsConfig) ToolsConfig {
+	return ToolsConfig{
+		IncludeInClaudeMD:    t.IncludeInClaudeMD && c.ToolEnabled(ToolClaude),
+		IncludeInAgentsMD:    t.IncludeInAgentsMD && c.ToolEnabled(ToolAgents),
+		IncludeInCursorRules: t.IncludeInCursorRules && c.ToolEnabled(ToolCursor),
+	}
+}
+
+// ContextLimit returns the size in bytes above which a target's managed instructions
+// may not fit in a tool's context: context_limit_kb, or DefaultContextLimitKB when unset.
+func (c *Config) ContextLimit() int64 {
+	kb := c.ContextLimitKB
+	if kb <= 0 {
+		kb = DefaultContextLimitKB
+	}
+	return int64(kb) << 10
 }
 
 // configUserFields is the subset of Config that users edit.
 // Used for two-pass marshaling so the resolved section stays below a comment.
 type configUserFields struct {
-	Version         int            `yaml:"version"`
-	Registry        RegistryConfig `yaml:"registry"`
-	InstructionsDir string         `yaml:"instructions_dir,omitempty"`
-	Mode            string         `yaml:"mode,omitempty"`
-	Stacks          []string       `yaml:"stacks"`
+	Version         int               `yaml:"version"`
+	Registry        RegistryConfig    `yaml:"registry"`
+	Registries      []RegistryConfig  `yaml:"registries,omitempty"`
+	StackBranches   map[string]string `yaml:"stack_branches,omitempty"`
+	VerifyRegistry  bool              `yaml:"verify_registry,omitempty"`
+	InstructionsDir string            `yaml:"instructions_dir,omitempty"`
+	ManagedDir      string            `yaml:"managed_dir,omitempty"`
+	Mode            string            `yaml:"mode,omitempty"`
+	Locale          string            `yaml:"locale,omitempty"`
+	Stacks          []string          `yaml:"stacks"`
+	SkipInjection   []string          `yaml:"skip_injection,omitempty"`
+	Tools           []string          `yaml:"tools,omitempty"`
+	Inject          *bool             `yaml:"inject,omitempty"`
+	Placement       string            `yaml:"placement,omitempty"`
+	Targets         []TargetConfig    `yaml:"targets,omitempty"`
+	Block           BlockConfig       `yaml:"block,omitempty"`
+	ContextLimitKB  int               `yaml:"context_limit_kb,omitempty"`
+	Hooks           HooksConfig       `yaml:"hooks,omitempty"`
+	Variables       map[string]string `yaml:"variables,omitempty"`
 }
 
 // configResolvedFields is the auto-generated portion of the config file.
 type configResolvedFields struct {
-	Resolved map[string]ResolvedStack `yaml:"resolved,omitempty"`
+	LastSyncedBranch string                   `yaml:"last_synced_branch,omitempty"`
+	LastManagedDir   string                   `yaml:"last_managed_dir,omitempty"`
+	Resolved         map[string]ResolvedStack `yaml:"resolved,omitempty"`
 }
 
 // RegistryConfig holds registry connection settings.
+// Registries listed under registries are layered over the main registry in order,
+// later ones overriding earlier ones when they define the same stack.
+// The URL may reference environment variables as ${VAR}; LoadConfig resolves them.
 type RegistryConfig struct {
-	URL    string `yaml:"url"`
-	Branch string `yaml:"branch,omitempty"`
+	URL       string `yaml:"url"`
+	Branch    string `yaml:"branch,omitempty"`
+	ProjectID string `yaml:"project_id,omitempty"` // numeric GitLab project ID, used instead of the URL's path
+
+	urlTemplate string // URL as written, when it references environment variables
+	expandedURL string // urlTemplate resolved at load time
 }
 
 // ConfigExists checks whether the config file exists in the given directory.
 func ConfigExists(dir string) bool {
-	_, err := os.Stat(filepath.Join(dir, ConfigFile))
+	return FileExists(filepath.Join(dir, ConfigFile))
+}
+
+// FileExists checks whether a config file exists at path.
+func FileExists(path string) bool {
+	_, err := os.Stat(path)
 	return err == nil
 }
 
 // LoadConfig reads and parses the config file from the given directory.
 func LoadConfig(dir string) (*Config, error) {
-	data, err := os.ReadFile(filepath.Join(dir, ConfigFile))
+	return LoadFile(filepath.Join(dir, ConfigFile))
+}
+
+// LoadFile reads and parses the config file at path, which may have any name.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, fmt.Errorf("config file not found: run 'ai-instructions init' first")
@@ -65,70 +188,110 @@ func LoadConfig(dir string) (*Config, error) {
 	}
 
 	var c Config
-	if err := yaml.Unmarshal(data, &c); err != nil {
-		return nil, fmt.Errorf("parsing config: %w", err)
+	if err := decodeStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filepath.Base(path), err)
 	}
 
 	// Apply defaults
 	if c.InstructionsDir == "" {
 		c.InstructionsDir = DefaultInstructionsDir
 	}
+	if c.ManagedDir == "" {
+		c.ManagedDir = DefaultManagedDir
+	}
 	if c.Mode == "" {
 		c.Mode = "platform"
 	}
-	if c.Registry.Branch == "" {
-		c.Registry.Branch = "master"
+
+	if sum, ok := savedResolvedChecksum(data); ok {
+		_, actual, err := marshalResolved(&c)
+		if err != nil {
+			return nil, err
+		}
+		c.resolvedEdited = sum != actual
 	}
 
+	if err := expandRegistryURLs(&c); err != nil {
+		return nil, err
+	}
 	if err := ValidateConfig(&c); err != nil {
 		return nil, err
 	}
+	c.InstructionsDir = filepath.ToSlash(filepath.Clean(c.InstructionsDir))
+	if err := checkInstructionsDirInside(filepath.Dir(path), c.InstructionsDir); err != nil {
+		return nil, err
+	}
 
 	return &c, nil
 }
 
 // SaveConfig writes the config file to the given directory.
 // It uses two-pass marshaling: user fields first, then a comment separator,
-// then the resolved section.
+// then the resolved section. Each resolved entry's files are sorted in place,
+// so saving the same state always produces the same bytes.
 func SaveConfig(dir string, c *Config) error {
+	return SaveFile(filepath.Join(dir, ConfigFile), c)
+}
+
+// SaveFile writes the config file to path, like SaveConfig.
+func SaveFile(path string, c *Config) error {
+	sortResolvedFiles(c.Resolved)
+
 	if c.InstructionsDir == "" {
 		c.InstructionsDir = DefaultInstructionsDir
 	}
 	if c.Mode == "" {
 		c.Mode = "platform"
 	}
-	if c.Registry.Branch == "" {
-		c.Registry.Branch = "master"
+
+	// The default managed dir is left out so existing config files don't change
+	managedDir := c.ManagedDir
+	if managedDir == DefaultManagedDir {
+		managedDir = ""
 	}
 
 	userPart := configUserFields{
 		Version:         c.Version,
-		Registry:        c.Registry,
+		Registry:        c.Registry.persisted(),
+		Registries:      persistedRegistries(c.Registries),
+		StackBranches:   c.StackBranches,
+		VerifyRegistry:  c.VerifyRegistry,
 		InstructionsDir: c.InstructionsDir,
+		ManagedDir:      managedDir,
 		Mode:            c.Mode,
+		Locale:          c.Locale,
 		Stacks:          c.Stacks,
+		SkipInjection:   c.SkipInjection,
+		Tools:           c.Tools,
+		Inject:          c.Inject,
+		Placement:       c.Placement,
+		Targets:         c.Targets,
+		Block:           c.Block,
+		ContextLimitKB:  c.ContextLimitKB,
+		Hooks:           c.Hooks,
+		Variables:       c.Variables,
 	}
 
 	userBytes, err := yaml.Marshal(userPart)
 	if err != nil {
 		return fmt.Errorf("marshaling config: %w", err)
 	}
+	userBytes = preserveComments(path, userBytes)
 
 	content := []byte("---\n")
 	if len(c.Resolved) > 0 {
-		resolvedPart := configResolvedFields{Resolved: c.Resolved}
-		resolvedBytes, marshalErr := yaml.Marshal(resolvedPart)
+		resolvedBytes, sum, marshalErr := marshalResolved(c)
 		if marshalErr != nil {
-			return fmt.Errorf("marshaling resolved: %w", marshalErr)
+			return marshalErr
 		}
 		content = append(content, userBytes...)
 		content = append(content, []byte(resolvedSeparator)...)
 		content = append(content, resolvedBytes...)
+		content = append(content, []byte(resolvedChecksumPrefix+sum+"\n")...)
 	} else {
 		content = append(content, userBytes...)
 	}
 
-	path := filepath.Join(dir, ConfigFile)
 	tmpPath := path + ".tmp"
 
 	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
@@ -140,9 +303,57 @@ func SaveConfig(dir string, c *Config) error {
 		return fmt.Errorf("saving config: %w", err)
 	}
 
+	c.resolvedEdited = false
 	return nil
 }
 
+// marshalResolved renders the resolved section and returns it with its checksum.
+// File lists are expected to be sorted, as SaveConfig leaves them.
+func marshalResolved(c *Config) ([]byte, string, error) {
+	data, err := yaml.Marshal(configResolvedFields{LastSyncedBranch: c.LastSyncedBranch, LastManagedDir: c.LastManagedDir, Resolved: c.Resolved})
+	if err != nil {
+		return nil, "", fmt.Errorf("marshaling resolved: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return data, "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// savedResolvedChecksum returns the resolved checksum recorded in a config file, if any.
+func savedResolvedChecksum(data []byte) (string, bool) {
+	for _, line := range strings.Split(string(data), "\n") {
+		if sum, ok := strings.CutPrefix(line, resolvedChecksumPrefix); ok {
+			return strings.TrimSpace(sum), true
+		}
+	}
+	return "", false
+}
+
+// sortResolvedFiles sorts the file list of every resolved stack.
+// Map keys, including file_hashes, are already emitted in sorted order by yaml.Marshal.
+func sortResolvedFiles(resolved map[string]ResolvedStack) {
+	for id, rs := range resolved {
+		if sort.StringsAreSorted(rs.Files) {
+			continue
+		}
+		files := append([]string(nil), rs.Files...)
+		sort.Strings(files)
+		rs.Files = files
+		resolved[id] = rs
+	}
+}
+
+// persistedRegistries returns the registries as they should be written back.
+func persistedRegistries(registries []RegistryConfig) []RegistryConfig {
+	if registries == nil {
+		return nil
+	}
+	out := make([]RegistryConfig, len(registries))
+	for i, r := range registries {
+		out[i] = r.persisted()
+	}
+	return out
+}
+
 // ValidateConfig checks that a Config struct has required fields.
 func ValidateConfig(c *Config) error {
 	if c.Version < 1 {
@@ -151,8 +362,111 @@ func ValidateConfig(c *Config) error {
 	if c.Registry.URL == "" {
 		return fmt.Errorf("registry url is required")
 	}
+	for i, r := range c.Registries {
+		if r.URL == "" {
+			return fmt.Errorf("registries[%d]: url is required", i)
+		}
+	}
 	if len(c.Stacks) == 0 {
 		return fmt.Errorf("at least one stack is required")
 	}
+	if err := validateInstructionsDir(c.InstructionsDir); err != nil {
+		return err
+	}
+	if err := validateManagedDir(c.ManagedDir); err != nil {
+		return err
+	}
+	if err := validateManagedDir(c.LastManagedDir); err != nil {
+		return fmt.Errorf("last_managed_dir: %w", err)
+	}
+	for _, tool := range c.Tools {
+		if tool != ToolClaude && tool != ToolAgents && tool != ToolCursor {
+			return fmt.Errorf("invalid tool %q: must be %s, %s or %s", tool, ToolClaude, ToolAgents, ToolCursor)
+		}
+	}
+	if c.Placement != "" && c.Placement != PlacementPrepend && c.Placement != PlacementAppend {
+		return fmt.Errorf("invalid placement %q: must be %q or %q", c.Placement, PlacementPrepend, PlacementAppend)
+	}
+	return validateTargets(c.Targets)
+}
+
+// validateInstructionsDir checks that the instructions dir is a relative path inside the
+// project, so downloaded files can't be written elsewhere. An empty path means the default.
+func validateInstructionsDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	for _, part := range strings.FieldsFunc(dir, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return fmt.Errorf("invalid instructions_dir %q: must not contain ..", dir)
+		}
+	}
+	if filepath.IsAbs(dir) || !filepath.IsLocal(dir) {
+		return fmt.Errorf("invalid instructions_dir %q: must be a relative path inside the project", dir)
+	}
+	return nil
+}
+
+// checkInstructionsDirInside rejects an instructions dir that a symlink in the project
+// points outside it. Parts of the path that don't exist yet are created as plain directories.
+func checkInstructionsDirInside(projectDir, dir string) error {
+	root, err := filepath.EvalSymlinks(projectDir)
+	if err != nil {
+		return fmt.Errorf("resolving project dir: %w", err)
+	}
+	path := filepath.Join(root, filepath.FromSlash(dir))
+	for p := path; ; p = filepath.Dir(p) {
+		resolved, err := filepath.EvalSymlinks(p)
+		if errors.Is(err, os.ErrNotExist) {
+			if _, lerr := os.Lstat(p); lerr == nil {
+				return fmt.Errorf("invalid instructions_dir %q: %s is a dangling symlink", dir, p)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("resolving instructions_dir: %w", err)
+		}
+		if rel, err := filepath.Rel(root, resolved); err != nil || !filepath.IsLocal(rel) {
+			return fmt.Errorf("invalid instructions_dir %q: resolves outside the project", dir)
+		}
+		return nil
+	}
+}
+
+// validateManagedDir checks that the managed dir is a single directory name, so the
+// files ai-instructions owns (and deletes) stay inside the instructions dir.
+// An empty name means the default.
+func validateManagedDir(name string) error {
+	if name == "" {
+		return nil
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) || !filepath.IsLocal(name) {
+		return fmt.Errorf("invalid managed_dir %q: must be a single directory name", name)
+	}
+	return nil
+}
+
+// validateTargets checks custom targets for unsafe paths, duplicates and unknown marker styles.
+func validateTargets(targets []TargetConfig) error {
+	seen := make(map[string]bool)
+	for _, name := range BuiltinTargets {
+		seen[name] = true
+	}
+	for _, t := range targets {
+		if t.Filename == "" {
+			return fmt.Errorf("target filename is required")
+		}
+		if !filepath.IsLocal(t.Filename) {
+			return fmt.Errorf("invalid target %q: must be a relative path inside the project", t.Filename)
+		}
+		name := filepath.ToSlash(filepath.Clean(t.Filename))
+		if seen[name] {
+			return fmt.Errorf("duplicate target %q", t.Filename)
+		}
+		seen[name] = true
+		if t.MarkerStyle != "" && t.MarkerStyle != MarkerStyleHTML && t.MarkerStyle != MarkerStyleHash {
+			return fmt.Errorf("invalid marker_style %q for target %s: must be %q or %q", t.MarkerStyle, t.Filename, MarkerStyleHTML, MarkerStyleHash)
+		}
+	}
 	return nil
 }
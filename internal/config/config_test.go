@@ -75,11 +75,15 @@ func TestConfigDefaults(t *testing.T) {
 	if loaded.InstructionsDir != DefaultInstructionsDir {
 		t.Errorf("InstructionsDir = %q, want %q", loaded.InstructionsDir, DefaultInstructionsDir)
 	}
+	if loaded.ManagedDir != DefaultManagedDir {
+		t.Errorf("ManagedDir = %q, want %q", loaded.ManagedDir, DefaultManagedDir)
+	}
 	if loaded.Mode != "platform" {
 		t.Errorf("Mode = %q, want %q", loaded.Mode, "platform")
 	}
-	if loaded.Registry.Branch != "master" {
-		t.Errorf("Registry.Branch = %q, want %q", loaded.Registry.Branch, "master")
+	// The branch is left unset, so the user config's branch or the default applies
+	if loaded.Registry.Branch != "" {
+		t.Errorf("Registry.Branch = %q, want it unset", loaded.Registry.Branch)
 	}
 }
 
@@ -110,6 +114,203 @@ func TestSaveAndLoadCustomInstructionsDir(t *testing.T) {
 	}
 }
 
+func TestLoadConfigInstructionsDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		setup   func(t *testing.T, dir string)
+		want    string
+		wantErr string
+	}{
+		{name: "normalized", value: "./docs//ai/", want: "docs/ai"},
+		{name: "parent", value: "../shared", wantErr: "must not contain .."},
+		{name: "absolute", value: "/tmp/ai", wantErr: "must be a relative path inside the project"},
+		{
+			name:  "symlink inside project",
+			value: "link/ai",
+			setup: func(t *testing.T, dir string) {
+				if err := os.Mkdir(filepath.Join(dir, "docs"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink("docs", filepath.Join(dir, "link")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "link/ai",
+		},
+		{
+			name:  "symlink outside project",
+			value: "link/ai",
+			setup: func(t *testing.T, dir string) {
+				if err := os.Symlink(t.TempDir(), filepath.Join(dir, "link")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "resolves outside the project",
+		},
+		{
+			name:  "dangling symlink",
+			value: "link",
+			setup: func(t *testing.T, dir string) {
+				if err := os.Symlink(filepath.Join(t.TempDir(), "missing"), filepath.Join(dir, "link")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "dangling symlink",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.setup != nil {
+				tt.setup(t, dir)
+			}
+			content := "version: 1\nregistry:\n  url: https://gitlab.example.com/ai\ninstructions_dir: " + tt.value + "\nstacks:\n  - php\n"
+			if err := os.WriteFile(filepath.Join(dir, ConfigFile), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := LoadConfig(dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadConfig() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error: %v", err)
+			}
+			if c.InstructionsDir != tt.want {
+				t.Errorf("InstructionsDir = %q, want %q", c.InstructionsDir, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveAndLoadCustomManagedDir(t *testing.T) {
+	dir := t.TempDir()
+
+	original := &Config{
+		Version:    1,
+		Registry:   RegistryConfig{URL: "https://ai-ctx.example.com"},
+		ManagedDir: "platform",
+		Stacks:     []string{"php"},
+	}
+	if err := SaveConfig(dir, original); err != nil {
+		t.Fatalf("SaveConfig() error: %v", err)
+	}
+
+	loaded, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if loaded.ManagedDir != "platform" {
+		t.Errorf("ManagedDir = %q, want %q", loaded.ManagedDir, "platform")
+	}
+
+	// The default is not written back
+	loaded.ManagedDir = DefaultManagedDir
+	if err := SaveConfig(dir, loaded); err != nil {
+		t.Fatalf("SaveConfig() error: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "managed_dir") {
+		t.Errorf("default managed_dir written to config:\n%s", data)
+	}
+}
+
+func TestContextLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  int64
+	}{
+		{name: "unset", limit: 0, want: DefaultContextLimitKB << 10},
+		{name: "negative", limit: -5, want: DefaultContextLimitKB << 10},
+		{name: "set", limit: 32, want: 32 << 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{ContextLimitKB: tt.limit}
+			if got := cfg.ContextLimit(); got != tt.want {
+				t.Errorf("ContextLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectionEnabled(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want bool
+	}{
+		{name: "unset", yaml: "", want: true},
+		{name: "true", yaml: "inject: true\n", want: true},
+		{name: "false", yaml: "inject: false\n", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			content := "version: 1\nregistry:\n  url: https://ai-ctx.example.com\nstacks: [php]\n" + tt.yaml
+			if err := os.WriteFile(filepath.Join(dir, ConfigFile), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := LoadConfig(dir)
+			if err != nil {
+				t.Fatalf("LoadConfig() error: %v", err)
+			}
+			if got := loaded.InjectionEnabled(); got != tt.want {
+				t.Errorf("InjectionEnabled() = %v, want %v", got, tt.want)
+			}
+
+			// The setting survives a save as written
+			if err := SaveConfig(dir, loaded); err != nil {
+				t.Fatalf("SaveConfig() error: %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, ConfigFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(string(data), strings.TrimSpace(tt.yaml)); tt.yaml != "" && !got {
+				t.Errorf("saved config lost %q:\n%s", strings.TrimSpace(tt.yaml), data)
+			}
+			if tt.yaml == "" && strings.Contains(string(data), "inject:") {
+				t.Errorf("unset inject written to config:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestEnabledTools(t *testing.T) {
+	all := ToolsConfig{IncludeInClaudeMD: true, IncludeInAgentsMD: true, IncludeInCursorRules: true}
+	tests := []struct {
+		name  string
+		tools []string
+		want  ToolsConfig
+	}{
+		{name: "unset", want: all},
+		{name: "claude only", tools: []string{ToolClaude}, want: ToolsConfig{IncludeInClaudeMD: true}},
+		{name: "agents and cursor", tools: []string{ToolAgents, ToolCursor}, want: ToolsConfig{IncludeInAgentsMD: true, IncludeInCursorRules: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{Tools: tt.tools}
+			if got := c.EnabledTools(all); got != tt.want {
+				t.Errorf("EnabledTools() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestLoadConfigNotFound(t *testing.T) {
 	dir := t.TempDir()
 	_, err := LoadConfig(dir)
@@ -118,6 +319,43 @@ func TestLoadConfigNotFound(t *testing.T) {
 	}
 }
 
+func TestLoadConfigStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "misspelled key",
+			content: "version: 1\nregistry:\n  url: https://gitlab.example.com/ai\nstackss:\n  - php\n",
+			wantErr: `line 4: unknown key "stackss"`,
+		},
+		{
+			name:    "misspelled nested key",
+			content: "version: 1\nregistry:\n  url: https://gitlab.example.com/ai\n  brnach: main\nstacks:\n  - php\n",
+			wantErr: `line 4: unknown key "brnach"`,
+		},
+		{
+			name:    "alias",
+			content: "version: 1\nregistry:\n  url: https://gitlab.example.com/ai\nstacks: &base\n  - php\nskip_injection: *base\n",
+			wantErr: "line 6: YAML aliases are not supported (*base)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, ConfigFile), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadConfig(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateConfig(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -139,6 +377,86 @@ func TestValidateConfig(t *testing.T) {
 			c:       &Config{Version: 1, Registry: RegistryConfig{URL: ""}, Stacks: []string{"php"}},
 			wantErr: true,
 		},
+		{
+			name:    "append placement",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, Placement: PlacementAppend},
+			wantErr: false,
+		},
+		{
+			name:    "invalid placement",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, Placement: "middle"},
+			wantErr: true,
+		},
+		{
+			name:    "custom target",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, Targets: []TargetConfig{{Filename: ".windsurfrules", MarkerStyle: MarkerStyleHash}}},
+			wantErr: false,
+		},
+		{
+			name:    "custom target outside project",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, Targets: []TargetConfig{{Filename: "../rules.md"}}},
+			wantErr: true,
+		},
+		{
+			name:    "custom target shadows built-in",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, Targets: []TargetConfig{{Filename: "CLAUDE.md"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid marker style",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, Targets: []TargetConfig{{Filename: ".windsurfrules", MarkerStyle: "xml"}}},
+			wantErr: true,
+		},
+		{
+			name:    "custom managed dir",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, ManagedDir: "platform"},
+			wantErr: false,
+		},
+		{
+			name:    "managed dir outside instructions dir",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, ManagedDir: ".."},
+			wantErr: true,
+		},
+		{
+			name:    "nested managed dir",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, ManagedDir: "a/../../b"},
+			wantErr: true,
+		},
+		{
+			name:    "nested instructions dir",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, InstructionsDir: "docs/ai"},
+			wantErr: false,
+		},
+		{
+			name:    "instructions dir is project dir",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, InstructionsDir: "."},
+			wantErr: false,
+		},
+		{
+			name:    "instructions dir outside project",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, InstructionsDir: "../shared"},
+			wantErr: true,
+		},
+		{
+			name:    "instructions dir with dot-dot inside project",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, InstructionsDir: "docs/../ai"},
+			wantErr: true,
+		},
+		{
+			name:    "absolute instructions dir",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, InstructionsDir: "/etc/ai"},
+			wantErr: true,
+		},
+		{
+			name:    "tools",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, Tools: []string{ToolClaude, ToolCursor}},
+			wantErr: false,
+		},
+		{
+			name:    "unknown tool",
+			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{"php"}, Tools: []string{"copilot"}},
+			wantErr: true,
+		},
 		{
 			name:    "no stacks",
 			c:       &Config{Version: 1, Registry: RegistryConfig{URL: "https://example.com"}, Stacks: []string{}},
@@ -317,3 +635,229 @@ func TestSaveConfigHasCommentSeparator(t *testing.T) {
 		t.Error("config with resolved should contain do-not-edit warning")
 	}
 }
+
+func TestSaveConfigIsStable(t *testing.T) {
+	build := func(files []string, hashOrder []string) *Config {
+		hashes := make(map[string]string)
+		for _, f := range hashOrder {
+			hashes[f] = "sha256:" + f
+		}
+		return &Config{
+			Version:  1,
+			Registry: RegistryConfig{URL: "https://ai-ctx.example.com"},
+			Stacks:   []string{"php"},
+			Resolved: map[string]ResolvedStack{
+				"php": {Version: "1.2.0", Hash: "sha256:abc", Files: files, FileHashes: hashes, Explicit: true},
+			},
+		}
+	}
+
+	save := func(c *Config) []byte {
+		t.Helper()
+		dir := t.TempDir()
+		if err := SaveConfig(dir, c); err != nil {
+			t.Fatalf("SaveConfig() error: %v", err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, ConfigFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first := save(build([]string{"testing.md", "coding-standards.md", "arch.md"}, []string{"testing.md", "arch.md", "coding-standards.md"}))
+	second := save(build([]string{"arch.md", "coding-standards.md", "testing.md"}, []string{"coding-standards.md", "testing.md", "arch.md"}))
+	if string(first) != string(second) {
+		t.Errorf("same state saved differently:\n%s\n---\n%s", first, second)
+	}
+
+	// Saving what was loaded is a no-op
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ConfigFile), first, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if again := save(loaded); string(again) != string(first) {
+		t.Errorf("re-saving loaded config changed it:\n%s\n---\n%s", first, again)
+	}
+
+	if !strings.Contains(string(first), "- arch.md\n            - coding-standards.md\n            - testing.md") {
+		t.Errorf("files not sorted:\n%s", first)
+	}
+}
+
+func TestSaveConfigPreservesComments(t *testing.T) {
+	dir := t.TempDir()
+	content := `# Managed by the platform team, ask in #ai before changing
+version: 1
+registry:
+    url: https://ai-ctx.example.com # moved in 2026
+    branch: master
+stacks: [php, laravel]
+skip_injection:
+    - .cursorrules # nobody uses Cursor here
+    # AGENTS.md is written by hand
+    - AGENTS.md
+`
+	path := filepath.Join(dir, ConfigFile)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	loaded.Stacks = append(loaded.Stacks, "vue")
+	loaded.Registry.Branch = "main"
+	loaded.Resolved = map[string]ResolvedStack{"php": {Version: "1.0.0", Explicit: true}}
+	if err := SaveConfig(dir, loaded); err != nil {
+		t.Fatalf("SaveConfig() error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := string(data)
+	for _, want := range []string{
+		"# Managed by the platform team, ask in #ai before changing",
+		"url: https://ai-ctx.example.com # moved in 2026",
+		"branch: main",
+		"stacks: [php, laravel, vue]",
+		"- .cursorrules # nobody uses Cursor here",
+		"# AGENTS.md is written by hand",
+		resolvedChecksumPrefix,
+	} {
+		if !strings.Contains(saved, want) {
+			t.Errorf("saved config lacks %q:\n%s", want, saved)
+		}
+	}
+
+	// The comments survive another round trip unchanged
+	reloaded, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig() after save error: %v", err)
+	}
+	if reloaded.ResolvedEdited() {
+		t.Error("resolved section reported as edited")
+	}
+	if err := SaveConfig(dir, reloaded); err != nil {
+		t.Fatalf("SaveConfig() error: %v", err)
+	}
+	again, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != saved {
+		t.Errorf("re-saving changed the config:\n%s\n---\n%s", saved, again)
+	}
+}
+
+func TestRegistryURLInterpolation(t *testing.T) {
+	t.Setenv("AI_REGISTRY_HOST", "https://staging.example.com")
+	t.Setenv("TEAM", "payments")
+
+	dir := t.TempDir()
+	content := "version: 1\nregistry:\n  url: ${AI_REGISTRY_HOST}/cego/ai-marketplace\nregistries:\n  - url: ${AI_REGISTRY_HOST}/${TEAM}/ai\nstacks:\n  - php\n"
+	if err := os.WriteFile(filepath.Join(dir, ConfigFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Registry.URL != "https://staging.example.com/cego/ai-marketplace" {
+		t.Errorf("Registry.URL = %q", cfg.Registry.URL)
+	}
+	if cfg.Registries[0].URL != "https://staging.example.com/payments/ai" {
+		t.Errorf("Registries[0].URL = %q", cfg.Registries[0].URL)
+	}
+
+	// Saving keeps the references
+	if err := SaveConfig(dir, cfg); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, ConfigFile))
+	for _, want := range []string{"url: ${AI_REGISTRY_HOST}/cego/ai-marketplace", "url: ${AI_REGISTRY_HOST}/${TEAM}/ai"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("saved config lacks %q:\n%s", want, data)
+		}
+	}
+
+	// A URL changed after loading is saved as is
+	cfg.Registry.URL = "https://gitlab.example.com/other"
+	if err := SaveConfig(dir, cfg); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, ConfigFile))
+	if !strings.Contains(string(data), "url: https://gitlab.example.com/other") {
+		t.Errorf("saved config lacks the changed URL:\n%s", data)
+	}
+}
+
+func TestRegistryURLInterpolationUnsetVariable(t *testing.T) {
+	dir := t.TempDir()
+	content := "version: 1\nregistry:\n  url: ${AI_INSTRUCTIONS_TEST_UNSET_HOST}/cego/ai\nstacks:\n  - php\n"
+	if err := os.WriteFile(filepath.Join(dir, ConfigFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadConfig(dir)
+	want := "registry url: environment variable AI_INSTRUCTIONS_TEST_UNSET_HOST is not set"
+	if err == nil || err.Error() != want {
+		t.Errorf("LoadConfig() error = %v, want %q", err, want)
+	}
+}
+
+func TestResolvedEdited(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{
+		Version:  1,
+		Registry: RegistryConfig{URL: "https://ai-ctx.example.com"},
+		Stacks:   []string{"php"},
+		Resolved: map[string]ResolvedStack{
+			"php": {Version: "1.2.0", Hash: "sha256:abc", Files: []string{"rules.md"}, Explicit: true},
+		},
+	}
+	if err := SaveConfig(dir, cfg); err != nil {
+		t.Fatalf("SaveConfig() error: %v", err)
+	}
+	path := filepath.Join(dir, ConfigFile)
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		edit       func(string) string
+		wantEdited bool
+	}{
+		{name: "untouched", edit: func(s string) string { return s }},
+		{name: "user section edited", edit: func(s string) string { return strings.Replace(s, "mode: platform", "mode: platform # team", 1) }},
+		{name: "version bumped", edit: func(s string) string { return strings.Replace(s, "version: 1.2.0", "version: 1.3.0", 1) }, wantEdited: true},
+		{name: "no checksum", edit: func(s string) string {
+			return strings.Replace(strings.Replace(s, "version: 1.2.0", "version: 1.3.0", 1), resolvedChecksumPrefix, "# ", 1)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(tt.edit(string(saved))), 0644); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := LoadConfig(dir)
+			if err != nil {
+				t.Fatalf("LoadConfig() error: %v", err)
+			}
+			if loaded.ResolvedEdited() != tt.wantEdited {
+				t.Errorf("ResolvedEdited() = %v, want %v", loaded.ResolvedEdited(), tt.wantEdited)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import "sort"
+
+// ConfigDiff describes how the resolved stacks of two configs differ.
+type ConfigDiff struct {
+	// Added are resolved only in the new config.
+	Added []string
+	// Removed are resolved only in the old config.
+	Removed []string
+	// Changed are resolved in both, with a different version, hash or files.
+	Changed []StackChange
+}
+
+// StackChange describes how a stack resolved in both configs differs between them.
+type StackChange struct {
+	Stack      string
+	OldVersion string
+	NewVersion string
+	// AddedFiles and RemovedFiles are the files only the new or only the old config lists.
+	AddedFiles   []string
+	RemovedFiles []string
+	// ModifiedFiles are listed in both, with a different recorded hash.
+	ModifiedFiles []string
+}
+
+// Empty reports whether the configs resolve the same stacks.
+func (d ConfigDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// VersionChanged reports whether the stack's version differs between the configs.
+func (c StackChange) VersionChanged() bool {
+	return c.OldVersion != c.NewVersion
+}
+
+// Diff compares the resolved stacks of two configs. A nil config counts as empty, so
+// Diff(nil, c) lists every stack of c as added. All lists are sorted.
+func Diff(old, new *Config) ConfigDiff {
+	var oldResolved, newResolved map[string]ResolvedStack
+	if old != nil {
+		oldResolved = old.Resolved
+	}
+	if new != nil {
+		newResolved = new.Resolved
+	}
+
+	var d ConfigDiff
+	for id := range oldResolved {
+		if _, ok := newResolved[id]; !ok {
+			d.Removed = append(d.Removed, id)
+		}
+	}
+	for id, n := range newResolved {
+		o, ok := oldResolved[id]
+		if !ok {
+			d.Added = append(d.Added, id)
+			continue
+		}
+		change := StackChange{Stack: id, OldVersion: o.Version, NewVersion: n.Version}
+		change.AddedFiles, change.RemovedFiles = FileChanges(o.Files, n.Files)
+		for _, f := range n.Files {
+			if oh, ok := o.FileHashes[f]; ok && oh != n.FileHashes[f] {
+				change.ModifiedFiles = append(change.ModifiedFiles, f)
+			}
+		}
+		sort.Strings(change.ModifiedFiles)
+		if change.VersionChanged() || o.Hash != n.Hash || len(change.AddedFiles) > 0 ||
+			len(change.RemovedFiles) > 0 || len(change.ModifiedFiles) > 0 {
+			d.Changed = append(d.Changed, change)
+		}
+	}
+
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Stack < d.Changed[j].Stack })
+	return d
+}
+
+// FileChanges returns the files in new but not in old, and the files in old but not in
+// new, each sorted.
+func FileChanges(old, new []string) (added, removed []string) {
+	oldSet := make(map[string]bool, len(old))
+	for _, f := range old {
+		oldSet[f] = true
+	}
+	newSet := make(map[string]bool, len(new))
+	for _, f := range new {
+		newSet[f] = true
+		if !oldSet[f] {
+			added = append(added, f)
+		}
+	}
+	for _, f := range old {
+		if !newSet[f] {
+			removed = append(removed, f)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := &Config{Resolved: map[string]ResolvedStack{
+		"php":     {Version: "1.0.0", Hash: "sha256:a", Files: []string{"rules.md"}, FileHashes: map[string]string{"rules.md": "sha256:1"}},
+		"laravel": {Version: "1.3.0", Hash: "sha256:b", Files: []string{"a.md", "old.md"}, FileHashes: map[string]string{"a.md": "sha256:2", "old.md": "sha256:3"}},
+		"vue":     {Version: "2.0.0", Hash: "sha256:c", Files: []string{"vue.md"}},
+		"go":      {Version: "1.0.0", Hash: "sha256:d"},
+	}}
+
+	tests := []struct {
+		name string
+		old  *Config
+		new  *Config
+		want ConfigDiff
+	}{
+		{name: "unchanged", old: old, new: old, want: ConfigDiff{}},
+		{name: "both nil", want: ConfigDiff{}},
+		{
+			name: "added",
+			old:  &Config{Resolved: map[string]ResolvedStack{"php": old.Resolved["php"]}},
+			new:  &Config{Resolved: map[string]ResolvedStack{"php": old.Resolved["php"], "vue": old.Resolved["vue"], "go": old.Resolved["go"]}},
+			want: ConfigDiff{Added: []string{"go", "vue"}},
+		},
+		{
+			name: "removed",
+			old:  old,
+			new:  &Config{Resolved: map[string]ResolvedStack{"php": old.Resolved["php"]}},
+			want: ConfigDiff{Removed: []string{"go", "laravel", "vue"}},
+		},
+		{
+			name: "from nothing",
+			new:  &Config{Resolved: map[string]ResolvedStack{"php": old.Resolved["php"]}},
+			want: ConfigDiff{Added: []string{"php"}},
+		},
+		{
+			name: "bump",
+			old:  old,
+			new: &Config{Resolved: map[string]ResolvedStack{
+				"php":     {Version: "1.1.0", Hash: "sha256:e", Files: []string{"rules.md"}, FileHashes: map[string]string{"rules.md": "sha256:4"}},
+				"laravel": {Version: "1.4.0", Hash: "sha256:f", Files: []string{"a.md", "new.md"}, FileHashes: map[string]string{"a.md": "sha256:2", "new.md": "sha256:5"}},
+				"vue":     old.Resolved["vue"],
+				"go":      {Version: "1.0.0", Hash: "sha256:g"},
+			}},
+			want: ConfigDiff{Changed: []StackChange{
+				{Stack: "go", OldVersion: "1.0.0", NewVersion: "1.0.0"},
+				{Stack: "laravel", OldVersion: "1.3.0", NewVersion: "1.4.0", AddedFiles: []string{"new.md"}, RemovedFiles: []string{"old.md"}},
+				{Stack: "php", OldVersion: "1.0.0", NewVersion: "1.1.0", ModifiedFiles: []string{"rules.md"}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diff(tt.old, tt.new)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %+v, want %+v", got, tt.want)
+			}
+			if got.Empty() != tt.want.Empty() {
+				t.Errorf("Empty() = %v, want %v", got.Empty(), tt.want.Empty())
+			}
+		})
+	}
+}
+
+func TestStackChangeVersionChanged(t *testing.T) {
+	if (StackChange{OldVersion: "1.0.0", NewVersion: "1.0.0"}).VersionChanged() {
+		t.Error("VersionChanged() = true for the same version")
+	}
+	if !(StackChange{OldVersion: "1.0.0", NewVersion: "1.1.0"}).VersionChanged() {
+		t.Error("VersionChanged() = false for a bump")
+	}
+}
+
+func TestFileChanges(t *testing.T) {
+	tests := []struct {
+		name        string
+		old         []string
+		new         []string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{name: "unchanged", old: []string{"a.md", "b.md"}, new: []string{"b.md", "a.md"}},
+		{name: "added", old: []string{"a.md"}, new: []string{"c.md", "a.md", "b.md"}, wantAdded: []string{"b.md", "c.md"}},
+		{name: "removed", old: []string{"a.md", "b.md"}, new: []string{"a.md"}, wantRemoved: []string{"b.md"}},
+		{name: "renamed", old: []string{"old.md"}, new: []string{"new.md"}, wantAdded: []string{"new.md"}, wantRemoved: []string{"old.md"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := FileChanges(tt.old, tt.new)
+			if !reflect.DeepEqual(added, tt.wantAdded) {
+				t.Errorf("added = %v, want %v", added, tt.wantAdded)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("removed = %v, want %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import "sort"
+
+// Drift describes where the stacks list and the resolved section disagree.
+type Drift struct {
+	// Unresolved are listed in stacks but have no resolved entry.
+	Unresolved []string
+	// Unlisted are resolved as explicit but missing from stacks. Imported stacks are
+	// never listed in stacks, so they don't count.
+	Unlisted []string
+}
+
+// Empty reports whether the config is consistent.
+func (d Drift) Empty() bool {
+	return len(d.Unresolved) == 0 && len(d.Unlisted) == 0
+}
+
+// StackDrift cross-checks the explicit stacks list against the resolved section.
+func StackDrift(c *Config) Drift {
+	var d Drift
+
+	listed := make(map[string]bool, len(c.Stacks))
+	for _, id := range c.Stacks {
+		listed[id] = true
+		if _, ok := c.Resolved[id]; !ok {
+			d.Unresolved = append(d.Unresolved, id)
+		}
+	}
+	for id, rs := range c.Resolved {
+		if rs.Explicit && !rs.Local && !listed[id] {
+			d.Unlisted = append(d.Unlisted, id)
+		}
+	}
+
+	sort.Strings(d.Unresolved)
+	sort.Strings(d.Unlisted)
+	return d
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStackDrift(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *Config
+		want Drift
+	}{
+		{
+			name: "consistent",
+			c: &Config{
+				Stacks: []string{"laravel"},
+				Resolved: map[string]ResolvedStack{
+					"laravel": {Explicit: true},
+					"php":     {DependencyOf: "laravel"},
+				},
+			},
+			want: Drift{},
+		},
+		{
+			name: "listed but unresolved",
+			c: &Config{
+				Stacks:   []string{"laravel", "vue"},
+				Resolved: map[string]ResolvedStack{"laravel": {Explicit: true}},
+			},
+			want: Drift{Unresolved: []string{"vue"}},
+		},
+		{
+			name: "resolved but unlisted",
+			c: &Config{
+				Stacks: []string{"laravel"},
+				Resolved: map[string]ResolvedStack{
+					"laravel": {Explicit: true},
+					"go":      {Explicit: true},
+				},
+			},
+			want: Drift{Unlisted: []string{"go"}},
+		},
+		{
+			name: "imported stack",
+			c: &Config{
+				Stacks: []string{"laravel"},
+				Resolved: map[string]ResolvedStack{
+					"laravel":  {Explicit: true},
+					"handbook": {Explicit: true, Local: true},
+				},
+			},
+			want: Drift{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := StackDrift(tt.c)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("StackDrift() = %+v, want %+v", got, tt.want)
+			}
+			if got.Empty() != tt.want.Empty() {
+				t.Errorf("Empty() = %v, want %v", got.Empty(), tt.want.Empty())
+			}
+		})
+	}
+}
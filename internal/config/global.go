@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// GlobalConfigFile is the user config's path within the XDG config directory.
+const GlobalConfigFile = "ai-instructions/config.yml"
+
+// GlobalConfig holds a user's defaults for every project, read from
+// $XDG_CONFIG_HOME/ai-instructions/config.yml. Its settings rank below flags,
+// environment variables and the project config, and above the built-in defaults.
+type GlobalConfig struct {
+	Registry GlobalRegistry `yaml:"registry,omitempty"`
+	Token    string         `yaml:"token,omitempty"`
+}
+
+// GlobalRegistry is the default registry of a GlobalConfig.
+type GlobalRegistry struct {
+	URL    string `yaml:"url,omitempty"`
+	Branch string `yaml:"branch,omitempty"`
+}
+
+// GlobalConfigPath returns the user config path: under $XDG_CONFIG_HOME, or under
+// ~/.config when it isn't set, as the XDG base directory spec prescribes.
+func GlobalConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, GlobalConfigFile), nil
+}
+
+// LoadGlobalConfig reads the user config. A missing file yields an empty config.
+func LoadGlobalConfig() (*GlobalConfig, error) {
+	path, err := GlobalConfigPath()
+	if err != nil {
+		return nil, fmt.Errorf("locating user config: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &GlobalConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var g GlobalConfig
+	if err := decodeStrict(data, &g); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &g, nil
+}
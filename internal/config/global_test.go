@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGlobalConfigPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if got, err := GlobalConfigPath(); err != nil || got != filepath.Join("/xdg", "ai-instructions", "config.yml") {
+		t.Errorf("GlobalConfigPath() = %q, %v, want it under XDG_CONFIG_HOME", got, err)
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", "")
+	if got, err := GlobalConfigPath(); err != nil || got != filepath.Join(home, ".config", "ai-instructions", "config.yml") {
+		t.Errorf("GlobalConfigPath() = %q, %v, want it under ~/.config", got, err)
+	}
+}
+
+func TestLoadGlobalConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // "" leaves the file missing
+		want    GlobalConfig
+		wantErr string
+	}{
+		{name: "missing", want: GlobalConfig{}},
+		{
+			name:    "settings",
+			content: "registry:\n  url: https://gitlab.example.com/ai\n  branch: main\ntoken: secret\n",
+			want:    GlobalConfig{Registry: GlobalRegistry{URL: "https://gitlab.example.com/ai", Branch: "main"}, Token: "secret"},
+		},
+		{name: "unknown key", content: "registry_url: https://x\n", wantErr: "registry_url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xdg := t.TempDir()
+			t.Setenv("XDG_CONFIG_HOME", xdg)
+			if tt.content != "" {
+				path := filepath.Join(xdg, GlobalConfigFile)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := LoadGlobalConfig()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadGlobalConfig() error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadGlobalConfig() error: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("LoadGlobalConfig() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile lists target files (one per line) that injection should leave untouched.
+const IgnoreFile = ".ai-instructions-ignore"
+
+// LoadIgnoreFile reads the ignore file from the given directory.
+// Blank lines and lines starting with # are skipped. Returns nil if the file doesn't exist.
+func LoadIgnoreFile(dir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(dir, IgnoreFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading %s: %w", IgnoreFile, err)
+	}
+	defer f.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", IgnoreFile, err)
+	}
+
+	return entries, nil
+}
+
+// SkippedTargets returns the set of target files excluded from injection,
+// combining the config's skip_injection list with the ignore file.
+func SkippedTargets(dir string, c *Config) (map[string]bool, error) {
+	skip := make(map[string]bool)
+	if c != nil {
+		for _, f := range c.SkipInjection {
+			skip[f] = true
+		}
+	}
+
+	entries, err := LoadIgnoreFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range entries {
+		skip[f] = true
+	}
+
+	return skip, nil
+}
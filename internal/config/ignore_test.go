@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+
+	entries, err := LoadIgnoreFile(dir)
+	if err != nil {
+		t.Fatalf("LoadIgnoreFile() error: %v", err)
+	}
+	if entries != nil {
+		t.Errorf("entries = %v, want nil for missing file", entries)
+	}
+
+	content := "# hand-written, do not manage\nCLAUDE.md\n\n  .cursorrules  \n"
+	os.WriteFile(filepath.Join(dir, IgnoreFile), []byte(content), 0644)
+
+	entries, err = LoadIgnoreFile(dir)
+	if err != nil {
+		t.Fatalf("LoadIgnoreFile() error: %v", err)
+	}
+	if len(entries) != 2 || entries[0] != "CLAUDE.md" || entries[1] != ".cursorrules" {
+		t.Errorf("entries = %v, want [CLAUDE.md .cursorrules]", entries)
+	}
+}
+
+func TestSkippedTargets(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, IgnoreFile), []byte("AGENTS.md\n"), 0644)
+
+	c := &Config{SkipInjection: []string{"CLAUDE.md"}}
+	skip, err := SkippedTargets(dir, c)
+	if err != nil {
+		t.Fatalf("SkippedTargets() error: %v", err)
+	}
+
+	if !skip["CLAUDE.md"] || !skip["AGENTS.md"] {
+		t.Errorf("skip = %v, want CLAUDE.md and AGENTS.md", skip)
+	}
+	if skip[".cursorrules"] {
+		t.Error(".cursorrules should not be skipped")
+	}
+}
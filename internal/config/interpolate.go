@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// envVarPattern matches ${VAR} references in registry URLs.
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} references in s with their environment values.
+// It fails if a referenced variable is not set.
+func expandEnv(s string) (string, error) {
+	var missing string
+	expanded := envVarPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envVarPattern.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && missing == "" {
+			missing = name
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s is not set", missing)
+	}
+	return expanded, nil
+}
+
+// expandURL resolves ${VAR} references in the registry URL, remembering the
+// original so that saving the config keeps the reference.
+func (r *RegistryConfig) expandURL() error {
+	if !envVarPattern.MatchString(r.URL) {
+		return nil
+	}
+	expanded, err := expandEnv(r.URL)
+	if err != nil {
+		return err
+	}
+	r.urlTemplate, r.expandedURL = r.URL, expanded
+	r.URL = expanded
+	return nil
+}
+
+// persisted returns the registry config as it should be written back: with the
+// original ${VAR} reference, unless the URL was changed since loading.
+func (r RegistryConfig) persisted() RegistryConfig {
+	if r.urlTemplate != "" && r.URL == r.expandedURL {
+		r.URL = r.urlTemplate
+	}
+	return r
+}
+
+// expandRegistryURLs resolves ${VAR} references in every registry URL of c.
+func expandRegistryURLs(c *Config) error {
+	if err := c.Registry.expandURL(); err != nil {
+		return fmt.Errorf("registry url: %w", err)
+	}
+	for i := range c.Registries {
+		if err := c.Registries[i].expandURL(); err != nil {
+			return fmt.Errorf("registries[%d] url: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -89,18 +89,14 @@ func MigrateFromOldSettings(dir string) (*Config, error) {
 		mode = "platform"
 	}
 
-	branch := old.Branch
-	if branch == "" {
-		branch = "master"
-	}
-
 	cfg := &Config{
 		Version: 1,
 		Registry: RegistryConfig{
 			URL:    old.RegistryURL,
-			Branch: branch,
+			Branch: old.Branch,
 		},
 		InstructionsDir: instrDir,
+		ManagedDir:      DefaultManagedDir,
 		Mode:            mode,
 		Stacks:          old.Stacks,
 		Resolved:        old.Resolved,
@@ -111,11 +111,15 @@ resolved:
 	if cfg.InstructionsDir != DefaultInstructionsDir {
 		t.Errorf("InstructionsDir = %q, want %q", cfg.InstructionsDir, DefaultInstructionsDir)
 	}
+	if cfg.ManagedDir != DefaultManagedDir {
+		t.Errorf("ManagedDir = %q, want %q", cfg.ManagedDir, DefaultManagedDir)
+	}
 	if cfg.Mode != "platform" {
 		t.Errorf("Mode = %q, want %q", cfg.Mode, "platform")
 	}
-	if cfg.Registry.Branch != "master" {
-		t.Errorf("Registry.Branch = %q, want %q", cfg.Registry.Branch, "master")
+	// The branch is left unset, so the user config's branch or the default applies
+	if cfg.Registry.Branch != "" {
+		t.Errorf("Registry.Branch = %q, want it unset", cfg.Registry.Branch)
 	}
 }
 
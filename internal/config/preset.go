@@ -0,0 +1,34 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Preset is a reusable project setup for init --from: the stacks to install
+// and the registry to install them from.
+type Preset struct {
+	Registry RegistryConfig `yaml:"registry"`
+	Mode     string         `yaml:"mode,omitempty"`
+	Stacks   []string       `yaml:"stacks"`
+}
+
+// LoadPreset reads and validates a preset file. Unknown keys are rejected so typos
+// don't silently fall back to defaults.
+func LoadPreset(path string) (*Preset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading preset: %w", err)
+	}
+
+	var p Preset
+	if err := decodeStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing preset %s: %w", path, err)
+	}
+
+	if len(p.Stacks) == 0 {
+		return nil, errors.New("invalid preset: stacks must list at least one stack")
+	}
+	return &p, nil
+}
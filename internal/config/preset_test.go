@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadPreset(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Preset
+		wantErr string
+	}{
+		{
+			name:    "full",
+			content: "registry:\n  url: https://gitlab.example.com/ai\n  branch: develop\nmode: platform\nstacks: [php, laravel]\n",
+			want: &Preset{
+				Registry: RegistryConfig{URL: "https://gitlab.example.com/ai", Branch: "develop"},
+				Mode:     "platform",
+				Stacks:   []string{"php", "laravel"},
+			},
+		},
+		{
+			name:    "stacks only",
+			content: "stacks:\n  - go\n",
+			want:    &Preset{Stacks: []string{"go"}},
+		},
+		{
+			name:    "no stacks",
+			content: "registry:\n  url: https://gitlab.example.com/ai\n",
+			wantErr: "stacks must list at least one stack",
+		},
+		{
+			name:    "unknown key",
+			content: "stack: [php]\n",
+			wantErr: `unknown key "stack"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "preset.yml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadPreset(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadPreset() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadPreset() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadPreset() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,19 +1,90 @@
 package config
 
+import "fmt"
+
 const DefaultInstructionsDir = "ai-instructions"
-const ManagedDir = "company-instructions"
+const DefaultManagedDir = "company-instructions"
 const DefaultRegistryURL = "https://gitlab.cego.dk/cego/platform-agent-instructions"
 const DefaultBranch = "master"
 
+// LocalVersion is the version recorded for imported stacks, which have no registry version.
+const LocalVersion = "local"
+
+// DefaultContextLimitKB is the default size of a target's managed instructions above
+// which sync and doctor warn that they may not fit in a tool's context.
+const DefaultContextLimitKB = 100
+
+// Managed block placement values for the placement setting.
+const (
+	PlacementPrepend = "prepend"
+	PlacementAppend  = "append"
+)
+
+// Marker styles for custom targets.
+const (
+	MarkerStyleHTML = "html"
+	MarkerStyleHash = "hash"
+)
+
+// BuiltinTargets are the target files that are always managed, controlled by each stack's tools settings.
+var BuiltinTargets = []string{"CLAUDE.md", "AGENTS.md", ".cursorrules"}
+
+// TargetConfig defines an additional file to inject the managed block into.
+type TargetConfig struct {
+	Filename    string   `yaml:"filename"`
+	MarkerStyle string   `yaml:"marker_style,omitempty"`
+	Stacks      []string `yaml:"stacks,omitempty"`
+}
+
+// BlockConfig overrides the wording around the file list of the managed blocks.
+// Empty fields keep the default text.
+type BlockConfig struct {
+	Heading string `yaml:"heading,omitempty"` // replaces "# Company AI Instructions"
+	Footer  string `yaml:"footer,omitempty"`  // replaces the closing "mandatory company standards" line
+}
+
+// HooksConfig holds shell commands run in the project dir after a successful command.
+// Hooks are skipped in CI unless RunInCI is set.
+type HooksConfig struct {
+	PostInit string `yaml:"post_init,omitempty"`
+	PostSync string `yaml:"post_sync,omitempty"` // after sync and update
+	RunInCI  bool   `yaml:"run_in_ci,omitempty"`
+}
+
 // ResolvedStack represents a single resolved stack in the lockfile.
 type ResolvedStack struct {
-	Version      string            `yaml:"version"`
-	Hash         string            `yaml:"hash"`
-	Files        []string          `yaml:"files"`
-	FileHashes   map[string]string `yaml:"file_hashes,omitempty"`
-	Tools        ToolsConfig       `yaml:"tools"`
-	Explicit     bool              `yaml:"explicit,omitempty"`
-	DependencyOf string            `yaml:"dependency_of,omitempty"`
+	Version      string                 `yaml:"version"`
+	Hash         string                 `yaml:"hash"`
+	Files        []string               `yaml:"files"`
+	FileHashes   map[string]string      `yaml:"file_hashes,omitempty"`
+	ETags        map[string]string      `yaml:"etags,omitempty"` // file → registry ETag, for conditional re-downloads
+	Tools        ToolsConfig            `yaml:"tools"`
+	FileTools    map[string]ToolsConfig `yaml:"file_tools,omitempty"`
+	Explicit     bool                   `yaml:"explicit,omitempty"`
+	DependencyOf string                 `yaml:"dependency_of,omitempty"`
+	// Depends are the resolved stacks this one was ordered after when it was locked: its
+	// dependencies, and the optional and conditional ones that were installed too. Unlike
+	// dependency_of, it keeps every parent of a shared dependency.
+	Depends []string `yaml:"depends,omitempty"`
+	// Local marks a stack imported from files in the project rather than downloaded from
+	// the registry. Sync leaves it alone; re-importing it is the only way to change it.
+	Local bool `yaml:"local,omitempty"`
+	// Locale is the locale the stack's files were downloaded in, for stacks that offer several.
+	Locale string `yaml:"locale,omitempty"`
+	// Inline are the files whose content the managed blocks embed rather than reference.
+	Inline []string `yaml:"inline,omitempty"`
+	// VariablesHash identifies the variables the stack's templates were rendered with, so a
+	// change to them renders the files again. Empty for stacks without templates.
+	VariablesHash string `yaml:"variables_hash,omitempty"`
+}
+
+// ToolsFor returns the tools a file of the stack targets: its file_tools setting if it has one,
+// otherwise the stack's.
+func (rs ResolvedStack) ToolsFor(file string) ToolsConfig {
+	if t, ok := rs.FileTools[file]; ok {
+		return t
+	}
+	return rs.Tools
 }
 
 // ToolsConfig specifies which AI tool files a stack targets.
@@ -22,3 +93,52 @@ type ToolsConfig struct {
 	IncludeInAgentsMD    bool `yaml:"include_in_agents_md"`
 	IncludeInCursorRules bool `yaml:"include_in_cursorrules"`
 }
+
+// Tool names, as used by stack manifests' file_tools and bundle --tool.
+const (
+	ToolClaude = "claude"
+	ToolAgents = "agents"
+	ToolCursor = "cursor"
+)
+
+// ToolsFromNames builds a ToolsConfig that includes exactly the named tools.
+func ToolsFromNames(names []string) (ToolsConfig, error) {
+	var t ToolsConfig
+	for _, name := range names {
+		switch name {
+		case ToolClaude:
+			t.IncludeInClaudeMD = true
+		case ToolAgents:
+			t.IncludeInAgentsMD = true
+		case ToolCursor:
+			t.IncludeInCursorRules = true
+		default:
+			return ToolsConfig{}, fmt.Errorf("unknown tool %q", name)
+		}
+	}
+	return t, nil
+}
+
+// Includes reports whether the named tool is targeted. An empty name matches every config.
+func (t ToolsConfig) Includes(tool string) bool {
+	switch tool {
+	case ToolClaude:
+		return t.IncludeInClaudeMD
+	case ToolAgents:
+		return t.IncludeInAgentsMD
+	case ToolCursor:
+		return t.IncludeInCursorRules
+	}
+	return tool == ""
+}
+
+// Names returns the names of the targeted tools, the inverse of ToolsFromNames.
+func (t ToolsConfig) Names() []string {
+	var names []string
+	for _, name := range []string{ToolClaude, ToolAgents, ToolCursor} {
+		if t.Includes(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,226 @@
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Op is the kind of change a diff line represents.
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Line is a single line in a line diff.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// FileChanges summarises which files were added, removed or modified between two snapshots.
+type FileChanges struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// Empty reports whether no files changed.
+func (c FileChanges) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Modified) == 0
+}
+
+// Files compares two filename → content snapshots.
+func Files(old, new map[string][]byte) FileChanges {
+	var c FileChanges
+	for name, oldData := range old {
+		newData, ok := new[name]
+		if !ok {
+			c.Removed = append(c.Removed, name)
+			continue
+		}
+		if string(oldData) != string(newData) {
+			c.Modified = append(c.Modified, name)
+		}
+	}
+	for name := range new {
+		if _, ok := old[name]; !ok {
+			c.Added = append(c.Added, name)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Strings(c.Modified)
+	return c
+}
+
+// maxLCSCells bounds the LCS table of Lines, which holds one int per pair of changed
+// lines. Larger changes are diffed as a whole replacement instead.
+const maxLCSCells = 4 << 20
+
+// Lines computes a line-based diff using the longest common subsequence of the lines
+// between the common prefix and suffix.
+func Lines(old, new string) []Line {
+	a := splitLines(old)
+	b := splitLines(new)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []Line
+	for _, text := range a[:prefix] {
+		lines = append(lines, Line{Op: Equal, Text: text})
+	}
+	lines = append(lines, lcsLines(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, Line{Op: Equal, Text: text})
+	}
+	return lines
+}
+
+// lcsLines diffs a and b by their longest common subsequence. When the table would
+// exceed maxLCSCells, all of a is deleted and all of b inserted.
+func lcsLines(a, b []string) []Line {
+	var lines []Line
+	if len(a)*len(b) > maxLCSCells {
+		for _, text := range a {
+			lines = append(lines, Line{Op: Delete, Text: text})
+		}
+		for _, text := range b {
+			lines = append(lines, Line{Op: Insert, Text: text})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, Line{Op: Equal, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Op: Delete, Text: a[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: Insert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, Line{Op: Delete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, Line{Op: Insert, Text: b[j]})
+	}
+	return lines
+}
+
+// Unified renders a unified diff with the given number of context lines.
+// Returns an empty string if the inputs are identical.
+func Unified(oldName, newName, old, new string, context int) string {
+	lines := Lines(old, new)
+
+	var changed []int
+	for i, l := range lines {
+		if l.Op != Equal {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Group changed lines into hunks that overlap within the context window
+	for k := 0; k < len(changed); {
+		start := max(changed[k]-context, 0)
+		end := changed[k]
+		for k < len(changed) && changed[k] <= end+2*context {
+			end = changed[k]
+			k++
+		}
+		end = min(end+context, len(lines)-1)
+
+		oldStart, newStart := lineNumbers(lines, start)
+		oldCount, newCount := 0, 0
+		for _, l := range lines[start : end+1] {
+			if l.Op != Insert {
+				oldCount++
+			}
+			if l.Op != Delete {
+				newCount++
+			}
+		}
+
+		// A side without lines is numbered by the line before the hunk, 0 at the top
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, l := range lines[start : end+1] {
+			switch l.Op {
+			case Equal:
+				b.WriteString(" ")
+			case Insert:
+				b.WriteString("+")
+			case Delete:
+				b.WriteString("-")
+			}
+			b.WriteString(l.Text)
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+// lineNumbers returns the 1-based old and new line numbers at diff index idx.
+func lineNumbers(lines []Line, idx int) (int, int) {
+	oldLine, newLine := 1, 1
+	for _, l := range lines[:idx] {
+		if l.Op != Insert {
+			oldLine++
+		}
+		if l.Op != Delete {
+			newLine++
+		}
+	}
+	return oldLine, newLine
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
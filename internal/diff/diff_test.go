@@ -0,0 +1,167 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want []Line
+	}{
+		{
+			name: "identical",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: []Line{{Equal, "a"}, {Equal, "b"}},
+		},
+		{
+			name: "insert",
+			old:  "a\nc\n",
+			new:  "a\nb\nc\n",
+			want: []Line{{Equal, "a"}, {Insert, "b"}, {Equal, "c"}},
+		},
+		{
+			name: "delete",
+			old:  "a\nb\nc\n",
+			new:  "a\nc\n",
+			want: []Line{{Equal, "a"}, {Delete, "b"}, {Equal, "c"}},
+		},
+		{
+			name: "replace",
+			old:  "a\nb\n",
+			new:  "a\nx\n",
+			want: []Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}},
+		},
+		{
+			name: "from empty",
+			old:  "",
+			new:  "a\n",
+			want: []Line{{Insert, "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.old, tt.new)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	old := "# Title\n\nRule one.\nRule two.\n"
+	new := "# Title\n\nRule one.\nRule 2.\nRule three.\n"
+
+	got := Unified("a/rules.md", "b/rules.md", old, new, 3)
+
+	want := strings.Join([]string{
+		"--- a/rules.md",
+		"+++ b/rules.md",
+		"@@ -1,4 +1,5 @@",
+		" # Title",
+		" ",
+		" Rule one.",
+		"-Rule two.",
+		"+Rule 2.",
+		"+Rule three.",
+		"",
+	}, "\n")
+	if got != want {
+		t.Errorf("Unified() =\n%s\nwant\n%s", got, want)
+	}
+
+	if Unified("a", "b", old, old, 3) != "" {
+		t.Error("Unified() of identical input should be empty")
+	}
+}
+
+func TestUnifiedHunkHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     string
+		new     string
+		context int
+		want    string
+	}{
+		{name: "from empty", old: "", new: "a\nb\n", context: 3, want: "@@ -0,0 +1,2 @@"},
+		{name: "to empty", old: "a\nb\n", new: "", context: 3, want: "@@ -1,2 +0,0 @@"},
+		{name: "insert without context", old: "a\nb\n", new: "a\nx\nb\n", context: 0, want: "@@ -1,0 +2,1 @@"},
+		{name: "delete without context", old: "a\nx\nb\n", new: "a\nb\n", context: 0, want: "@@ -2,1 +1,0 @@"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Split(Unified("a", "b", tt.old, tt.new, tt.context), "\n")
+			if len(got) < 3 || got[2] != tt.want {
+				t.Errorf("Unified() hunk header = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesLargeInput(t *testing.T) {
+	var old, new strings.Builder
+	for i := 0; i < 3000; i++ {
+		if i%100 == 50 {
+			// Common lines the LCS would keep, but too many lines changed around them
+			old.WriteString("shared\n")
+			new.WriteString("shared\n")
+			continue
+		}
+		fmt.Fprintf(&old, "old %d\n", i)
+		fmt.Fprintf(&new, "new %d\n", i)
+	}
+	header := "# Title\n"
+
+	lines := Lines(header+old.String(), header+new.String())
+	counts := make(map[Op]int)
+	for _, l := range lines {
+		counts[l.Op]++
+	}
+	if want := map[Op]int{Equal: 1, Delete: 3000, Insert: 3000}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("Lines() op counts = %v, want %v", counts, want)
+	}
+
+	// A small change in a large file is still diffed line by line
+	edited := strings.Replace(old.String(), "old 1500\n", "changed\n", 1)
+	if got := Lines(old.String(), edited); len(got) != 3001 {
+		t.Errorf("Lines() of a one-line change = %d lines, want 3001", len(got))
+	}
+}
+
+func TestFiles(t *testing.T) {
+	old := map[string][]byte{
+		"kept.md":    []byte("same"),
+		"changed.md": []byte("before"),
+		"gone.md":    []byte("x"),
+	}
+	new := map[string][]byte{
+		"kept.md":    []byte("same"),
+		"changed.md": []byte("after"),
+		"added.md":   []byte("y"),
+	}
+
+	got := Files(old, new)
+	want := FileChanges{
+		Added:    []string{"added.md"},
+		Removed:  []string{"gone.md"},
+		Modified: []string{"changed.md"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Files() = %+v, want %+v", got, want)
+	}
+	if got.Empty() {
+		t.Error("Empty() should be false")
+	}
+	if !Files(old, old).Empty() {
+		t.Error("Files() of identical snapshots should be empty")
+	}
+}
@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/filemanager"
+	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/cego/ai-instructions/internal/resolver"
+)
+
+// downloadStack fetches a stack's manifest, downloads its files in cfg's locale, renders
+// its templates with cfg's variables and returns the resolved entry to record in config.
+// Files of prev that are intact on disk are only downloaded if the registry reports a new
+// ETag for them.
+func (e *Engine) downloadStack(ctx context.Context, fm *filemanager.Manager, cfg *config.Config, stackID, version string, prev config.ResolvedStack) (config.ResolvedStack, error) {
+	manifest, err := e.client.FetchStackManifest(ctx, stackID)
+	if err != nil {
+		return config.ResolvedStack{}, err
+	}
+
+	files, locale, err := localeFiles(manifest, cfg.Locale)
+	if err != nil {
+		return config.ResolvedStack{}, fmt.Errorf("stack %s: %w", stackID, err)
+	}
+
+	modes, err := fileModesFromManifest(manifest)
+	if err != nil {
+		return config.ResolvedStack{}, fmt.Errorf("stack %s: %w", stackID, err)
+	}
+	fileTools, err := fileToolsFromManifest(manifest)
+	if err != nil {
+		return config.ResolvedStack{}, fmt.Errorf("stack %s: %w", stackID, err)
+	}
+	inline, err := inlineFromManifest(manifest, files)
+	if err != nil {
+		return config.ResolvedStack{}, fmt.Errorf("stack %s: %w", stackID, err)
+	}
+	templates, err := templatesFromManifest(manifest, files)
+	if err != nil {
+		return config.ResolvedStack{}, fmt.Errorf("stack %s: %w", stackID, err)
+	}
+
+	// Templates are always downloaded: a copy kept because its ETag matches is the rendered
+	// file, which neither matches the published hash nor can be rendered again
+	etags := intactETags(fm.StackDir(stackID), prev)
+	dropETags(etags, templates)
+	opts := []filemanager.DownloadOption{
+		filemanager.WithFileModes(modes),
+		filemanager.WithExpectedHashes(manifest.Hashes),
+		filemanager.WithETags(etags),
+	}
+	var variablesHash string
+	if len(templates) > 0 {
+		data := e.templateData(cfg)
+		opts = append(opts, filemanager.WithRender(func(filename string, content []byte) ([]byte, error) {
+			if !slices.Contains(templates, filename) {
+				return content, nil
+			}
+			return renderTemplate(filename, content, data)
+		}))
+		variablesHash = data.hash()
+	}
+	if manifest.ArchiveURL != "" {
+		opts = append(opts, filemanager.WithArchiveURL(manifest.ArchiveURL))
+	}
+	if e.progress != nil {
+		opts = append(opts, filemanager.WithProgress(e.progress))
+	}
+	if err := fm.DownloadStack(ctx, stackID, files, opts...); err != nil {
+		return config.ResolvedStack{}, err
+	}
+	dropETags(etags, templates)
+	if len(files) == 0 {
+		// Nothing on disk to hash for a stack that only pulls in dependencies
+		return config.ResolvedStack{Version: version, Locale: locale}, nil
+	}
+
+	hash, err := filemanager.HashDir(fm.StackDir(stackID), files...)
+	if err != nil {
+		return config.ResolvedStack{}, fmt.Errorf("hashing %s: %w", stackID, err)
+	}
+	fileHashes, err := filemanager.HashFilesInStack(fm.StackDir(stackID), files)
+	if err != nil {
+		return config.ResolvedStack{}, fmt.Errorf("hashing %s: %w", stackID, err)
+	}
+
+	return config.ResolvedStack{
+		Version:       version,
+		Hash:          hash,
+		Files:         files,
+		FileHashes:    fileHashes,
+		ETags:         filesETags(files, etags),
+		Tools:         toolsConfigFromManifest(manifest.Tools),
+		FileTools:     fileTools,
+		Locale:        locale,
+		Inline:        inline,
+		VariablesHash: variablesHash,
+	}, nil
+}
+
+// recordMessage adds a downloaded stack's post-install message, if it has one, to result.
+// The manifest was already fetched for the download, so it comes from the cache.
+func (e *Engine) recordMessage(ctx context.Context, stackID string, result *Result) error {
+	manifest, err := e.client.FetchStackManifest(ctx, stackID)
+	if err != nil {
+		return err
+	}
+	if manifest.PostInstallMessage == "" {
+		return nil
+	}
+	if result.Messages == nil {
+		result.Messages = make(map[string]string)
+	}
+	result.Messages[stackID] = manifest.PostInstallMessage
+	return nil
+}
+
+// intactETags returns the recorded ETags of the stack files whose content still matches
+// the locked hash, which can safely be kept when the registry reports them unchanged.
+func intactETags(stackDir string, rs config.ResolvedStack) map[string]string {
+	etags := make(map[string]string, len(rs.ETags))
+	for f, etag := range rs.ETags {
+		locked, ok := rs.FileHashes[f]
+		if !ok {
+			continue
+		}
+		if actual, err := filemanager.HashFile(filepath.Join(stackDir, f)); err == nil && actual == locked {
+			etags[f] = etag
+		}
+	}
+	return etags
+}
+
+// dropETags removes the ETags of files from etags.
+func dropETags(etags map[string]string, files []string) {
+	for _, f := range files {
+		delete(etags, f)
+	}
+}
+
+// filesETags returns the ETags of files, or nil if none has one.
+func filesETags(files []string, etags map[string]string) map[string]string {
+	var out map[string]string
+	for _, f := range files {
+		if etag, ok := etags[f]; ok {
+			if out == nil {
+				out = make(map[string]string)
+			}
+			out[f] = etag
+		}
+	}
+	return out
+}
+
+// fileModesFromManifest parses the manifest's octal file modes.
+// Only permission bits are accepted, so a manifest can't set setuid/setgid/sticky.
+func fileModesFromManifest(manifest *registry.StackManifest) (map[string]os.FileMode, error) {
+	modes := make(map[string]os.FileMode, len(manifest.Modes))
+	for filename, raw := range manifest.Modes {
+		v, err := strconv.ParseUint(raw, 8, 32)
+		if err != nil || v&^0777 != 0 {
+			return nil, fmt.Errorf("invalid mode %q for %s", raw, filename)
+		}
+		modes[filename] = os.FileMode(v)
+	}
+	return modes, nil
+}
+
+// fileToolsFromManifest parses the manifest's per-file tool targets.
+// Only files the manifest lists may be given targets; translations by their path in the stack.
+func fileToolsFromManifest(manifest *registry.StackManifest) (map[string]config.ToolsConfig, error) {
+	if len(manifest.FileTools) == 0 {
+		return nil, nil
+	}
+	files, err := ManifestFiles(manifest)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]bool, len(files))
+	for _, f := range files {
+		listed[f] = true
+	}
+
+	fileTools := make(map[string]config.ToolsConfig, len(manifest.FileTools))
+	for filename, names := range manifest.FileTools {
+		if !listed[filename] {
+			return nil, fmt.Errorf("file_tools names %s, which is not in files", filename)
+		}
+		tools, err := config.ToolsFromNames(names)
+		if err != nil {
+			return nil, fmt.Errorf("file_tools for %s: %w", filename, err)
+		}
+		fileTools[filename] = tools
+	}
+	return fileTools, nil
+}
+
+// inlineFromManifest returns the manifest's inline files that are among the downloaded
+// files. Only files the manifest lists may be inlined.
+func inlineFromManifest(manifest *registry.StackManifest, files []string) ([]string, error) {
+	return listedSubset(manifest, manifest.Inline, "inline", files)
+}
+
+// templatesFromManifest returns the manifest's template files that are among the
+// downloaded files. Only files the manifest lists may be templates.
+func templatesFromManifest(manifest *registry.StackManifest, files []string) ([]string, error) {
+	return listedSubset(manifest, manifest.Templates, "templates", files)
+}
+
+// listedSubset returns the names, from the manifest field called field, that are among
+// the downloaded files. Every name must be one of the manifest's files.
+func listedSubset(manifest *registry.StackManifest, names []string, field string, files []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	listed, err := ManifestFiles(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	var subset []string
+	for _, f := range names {
+		if !slices.Contains(listed, f) {
+			return nil, fmt.Errorf("%s names %s, which is not in files", field, f)
+		}
+		if slices.Contains(files, f) {
+			subset = append(subset, f)
+		}
+	}
+	return subset, nil
+}
+
+// toolsConfigFromManifest converts registry ToolsConfig to config ToolsConfig.
+func toolsConfigFromManifest(tools registry.ToolsConfig) config.ToolsConfig {
+	return config.ToolsConfig{
+		IncludeInClaudeMD:    tools.Claude.IncludeInClaudeMD,
+		IncludeInAgentsMD:    tools.Claude.IncludeInAgentsMD,
+		IncludeInCursorRules: tools.Cursor.IncludeInCursorRules,
+	}
+}
+
+// applyResolution sets the explicit/dependency_of attribution and the dependencies from a resolution.
+func applyResolution(rs config.ResolvedStack, res *resolver.Resolution, stackID string) config.ResolvedStack {
+	if res.Explicit[stackID] {
+		rs.Explicit = true
+		rs.DependencyOf = ""
+	} else {
+		rs.Explicit = false
+		rs.DependencyOf = res.DependencyOf[stackID]
+	}
+	rs.Depends = res.Depends[stackID]
+	return rs
+}
+
+// localStackIntact reports whether a resolved stack's files on disk match the locked hashes.
+func (e *Engine) localStackIntact(managedDir, stackID string, rs config.ResolvedStack) bool {
+	result := filemanager.VerifyStack(e.projectDir, managedDir, stackID, filemanager.StackVerifyInfo{
+		Hash:       rs.Hash,
+		Files:      rs.Files,
+		FileHashes: rs.FileHashes,
+	})
+	return result.OK
+}
@@ -0,0 +1,216 @@
+// Package engine implements the init, sync and update operations behind the CLI.
+// It does no terminal output of its own, so other front ends (bots, scripts) can drive
+// it with a project directory, a registry client and a config and inspect the Result.
+package engine
+
+import (
+	"context"
+	"slices"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/filemanager"
+	"github.com/cego/ai-instructions/internal/injector"
+	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/cego/ai-instructions/internal/resolver"
+)
+
+// Option configures an Engine.
+type Option func(*Engine)
+
+// Engine installs and syncs the stacks of a single project.
+type Engine struct {
+	client     *registry.Client
+	projectDir string
+	configFile string // config path, or "" for the default name in projectDir
+	progress   filemanager.ProgressFunc
+	debugf     func(format string, args ...any)
+}
+
+// New creates an engine operating on projectDir with the given registry client.
+func New(client *registry.Client, projectDir string, opts ...Option) *Engine {
+	e := &Engine{
+		client:     client,
+		projectDir: projectDir,
+		debugf:     func(string, ...any) {},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// WithProgress reports each downloaded file to fn.
+func WithProgress(fn filemanager.ProgressFunc) Option {
+	return func(e *Engine) { e.progress = fn }
+}
+
+// WithConfigFile saves the config to path instead of ai-instructions.yml in the project dir.
+func WithConfigFile(path string) Option {
+	return func(e *Engine) { e.configFile = path }
+}
+
+// saveConfig writes cfg to the engine's config file.
+func (e *Engine) saveConfig(cfg *config.Config) error {
+	if e.configFile != "" {
+		return config.SaveFile(e.configFile, cfg)
+	}
+	return config.SaveConfig(e.projectDir, cfg)
+}
+
+// WithDebug sends diagnostic messages to fn.
+func WithDebug(fn func(format string, args ...any)) Option {
+	return func(e *Engine) { e.debugf = fn }
+}
+
+// FetchError indicates the registry could not be fetched.
+type FetchError struct {
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Result describes what an operation did.
+type Result struct {
+	// Order is every resolved stack in dependency order.
+	Order []string
+	// Updates are the stacks that were downloaded.
+	Updates []StackUpdate
+	// Unchanged are the checked stacks that were already up to date.
+	Unchanged []string
+	// Missing are resolved stacks the registry no longer has; they were skipped.
+	Missing []string
+	// Pruned are explicit stacks the registry no longer has, removed by a sync with Prune.
+	Pruned []string
+	// Kept are stacks with local modifications that were left as they were.
+	Kept []string
+	// Diffs holds the content changes of each updated stack, when requested.
+	Diffs []StackDiff
+	// Targets are the target files the managed blocks were injected into.
+	Targets []injector.FileConfig
+	// Rewritten are the target files whose content changed; the others were left untouched.
+	Rewritten []string
+	// Injected is set when the managed blocks were written, and false when injection was
+	// disabled by the config or for the run.
+	Injected bool
+	// Messages are the post-install messages of the downloaded stacks, by stack ID.
+	Messages map[string]string
+	// StaleManagedDir is the previous managed directory after managed_dir changed, when it
+	// was left in place because the new one already existed.
+	StaleManagedDir string
+}
+
+// StackUpdate records a version change. OldVersion is empty for new stacks.
+type StackUpdate struct {
+	Stack      string
+	OldVersion string
+	NewVersion string
+	Branch     string // branch override the stack was fetched from, if any
+}
+
+// StackDiff holds a stack's file contents before and after a download.
+type StackDiff struct {
+	Stack  string
+	Before map[string][]byte
+	After  map[string][]byte
+}
+
+// FetchRegistry fetches the registry index, wrapping failures in a FetchError.
+func (e *Engine) FetchRegistry(ctx context.Context) (*registry.Registry, error) {
+	reg, err := e.client.FetchRegistry(ctx)
+	if err != nil {
+		return nil, &FetchError{Err: err}
+	}
+	return reg, nil
+}
+
+// Resolve resolves the given stacks and their dependencies against a registry.
+func Resolve(reg *registry.Registry, stacks []string) (*resolver.Resolution, error) {
+	return resolver.NewResolver(StackInfos(reg)).Resolve(stacks)
+}
+
+// StackInfos converts the registry's stacks into resolver input.
+func StackInfos(reg *registry.Registry) map[string]resolver.StackInfo {
+	m := make(map[string]resolver.StackInfo)
+	for id, meta := range reg.Stacks {
+		m[id] = resolver.StackInfo{
+			ID:                 id,
+			Depends:            meta.Depends,
+			OptionalDepends:    meta.OptionalDepends,
+			ConditionalDepends: meta.ConditionalDepends,
+		}
+	}
+	return m
+}
+
+// ResolvedOrder orders the resolved stacks of a config offline, so that every
+// stack comes after its recorded dependencies. Configs locked before those were
+// recorded fall back to ordering each dependency before its dependency_of.
+func ResolvedOrder(resolved map[string]config.ResolvedStack) ([]string, error) {
+	stacks := make(map[string]resolver.StackInfo, len(resolved))
+	ids := make([]string, 0, len(resolved))
+	for id, rs := range resolved {
+		ids = append(ids, id)
+		info := resolver.StackInfo{ID: id}
+		for _, dep := range rs.Depends {
+			if _, ok := resolved[dep]; ok {
+				info.Depends = append(info.Depends, dep)
+			}
+		}
+		stacks[id] = info
+	}
+	for id, rs := range resolved {
+		if parent, ok := stacks[rs.DependencyOf]; ok && !rs.Explicit && !slices.Contains(parent.Depends, id) {
+			parent.Depends = append(parent.Depends, id)
+			stacks[rs.DependencyOf] = parent
+		}
+	}
+
+	res, err := resolver.NewResolver(stacks).Resolve(ids)
+	if err != nil {
+		return nil, err
+	}
+	return res.Order, nil
+}
+
+// ManagedDir returns the managed subdirectory of a config's instructions dir.
+// A nil config, or one without the settings, uses the default directories.
+func ManagedDir(cfg *config.Config) string {
+	instrDir, managed := config.DefaultInstructionsDir, config.DefaultManagedDir
+	if cfg != nil && cfg.InstructionsDir != "" {
+		instrDir = cfg.InstructionsDir
+	}
+	if cfg != nil && cfg.ManagedDir != "" {
+		managed = cfg.ManagedDir
+	}
+	return instrDir + "/" + managed
+}
+
+// inject writes the managed blocks for the resolved stacks in injection order and records
+// the target files in result. It does nothing when the config disables injection.
+func (e *Engine) inject(cfg *config.Config, result *Result) error {
+	if !cfg.InjectionEnabled() {
+		return nil
+	}
+	order, err := InjectionOrder(cfg)
+	if err != nil {
+		return err
+	}
+	configs, err := InjectorConfigs(e.projectDir, cfg, order)
+	if err != nil {
+		return err
+	}
+	rewritten, err := injector.InjectAll(e.projectDir, order, configs, ManagedDir(cfg))
+	if err != nil {
+		return err
+	}
+	result.Targets = configs
+	result.Rewritten = rewritten
+	result.Injected = true
+	return nil
+}
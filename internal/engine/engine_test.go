@@ -0,0 +1,760 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/filemanager"
+	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/cego/ai-instructions/internal/resolver"
+)
+
+func newTestEngine(t *testing.T) (*Engine, string) {
+	t.Helper()
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "..", "testdata", "registry"))))
+	t.Cleanup(server.Close)
+
+	client := registry.NewClient(registry.WithBaseURL(server.URL), registry.WithHTTPClient(server.Client()))
+	dir := t.TempDir()
+	return New(client, dir), dir
+}
+
+func newTestConfig(stacks ...string) *config.Config {
+	return &config.Config{
+		Version:         1,
+		Registry:        config.RegistryConfig{URL: "https://gitlab.example.com/ai", Branch: "master"},
+		InstructionsDir: config.DefaultInstructionsDir,
+		Mode:            "platform",
+		Stacks:          stacks,
+	}
+}
+
+func initStacks(t *testing.T, e *Engine, cfg *config.Config) *Result {
+	t.Helper()
+	ctx := context.Background()
+	reg, err := e.FetchRegistry(ctx)
+	if err != nil {
+		t.Fatalf("FetchRegistry: %v", err)
+	}
+	res, err := Resolve(reg, cfg.Stacks)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	result, err := e.Init(ctx, cfg, reg, res)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return result
+}
+
+func TestInit(t *testing.T) {
+	e, dir := newTestEngine(t)
+	cfg := newTestConfig("laravel")
+
+	result := initStacks(t, e, cfg)
+
+	if want := []string{"php", "laravel"}; !reflect.DeepEqual(result.Order, want) {
+		t.Errorf("Order = %v, want %v", result.Order, want)
+	}
+	if len(result.Updates) != 2 {
+		t.Errorf("Updates = %v, want 2 entries", result.Updates)
+	}
+	if cfg.Resolved["php"].DependencyOf != "laravel" || !cfg.Resolved["laravel"].Explicit {
+		t.Errorf("attribution not recorded: %+v", cfg.Resolved)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, config.ConfigFile)); err != nil {
+		t.Errorf("config not saved: %v", err)
+	}
+	claude, err := os.ReadFile(filepath.Join(dir, "CLAUDE.md"))
+	if err != nil {
+		t.Fatalf("reading CLAUDE.md: %v", err)
+	}
+	if !strings.Contains(string(claude), ManagedDir(cfg)+"/laravel/") {
+		t.Errorf("CLAUDE.md does not reference laravel:\n%s", claude)
+	}
+}
+
+func TestSync(t *testing.T) {
+	e, dir := newTestEngine(t)
+	cfg := newTestConfig("laravel")
+	initStacks(t, e, cfg)
+
+	// Locally modified files are restored
+	path := filepath.Join(dir, ManagedDir(cfg), "php", "coding-standards.md")
+	if err := os.WriteFile(path, []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := e.Sync(context.Background(), cfg, SyncOptions{Diff: true, Force: true})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if len(result.Updates) != 1 || result.Updates[0].Stack != "php" || result.Updates[0].OldVersion != "1.2.0" {
+		t.Errorf("Updates = %+v, want php re-downloaded", result.Updates)
+	}
+	if want := []string{"laravel"}; !reflect.DeepEqual(result.Unchanged, want) {
+		t.Errorf("Unchanged = %v, want %v", result.Unchanged, want)
+	}
+	if len(result.Diffs) != 1 || string(result.Diffs[0].Before["coding-standards.md"]) != "edited" {
+		t.Errorf("Diffs = %+v, want php diff from the edited file", result.Diffs)
+	}
+}
+
+func TestImport(t *testing.T) {
+	e, dir := newTestEngine(t)
+	cfg := newTestConfig("php")
+	initStacks(t, e, cfg)
+
+	src := filepath.Join(t.TempDir(), "team")
+	for path, content := range map[string]string{"style.md": "# Style", "docs/review.md": "# Review", "notes.txt": "skipped"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(src, path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := e.Import(cfg, "team", src); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	rs := cfg.Resolved["team"]
+	if !rs.Local || rs.Version != config.LocalVersion {
+		t.Errorf("Resolved[team] = %+v, want a local stack", rs)
+	}
+	if want := []string{"docs/review.md", "style.md"}; !reflect.DeepEqual(rs.Files, want) {
+		t.Errorf("Files = %v, want %v", rs.Files, want)
+	}
+	claude, err := os.ReadFile(filepath.Join(dir, "CLAUDE.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(claude), ManagedDir(cfg)+"/team/style.md") {
+		t.Errorf("CLAUDE.md doesn't reference the imported files:\n%s", claude)
+	}
+
+	// Sync neither downloads nor removes the local stack
+	result, err := e.Sync(context.Background(), cfg, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if len(result.Updates) != 0 {
+		t.Errorf("Updates = %+v, want none", result.Updates)
+	}
+	if _, ok := cfg.Resolved["team"]; !ok {
+		t.Error("sync dropped the local stack")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ManagedDir(cfg), "team", "style.md")); err != nil {
+		t.Errorf("sync removed the local stack's files: %v", err)
+	}
+
+	// A registry stack can't be replaced by an import
+	if _, err := e.Import(cfg, "php", src); err == nil {
+		t.Error("Import over a registry stack should fail")
+	}
+}
+
+func TestImportProjectRoot(t *testing.T) {
+	e, dir := newTestEngine(t)
+	cfg := newTestConfig("php")
+	initStacks(t, e, cfg)
+
+	for _, path := range []string{
+		"docs/guide.md",
+		"node_modules/pkg/README.md",
+		"vendor/lib/README.md",
+		"a/b/c/d/e/f/g/deep.md",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, path), []byte("# Doc"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := e.Import(cfg, "project", dir); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	// CLAUDE.md, AGENTS.md and the managed php stack are left out too
+	if got, want := cfg.Resolved["project"].Files, []string{"docs/guide.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Files = %v, want %v", got, want)
+	}
+}
+
+func TestSyncLocalModifications(t *testing.T) {
+	tests := []struct {
+		name        string
+		confirm     func(ctx context.Context, stackID string, files []string) (bool, error)
+		wantErr     bool
+		wantKept    bool
+		wantRestore bool
+	}{
+		{name: "refused without confirmation", wantErr: true},
+		{
+			name:     "declined",
+			confirm:  func(context.Context, string, []string) (bool, error) { return false, nil },
+			wantKept: true,
+		},
+		{
+			name:        "accepted",
+			confirm:     func(context.Context, string, []string) (bool, error) { return true, nil },
+			wantRestore: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, dir := newTestEngine(t)
+			cfg := newTestConfig("php")
+			initStacks(t, e, cfg)
+
+			path := filepath.Join(dir, ManagedDir(cfg), "php", "coding-standards.md")
+			if err := os.WriteFile(path, []byte("edited"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := e.Sync(context.Background(), cfg, SyncOptions{ConfirmOverwrite: tt.confirm})
+			var modErr *LocalModificationError
+			if tt.wantErr {
+				if !errors.As(err, &modErr) || modErr.Stack != "php" || !reflect.DeepEqual(modErr.Files, []string{"coding-standards.md"}) {
+					t.Fatalf("Sync error = %v, want LocalModificationError for php/coding-standards.md", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Sync: %v", err)
+			}
+			if !tt.wantErr && (len(result.Kept) == 1) != tt.wantKept {
+				t.Errorf("Kept = %v, want kept %v", result.Kept, tt.wantKept)
+			}
+
+			data, _ := os.ReadFile(path)
+			if restored := string(data) != "edited"; restored != tt.wantRestore {
+				t.Errorf("file restored = %v, want %v", restored, tt.wantRestore)
+			}
+		})
+	}
+}
+
+func TestSyncInjectionFailure(t *testing.T) {
+	e, dir := newTestEngine(t)
+	cfg := newTestConfig("php", "vue")
+	initStacks(t, e, cfg)
+
+	configPath := filepath.Join(dir, config.ConfigFile)
+	before, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Swapping vue for laravel changes the config, but CLAUDE.md can't be written
+	cfg.Stacks = []string{"laravel"}
+	if err := os.Mkdir(filepath.Join(dir, "CLAUDE.md.tmp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Sync(context.Background(), cfg, SyncOptions{}); err == nil {
+		t.Fatal("Sync should fail when injection fails")
+	}
+
+	after, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("config saved despite the failed injection:\n%s", after)
+	}
+	// The previous config still references vue, so its files must still be there
+	if _, err := os.Stat(filepath.Join(dir, ManagedDir(cfg), "vue")); err != nil {
+		t.Errorf("vue removed despite the failed injection: %v", err)
+	}
+}
+
+func TestSyncSelection(t *testing.T) {
+	e, _ := newTestEngine(t)
+	cfg := newTestConfig("laravel", "vue")
+	initStacks(t, e, cfg)
+
+	tests := []struct {
+		name string
+		opts SyncOptions
+		want []string
+	}{
+		{name: "all", opts: SyncOptions{}, want: []string{"laravel", "php", "vue"}},
+		{name: "only with dependencies", opts: SyncOptions{Only: []string{"laravel"}}, want: []string{"laravel", "php"}},
+		{name: "exclude", opts: SyncOptions{Exclude: []string{"vue"}}, want: []string{"laravel", "php"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.Sync(context.Background(), cfg, tt.opts)
+			if err != nil {
+				t.Fatalf("Sync: %v", err)
+			}
+			got := append([]string{}, result.Unchanged...)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checked stacks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncStackBranch(t *testing.T) {
+	e, dir := newTestEngine(t)
+	cfg := newTestConfig("laravel")
+	initStacks(t, e, cfg)
+
+	// Stacks on a branch override are refreshed even when their version is unchanged
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("..", "..", "testdata", "registry"))))
+	defer server.Close()
+	client := registry.NewClient(
+		registry.WithBaseURL(server.URL),
+		registry.WithHTTPClient(server.Client()),
+		registry.WithStackBranches(map[string]string{"php": "feature/x"}),
+	)
+
+	result, err := New(client, dir).Sync(context.Background(), cfg, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	want := []StackUpdate{{Stack: "php", OldVersion: "1.2.0", NewVersion: "1.2.0", Branch: "feature/x"}}
+	if !reflect.DeepEqual(result.Updates, want) {
+		t.Errorf("Updates = %+v, want %+v", result.Updates, want)
+	}
+}
+
+func TestFetchError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	e := New(registry.NewClient(registry.WithBaseURL(server.URL)), t.TempDir())
+	_, err := e.Sync(context.Background(), newTestConfig("php"), SyncOptions{})
+
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) {
+		t.Errorf("Sync error = %v, want FetchError", err)
+	}
+}
+
+func TestResolvedOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolved map[string]config.ResolvedStack
+		before   [][2]string
+	}{
+		{
+			name: "recorded dependencies",
+			resolved: map[string]config.ResolvedStack{
+				"laravel": {Explicit: true, Depends: []string{"pest", "php"}},
+				"php":     {Explicit: true},
+				"pest":    {DependencyOf: "laravel", Depends: []string{"php", "removed"}},
+			},
+			before: [][2]string{{"php", "pest"}, {"php", "laravel"}, {"pest", "laravel"}},
+		},
+		{
+			name: "legacy dependency_of",
+			resolved: map[string]config.ResolvedStack{
+				"nuxt-ui": {Explicit: true},
+				"nuxt":    {DependencyOf: "nuxt-ui"},
+				"vue":     {DependencyOf: "nuxt"},
+				"php":     {Explicit: true},
+				"docker":  {DependencyOf: "removed"},
+			},
+			before: [][2]string{{"vue", "nuxt"}, {"nuxt", "nuxt-ui"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := ResolvedOrder(tt.resolved)
+			if err != nil {
+				t.Fatalf("ResolvedOrder: %v", err)
+			}
+			if len(order) != len(tt.resolved) {
+				t.Fatalf("order = %v, want every resolved stack", order)
+			}
+			pos := make(map[string]int, len(order))
+			for i, id := range order {
+				pos[id] = i
+			}
+			for _, pair := range tt.before {
+				if pos[pair[0]] > pos[pair[1]] {
+					t.Errorf("order = %v, want %s before %s", order, pair[0], pair[1])
+				}
+			}
+		})
+	}
+}
+
+func TestIntactETags(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "rules.md"), []byte("rules"), 0644)
+	os.WriteFile(filepath.Join(dir, "edited.md"), []byte("edited"), 0644)
+
+	rs := config.ResolvedStack{
+		FileHashes: map[string]string{
+			"rules.md":   filemanager.HashBytes([]byte("rules")),
+			"edited.md":  filemanager.HashBytes([]byte("original")),
+			"missing.md": filemanager.HashBytes([]byte("missing")),
+		},
+		ETags: map[string]string{"rules.md": `"a"`, "edited.md": `"b"`, "missing.md": `"c"`, "unhashed.md": `"d"`},
+	}
+
+	want := map[string]string{"rules.md": `"a"`}
+	if got := intactETags(dir, rs); !reflect.DeepEqual(got, want) {
+		t.Errorf("intactETags() = %v, want %v", got, want)
+	}
+}
+
+// newLocalEngine returns an engine reading the registry files given by path below
+// company-instructions/ from a local directory.
+func newLocalEngine(t *testing.T, files map[string]string) (*Engine, string) {
+	t.Helper()
+	regDir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(regDir, "company-instructions", name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	dir := t.TempDir()
+	return New(registry.NewClient(registry.WithLocalDir(regDir)), dir), dir
+}
+
+func TestStackWithoutFiles(t *testing.T) {
+	e, dir := newLocalEngine(t, map[string]string{
+		"registry.json": `{"version": 1, "stacks": {
+			"php": {"name": "PHP", "version": "1.0.0", "category": "language"},
+			"backend": {"name": "Backend", "version": "1.0.0", "category": "bundle", "depends": ["php"]}}}`,
+		"php/stack.json":     `{"name": "PHP", "version": "1.0.0", "files": ["rules.md"], "tools": {"claude": {"include_in_claude_md": true}}}`,
+		"php/rules.md":       "# PHP",
+		"backend/stack.json": `{"name": "Backend", "version": "1.0.0", "files": []}`,
+	})
+	cfg := newTestConfig("backend")
+	initStacks(t, e, cfg)
+
+	if _, err := os.Stat(filepath.Join(dir, ManagedDir(cfg), "backend")); !os.IsNotExist(err) {
+		t.Errorf("backend should have no directory, stat error: %v", err)
+	}
+	if rs := cfg.Resolved["php"]; rs.DependencyOf != "backend" {
+		t.Errorf("php dependency_of = %q, want backend", rs.DependencyOf)
+	}
+	if !e.localStackIntact(ManagedDir(cfg), "backend", cfg.Resolved["backend"]) {
+		t.Error("backend should verify as intact")
+	}
+
+	result, err := e.Sync(context.Background(), cfg, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if len(result.Updates) != 0 {
+		t.Errorf("Updates = %+v, want none", result.Updates)
+	}
+}
+
+func TestPostInstallMessages(t *testing.T) {
+	e, _ := newLocalEngine(t, map[string]string{
+		"registry.json": `{"version": 1, "stacks": {
+			"php": {"name": "PHP", "version": "1.0.0", "category": "language"},
+			"laravel": {"name": "Laravel", "version": "1.0.0", "category": "framework", "depends": ["php"]}}}`,
+		"php/stack.json":     `{"name": "PHP", "version": "1.0.0", "files": ["rules.md"], "post_install_message": "Enable strict_types."}`,
+		"php/rules.md":       "# PHP",
+		"laravel/stack.json": `{"name": "Laravel", "version": "1.0.0", "files": ["rules.md"]}`,
+		"laravel/rules.md":   "# Laravel",
+	})
+	cfg := newTestConfig("laravel")
+
+	result := initStacks(t, e, cfg)
+	if want := map[string]string{"php": "Enable strict_types."}; !reflect.DeepEqual(result.Messages, want) {
+		t.Errorf("Messages = %v, want %v", result.Messages, want)
+	}
+
+	// Stacks that aren't downloaded again have nothing to say
+	result, err := e.Sync(context.Background(), cfg, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if len(result.Messages) != 0 {
+		t.Errorf("Messages after sync = %v, want none", result.Messages)
+	}
+}
+
+func TestSyncPrune(t *testing.T) {
+	regDir := t.TempDir()
+	writeRegistry := func(files map[string]string) {
+		for name, content := range files {
+			path := filepath.Join(regDir, "company-instructions", name)
+			os.MkdirAll(filepath.Dir(path), 0755)
+			os.WriteFile(path, []byte(content), 0644)
+		}
+	}
+	writeRegistry(map[string]string{
+		"registry.json": `{"version": 1, "stacks": {
+			"php": {"name": "PHP", "version": "1.0.0", "category": "language"},
+			"laravel": {"name": "Laravel", "version": "1.0.0", "category": "framework", "depends": ["php"]},
+			"go": {"name": "Go", "version": "1.0.0", "category": "language"}}}`,
+		"php/stack.json":     `{"name": "PHP", "version": "1.0.0", "files": ["rules.md"]}`,
+		"php/rules.md":       "# PHP",
+		"laravel/stack.json": `{"name": "Laravel", "version": "1.0.0", "files": ["rules.md"]}`,
+		"laravel/rules.md":   "# Laravel",
+		"go/stack.json":      `{"name": "Go", "version": "1.0.0", "files": ["rules.md"]}`,
+		"go/rules.md":        "# Go",
+	})
+	dir := t.TempDir()
+	cfg := newTestConfig("laravel", "go")
+	initStacks(t, New(registry.NewClient(registry.WithLocalDir(regDir)), dir), cfg)
+
+	// laravel is removed from the registry
+	writeRegistry(map[string]string{
+		"registry.json": `{"version": 1, "stacks": {
+			"php": {"name": "PHP", "version": "1.0.0", "category": "language"},
+			"go": {"name": "Go", "version": "1.0.0", "category": "language"}}}`,
+	})
+
+	e := New(registry.NewClient(registry.WithLocalDir(regDir)), dir)
+	var missing *resolver.MissingStackError
+	if _, err := e.Sync(context.Background(), cfg, SyncOptions{}); !errors.As(err, &missing) || missing.Stack != "laravel" {
+		t.Fatalf("Sync without prune error = %v, want missing stack laravel", err)
+	}
+	if _, ok := cfg.Resolved["laravel"]; !ok {
+		t.Fatal("sync without prune should keep laravel")
+	}
+
+	result, err := e.Sync(context.Background(), cfg, SyncOptions{Prune: true})
+	if err != nil {
+		t.Fatalf("Sync with prune: %v", err)
+	}
+	if !reflect.DeepEqual(result.Pruned, []string{"laravel"}) {
+		t.Errorf("Pruned = %v, want [laravel]", result.Pruned)
+	}
+	if !reflect.DeepEqual(cfg.Stacks, []string{"go"}) {
+		t.Errorf("Stacks = %v, want [go]", cfg.Stacks)
+	}
+	// php was only needed by laravel
+	for _, id := range []string{"laravel", "php"} {
+		if _, ok := cfg.Resolved[id]; ok {
+			t.Errorf("%s should no longer be resolved", id)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ManagedDir(cfg), id)); !os.IsNotExist(err) {
+			t.Errorf("%s files should be removed, stat error: %v", id, err)
+		}
+	}
+	if _, ok := cfg.Resolved["go"]; !ok {
+		t.Error("go should stay installed")
+	}
+}
+
+func TestUpdateKeepsOtherStacksLocked(t *testing.T) {
+	regDir := t.TempDir()
+	writeRegistry := func(files map[string]string) {
+		t.Helper()
+		for name, content := range files {
+			path := filepath.Join(regDir, "company-instructions", name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeRegistry(map[string]string{
+		"registry.json": `{"version": 1, "stacks": {
+			"php": {"name": "PHP", "version": "1.0.0", "category": "language"},
+			"vue": {"name": "Vue", "version": "1.0.0", "category": "language"}}}`,
+		"php/stack.json": `{"name": "PHP", "version": "1.0.0", "files": ["rules.md"]}`,
+		"php/rules.md":   "# PHP",
+		"vue/stack.json": `{"name": "Vue", "version": "1.0.0", "files": ["rules.md"]}`,
+		"vue/rules.md":   "# Vue",
+	})
+	dir := t.TempDir()
+	cfg := newTestConfig("php", "vue")
+	initStacks(t, New(registry.NewClient(registry.WithLocalDir(regDir)), dir), cfg)
+
+	// Both stacks move on, and vue now requires a new stack
+	writeRegistry(map[string]string{
+		"registry.json": `{"version": 1, "stacks": {
+			"php": {"name": "PHP", "version": "1.1.0", "category": "language"},
+			"vue": {"name": "Vue", "version": "2.0.0", "category": "language", "depends": ["typescript"]},
+			"typescript": {"name": "TypeScript", "version": "1.0.0", "category": "language"}}}`,
+		"php/stack.json":        `{"name": "PHP", "version": "1.1.0", "files": ["rules.md"]}`,
+		"vue/stack.json":        `{"name": "Vue", "version": "2.0.0", "files": ["rules.md"]}`,
+		"typescript/stack.json": `{"name": "TypeScript", "version": "1.0.0", "files": ["rules.md"]}`,
+		"typescript/rules.md":   "# TypeScript",
+	})
+	e := New(registry.NewClient(registry.WithLocalDir(regDir)), dir)
+	result, err := e.Update(context.Background(), cfg, []string{"php"}, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if len(result.Updates) != 1 || result.Updates[0].Stack != "php" {
+		t.Errorf("Updates = %+v, want only php", result.Updates)
+	}
+	if got := cfg.Resolved["vue"].Version; got != "1.0.0" {
+		t.Errorf("vue version = %s, want it kept at 1.0.0", got)
+	}
+	if _, ok := cfg.Resolved["typescript"]; ok {
+		t.Error("typescript installed, but only vue's newer version requires it")
+	}
+}
+
+func TestUpdateKeepsSharedDependency(t *testing.T) {
+	tests := []struct {
+		name string
+		// bLatest is b's registry entry after the update; it no longer needs c when bumped
+		bLatest string
+		// legacy clears the recorded dependencies, as in configs locked before they existed
+		legacy bool
+	}{
+		{name: "recorded dependencies", bLatest: `"b": {"name": "B", "version": "2.0.0", "category": "language"}`},
+		{name: "legacy config", bLatest: `"b": {"name": "B", "version": "1.0.0", "category": "language", "depends": ["c"]}`, legacy: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regDir := t.TempDir()
+			writeRegistry := func(files map[string]string) {
+				t.Helper()
+				for name, content := range files {
+					path := filepath.Join(regDir, "company-instructions", name)
+					if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			// c is shared by a and b, and attributed to a
+			writeRegistry(map[string]string{
+				"registry.json": `{"version": 1, "stacks": {
+					"a": {"name": "A", "version": "1.0.0", "category": "language", "depends": ["c"]},
+					"b": {"name": "B", "version": "1.0.0", "category": "language", "depends": ["c"]},
+					"c": {"name": "C", "version": "1.0.0", "category": "language"}}}`,
+				"a/stack.json": `{"name": "A", "version": "1.0.0", "files": ["rules.md"]}`,
+				"a/rules.md":   "# A",
+				"b/stack.json": `{"name": "B", "version": "1.0.0", "files": ["rules.md"]}`,
+				"b/rules.md":   "# B",
+				"c/stack.json": `{"name": "C", "version": "1.0.0", "files": ["rules.md"]}`,
+				"c/rules.md":   "# C",
+			})
+			dir := t.TempDir()
+			cfg := newTestConfig("a", "b")
+			initStacks(t, New(registry.NewClient(registry.WithLocalDir(regDir)), dir), cfg)
+			if got := cfg.Resolved["c"].DependencyOf; got != "a" {
+				t.Fatalf("c dependency_of = %q, want a", got)
+			}
+			if tt.legacy {
+				for id, rs := range cfg.Resolved {
+					rs.Depends = nil
+					cfg.Resolved[id] = rs
+				}
+			}
+
+			// a no longer needs c, but the locked b still does
+			writeRegistry(map[string]string{
+				"registry.json": `{"version": 1, "stacks": {
+					"a": {"name": "A", "version": "2.0.0", "category": "language"},
+					` + tt.bLatest + `,
+					"c": {"name": "C", "version": "1.0.0", "category": "language"}}}`,
+				"a/stack.json": `{"name": "A", "version": "2.0.0", "files": ["rules.md"]}`,
+			})
+			e := New(registry.NewClient(registry.WithLocalDir(regDir)), dir)
+			if _, err := e.Update(context.Background(), cfg, []string{"a"}, SyncOptions{}); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+
+			rs, ok := cfg.Resolved["c"]
+			if !ok {
+				t.Fatal("c was removed, but the locked b still depends on it")
+			}
+			if rs.DependencyOf != "b" {
+				t.Errorf("c dependency_of = %q, want b", rs.DependencyOf)
+			}
+			if _, err := os.Stat(filepath.Join(dir, ManagedDir(cfg), "c", "rules.md")); err != nil {
+				t.Errorf("c's files should be kept: %v", err)
+			}
+		})
+	}
+}
+
+func TestSyncMovesChangedManagedDir(t *testing.T) {
+	e, dir := newTestEngine(t)
+	cfg := newTestConfig("php")
+	initStacks(t, e, cfg)
+	oldDir := ManagedDir(cfg)
+
+	cfg.ManagedDir = "team-instructions"
+	result, err := e.Sync(context.Background(), cfg, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if len(result.Updates) != 0 || result.StaleManagedDir != "" {
+		t.Errorf("Sync() = updates %+v, stale %q, want the stacks moved as they were", result.Updates, result.StaleManagedDir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ManagedDir(cfg), "php", "coding-standards.md")); err != nil {
+		t.Errorf("php should be in the new managed dir: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, oldDir)); !os.IsNotExist(err) {
+		t.Errorf("old managed dir should be gone, stat error: %v", err)
+	}
+	saved, err := config.LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if saved.LastManagedDir != "team-instructions" || saved.PreviousManagedDir() != "" {
+		t.Errorf("last_managed_dir = %q, want team-instructions", saved.LastManagedDir)
+	}
+}
+
+func TestSyncLeavesManagedDirWhenTargetExists(t *testing.T) {
+	e, dir := newTestEngine(t)
+	cfg := newTestConfig("php")
+	initStacks(t, e, cfg)
+	oldDir := ManagedDir(cfg)
+
+	cfg.ManagedDir = "team-instructions"
+	if err := os.MkdirAll(filepath.Join(dir, ManagedDir(cfg)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	result, err := e.Sync(context.Background(), cfg, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if result.StaleManagedDir != oldDir {
+		t.Errorf("StaleManagedDir = %q, want %q", result.StaleManagedDir, oldDir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ManagedDir(cfg), "php", "coding-standards.md")); err != nil {
+		t.Errorf("php should be downloaded into the new managed dir: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, oldDir, "php")); err != nil {
+		t.Errorf("old managed dir should be left in place: %v", err)
+	}
+}
+
+func TestSyncIgnoresUnrecordedManagedDir(t *testing.T) {
+	e, dir := newTestEngine(t)
+	cfg := newTestConfig("php")
+	initStacks(t, e, cfg)
+	oldDir := ManagedDir(cfg)
+
+	// A second config sharing the project, never synced into its own managed dir
+	other := newTestConfig("vue")
+	other.ManagedDir = "frontend"
+	e.configFile = filepath.Join(dir, "frontend.yml")
+	if _, err := e.Sync(context.Background(), other, SyncOptions{NoInject: true}); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, oldDir, "php")); err != nil {
+		t.Errorf("the other config's managed dir should be left alone: %v", err)
+	}
+}
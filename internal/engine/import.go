@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/filemanager"
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+// Import copies the Markdown files under srcDir into the managed directory as the local
+// stack stackID, records it in cfg.Resolved with its hashes, re-injects the managed blocks
+// and saves cfg. Importing an existing local stack again replaces its files. The registry
+// is not contacted, and later syncs keep the stack as it is.
+func (e *Engine) Import(cfg *config.Config, stackID, srcDir string) (*Result, error) {
+	if err := registry.ValidatePathComponent(stackID, "stack ID"); err != nil {
+		return nil, err
+	}
+	prev, exists := cfg.Resolved[stackID]
+	if (exists && !prev.Local) || slices.Contains(cfg.Stacks, stackID) {
+		return nil, fmt.Errorf("stack %s is installed from the registry", stackID)
+	}
+
+	if cfg.Resolved == nil {
+		cfg.Resolved = make(map[string]config.ResolvedStack)
+	}
+	// Importing the project root mustn't pick up the target files or the managed stacks
+	targets, err := InjectorConfigs(e.projectDir, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	skip := []string{filepath.Join(e.projectDir, ManagedDir(cfg))}
+	for _, t := range targets {
+		skip = append(skip, filepath.Join(e.projectDir, t.Filename))
+	}
+
+	fm := filemanager.NewManager(e.client, e.projectDir, ManagedDir(cfg))
+	files, err := fm.ImportStack(stackID, srcDir, skip...)
+	if err != nil {
+		return nil, fmt.Errorf("importing %s: %w", stackID, err)
+	}
+
+	hash, err := filemanager.HashDir(fm.StackDir(stackID), files...)
+	if err != nil {
+		return nil, fmt.Errorf("hashing %s: %w", stackID, err)
+	}
+	fileHashes, err := filemanager.HashFilesInStack(fm.StackDir(stackID), files)
+	if err != nil {
+		return nil, fmt.Errorf("hashing %s: %w", stackID, err)
+	}
+	cfg.Resolved[stackID] = config.ResolvedStack{
+		Version:    config.LocalVersion,
+		Hash:       hash,
+		Files:      files,
+		FileHashes: fileHashes,
+		Tools:      config.ToolsConfig{IncludeInClaudeMD: true, IncludeInAgentsMD: true, IncludeInCursorRules: true},
+		Explicit:   true,
+		Local:      true,
+	}
+
+	update := StackUpdate{Stack: stackID, NewVersion: config.LocalVersion}
+	if exists {
+		update.OldVersion = prev.Version
+	}
+	result := &Result{Order: []string{stackID}, Updates: []StackUpdate{update}}
+	if err := e.inject(cfg, result); err != nil {
+		return nil, err
+	}
+	if err := e.saveConfig(cfg); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// keepLocalStacks adds cfg's imported stacks to resolved, the set of stacks an init or
+// sync keeps, since the registry never resolves them.
+func keepLocalStacks(cfg *config.Config, resolved map[string]bool) {
+	for id, rs := range cfg.Resolved {
+		if rs.Local {
+			resolved[id] = true
+		}
+	}
+}
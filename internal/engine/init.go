@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/filemanager"
+	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/cego/ai-instructions/internal/resolver"
+)
+
+// Init downloads every stack of a resolution, records them in cfg.Resolved, injects the
+// managed blocks and saves cfg, replacing whatever was installed before.
+//
+// Stacks are swapped in one at a time, so a failed or cancelled re-init keeps the previous
+// config and files usable. A first init leaves nothing behind if it fails.
+func (e *Engine) Init(ctx context.Context, cfg *config.Config, reg *registry.Registry, res *resolver.Resolution) (result *Result, err error) {
+	result = &Result{Order: res.Order}
+	if err := e.moveManagedDir(cfg, result); err != nil {
+		return nil, err
+	}
+
+	managedDir := ManagedDir(cfg)
+	managedPath := filepath.Join(e.projectDir, managedDir)
+	if _, statErr := os.Stat(managedPath); os.IsNotExist(statErr) {
+		defer func() {
+			if err != nil {
+				os.RemoveAll(managedPath)
+			}
+		}()
+	}
+
+	if cfg.Resolved == nil {
+		cfg.Resolved = make(map[string]config.ResolvedStack)
+	}
+	fm := filemanager.NewManager(e.client, e.projectDir, managedDir)
+
+	for _, stackID := range res.Order {
+		meta, ok := reg.Stacks[stackID]
+		if !ok {
+			return nil, &resolver.MissingStackError{Stack: stackID}
+		}
+		rs, dlErr := e.downloadStack(ctx, fm, cfg, stackID, meta.Version, cfg.Resolved[stackID])
+		if dlErr != nil {
+			return nil, fmt.Errorf("downloading stacks: %w", dlErr)
+		}
+		if msgErr := e.recordMessage(ctx, stackID, result); msgErr != nil {
+			return nil, fmt.Errorf("downloading stacks: %w", msgErr)
+		}
+		cfg.Resolved[stackID] = applyResolution(rs, res, stackID)
+		result.Updates = append(result.Updates, StackUpdate{Stack: stackID, NewVersion: meta.Version})
+	}
+
+	// Don't commit a config for a run that was already cancelled
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resolvedSet := make(map[string]bool, len(res.Order))
+	for _, id := range res.Order {
+		resolvedSet[id] = true
+	}
+	keepLocalStacks(cfg, resolvedSet)
+
+	// Inject before saving, so a failure leaves the previous config in place
+	if err := e.inject(cfg, result); err != nil {
+		return nil, err
+	}
+	cfg.RecordManagedDir()
+	if err := e.saveConfig(cfg); err != nil {
+		return nil, err
+	}
+	if _, err := filemanager.CleanupStaleStacks(e.projectDir, managedDir, resolvedSet); err != nil {
+		return nil, err
+	}
+
+	// Cleanup old files
+	if config.OldSettingsExists(e.projectDir) {
+		os.Remove(filepath.Join(e.projectDir, config.OldSettingsFile))
+	}
+	if config.OldLockfileExists(e.projectDir) {
+		os.Remove(filepath.Join(e.projectDir, config.LockFile))
+	}
+	return result, nil
+}
@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+// DefaultLocale is the default locale of stacks whose manifest doesn't name one.
+const DefaultLocale = "en"
+
+// manifestDefaultLocale returns the locale a stack falls back to for missing translations.
+func manifestDefaultLocale(manifest *registry.StackManifest) string {
+	if manifest.DefaultLocale != "" {
+		return manifest.DefaultLocale
+	}
+	return DefaultLocale
+}
+
+// TranslatedFiles checks a manifest's locales and returns the paths of the files of every
+// locale in the stack, sorted. Registry validation downloads them all.
+func TranslatedFiles(manifest *registry.StackManifest) ([]string, error) {
+	if len(manifest.Locales) == 0 {
+		return nil, nil
+	}
+	if _, ok := manifest.Locales[manifestDefaultLocale(manifest)]; !ok {
+		return nil, fmt.Errorf("default locale %s has no files", manifestDefaultLocale(manifest))
+	}
+	var paths []string
+	for locale, files := range manifest.Locales {
+		if err := registry.ValidatePathComponent(locale, "locale"); err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			paths = append(paths, path.Join(locale, f))
+		}
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// ManifestFiles returns every file a manifest lists: the shared files, then the files of
+// every locale by their path in the stack.
+func ManifestFiles(manifest *registry.StackManifest) ([]string, error) {
+	translated, err := TranslatedFiles(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return append(slices.Clone(manifest.Files), translated...), nil
+}
+
+// localeFiles returns the files of a stack to download for locale: the shared files, then
+// for each file of the default locale its translation into locale, or the default locale's
+// file where there is none, then the files only locale has. An empty locale selects the
+// default. The locale to record is returned too; it is empty for stacks without locales.
+func localeFiles(manifest *registry.StackManifest, locale string) ([]string, string, error) {
+	if len(manifest.Locales) == 0 {
+		return manifest.Files, "", nil
+	}
+	if _, err := TranslatedFiles(manifest); err != nil {
+		return nil, "", err
+	}
+	def := manifestDefaultLocale(manifest)
+	if locale == "" {
+		locale = def
+	}
+	if err := registry.ValidatePathComponent(locale, "locale"); err != nil {
+		return nil, "", err
+	}
+
+	files := slices.Clone(manifest.Files)
+	for _, f := range manifest.Locales[def] {
+		if locale != def && slices.Contains(manifest.Locales[locale], f) {
+			files = append(files, path.Join(locale, f))
+		} else {
+			files = append(files, path.Join(def, f))
+		}
+	}
+	if locale != def {
+		for _, f := range manifest.Locales[locale] {
+			if !slices.Contains(manifest.Locales[def], f) {
+				files = append(files, path.Join(locale, f))
+			}
+		}
+	}
+	return files, locale, nil
+}
+
+// localeChanged reports whether an installed stack was downloaded in another locale than
+// the config now selects, so its files must be fetched again. Stacks without locales
+// never change; for an unset locale the manifest names the default.
+func (e *Engine) localeChanged(ctx context.Context, stackID string, rs config.ResolvedStack, locale string) bool {
+	if rs.Locale == "" {
+		return false
+	}
+	if locale != "" {
+		return rs.Locale != locale
+	}
+	manifest, err := e.client.FetchStackManifest(ctx, stackID)
+	if err != nil {
+		// Download again, which reports the error
+		return true
+	}
+	return rs.Locale != manifestDefaultLocale(manifest)
+}
+
+// StackLocales returns the locales offered by any of the given stacks, sorted.
+func (e *Engine) StackLocales(ctx context.Context, stacks []string) ([]string, error) {
+	var locales []string
+	for _, id := range stacks {
+		manifest, err := e.client.FetchStackManifest(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for l := range manifest.Locales {
+			if !slices.Contains(locales, l) {
+				locales = append(locales, l)
+			}
+		}
+	}
+	slices.Sort(locales)
+	return locales, nil
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+func TestLocaleFiles(t *testing.T) {
+	manifest := &registry.StackManifest{
+		Files: []string{"shared.md"},
+		Locales: map[string][]string{
+			"en": {"rules.md", "testing.md"},
+			"da": {"rules.md", "ordbog.md"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		manifest   *registry.StackManifest
+		locale     string
+		wantFiles  []string
+		wantLocale string
+		wantErr    bool
+	}{
+		{
+			name:      "no locales",
+			manifest:  &registry.StackManifest{Files: []string{"rules.md"}},
+			locale:    "da",
+			wantFiles: []string{"rules.md"},
+		},
+		{
+			name:       "default locale",
+			manifest:   manifest,
+			wantFiles:  []string{"shared.md", "en/rules.md", "en/testing.md"},
+			wantLocale: "en",
+		},
+		{
+			name:       "translation with fallback",
+			manifest:   manifest,
+			locale:     "da",
+			wantFiles:  []string{"shared.md", "da/rules.md", "en/testing.md", "da/ordbog.md"},
+			wantLocale: "da",
+		},
+		{
+			name:       "unknown locale falls back entirely",
+			manifest:   manifest,
+			locale:     "de",
+			wantFiles:  []string{"shared.md", "en/rules.md", "en/testing.md"},
+			wantLocale: "de",
+		},
+		{
+			name:       "manifest default locale",
+			manifest:   &registry.StackManifest{DefaultLocale: "da", Locales: map[string][]string{"da": {"rules.md"}}},
+			wantFiles:  []string{"da/rules.md"},
+			wantLocale: "da",
+		},
+		{
+			name:     "default locale without files",
+			manifest: &registry.StackManifest{Locales: map[string][]string{"da": {"rules.md"}}},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid locale",
+			manifest: manifest,
+			locale:   "../en",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, locale, err := localeFiles(tt.manifest, tt.locale)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("localeFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(files, tt.wantFiles) || locale != tt.wantLocale {
+				t.Errorf("localeFiles() = %v, %q; want %v, %q", files, locale, tt.wantFiles, tt.wantLocale)
+			}
+		})
+	}
+}
+
+func TestSyncLocaleChange(t *testing.T) {
+	e, dir := newLocalEngine(t, map[string]string{
+		"registry.json": `{"version": 1, "stacks": {"php": {"name": "PHP", "version": "1.0.0", "category": "language"}}}`,
+		"php/stack.json": `{"name": "PHP", "version": "1.0.0", "locales": {"en": ["rules.md", "testing.md"], "da": ["rules.md"]},
+			"tools": {"claude": {"include_in_claude_md": true}}}`,
+		"php/en/rules.md":   "# PHP",
+		"php/en/testing.md": "# Testing",
+		"php/da/rules.md":   "# PHP på dansk",
+	})
+	cfg := newTestConfig("php")
+	initStacks(t, e, cfg)
+
+	stackDir := filepath.Join(dir, ManagedDir(cfg), "php")
+	if rs := cfg.Resolved["php"]; rs.Locale != "en" || !reflect.DeepEqual(rs.Files, []string{"en/rules.md", "en/testing.md"}) {
+		t.Fatalf("after init: locale %q, files %v", rs.Locale, rs.Files)
+	}
+
+	cfg.Locale = "da"
+	result, err := e.Sync(context.Background(), cfg, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if len(result.Updates) != 1 {
+		t.Errorf("Updates = %+v, want php downloaded again", result.Updates)
+	}
+	if rs := cfg.Resolved["php"]; rs.Locale != "da" || !reflect.DeepEqual(rs.Files, []string{"da/rules.md", "en/testing.md"}) {
+		t.Errorf("after sync: locale %q, files %v", rs.Locale, rs.Files)
+	}
+	if _, err := os.Stat(filepath.Join(stackDir, "en", "rules.md")); !os.IsNotExist(err) {
+		t.Errorf("untranslated en/rules.md should be gone, stat error: %v", err)
+	}
+
+	// Nothing to do once the locale matches
+	result, err = e.Sync(context.Background(), cfg, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if len(result.Updates) != 0 {
+		t.Errorf("Updates = %+v, want none", result.Updates)
+	}
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/filemanager"
+	"github.com/cego/ai-instructions/internal/resolver"
+)
+
+// LockedVersionGoneError indicates a stack can't be restored because the registry no
+// longer serves its locked version.
+type LockedVersionGoneError struct {
+	Stack  string
+	Locked string
+	Latest string
+}
+
+func (e *LockedVersionGoneError) Error() string {
+	return fmt.Sprintf("cannot restore %s %s: the registry now has %s", e.Stack, e.Locked, e.Latest)
+}
+
+// Repair downloads the given stacks again at their locked version, re-injects the managed
+// blocks and saves cfg. Unlike Sync, it doesn't re-resolve or look for updates, so it is
+// the targeted fix for tampered or missing files and broken blocks; with no stacks it only
+// re-injects, without contacting the registry. Local modifications to the stacks are
+// overwritten. Imported stacks can't be downloaded and are rejected. cfg is updated in place.
+func (e *Engine) Repair(ctx context.Context, cfg *config.Config, stacks []string) (*Result, error) {
+	result := &Result{Order: stacks}
+	if len(stacks) > 0 {
+		reg, err := e.FetchRegistry(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		fm := filemanager.NewManager(e.client, e.projectDir, ManagedDir(cfg))
+		for _, id := range stacks {
+			rs, ok := cfg.Resolved[id]
+			if !ok {
+				return nil, fmt.Errorf("stack %s is not installed", id)
+			}
+			if rs.Local {
+				return nil, fmt.Errorf("stack %s was imported from local files; import it again to restore it", id)
+			}
+			meta, ok := reg.Stacks[id]
+			if !ok {
+				return nil, &resolver.MissingStackError{Stack: id}
+			}
+			if meta.Version != rs.Version {
+				return nil, &LockedVersionGoneError{Stack: id, Locked: rs.Version, Latest: meta.Version}
+			}
+
+			// No previous entry, so no file on disk is trusted to match its ETag
+			fresh, err := e.downloadStack(ctx, fm, cfg, id, rs.Version, config.ResolvedStack{})
+			if err != nil {
+				return nil, fmt.Errorf("repairing %s: %w", id, err)
+			}
+			fresh.Explicit, fresh.DependencyOf = rs.Explicit, rs.DependencyOf
+			cfg.Resolved[id] = fresh
+			result.Updates = append(result.Updates, StackUpdate{Stack: id, OldVersion: rs.Version, NewVersion: rs.Version})
+		}
+	}
+
+	if err := e.inject(cfg, result); err != nil {
+		return nil, err
+	}
+	if err := e.saveConfig(cfg); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
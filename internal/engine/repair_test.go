@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	files := map[string]string{
+		"registry.json": `{"version": 1, "stacks": {
+			"php": {"name": "PHP", "version": "1.0.0", "category": "language"},
+			"laravel": {"name": "Laravel", "version": "1.0.0", "category": "framework", "depends": ["php"]}}}`,
+		"php/stack.json":     `{"name": "PHP", "version": "1.0.0", "files": ["rules.md"], "tools": {"claude": {"include_in_claude_md": true}}}`,
+		"php/rules.md":       "# PHP",
+		"laravel/stack.json": `{"name": "Laravel", "version": "1.0.0", "files": ["rules.md"], "tools": {"claude": {"include_in_claude_md": true}}}`,
+		"laravel/rules.md":   "# Laravel",
+	}
+	e, dir := newLocalEngine(t, files)
+	cfg := newTestConfig("laravel")
+	initStacks(t, e, cfg)
+
+	managed := filepath.Join(dir, ManagedDir(cfg))
+	os.WriteFile(filepath.Join(managed, "php", "rules.md"), []byte("tampered"), 0644)
+	os.WriteFile(filepath.Join(managed, "laravel", "rules.md"), []byte("edited"), 0644)
+	os.WriteFile(filepath.Join(dir, "CLAUDE.md"), []byte("# Hand-written\n"), 0644)
+
+	result, err := e.Repair(context.Background(), cfg, []string{"php"})
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if len(result.Updates) != 1 || result.Updates[0].Stack != "php" {
+		t.Errorf("Updates = %+v, want php", result.Updates)
+	}
+	if data, _ := os.ReadFile(filepath.Join(managed, "php", "rules.md")); string(data) != "# PHP" {
+		t.Errorf("php/rules.md = %q, want it restored", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(managed, "laravel", "rules.md")); string(data) != "edited" {
+		t.Errorf("laravel/rules.md = %q, want stacks outside the repair left alone", data)
+	}
+	if rs := cfg.Resolved["php"]; rs.Explicit || rs.DependencyOf != "laravel" {
+		t.Errorf("php attribution = explicit %v, dependency_of %q; want kept", rs.Explicit, rs.DependencyOf)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "CLAUDE.md")); !strings.Contains(string(data), "php/rules.md") {
+		t.Errorf("CLAUDE.md = %q, want the managed block injected again", data)
+	}
+}
+
+func TestRepairLockedVersionGone(t *testing.T) {
+	files := map[string]string{
+		"registry.json":  `{"version": 1, "stacks": {"php": {"name": "PHP", "version": "1.0.0", "category": "language"}}}`,
+		"php/stack.json": `{"name": "PHP", "version": "1.0.0", "files": ["rules.md"]}`,
+		"php/rules.md":   "# PHP",
+	}
+	e, _ := newLocalEngine(t, files)
+	cfg := newTestConfig("php")
+	initStacks(t, e, cfg)
+
+	rs := cfg.Resolved["php"]
+	rs.Version = "0.9.0"
+	cfg.Resolved["php"] = rs
+
+	_, err := e.Repair(context.Background(), cfg, []string{"php"})
+	var gone *LockedVersionGoneError
+	if !errors.As(err, &gone) {
+		t.Fatalf("Repair() error = %v, want LockedVersionGoneError", err)
+	}
+	if gone.Locked != "0.9.0" || gone.Latest != "1.0.0" {
+		t.Errorf("error = %+v, want 0.9.0 → 1.0.0", gone)
+	}
+}
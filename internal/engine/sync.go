@@ -0,0 +1,410 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/filemanager"
+	"github.com/cego/ai-instructions/internal/registry"
+	"github.com/cego/ai-instructions/internal/resolver"
+)
+
+// SyncOptions restricts and extends a sync.
+type SyncOptions struct {
+	// Only limits the check to these stacks and their dependencies.
+	Only []string
+	// Exclude skips these stacks. It can't be combined with Only.
+	Exclude []string
+	// Diff records the content changes of each updated stack in Result.Diffs.
+	Diff bool
+	// Force overwrites local modifications without asking.
+	Force bool
+	// NoInject leaves the target files alone for this run, as if the config set inject: false.
+	NoInject bool
+	// Prune removes explicit stacks the registry no longer has, instead of failing on them.
+	Prune bool
+	// ConfirmOverwrite is asked before a stack with local modifications is overwritten.
+	// If it declines, the stack keeps its local files and locked version. If it is nil,
+	// the sync fails with a LocalModificationError instead.
+	ConfirmOverwrite func(ctx context.Context, stackID string, files []string) (bool, error)
+}
+
+// LocalModificationError indicates sync would overwrite instruction files that were edited locally.
+type LocalModificationError struct {
+	Stack string
+	Files []string
+}
+
+func (e *LocalModificationError) Error() string {
+	return fmt.Sprintf("stack %s has local modifications: %s", e.Stack, strings.Join(e.Files, ", "))
+}
+
+// Sync re-resolves cfg's stacks against the registry, downloads the ones that are out
+// of date or modified locally, re-injects the managed blocks and saves cfg.
+// Stacks outside the selection keep their locked version. cfg is updated in place.
+func (e *Engine) Sync(ctx context.Context, cfg *config.Config, opts SyncOptions) (*Result, error) {
+	if len(opts.Only) > 0 && len(opts.Exclude) > 0 {
+		return nil, fmt.Errorf("only and exclude cannot be used together")
+	}
+
+	reg, err := e.FetchRegistry(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	if opts.Prune {
+		pruned = pruneVanished(cfg, reg)
+	}
+
+	// Re-resolve dependencies (in case registry has changed)
+	res, err := Resolve(reg, cfg.Stacks)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := syncSelection(StackInfos(reg), res, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Order: res.Order, Pruned: pruned}
+	if err := e.moveManagedDir(cfg, result); err != nil {
+		return nil, err
+	}
+	if err := e.syncStacks(ctx, cfg, reg, res, selected, opts, result); err != nil {
+		return nil, fmt.Errorf("syncing: %w", err)
+	}
+	if err := e.finish(cfg, res, result, opts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Update downloads the latest version of the named installed stacks and any newly
+// required dependencies. All other stacks stay at their locked version. Only the
+// Force and ConfirmOverwrite options apply. cfg is updated in place.
+func (e *Engine) Update(ctx context.Context, cfg *config.Config, stacks []string, opts SyncOptions) (*Result, error) {
+	reg, err := e.FetchRegistry(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range stacks {
+		if _, ok := reg.Stacks[s]; !ok {
+			return nil, &resolver.MissingStackError{Stack: s}
+		}
+	}
+
+	selected := make(map[string]bool, len(cfg.Stacks))
+	for _, s := range stacks {
+		selected[s] = true
+	}
+	res, err := resolver.NewResolver(updateStackInfos(reg, cfg.Resolved, selected)).Resolve(cfg.Stacks)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range res.Order {
+		if _, ok := cfg.Resolved[id]; !ok {
+			selected[id] = true
+		}
+	}
+
+	result := &Result{Order: res.Order}
+	opts = SyncOptions{Force: opts.Force, NoInject: opts.NoInject, ConfirmOverwrite: opts.ConfirmOverwrite}
+	if err := e.moveManagedDir(cfg, result); err != nil {
+		return nil, err
+	}
+	if err := e.syncStacks(ctx, cfg, reg, res, selected, opts, result); err != nil {
+		return nil, fmt.Errorf("updating: %w", err)
+	}
+	if err := e.finish(cfg, res, result, opts); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// updateStackInfos returns the resolver input for updating only the stacks in updating. They,
+// and stacks not installed yet, are resolved with the registry's metadata, while every other
+// installed stack keeps the dependencies it was locked with. Stacks locked before their
+// dependencies were recorded fall back to the registry's metadata if their version is
+// unchanged, and to their dependency_of attribution otherwise.
+func updateStackInfos(reg *registry.Registry, resolved map[string]config.ResolvedStack, updating map[string]bool) map[string]resolver.StackInfo {
+	infos := StackInfos(reg)
+	ids := make([]string, 0, len(resolved))
+	for id, rs := range resolved {
+		ids = append(ids, id)
+		if updating[id] {
+			continue
+		}
+		if meta, ok := reg.Stacks[id]; rs.Depends == nil && ok && meta.Version == rs.Version {
+			continue
+		}
+		infos[id] = resolver.StackInfo{ID: id, Depends: rs.Depends}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		rs := resolved[id]
+		if _, locked := resolved[rs.DependencyOf]; rs.Explicit || !locked || updating[rs.DependencyOf] {
+			continue
+		}
+		parent := infos[rs.DependencyOf]
+		if !slices.Contains(parent.Depends, id) {
+			parent.Depends = append(slices.Clone(parent.Depends), id)
+			infos[rs.DependencyOf] = parent
+		}
+	}
+	return infos
+}
+
+// syncStacks downloads the selected stacks of a resolution that are out of date or
+// modified locally and records every resolved stack in cfg.Resolved.
+func (e *Engine) syncStacks(ctx context.Context, cfg *config.Config, reg *registry.Registry, res *resolver.Resolution, selected map[string]bool, opts SyncOptions, result *Result) error {
+	if cfg.Resolved == nil {
+		cfg.Resolved = make(map[string]config.ResolvedStack)
+	}
+	managedDir := ManagedDir(cfg)
+	fm := filemanager.NewManager(e.client, e.projectDir, managedDir)
+
+	for _, stackID := range res.Order {
+		currentResolved, hasExisting := cfg.Resolved[stackID]
+
+		if !selected[stackID] {
+			e.debugf("%s: not selected, keeping locked version", stackID)
+			if hasExisting {
+				cfg.Resolved[stackID] = applyResolution(currentResolved, res, stackID)
+			}
+			continue
+		}
+
+		regMeta, exists := reg.Stacks[stackID]
+		if !exists {
+			result.Missing = append(result.Missing, stackID)
+			continue
+		}
+
+		e.debugf("%s: registry=%s local=%s", stackID, regMeta.Version, currentResolved.Version)
+
+		// Skip download if version, locale and variables match and local files are intact. Stacks
+		// fetched from a branch override are always refreshed, since the branch moves without a
+		// version bump.
+		branch := e.client.StackBranch(stackID)
+		if branch != "" {
+			e.debugf("%s: fetching from branch %s", stackID, branch)
+		}
+		if hasExisting && branch == "" && currentResolved.Version == regMeta.Version && e.localStackIntact(managedDir, stackID, currentResolved) &&
+			!e.localeChanged(ctx, stackID, currentResolved, cfg.Locale) && !e.variablesChanged(cfg, currentResolved) {
+			e.debugf("%s: version match + files intact, skipping", stackID)
+			result.Unchanged = append(result.Unchanged, stackID)
+			// Still update explicit/dependency_of in case it changed
+			cfg.Resolved[stackID] = applyResolution(currentResolved, res, stackID)
+			continue
+		}
+
+		if hasExisting && !opts.Force {
+			overwrite, err := e.confirmOverwrite(ctx, fm, stackID, currentResolved, opts)
+			if err != nil {
+				return err
+			}
+			if !overwrite {
+				result.Kept = append(result.Kept, stackID)
+				cfg.Resolved[stackID] = applyResolution(currentResolved, res, stackID)
+				continue
+			}
+		}
+
+		var before map[string][]byte
+		if opts.Diff && hasExisting {
+			var err error
+			before, err = filemanager.ReadStackFiles(fm.StackDir(stackID), currentResolved.Files)
+			if err != nil {
+				return fmt.Errorf("reading %s before sync: %w", stackID, err)
+			}
+		}
+
+		rs, err := e.downloadStack(ctx, fm, cfg, stackID, regMeta.Version, currentResolved)
+		if err != nil {
+			return err
+		}
+		if err := e.recordMessage(ctx, stackID, result); err != nil {
+			return err
+		}
+
+		if opts.Diff {
+			after, err := filemanager.ReadStackFiles(fm.StackDir(stackID), rs.Files)
+			if err != nil {
+				return fmt.Errorf("reading %s after sync: %w", stackID, err)
+			}
+			result.Diffs = append(result.Diffs, StackDiff{Stack: stackID, Before: before, After: after})
+		}
+
+		oldVersion := ""
+		if hasExisting {
+			oldVersion = currentResolved.Version
+		}
+		result.Updates = append(result.Updates, StackUpdate{
+			Stack:      stackID,
+			OldVersion: oldVersion,
+			NewVersion: regMeta.Version,
+			Branch:     branch,
+		})
+		cfg.Resolved[stackID] = applyResolution(rs, res, stackID)
+	}
+	return nil
+}
+
+// confirmOverwrite reports whether a stack may be downloaded over its local files.
+// Stacks without local modifications may always be overwritten.
+func (e *Engine) confirmOverwrite(ctx context.Context, fm *filemanager.Manager, stackID string, rs config.ResolvedStack, opts SyncOptions) (bool, error) {
+	manifest, err := e.client.FetchStackManifest(ctx, stackID)
+	if err != nil {
+		return false, err
+	}
+	modified := localModifications(fm.StackDir(stackID), rs, manifest.Hashes)
+	if len(modified) == 0 {
+		return true, nil
+	}
+	if opts.ConfirmOverwrite == nil {
+		return false, &LocalModificationError{Stack: stackID, Files: modified}
+	}
+	return opts.ConfirmOverwrite(ctx, stackID, modified)
+}
+
+// localModifications returns the stack files whose content matches neither the locked
+// hash nor the hash published for the incoming version. Missing files and files
+// without a locked hash are not reported.
+func localModifications(stackDir string, rs config.ResolvedStack, incoming map[string]string) []string {
+	var modified []string
+	for _, f := range rs.Files {
+		locked, ok := rs.FileHashes[f]
+		if !ok {
+			continue
+		}
+		actual, err := filemanager.HashFile(filepath.Join(stackDir, f))
+		if err != nil || actual == locked || actual == incoming[f] {
+			continue
+		}
+		modified = append(modified, f)
+	}
+	return modified
+}
+
+// moveManagedDir moves the stacks of the previous managed directory to the current one
+// after managed_dir changed, so they aren't orphaned. Imported stacks can't be downloaded
+// again, so the directory is moved rather than removed. If the current directory already
+// exists, the previous one is left in place and reported in result.StaleManagedDir.
+func (e *Engine) moveManagedDir(cfg *config.Config, result *Result) error {
+	prev := cfg.PreviousManagedDir()
+	if prev == "" {
+		return nil
+	}
+	managedDir := ManagedDir(cfg)
+	prevDir := path.Join(path.Dir(managedDir), prev)
+	prevPath := filepath.Join(e.projectDir, prevDir)
+	if _, err := os.Stat(prevPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("checking previous managed directory: %w", err)
+	}
+
+	managedPath := filepath.Join(e.projectDir, managedDir)
+	if _, err := os.Stat(managedPath); err == nil {
+		result.StaleManagedDir = prevDir
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("checking managed directory: %w", err)
+	}
+	e.debugf("managed_dir changed, moving %s to %s", prevDir, managedDir)
+	if err := os.Rename(prevPath, managedPath); err != nil {
+		return fmt.Errorf("moving managed directory: %w", err)
+	}
+	return nil
+}
+
+// finish drops stacks that are no longer resolved, re-injects the managed blocks unless
+// opts.NoInject is set, saves the config and then removes the dropped stacks' files. A
+// failed injection leaves the previous config, and the files it references, in place.
+func (e *Engine) finish(cfg *config.Config, res *resolver.Resolution, result *Result, opts SyncOptions) error {
+	resolvedSet := make(map[string]bool, len(res.Order))
+	for _, id := range res.Order {
+		resolvedSet[id] = true
+	}
+	keepLocalStacks(cfg, resolvedSet)
+	for id := range cfg.Resolved {
+		if !resolvedSet[id] {
+			delete(cfg.Resolved, id)
+		}
+	}
+
+	if !opts.NoInject {
+		if err := e.inject(cfg, result); err != nil {
+			return err
+		}
+	}
+	cfg.RecordManagedDir()
+	if err := e.saveConfig(cfg); err != nil {
+		return err
+	}
+	if _, err := filemanager.CleanupStaleStacks(e.projectDir, ManagedDir(cfg), resolvedSet); err != nil {
+		return err
+	}
+
+	// Cleanup old lockfile if present
+	if config.OldLockfileExists(e.projectDir) {
+		os.Remove(filepath.Join(e.projectDir, config.LockFile))
+	}
+	return nil
+}
+
+// pruneVanished removes the explicit stacks the registry no longer has from cfg.Stacks and
+// returns them. Their files, and dependencies nothing else needs, are then removed by finish.
+func pruneVanished(cfg *config.Config, reg *registry.Registry) []string {
+	var kept, pruned []string
+	for _, id := range cfg.Stacks {
+		if _, ok := reg.Stacks[id]; ok {
+			kept = append(kept, id)
+		} else {
+			pruned = append(pruned, id)
+		}
+	}
+	if len(pruned) > 0 {
+		cfg.Stacks = kept
+	}
+	return pruned
+}
+
+// syncSelection returns the stacks sync should check: the Only stacks plus their
+// dependencies, everything but the Exclude stacks, or the whole resolution.
+func syncSelection(stacks map[string]resolver.StackInfo, res *resolver.Resolution, opts SyncOptions) (map[string]bool, error) {
+	selected := make(map[string]bool, len(res.Order))
+
+	if len(opts.Only) > 0 {
+		onlyRes, err := resolver.NewResolver(stacks).Resolve(opts.Only)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range onlyRes.Order {
+			selected[id] = true
+		}
+		return selected, nil
+	}
+
+	excluded := make(map[string]bool, len(opts.Exclude))
+	for _, id := range opts.Exclude {
+		excluded[id] = true
+	}
+	for _, id := range res.Order {
+		if !excluded[id] {
+			selected[id] = true
+		}
+	}
+	return selected, nil
+}
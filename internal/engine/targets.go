@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/injector"
+)
+
+// maxInlineSize is the size above which a file marked inline is still referenced by path,
+// so a long file doesn't crowd out the rest of the target.
+const maxInlineSize = 8 << 10
+
+// InjectionOrder returns the order the managed blocks list cfg's resolved stacks in.
+// It depends only on the config, so the blocks can be rebuilt offline to verify them.
+func InjectionOrder(cfg *config.Config) ([]string, error) {
+	order, err := ResolvedOrder(cfg.Resolved)
+	if err != nil {
+		return nil, fmt.Errorf("ordering stacks: %w", err)
+	}
+	return order, nil
+}
+
+// InjectorConfigs builds the target file configs for the given stacks of cfg, applying the
+// project's injection settings, tools and ignore file. A nil config yields the built-in
+// targets only.
+func InjectorConfigs(projectDir string, cfg *config.Config, order []string) ([]injector.FileConfig, error) {
+	skip, err := config.SkippedTargets(projectDir, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolved map[string]config.ResolvedStack
+	var placement string
+	var targets []config.TargetConfig
+	var text injector.BlockText
+	if cfg != nil {
+		resolved = cfg.Resolved
+		placement = cfg.Placement
+		targets = cfg.Targets
+		text = injector.BlockText{Heading: cfg.Block.Heading, Footer: cfg.Block.Footer}
+	}
+	instrDir := ManagedDir(cfg)
+
+	var claudeFiles, agentsFiles, cursorFiles []string
+	for _, stackID := range order {
+		rs := resolved[stackID]
+		for _, f := range rs.Files {
+			path := fmt.Sprintf("%s/%s/%s", instrDir, stackID, f)
+			tools := rs.ToolsFor(f)
+			if cfg != nil {
+				tools = cfg.EnabledTools(tools)
+			}
+			if tools.IncludeInClaudeMD {
+				claudeFiles = append(claudeFiles, path)
+			}
+			if tools.IncludeInAgentsMD {
+				agentsFiles = append(agentsFiles, path)
+			}
+			if tools.IncludeInCursorRules {
+				cursorFiles = append(cursorFiles, path)
+			}
+		}
+	}
+
+	configs := []injector.FileConfig{
+		injector.ClaudeConfig(claudeFiles),
+		injector.AgentsConfig(agentsFiles),
+		injector.CursorConfig(cursorFiles),
+	}
+	for _, t := range targets {
+		configs = append(configs, customTargetConfig(t, order, resolved, instrDir))
+	}
+	inline, err := inlineContents(projectDir, instrDir, order, resolved)
+	if err != nil {
+		return nil, err
+	}
+	for i := range configs {
+		configs[i].Skip = skip[configs[i].Filename]
+		configs[i].Placement = placement
+		configs[i].Text = text
+		configs[i].Inline = inline
+	}
+	return configs, nil
+}
+
+// inlineContents reads the files the stacks mark inline, keyed by their path in the managed
+// blocks. Missing files and files over maxInlineSize are left out, and so referenced.
+func inlineContents(projectDir, instrDir string, order []string, resolved map[string]config.ResolvedStack) (map[string]string, error) {
+	var inline map[string]string
+	for _, stackID := range order {
+		for _, f := range resolved[stackID].Inline {
+			path := fmt.Sprintf("%s/%s/%s", instrDir, stackID, f)
+			info, err := os.Stat(filepath.Join(projectDir, filepath.FromSlash(path)))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("reading inline file %s: %w", path, err)
+			}
+			if info.Size() > maxInlineSize {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(projectDir, filepath.FromSlash(path)))
+			if err != nil {
+				return nil, fmt.Errorf("reading inline file %s: %w", path, err)
+			}
+			if inline == nil {
+				inline = make(map[string]string)
+			}
+			inline[path] = string(data)
+		}
+	}
+	return inline, nil
+}
+
+// customTargetConfig builds the FileConfig for a user-defined target.
+// It lists every file of the stacks it selects, or of all stacks if it selects none.
+func customTargetConfig(t config.TargetConfig, order []string, resolved map[string]config.ResolvedStack, instrDir string) injector.FileConfig {
+	selected := make(map[string]bool, len(t.Stacks))
+	for _, s := range t.Stacks {
+		selected[s] = true
+	}
+
+	var files []string
+	for _, stackID := range order {
+		if len(selected) > 0 && !selected[stackID] {
+			continue
+		}
+		for _, f := range resolved[stackID].Files {
+			files = append(files, fmt.Sprintf("%s/%s/%s", instrDir, stackID, f))
+		}
+	}
+
+	markers := injector.DefaultMarkers()
+	if t.MarkerStyle == config.MarkerStyleHash {
+		markers = injector.HashMarkers()
+	}
+	return injector.FileConfig{
+		Filename: filepath.ToSlash(filepath.Clean(t.Filename)),
+		Files:    files,
+		Markers:  markers,
+	}
+}
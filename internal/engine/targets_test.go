@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/injector"
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+func TestInjectorConfigsFileTools(t *testing.T) {
+	cfg := newTestConfig("php")
+	cfg.Resolved = map[string]config.ResolvedStack{
+		"php": {
+			Files: []string{"standards.md", "claude-only.md", "cursor-only.md"},
+			Tools: config.ToolsConfig{IncludeInClaudeMD: true, IncludeInAgentsMD: true, IncludeInCursorRules: true},
+			FileTools: map[string]config.ToolsConfig{
+				"claude-only.md": {IncludeInClaudeMD: true},
+				"cursor-only.md": {IncludeInCursorRules: true},
+			},
+		},
+	}
+
+	configs, err := InjectorConfigs(t.TempDir(), cfg, []string{"php"})
+	if err != nil {
+		t.Fatalf("InjectorConfigs: %v", err)
+	}
+
+	dir := ManagedDir(cfg) + "/php/"
+	want := map[string][]string{
+		"CLAUDE.md":    {dir + "standards.md", dir + "claude-only.md"},
+		"AGENTS.md":    {dir + "standards.md"},
+		".cursorrules": {dir + "standards.md", dir + "cursor-only.md"},
+	}
+	for _, c := range configs {
+		if !reflect.DeepEqual(c.Files, want[c.Filename]) {
+			t.Errorf("%s files = %v, want %v", c.Filename, c.Files, want[c.Filename])
+		}
+	}
+}
+
+func TestInjectorConfigsTools(t *testing.T) {
+	cfg := newTestConfig("php", "cursor-rules")
+	cfg.Tools = []string{config.ToolClaude, config.ToolAgents}
+	cfg.Resolved = map[string]config.ResolvedStack{
+		"php": {
+			Files: []string{"standards.md"},
+			Tools: config.ToolsConfig{IncludeInClaudeMD: true, IncludeInAgentsMD: true, IncludeInCursorRules: true},
+		},
+		"cursor-rules": {
+			Files: []string{"rules.md"},
+			Tools: config.ToolsConfig{IncludeInCursorRules: true},
+		},
+	}
+
+	configs, err := InjectorConfigs(t.TempDir(), cfg, []string{"php", "cursor-rules"})
+	if err != nil {
+		t.Fatalf("InjectorConfigs: %v", err)
+	}
+
+	dir := ManagedDir(cfg) + "/php/"
+	want := map[string][]string{
+		"CLAUDE.md": {dir + "standards.md"},
+		"AGENTS.md": {dir + "standards.md"},
+	}
+	for _, c := range configs {
+		if !reflect.DeepEqual(c.Files, want[c.Filename]) {
+			t.Errorf("%s files = %v, want %v", c.Filename, c.Files, want[c.Filename])
+		}
+	}
+}
+
+func TestInjectorConfigsBlockText(t *testing.T) {
+	cfg := newTestConfig("php")
+	cfg.Block = config.BlockConfig{Heading: "# Acme AI Instructions", Footer: "Acme standards apply."}
+	cfg.Targets = []config.TargetConfig{{Filename: "docs/zed.md"}}
+
+	configs, err := InjectorConfigs(t.TempDir(), cfg, nil)
+	if err != nil {
+		t.Fatalf("InjectorConfigs: %v", err)
+	}
+	want := injector.BlockText{Heading: "# Acme AI Instructions", Footer: "Acme standards apply."}
+	for _, c := range configs {
+		if c.Text != want {
+			t.Errorf("%s: Text = %+v, want %+v", c.Filename, c.Text, want)
+		}
+	}
+}
+
+func TestFileToolsFromManifest(t *testing.T) {
+	tests := []struct {
+		name      string
+		fileTools map[string][]string
+		want      map[string]config.ToolsConfig
+		wantErr   bool
+	}{
+		{name: "none"},
+		{
+			name:      "per file",
+			fileTools: map[string][]string{"a.md": {"claude", "agents"}, "b.md": {}},
+			want: map[string]config.ToolsConfig{
+				"a.md": {IncludeInClaudeMD: true, IncludeInAgentsMD: true},
+				"b.md": {},
+			},
+		},
+		{name: "unknown tool", fileTools: map[string][]string{"a.md": {"vim"}}, wantErr: true},
+		{name: "unlisted file", fileTools: map[string][]string{"c.md": {"claude"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := &registry.StackManifest{Files: []string{"a.md", "b.md"}, FileTools: tt.fileTools}
+			got, err := fileToolsFromManifest(manifest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fileToolsFromManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fileToolsFromManifest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectorConfigsInline(t *testing.T) {
+	projectDir := t.TempDir()
+	cfg := newTestConfig("php")
+	cfg.Resolved = map[string]config.ResolvedStack{
+		"php": {
+			Files:  []string{"critical.md", "large.md", "missing.md", "rules.md"},
+			Tools:  config.ToolsConfig{IncludeInClaudeMD: true},
+			Inline: []string{"critical.md", "large.md", "missing.md"},
+		},
+	}
+	stackDir := filepath.Join(projectDir, ManagedDir(cfg), "php")
+	os.MkdirAll(stackDir, 0755)
+	os.WriteFile(filepath.Join(stackDir, "critical.md"), []byte("Never commit secrets."), 0644)
+	os.WriteFile(filepath.Join(stackDir, "large.md"), []byte(strings.Repeat("x", maxInlineSize+1)), 0644)
+	os.WriteFile(filepath.Join(stackDir, "rules.md"), []byte("# Rules"), 0644)
+
+	configs, err := InjectorConfigs(projectDir, cfg, []string{"php"})
+	if err != nil {
+		t.Fatalf("InjectorConfigs: %v", err)
+	}
+	dir := ManagedDir(cfg) + "/php/"
+	want := map[string]string{dir + "critical.md": "Never commit secrets."}
+	for _, c := range configs {
+		if !reflect.DeepEqual(c.Inline, want) {
+			t.Errorf("%s: Inline = %v, want %v", c.Filename, c.Inline, want)
+		}
+	}
+}
+
+func TestInlineFromManifest(t *testing.T) {
+	manifest := &registry.StackManifest{
+		Files:   []string{"a.md"},
+		Locales: map[string][]string{"en": {"b.md"}, "da": {"b.md"}},
+	}
+	tests := []struct {
+		name    string
+		inline  []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "shared and downloaded translation", inline: []string{"a.md", "en/b.md", "da/b.md"}, want: []string{"a.md", "en/b.md"}},
+		{name: "unlisted file", inline: []string{"c.md"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest.Inline = tt.inline
+			got, err := inlineFromManifest(manifest, []string{"a.md", "en/b.md"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("inlineFromManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inlineFromManifest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"text/template"
+
+	"github.com/cego/ai-instructions/internal/config"
+)
+
+// projectNameVariable overrides the project directory's name as {{ .ProjectName }}.
+const projectNameVariable = "project_name"
+
+// templateValues is what stack templates can reference: {{ .ProjectName }} and
+// {{ .Var "name" }} for the config's variables.
+type templateValues struct {
+	ProjectName string
+	vars        map[string]string
+}
+
+// Var returns the config variable name. A template that reads an unset variable fails to
+// render, rather than leaving a gap in the instructions.
+func (d templateValues) Var(name string) (string, error) {
+	v, ok := d.vars[name]
+	if !ok {
+		return "", fmt.Errorf("variable %q is not set under variables", name)
+	}
+	return v, nil
+}
+
+// hash identifies the values the templates can see, so a change to any of them is noticed.
+func (d templateValues) hash() string {
+	names := make([]string, 0, len(d.vars))
+	for name := range d.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n", d.ProjectName)
+	for _, name := range names {
+		fmt.Fprintf(h, "%q=%q\n", name, d.vars[name])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// templateData returns the values cfg's stack templates are rendered with.
+func (e *Engine) templateData(cfg *config.Config) templateValues {
+	name := cfg.Variables[projectNameVariable]
+	if name == "" {
+		if abs, err := filepath.Abs(e.projectDir); err == nil {
+			name = filepath.Base(abs)
+		}
+	}
+	return templateValues{ProjectName: name, vars: cfg.Variables}
+}
+
+// variablesChanged reports whether an installed stack's templates were rendered with other
+// variables than cfg now sets, so its files must be fetched again.
+func (e *Engine) variablesChanged(cfg *config.Config, rs config.ResolvedStack) bool {
+	return rs.VariablesHash != "" && rs.VariablesHash != e.templateData(cfg).hash()
+}
+
+// ParseTemplate checks that content is a valid stack template.
+func ParseTemplate(name string, content []byte) error {
+	_, err := parseTemplate(name, content)
+	return err
+}
+
+func parseTemplate(name string, content []byte) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(string(content))
+}
+
+// renderTemplate renders a stack file as a Go template with data.
+func renderTemplate(name string, content []byte, data templateValues) ([]byte, error) {
+	tmpl, err := parseTemplate(name, content)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/filemanager"
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	data := templateValues{ProjectName: "shop", vars: map[string]string{"company": "Acme", "wiki_url": "https://wiki.acme.test"}}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "no template", content: "# PHP\n\nUse strict types.\n", want: "# PHP\n\nUse strict types.\n"},
+		{name: "project name", content: "# {{ .ProjectName }} rules", want: "# shop rules"},
+		{name: "variables", content: `{{ .Var "company" }}: see {{ .Var "wiki_url" }}`, want: "Acme: see https://wiki.acme.test"},
+		{name: "unset variable", content: `{{ .Var "team" }}`, wantErr: true},
+		{name: "unknown field", content: "{{ .Company }}", wantErr: true},
+		{name: "invalid template", content: "{{ .ProjectName", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderTemplate("rules.md", []byte(tt.content), data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("renderTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateDataProjectName(t *testing.T) {
+	e, dir := newLocalEngine(t, nil)
+	cfg := newTestConfig("php")
+	if got := e.templateData(cfg).ProjectName; got != filepath.Base(dir) {
+		t.Errorf("ProjectName = %q, want the project dir's name %q", got, filepath.Base(dir))
+	}
+	cfg.Variables = map[string]string{projectNameVariable: "shop"}
+	if got := e.templateData(cfg).ProjectName; got != "shop" {
+		t.Errorf("ProjectName = %q, want shop", got)
+	}
+}
+
+func TestSyncTemplates(t *testing.T) {
+	raw := `Ask in #{{ .Var "channel" }}.`
+	e, dir := newLocalEngine(t, map[string]string{
+		"registry.json": `{"version": 1, "stacks": {"php": {"name": "PHP", "version": "1.0.0", "category": "language"}}}`,
+		"php/stack.json": fmt.Sprintf(`{"name": "PHP", "version": "1.0.0", "files": ["rules.md", "plain.md"], "templates": ["rules.md"],
+			"hashes": {"rules.md": %q}, "tools": {"claude": {"include_in_claude_md": true}}}`, filemanager.HashBytes([]byte(raw))),
+		"php/rules.md": raw,
+		"php/plain.md": `Vue uses {{ mustache }} syntax.`,
+	})
+	cfg := newTestConfig("php")
+	cfg.Variables = map[string]string{"channel": "backend"}
+	initStacks(t, e, cfg)
+
+	stackDir := filepath.Join(dir, ManagedDir(cfg), "php")
+	readFile := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(stackDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if got := readFile("rules.md"); got != "Ask in #backend." {
+		t.Errorf("rules.md = %q, want it rendered", got)
+	}
+	if got := readFile("plain.md"); got != `Vue uses {{ mustache }} syntax.` {
+		t.Errorf("plain.md = %q, want it unchanged", got)
+	}
+
+	// The locked hashes cover the rendered files, so they stay intact
+	rs := cfg.Resolved["php"]
+	if rs.VariablesHash == "" {
+		t.Fatal("VariablesHash not recorded")
+	}
+	if !e.localStackIntact(ManagedDir(cfg), "php", rs) {
+		t.Error("rendered stack should verify against its locked hashes")
+	}
+	result, err := e.Sync(context.Background(), cfg, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if len(result.Updates) != 0 {
+		t.Errorf("Updates = %+v, want none while the variables are unchanged", result.Updates)
+	}
+
+	cfg.Variables["channel"] = "php"
+	result, err = e.Sync(context.Background(), cfg, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if len(result.Updates) != 1 {
+		t.Errorf("Updates = %+v, want php rendered again", result.Updates)
+	}
+	if got := readFile("rules.md"); got != "Ask in #php." {
+		t.Errorf("rules.md = %q, want it rendered with the new variable", got)
+	}
+}
+
+func TestSyncTemplatesWithETags(t *testing.T) {
+	raw := `Ask in #{{ .Var "channel" }}.`
+	manifest := func(version, plain string) string {
+		return fmt.Sprintf(`{"name": "PHP", "version": %q, "files": ["rules.md", "plain.md"], "templates": ["rules.md"],
+			"hashes": {"rules.md": %q, "plain.md": %q}, "tools": {"claude": {"include_in_claude_md": true}}}`,
+			version, filemanager.HashBytes([]byte(raw)), filemanager.HashBytes([]byte(plain)))
+	}
+	var mu sync.Mutex
+	files := map[string]string{
+		"registry.json":  `{"version": 1, "stacks": {"php": {"name": "PHP", "version": "1.0.0", "category": "language"}}}`,
+		"php/stack.json": manifest("1.0.0", "v1"),
+		"php/rules.md":   raw,
+		"php/plain.md":   "v1",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		content, ok := files[strings.TrimPrefix(r.URL.Path, "/company-instructions/")]
+		mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		etag := fmt.Sprintf("%q", filemanager.HashBytes([]byte(content)))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	newEngine := func() *Engine {
+		return New(registry.NewClient(registry.WithBaseURL(server.URL), registry.WithHTTPClient(server.Client())), dir)
+	}
+	e := newEngine()
+	cfg := newTestConfig("php")
+	// A value that would break a second rendering of the rendered file
+	cfg.Variables = map[string]string{"channel": "{{ oops"}
+	initStacks(t, e, cfg)
+
+	if _, ok := cfg.Resolved["php"].ETags["rules.md"]; ok {
+		t.Errorf("ETags = %v, want none recorded for the template", cfg.Resolved["php"].ETags)
+	}
+
+	// A new version where only the plain file changed
+	mu.Lock()
+	files["registry.json"] = strings.Replace(files["registry.json"], "1.0.0", "1.1.0", 1)
+	files["php/stack.json"] = manifest("1.1.0", "v2")
+	files["php/plain.md"] = "v2"
+	mu.Unlock()
+
+	if _, err := newEngine().Sync(context.Background(), cfg, SyncOptions{}); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ManagedDir(cfg), "php", "rules.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "Ask in #{{ oops." {
+		t.Errorf("rules.md = %q, want it rendered once from the published template", data)
+	}
+}
@@ -1,9 +1,12 @@
 package exitcodes
 
+// Exit codes are part of the CLI's contract with CI scripts; see the README table.
 const (
 	Success            = 0
-	VerificationFailed = 1
-	ConfigError        = 2
-	NetworkError       = 3
-	UsageError         = 4
+	VerificationFailed = 1   // outdated, tampered or missing files or blocks
+	ConfigError        = 2   // missing or invalid config, rejected token, wrong registry URL or branch
+	NetworkError       = 3   // registry unreachable
+	UsageError         = 4   // bad arguments or flags
+	StackNotFound      = 5   // requested stack doesn't exist in the registry
+	Aborted            = 130 // interrupted by the user (Ctrl-C), as shells report SIGINT
 )
@@ -0,0 +1,105 @@
+package filemanager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+// maxArchiveSize bounds the extracted size of a stack archive, so a small download
+// can't expand into something that fills the disk.
+const maxArchiveSize = 100 << 20 // 100 MB
+
+// WithArchiveURL downloads the stack's files in one request from the archive at
+// archiveURL, a .tar.gz with the files at its root. A registry that answers 404 for the
+// archive gets the files downloaded one by one instead.
+func WithArchiveURL(archiveURL string) DownloadOption {
+	return func(o *downloadOptions) { o.archiveURL = archiveURL }
+}
+
+// downloadArchive fetches a stack's archive and returns the contents of files from it.
+// It returns nil, nil when the registry has no such archive.
+func (m *Manager) downloadArchive(ctx context.Context, stackID, archiveURL string, files []string) (map[string][]byte, error) {
+	data, err := m.client.DownloadArchive(ctx, stackID, archiveURL)
+	if registry.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("downloading archive for %s: %w", stackID, err)
+	}
+
+	contents, err := extractArchive(data, files)
+	if err != nil {
+		return nil, fmt.Errorf("archive for %s: %w", stackID, err)
+	}
+	return contents, nil
+}
+
+// extractArchive reads the given files from a .tar.gz. Every entry must be a relative
+// path inside the archive root, so nothing can be written outside the stack directory.
+// Entries that aren't listed in files are ignored; a listed file that is missing, or
+// isn't a regular file, is an error.
+func extractArchive(data []byte, files []string) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing: %w", err)
+	}
+	defer gz.Close()
+
+	wanted := make(map[string]bool, len(files))
+	for _, f := range files {
+		wanted[f] = true
+	}
+
+	contents := make(map[string][]byte, len(files))
+	var total int64
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading: %w", err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "." {
+			continue
+		}
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("entry %q escapes the stack directory", hdr.Name)
+		}
+		if !wanted[name] {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%s is not a regular file", name)
+		}
+
+		total += hdr.Size
+		if total > maxArchiveSize {
+			return nil, fmt.Errorf("extracted files exceed %d MB", maxArchiveSize>>20)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+		contents[name] = content
+	}
+
+	for _, f := range files {
+		if _, ok := contents[f]; !ok {
+			return nil, fmt.Errorf("missing %s", f)
+		}
+	}
+	return contents, nil
+}
@@ -0,0 +1,203 @@
+package filemanager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cego/ai-instructions/internal/config"
+	"github.com/cego/ai-instructions/internal/registry"
+)
+
+// tarEntry is a file or link in a test archive.
+type tarEntry struct {
+	name     string
+	content  string
+	linkname string // makes the entry a symlink
+}
+
+func buildArchive(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.linkname != "" {
+			hdr = &tar.Header{Name: e.name, Mode: 0777, Linkname: e.linkname, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if e.linkname == "" {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		files   []string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "listed files",
+			entries: []tarEntry{{name: "./rules.md", content: "rules"}, {name: "docs/testing.md", content: "testing"}, {name: "extra.md", content: "ignored"}},
+			files:   []string{"rules.md", "docs/testing.md"},
+			want:    map[string]string{"rules.md": "rules", "docs/testing.md": "testing"},
+		},
+		{
+			name:    "parent traversal",
+			entries: []tarEntry{{name: "../../evil.md", content: "x"}, {name: "rules.md", content: "rules"}},
+			files:   []string{"rules.md"},
+			wantErr: "escapes the stack directory",
+		},
+		{
+			name:    "absolute path",
+			entries: []tarEntry{{name: "/etc/passwd", content: "x"}},
+			files:   []string{"rules.md"},
+			wantErr: "escapes the stack directory",
+		},
+		{
+			name:    "symlink",
+			entries: []tarEntry{{name: "rules.md", linkname: "/etc/passwd"}},
+			files:   []string{"rules.md"},
+			wantErr: "not a regular file",
+		},
+		{
+			name:    "missing file",
+			entries: []tarEntry{{name: "rules.md", content: "rules"}},
+			files:   []string{"rules.md", "testing.md"},
+			wantErr: "missing testing.md",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractArchive(buildArchive(t, tt.entries...), tt.files)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("extractArchive() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractArchive() error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("extractArchive() returned %d files, want %d", len(got), len(tt.want))
+			}
+			for f, want := range tt.want {
+				if string(got[f]) != want {
+					t.Errorf("%s = %q, want %q", f, got[f], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadStackFromArchive(t *testing.T) {
+	archive := buildArchive(t,
+		tarEntry{name: "rules.md", content: "# Rules"},
+		tarEntry{name: "docs/testing.md", content: "# Testing"},
+	)
+
+	tests := []struct {
+		name         string
+		archivePath  string
+		wantRequests int32
+		wantRules    string
+	}{
+		{name: "archive", archivePath: "stack.tar.gz", wantRequests: 1, wantRules: "# Rules"},
+		// Without the archive every file is fetched on its own
+		{name: "fallback", archivePath: "missing.tar.gz", wantRequests: 3, wantRules: "per-file /company-instructions/php/rules.md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				switch {
+				case r.URL.Path == "/company-instructions/php/stack.tar.gz":
+					w.Write(archive)
+				case strings.HasSuffix(r.URL.Path, ".tar.gz"):
+					http.Error(w, "not found", http.StatusNotFound)
+				default:
+					w.Write([]byte("per-file " + r.URL.Path))
+				}
+			}))
+			defer server.Close()
+
+			client := registry.NewClient(registry.WithBaseURL(server.URL), registry.WithHTTPClient(server.Client()))
+			dir := t.TempDir()
+			fm := NewManager(client, dir, config.DefaultInstructionsDir)
+
+			err := fm.DownloadStack(context.Background(), "php", []string{"rules.md", "docs/testing.md"}, WithArchiveURL(tt.archivePath))
+			if err != nil {
+				t.Fatalf("DownloadStack() error: %v", err)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, config.DefaultInstructionsDir, "php", "rules.md"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.wantRules {
+				t.Errorf("rules.md = %q, want %q", data, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestDownloadStackBadArchiveKeepsPreviousVersion(t *testing.T) {
+	archive := buildArchive(t, tarEntry{name: "../rules.md", content: "escaped"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	client := registry.NewClient(registry.WithBaseURL(server.URL), registry.WithHTTPClient(server.Client()))
+	dir := t.TempDir()
+	fm := NewManager(client, dir, config.DefaultInstructionsDir)
+	stackDir := fm.StackDir("php")
+	if err := os.MkdirAll(stackDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stackDir, "rules.md"), []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := fm.DownloadStack(context.Background(), "php", []string{"rules.md"}, WithArchiveURL("stack.tar.gz"))
+	if err == nil || !strings.Contains(err.Error(), "escapes the stack directory") {
+		t.Fatalf("DownloadStack() error = %v, want a path traversal error", err)
+	}
+	data, err := os.ReadFile(filepath.Join(stackDir, "rules.md"))
+	if err != nil || string(data) != "previous" {
+		t.Errorf("rules.md = %q, %v; want the previous version kept", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(fm.InstructionsDir(), "rules.md")); !os.IsNotExist(err) {
+		t.Errorf("escaped entry was written: %v", err)
+	}
+}
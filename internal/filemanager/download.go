@@ -12,23 +12,18 @@ import (
 
 // validatePathComponent rejects path components that could escape the intended directory.
 func validatePathComponent(name, label string) error {
-	if name == "" {
-		return fmt.Errorf("empty %s", label)
-	}
-	cleaned := filepath.Clean(name)
-	if cleaned != name || strings.Contains(cleaned, "..") || filepath.IsAbs(cleaned) {
-		return fmt.Errorf("invalid %s: %q", label, name)
-	}
-	return nil
+	return registry.ValidatePathComponent(name, label)
 }
 
-// validateInsideDir checks that resolved is a child of base after symlink-safe cleaning.
+// validateInsideDir checks that resolved is a child of base. Symlinks are resolved on both
+// paths first, as far as they exist, so a symlink inside base can't point a write outside
+// it, while a managed directory that is itself a symlink keeps working.
 func validateInsideDir(base, resolved string) error {
-	absBase, err := filepath.Abs(base)
+	absBase, err := evalExisting(base)
 	if err != nil {
 		return err
 	}
-	absResolved, err := filepath.Abs(resolved)
+	absResolved, err := evalExisting(resolved)
 	if err != nil {
 		return err
 	}
@@ -38,6 +33,95 @@ func validateInsideDir(base, resolved string) error {
 	return nil
 }
 
+// evalExisting returns the absolute path of path with symlinks resolved in its longest
+// existing prefix; the components that don't exist yet are appended as they are. A dangling
+// symlink is an error, since writing through it would create its unchecked target.
+func evalExisting(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	for p := abs; ; p = filepath.Dir(p) {
+		target, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{target}, rest...)...), nil
+		}
+		if _, lerr := os.Lstat(p); lerr == nil || !os.IsNotExist(err) {
+			return "", fmt.Errorf("resolving %s: %w", path, err)
+		}
+		if filepath.Dir(p) == p {
+			return abs, nil
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+	}
+}
+
+// defaultFileMode is used for downloaded files without an explicit mode.
+const defaultFileMode os.FileMode = 0644
+
+// DownloadOption configures a single DownloadStack call.
+type DownloadOption func(*downloadOptions)
+
+type downloadOptions struct {
+	modes    map[string]os.FileMode
+	hashes   map[string]string
+	etags    map[string]string
+	progress ProgressFunc
+	render   RenderFunc
+
+	archiveURL string
+}
+
+// ProgressFunc is called after each file is written, with the number of files done so far out of total.
+type ProgressFunc func(stackID, filename string, done, total int)
+
+// WithFileModes sets the permissions to write specific files with.
+// Files not present in the map are written with 0644.
+func WithFileModes(modes map[string]os.FileMode) DownloadOption {
+	return func(o *downloadOptions) { o.modes = modes }
+}
+
+// WithExpectedHashes verifies each downloaded file against its expected "sha256:<hex>" hash
+// before it is written into place. Files not present in the map are not checked.
+func WithExpectedHashes(hashes map[string]string) DownloadOption {
+	return func(o *downloadOptions) { o.hashes = hashes }
+}
+
+// WithETags makes the download conditional on each file's ETag in etags. A file the
+// registry reports unchanged is copied from the current stack directory instead, so the
+// caller must only pass ETags of files that are intact on disk. etags is updated in place
+// with the ETags the registry sent; files without one are removed from it.
+func WithETags(etags map[string]string) DownloadOption {
+	return func(o *downloadOptions) { o.etags = etags }
+}
+
+// RenderFunc returns the content to write for a downloaded file.
+type RenderFunc func(filename string, data []byte) ([]byte, error)
+
+// WithRender passes each downloaded file through fn before it is written. Expected hashes
+// are checked against the content as downloaded, before rendering.
+func WithRender(fn RenderFunc) DownloadOption {
+	return func(o *downloadOptions) { o.render = fn }
+}
+
+// WithProgress reports each completed file to fn.
+func WithProgress(fn ProgressFunc) DownloadOption {
+	return func(o *downloadOptions) { o.progress = fn }
+}
+
+// HashMismatchError indicates a downloaded file doesn't match the hash published for it.
+type HashMismatchError struct {
+	Stack    string
+	File     string
+	Expected string
+	Actual   string
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("hash mismatch for %s/%s: expected %s, got %s", e.Stack, e.File, e.Expected, e.Actual)
+}
+
 // Manager handles downloading and managing instruction files.
 type Manager struct {
 	client          *registry.Client
@@ -70,7 +154,16 @@ func (m *Manager) EnsureDir() error {
 }
 
 // DownloadStack downloads all files for a single stack.
-func (m *Manager) DownloadStack(ctx context.Context, stackID string, files []string) error {
+// Files are written to a temporary sibling directory that replaces the stack
+// directory only once every file succeeded, so a failed download leaves the
+// previous version intact. A stack without files, which only exists to pull in its
+// dependencies, gets no directory; one left from an earlier version is removed.
+func (m *Manager) DownloadStack(ctx context.Context, stackID string, files []string, opts ...DownloadOption) error {
+	var o downloadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	if err := validatePathComponent(stackID, "stack ID"); err != nil {
 		return err
 	}
@@ -80,44 +173,157 @@ func (m *Manager) DownloadStack(ctx context.Context, stackID string, files []str
 		return fmt.Errorf("invalid stack path: %w", err)
 	}
 
-	// Clear existing stack directory to remove stale files from previous versions
-	os.RemoveAll(stackDir)
-	if err := os.MkdirAll(stackDir, 0755); err != nil {
-		return fmt.Errorf("creating stack dir %s: %w", stackID, err)
+	if len(files) == 0 {
+		if err := os.RemoveAll(stackDir); err != nil {
+			return fmt.Errorf("removing stack dir %s: %w", stackID, err)
+		}
+		return nil
+	}
+
+	if err := m.EnsureDir(); err != nil {
+		return fmt.Errorf("creating instructions dir: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(m.InstructionsDir(), "."+stackID+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp dir for %s: %w", stackID, err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		return fmt.Errorf("creating temp dir for %s: %w", stackID, err)
 	}
 
 	for _, filename := range files {
 		if err := validatePathComponent(filename, "filename"); err != nil {
 			return err
 		}
+	}
 
-		filePath := filepath.Join(stackDir, filename)
-		if err := validateInsideDir(stackDir, filePath); err != nil {
+	var archived map[string][]byte
+	if o.archiveURL != "" {
+		archived, err = m.downloadArchive(ctx, stackID, o.archiveURL, files)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, filename := range files {
+		filePath := filepath.Join(tmpDir, filename)
+		if err := validateInsideDir(tmpDir, filePath); err != nil {
 			return fmt.Errorf("invalid file path: %w", err)
 		}
 
-		data, err := m.client.DownloadFile(ctx, stackID, filename)
-		if err != nil {
-			return fmt.Errorf("downloading %s/%s: %w", stackID, filename, err)
+		data, ok := archived[filename]
+		if ok {
+			// Archive contents carry no ETag to make the next download conditional on
+			delete(o.etags, filename)
+		} else {
+			data, err = m.downloadFile(ctx, stackID, filename, o.etags)
+			if err != nil {
+				return fmt.Errorf("downloading %s/%s: %w", stackID, filename, err)
+			}
 		}
 
-		tmpPath := filePath + ".tmp"
+		if expected, ok := o.hashes[filename]; ok {
+			if actual := HashBytes(data); actual != expected {
+				return &HashMismatchError{Stack: stackID, File: filename, Expected: expected, Actual: actual}
+			}
+		}
+		if o.render != nil {
+			data, err = o.render(filename, data)
+			if err != nil {
+				return fmt.Errorf("rendering %s/%s: %w", stackID, filename, err)
+			}
+		}
 
-		if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("writing %s/%s: %w", stackID, filename, err)
+		}
+		mode, hasMode := o.modes[filename]
+		if !hasMode {
+			mode = defaultFileMode
+		}
+		if err := os.WriteFile(filePath, data, mode); err != nil {
 			return fmt.Errorf("writing %s/%s: %w", stackID, filename, err)
 		}
+		if hasMode {
+			// WriteFile is subject to the umask; set the declared mode exactly
+			if err := os.Chmod(filePath, mode); err != nil {
+				return fmt.Errorf("setting mode on %s/%s: %w", stackID, filename, err)
+			}
+		}
 
-		if err := os.Rename(tmpPath, filePath); err != nil {
-			os.Remove(tmpPath)
-			return fmt.Errorf("saving %s/%s: %w", stackID, filename, err)
+		if o.progress != nil {
+			o.progress(stackID, filename, i+1, len(files))
 		}
 	}
 
+	if err := swapDir(tmpDir, stackDir); err != nil {
+		return fmt.Errorf("replacing stack dir %s: %w", stackID, err)
+	}
+	return nil
+}
+
+// downloadFile downloads a stack file, or reads the current copy when the registry
+// reports that it still matches its ETag. etags, if not nil, receives the new ETag.
+func (m *Manager) downloadFile(ctx context.Context, stackID, filename string, etags map[string]string) ([]byte, error) {
+	if etags == nil {
+		return m.client.DownloadFile(ctx, stackID, filename)
+	}
+
+	f, err := m.client.DownloadFileIfChanged(ctx, stackID, filename, etags[filename])
+	if err != nil {
+		return nil, err
+	}
+	data := f.Data
+	if f.NotModified {
+		data, err = os.ReadFile(filepath.Join(m.StackDir(stackID), filename))
+		if err != nil {
+			// The current copy is gone after all; fetch it unconditionally
+			f, err = m.client.DownloadFileIfChanged(ctx, stackID, filename, "")
+			if err != nil {
+				return nil, err
+			}
+			data = f.Data
+		}
+	}
+
+	if f.ETag != "" {
+		etags[filename] = f.ETag
+	} else {
+		delete(etags, filename)
+	}
+	return data, nil
+}
+
+// swapDir replaces dst with src, restoring the original dst if the final rename fails.
+func swapDir(src, dst string) error {
+	backup := dst + ".old"
+	os.RemoveAll(backup)
+
+	hadOld := true
+	if err := os.Rename(dst, backup); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		hadOld = false
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		if hadOld {
+			os.Rename(backup, dst)
+		}
+		return err
+	}
+
+	if hadOld {
+		os.RemoveAll(backup)
+	}
 	return nil
 }
 
 // DownloadStacks downloads files for multiple stacks.
-func (m *Manager) DownloadStacks(ctx context.Context, stacks map[string][]string) error {
+// A progress callback receives counts across all stacks rather than per stack.
+func (m *Manager) DownloadStacks(ctx context.Context, stacks map[string][]string, opts ...DownloadOption) error {
 	for stackID := range stacks {
 		if err := validatePathComponent(stackID, "stack ID"); err != nil {
 			return err
@@ -128,8 +334,25 @@ func (m *Manager) DownloadStacks(ctx context.Context, stacks map[string][]string
 		return err
 	}
 
+	var o downloadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.progress != nil {
+		total := 0
+		for _, files := range stacks {
+			total += len(files)
+		}
+		done := 0
+		report := o.progress
+		opts = append(opts, WithProgress(func(stackID, filename string, _, _ int) {
+			done++
+			report(stackID, filename, done, total)
+		}))
+	}
+
 	for stackID, files := range stacks {
-		if err := m.DownloadStack(ctx, stackID, files); err != nil {
+		if err := m.DownloadStack(ctx, stackID, files, opts...); err != nil {
 			return err
 		}
 	}
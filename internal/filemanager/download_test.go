@@ -2,6 +2,7 @@ package filemanager
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -50,6 +51,235 @@ func TestDownloadStack(t *testing.T) {
 	}
 }
 
+func TestDownloadStackSubdirectories(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	client := registry.NewClient(
+		registry.WithBaseURL(server.URL),
+		registry.WithHTTPClient(server.Client()),
+	)
+
+	dir := t.TempDir()
+	fm := NewManager(client, dir, config.DefaultInstructionsDir)
+	if err := fm.DownloadStack(context.Background(), "php", []string{"rules.md", "docs/testing.md"}); err != nil {
+		t.Fatalf("DownloadStack() error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, config.DefaultInstructionsDir, "php", "docs", "testing.md"))
+	if err != nil {
+		t.Fatalf("nested file should exist: %v", err)
+	}
+	if want := "content of /company-instructions/php/docs/testing.md"; string(data) != want {
+		t.Errorf("content = %q, want %q", data, want)
+	}
+}
+
+func TestDownloadStackWithoutFiles(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	client := registry.NewClient(registry.WithBaseURL(server.URL), registry.WithHTTPClient(server.Client()))
+
+	dir := t.TempDir()
+	fm := NewManager(client, dir, config.DefaultInstructionsDir)
+
+	// An earlier version of the stack had files
+	os.MkdirAll(fm.StackDir("backend"), 0755)
+	os.WriteFile(filepath.Join(fm.StackDir("backend"), "old.md"), []byte("old"), 0644)
+
+	if err := fm.DownloadStack(context.Background(), "backend", nil); err != nil {
+		t.Fatalf("DownloadStack() error: %v", err)
+	}
+	if _, err := os.Stat(fm.StackDir("backend")); !os.IsNotExist(err) {
+		t.Errorf("stack dir should not exist for a stack without files, stat error: %v", err)
+	}
+}
+
+func TestDownloadStackETags(t *testing.T) {
+	var served []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + filepath.Base(r.URL.Path) + `-v2"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		served = append(served, filepath.Base(r.URL.Path))
+		w.Write([]byte("new " + filepath.Base(r.URL.Path)))
+	}))
+	defer server.Close()
+
+	client := registry.NewClient(registry.WithBaseURL(server.URL), registry.WithHTTPClient(server.Client()))
+	dir := t.TempDir()
+	fm := NewManager(client, dir, config.DefaultInstructionsDir)
+	stackDir := fm.StackDir("php")
+	os.MkdirAll(stackDir, 0755)
+	os.WriteFile(filepath.Join(stackDir, "rules.md"), []byte("kept rules.md"), 0644)
+	os.WriteFile(filepath.Join(stackDir, "testing.md"), []byte("old testing.md"), 0644)
+
+	etags := map[string]string{"rules.md": `"rules.md-v2"`, "testing.md": `"testing.md-v1"`}
+	if err := fm.DownloadStack(context.Background(), "php", []string{"rules.md", "testing.md"}, WithETags(etags)); err != nil {
+		t.Fatalf("DownloadStack() error: %v", err)
+	}
+
+	if len(served) != 1 || served[0] != "testing.md" {
+		t.Errorf("served = %v, want only testing.md", served)
+	}
+	for file, want := range map[string]string{"rules.md": "kept rules.md", "testing.md": "new testing.md"} {
+		data, _ := os.ReadFile(filepath.Join(stackDir, file))
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", file, data, want)
+		}
+	}
+	if etags["testing.md"] != `"testing.md-v2"` {
+		t.Errorf("etags = %v, want testing.md updated", etags)
+	}
+}
+
+func TestDownloadStackFileModes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	client := registry.NewClient(
+		registry.WithBaseURL(server.URL),
+		registry.WithHTTPClient(server.Client()),
+	)
+
+	dir := t.TempDir()
+	fm := NewManager(client, dir, config.DefaultInstructionsDir)
+
+	err := fm.DownloadStack(context.Background(), "go", []string{"coding-standards.md", "lint.sh"},
+		WithFileModes(map[string]os.FileMode{"lint.sh": 0755}),
+	)
+	if err != nil {
+		t.Fatalf("DownloadStack() error: %v", err)
+	}
+
+	tests := []struct {
+		file string
+		want os.FileMode
+	}{
+		{file: "coding-standards.md", want: 0644},
+		{file: "lint.sh", want: 0755},
+	}
+	for _, tt := range tests {
+		info, err := os.Stat(filepath.Join(fm.StackDir("go"), tt.file))
+		if err != nil {
+			t.Fatalf("stat %s: %v", tt.file, err)
+		}
+		if info.Mode().Perm() != tt.want {
+			t.Errorf("%s mode = %o, want %o", tt.file, info.Mode().Perm(), tt.want)
+		}
+	}
+}
+
+func TestDownloadStackExpectedHashes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# PHP Standards"))
+	}))
+	defer server.Close()
+
+	client := registry.NewClient(
+		registry.WithBaseURL(server.URL),
+		registry.WithHTTPClient(server.Client()),
+	)
+
+	tests := []struct {
+		name     string
+		expected string
+		wantErr  bool
+	}{
+		{name: "matching hash", expected: HashBytes([]byte("# PHP Standards")), wantErr: false},
+		{name: "mismatched hash", expected: HashBytes([]byte("something else")), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fm := NewManager(client, dir, config.DefaultInstructionsDir)
+
+			err := fm.DownloadStack(context.Background(), "php", []string{"coding-standards.md"},
+				WithExpectedHashes(map[string]string{"coding-standards.md": tt.expected}),
+			)
+
+			path := filepath.Join(fm.StackDir("php"), "coding-standards.md")
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("DownloadStack() error: %v", err)
+				}
+				if _, statErr := os.Stat(path); statErr != nil {
+					t.Error("file should be written when hash matches")
+				}
+				return
+			}
+
+			var mismatch *HashMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("expected HashMismatchError, got %T: %v", err, err)
+			}
+			if mismatch.File != "coding-standards.md" || mismatch.Expected != tt.expected {
+				t.Errorf("mismatch = %+v", mismatch)
+			}
+			if _, statErr := os.Stat(path); !os.IsNotExist(statErr) {
+				t.Error("file with mismatched hash should not be written")
+			}
+		})
+	}
+}
+
+func TestDownloadStackFailureKeepsPreviousVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/broken.md") {
+			http.Error(w, "boom", 500)
+			return
+		}
+		w.Write([]byte("new content"))
+	}))
+	defer server.Close()
+
+	client := registry.NewClient(
+		registry.WithBaseURL(server.URL),
+		registry.WithHTTPClient(server.Client()),
+	)
+
+	dir := t.TempDir()
+	fm := NewManager(client, dir, config.DefaultInstructionsDir)
+	stackDir := fm.StackDir("php")
+	if err := os.MkdirAll(stackDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(stackDir, "coding-standards.md"), []byte("old standards"), 0644)
+	os.WriteFile(filepath.Join(stackDir, "testing.md"), []byte("old testing"), 0644)
+
+	err := fm.DownloadStack(context.Background(), "php", []string{"coding-standards.md", "testing.md", "broken.md"})
+	if err == nil {
+		t.Fatal("DownloadStack() should fail when a file can't be downloaded")
+	}
+
+	for file, want := range map[string]string{"coding-standards.md": "old standards", "testing.md": "old testing"} {
+		data, err := os.ReadFile(filepath.Join(stackDir, file))
+		if err != nil {
+			t.Fatalf("%s should still exist: %v", file, err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want previous content %q", file, data, want)
+		}
+	}
+
+	entries, _ := os.ReadDir(fm.InstructionsDir())
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("instructions dir = %v, temp dirs should be cleaned up", names)
+	}
+}
+
 func TestDownloadStacks(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("content of " + r.URL.Path))
@@ -82,6 +312,53 @@ func TestDownloadStacks(t *testing.T) {
 	}
 }
 
+func TestDownloadStacksProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	client := registry.NewClient(
+		registry.WithBaseURL(server.URL),
+		registry.WithHTTPClient(server.Client()),
+	)
+
+	fm := NewManager(client, t.TempDir(), config.DefaultInstructionsDir)
+
+	var stackDone []int
+	err := fm.DownloadStack(context.Background(), "php", []string{"a.md", "b.md"},
+		WithProgress(func(stackID, filename string, done, total int) {
+			if total != 2 {
+				t.Errorf("total = %d, want 2", total)
+			}
+			stackDone = append(stackDone, done)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("DownloadStack() error: %v", err)
+	}
+	if len(stackDone) != 2 || stackDone[0] != 1 || stackDone[1] != 2 {
+		t.Errorf("DownloadStack progress = %v, want [1 2]", stackDone)
+	}
+
+	var allDone []int
+	err = fm.DownloadStacks(context.Background(), map[string][]string{
+		"php":     {"a.md", "b.md"},
+		"laravel": {"c.md"},
+	}, WithProgress(func(stackID, filename string, done, total int) {
+		if total != 3 {
+			t.Errorf("total = %d, want 3", total)
+		}
+		allDone = append(allDone, done)
+	}))
+	if err != nil {
+		t.Fatalf("DownloadStacks() error: %v", err)
+	}
+	if len(allDone) != 3 || allDone[2] != 3 {
+		t.Errorf("DownloadStacks progress = %v, want counts up to 3", allDone)
+	}
+}
+
 func TestDownloadStack_PathTraversal(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("malicious content"))
@@ -165,6 +442,85 @@ func TestDownloadStack_PathTraversal(t *testing.T) {
 	}
 }
 
+func TestValidateInsideDir(t *testing.T) {
+	root := t.TempDir()
+	outside := filepath.Join(root, "outside")
+	realDir := filepath.Join(root, "realDir")
+	for _, d := range []string{outside, filepath.Join(realDir, "php")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The managed dir is a symlink, and holds symlinks pointing out of it
+	managed := filepath.Join(root, "managed")
+	links := map[string]string{
+		managed:                            realDir,
+		filepath.Join(realDir, "escape"):   outside,
+		filepath.Join(realDir, "dangling"): filepath.Join(outside, "missing"),
+		filepath.Join(realDir, "inner"):    filepath.Join(realDir, "php"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		base    string
+		path    string
+		wantErr bool
+	}{
+		{name: "existing dir under symlinked base", base: managed, path: filepath.Join(managed, "php")},
+		{name: "new file under symlinked base", base: managed, path: filepath.Join(managed, "go", "rules.md")},
+		{name: "symlink within base", base: managed, path: filepath.Join(managed, "inner", "rules.md")},
+		{name: "base itself", base: managed, path: managed},
+		{name: "symlink pointing outside", base: managed, path: filepath.Join(managed, "escape"), wantErr: true},
+		{name: "new file behind symlink pointing outside", base: managed, path: filepath.Join(managed, "escape", "rules.md"), wantErr: true},
+		{name: "dangling symlink", base: managed, path: filepath.Join(managed, "dangling"), wantErr: true},
+		{name: "parent dir", base: managed, path: filepath.Join(managed, ".."), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInsideDir(tt.base, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateInsideDir(%q, %q) error = %v, wantErr %v", tt.base, tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownloadStackSymlinkedStackDir(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("malicious content"))
+	}))
+	defer server.Close()
+
+	client := registry.NewClient(
+		registry.WithBaseURL(server.URL),
+		registry.WithHTTPClient(server.Client()),
+	)
+
+	dir := t.TempDir()
+	outside := t.TempDir()
+	fm := NewManager(client, dir, config.DefaultInstructionsDir)
+	if err := fm.EnsureDir(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, fm.StackDir("php")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	err := fm.DownloadStack(context.Background(), "php", []string{"rules.md"})
+	if err == nil || !strings.Contains(err.Error(), "invalid stack path") {
+		t.Fatalf("DownloadStack() error = %v, want invalid stack path", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "rules.md")); !os.IsNotExist(err) {
+		t.Errorf("file written outside the managed dir: %v", err)
+	}
+}
+
 func TestDownloadStacks_PathTraversal(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("malicious content"))
@@ -0,0 +1,40 @@
+package filemanager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitignoreFile is the project's git ignore file.
+const GitignoreFile = ".gitignore"
+
+// EnsureGitignored adds dir (relative to the project, slash-separated) to the project's
+// .gitignore, creating the file if needed. It reports whether the file was changed;
+// an existing entry for dir, with or without leading and trailing slashes, is left alone.
+func EnsureGitignored(projectDir, dir string) (bool, error) {
+	path := filepath.Join(projectDir, GitignoreFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("reading %s: %w", GitignoreFile, err)
+	}
+
+	want := strings.Trim(dir, "/")
+	content := string(data)
+	for _, line := range strings.Split(content, "\n") {
+		if strings.Trim(strings.TrimSpace(line), "/") == want {
+			return false, nil
+		}
+	}
+
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += "/" + want + "/\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return false, fmt.Errorf("writing %s: %w", GitignoreFile, err)
+	}
+	return true, nil
+}
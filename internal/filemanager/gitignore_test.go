@@ -0,0 +1,53 @@
+package filemanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureGitignored(t *testing.T) {
+	const dir = "ai-instructions/company-instructions"
+
+	tests := []struct {
+		name        string
+		existing    *string // nil for no .gitignore
+		want        string
+		wantChanged bool
+	}{
+		{name: "no gitignore", want: "/" + dir + "/\n", wantChanged: true},
+		{name: "appends", existing: ptr("node_modules/\n"), want: "node_modules/\n/" + dir + "/\n", wantChanged: true},
+		{name: "adds missing newline", existing: ptr("vendor"), want: "vendor\n/" + dir + "/\n", wantChanged: true},
+		{name: "already ignored", existing: ptr("vendor/\n/" + dir + "/\n"), want: "vendor/\n/" + dir + "/\n"},
+		{name: "ignored without slashes", existing: ptr(dir + "\n"), want: dir + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectDir := t.TempDir()
+			path := filepath.Join(projectDir, GitignoreFile)
+			if tt.existing != nil {
+				os.WriteFile(path, []byte(*tt.existing), 0644)
+			}
+
+			changed, err := EnsureGitignored(projectDir, dir)
+			if err != nil {
+				t.Fatalf("EnsureGitignored() error: %v", err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			data, _ := os.ReadFile(path)
+			if string(data) != tt.want {
+				t.Errorf(".gitignore = %q, want %q", data, tt.want)
+			}
+
+			// Running again never changes it
+			if changed, _ := EnsureGitignored(projectDir, dir); changed {
+				t.Error("second EnsureGitignored() changed the file")
+			}
+		})
+	}
+}
+
+func ptr(s string) *string { return &s }
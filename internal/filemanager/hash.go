@@ -7,8 +7,36 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 )
 
+// ignoredForHash reports whether a file, given by its slash-separated path relative to the
+// stack directory, is left out of stack hashes: leftover .tmp files from an interrupted
+// write, and hidden editor/OS artifacts unless the manifest lists them.
+func ignoredForHash(rel string, listed map[string]bool) bool {
+	if strings.HasSuffix(rel, ".tmp") {
+		return true
+	}
+	if listed[rel] {
+		return false
+	}
+	for _, part := range strings.Split(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// listedSet returns the stack's listed files as a set of slash-separated paths.
+func listedSet(files []string) map[string]bool {
+	set := make(map[string]bool, len(files))
+	for _, f := range files {
+		set[filepath.ToSlash(f)] = true
+	}
+	return set
+}
+
 // HashBytes computes the SHA256 hash of a byte slice.
 func HashBytes(data []byte) string {
 	h := sha256.Sum256(data)
@@ -17,14 +45,8 @@ func HashBytes(data []byte) string {
 
 // HashFile computes the SHA256 hash of a file.
 func HashFile(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
-
 	h := sha256.New()
-	if _, err := io.Copy(h, f); err != nil {
+	if err := copyFile(h, path); err != nil {
 		return "", err
 	}
 
@@ -32,18 +54,24 @@ func HashFile(path string) (string, error) {
 }
 
 // HashDir computes a deterministic SHA256 hash of a directory's contents.
-// Files are sorted by name and each file's path + content is hashed.
-func HashDir(dir string) (string, error) {
+// Files are sorted by name and each file's path + content is hashed. Contents are
+// streamed into the hash, so large files are never held in memory.
+// Temp files are skipped, and so are hidden files or directories unless listed names them.
+func HashDir(dir string, listed ...string) (string, error) {
+	keep := listedSet(listed)
 	var files []string
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() {
-			rel, err := filepath.Rel(dir, path)
-			if err != nil {
-				return err
-			}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if !ignoredForHash(filepath.ToSlash(rel), keep) {
 			files = append(files, rel)
 		}
 		return nil
@@ -59,12 +87,22 @@ func HashDir(dir string) (string, error) {
 		// Include the relative file path in the hash
 		fmt.Fprintf(h, "file:%s\n", f)
 
-		data, err := os.ReadFile(filepath.Join(dir, f))
-		if err != nil {
+		if err := copyFile(h, filepath.Join(dir, f)); err != nil {
 			return "", err
 		}
-		h.Write(data)
 	}
 
 	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
 }
+
+// copyFile writes the content of the file at path to w.
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -107,3 +107,103 @@ func TestHashDirDeterministic(t *testing.T) {
 		t.Error("directory hash should be deterministic regardless of file creation order")
 	}
 }
+
+func TestHashDirUnchanged(t *testing.T) {
+	// Locked hashes in existing configs must stay valid, so the hash of known content is pinned
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "a.md"), []byte("first"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "b.md"), []byte("second\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "large.md"), []byte(strings.Repeat("x", 300000)), 0644)
+
+	got, err := HashDir(dir)
+	if err != nil {
+		t.Fatalf("HashDir() error: %v", err)
+	}
+	if want := "sha256:7533fec44c406efdabb67e77220580a8bbfe63c8e722fcaf915828aff3acb6d7"; got != want {
+		t.Errorf("HashDir() = %s, want %s", got, want)
+	}
+
+	// The same as hashing every path and content in memory
+	var whole []byte
+	for _, f := range []string{"a.md", "large.md", "sub/b.md"} {
+		data, _ := os.ReadFile(filepath.Join(dir, f))
+		whole = append(whole, "file:"+f+"\n"...)
+		whole = append(whole, data...)
+	}
+	if want := HashBytes(whole); got != want {
+		t.Errorf("HashDir() = %s, want the in-memory hash %s", got, want)
+	}
+}
+
+func TestHashDirIgnoresTempAndHiddenFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.md"), []byte("file a"), 0644)
+
+	clean, err := HashDir(dir)
+	if err != nil {
+		t.Fatalf("HashDir() error: %v", err)
+	}
+
+	// Leftovers from an interrupted download and editor artifacts
+	os.WriteFile(filepath.Join(dir, "a.md.tmp"), []byte("partial"), 0644)
+	os.WriteFile(filepath.Join(dir, ".DS_Store"), []byte("junk"), 0644)
+	os.MkdirAll(filepath.Join(dir, ".idea"), 0755)
+	os.WriteFile(filepath.Join(dir, ".idea", "workspace.xml"), []byte("<xml/>"), 0644)
+
+	got, err := HashDir(dir)
+	if err != nil {
+		t.Fatalf("HashDir() error: %v", err)
+	}
+	if got != clean {
+		t.Errorf("HashDir() = %s, want %s (temp and hidden files should be ignored)", got, clean)
+	}
+
+	result := VerifyStack(filepath.Dir(dir), "", filepath.Base(dir), StackVerifyInfo{
+		Hash:  clean,
+		Files: []string{"a.md"},
+	})
+	if !result.OK {
+		t.Errorf("VerifyStack() = %+v, want OK with leftover temp file", result)
+	}
+}
+
+func TestHashDirListedHiddenFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.md"), []byte("file a"), 0644)
+	os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte("root = true"), 0644)
+	listed := []string{"a.md", ".editorconfig"}
+
+	clean, err := HashDir(dir, listed...)
+	if err != nil {
+		t.Fatalf("HashDir() error: %v", err)
+	}
+	unlisted, err := HashDir(dir, "a.md")
+	if err != nil {
+		t.Fatalf("HashDir() error: %v", err)
+	}
+	if clean == unlisted {
+		t.Error("HashDir() ignored a listed hidden file")
+	}
+	fileHashes, err := HashFilesInStack(dir, listed)
+	if err != nil {
+		t.Fatalf("HashFilesInStack() error: %v", err)
+	}
+	if _, ok := fileHashes[".editorconfig"]; !ok {
+		t.Errorf("HashFilesInStack() = %v, want .editorconfig hashed", fileHashes)
+	}
+
+	info := StackVerifyInfo{Hash: clean, Files: listed, FileHashes: fileHashes}
+	if result := VerifyStack(filepath.Dir(dir), "", filepath.Base(dir), info); !result.OK {
+		t.Errorf("VerifyStack() = %+v, want OK", result)
+	}
+
+	// Unlisted hidden files are still ignored, but an edit to the listed one is caught
+	os.WriteFile(filepath.Join(dir, ".DS_Store"), []byte("junk"), 0644)
+	os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte("root = false"), 0644)
+	result := VerifyStack(filepath.Dir(dir), "", filepath.Base(dir), info)
+	want := filepath.Join(filepath.Base(dir), ".editorconfig")
+	if result.OK || len(result.Tampered) != 1 || result.Tampered[0] != want {
+		t.Errorf("VerifyStack() = %+v, want only %s tampered", result, want)
+	}
+}
@@ -0,0 +1,107 @@
+package filemanager
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxImportDepth is how many directory levels below its source directory ImportStack reads.
+const maxImportDepth = 6
+
+// importSkippedDirs are dependency directories whose Markdown files belong to other projects.
+var importSkippedDirs = map[string]bool{"node_modules": true, "vendor": true}
+
+// ImportStack copies the Markdown files under srcDir into the stack directory of stackID,
+// keeping their layout, and returns their paths relative to the stack directory.
+// Like DownloadStack, it replaces the stack directory only once every file is copied.
+// Hidden files and directories, dependency directories, directories more than
+// maxImportDepth levels down, the paths in skip and anything that isn't a regular file
+// are skipped.
+func (m *Manager) ImportStack(stackID, srcDir string, skip ...string) ([]string, error) {
+	if err := validatePathComponent(stackID, "stack ID"); err != nil {
+		return nil, err
+	}
+	stackDir := m.StackDir(stackID)
+	if err := validateInsideDir(m.InstructionsDir(), stackDir); err != nil {
+		return nil, fmt.Errorf("invalid stack path: %w", err)
+	}
+
+	skipped := make(map[string]bool, len(skip))
+	for _, p := range skip {
+		skipped[filepath.Clean(p)] = true
+	}
+
+	// Read everything first: srcDir may be the stack directory itself
+	contents := make(map[string][]byte)
+	err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == srcDir {
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") || skipped[path] ||
+			(d.IsDir() && (importSkippedDirs[d.Name()] || strings.Count(rel, string(filepath.Separator)) >= maxImportDepth)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || filepath.Ext(d.Name()) != ".md" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contents[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", srcDir, err)
+	}
+	if len(contents) == 0 {
+		return nil, fmt.Errorf("no .md files in %s", srcDir)
+	}
+
+	files := make([]string, 0, len(contents))
+	for f := range contents {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	if err := m.EnsureDir(); err != nil {
+		return nil, fmt.Errorf("creating instructions dir: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(m.InstructionsDir(), "."+stackID+"-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp dir for %s: %w", stackID, err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating temp dir for %s: %w", stackID, err)
+	}
+
+	for _, f := range files {
+		filePath := filepath.Join(tmpDir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return nil, fmt.Errorf("writing %s/%s: %w", stackID, f, err)
+		}
+		if err := os.WriteFile(filePath, contents[f], defaultFileMode); err != nil {
+			return nil, fmt.Errorf("writing %s/%s: %w", stackID, f, err)
+		}
+	}
+
+	if err := swapDir(tmpDir, stackDir); err != nil {
+		return nil, fmt.Errorf("replacing stack dir %s: %w", stackID, err)
+	}
+	return files, nil
+}
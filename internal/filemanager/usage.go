@@ -0,0 +1,62 @@
+package filemanager
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Usage summarizes the disk usage of an instructions directory.
+type Usage struct {
+	Files int
+	Bytes int64
+	// Large are the files bigger than the threshold given to DiskUsage, largest first.
+	Large []FileSize
+}
+
+// FileSize is a file's path relative to the instructions directory and its size.
+type FileSize struct {
+	Path  string
+	Bytes int64
+}
+
+// DiskUsage walks the instructions directory and totals its regular files, collecting
+// those larger than largeThreshold bytes. A missing directory has no usage.
+func DiskUsage(projectDir, instructionsDir string, largeThreshold int64) (Usage, error) {
+	root := filepath.Join(projectDir, instructionsDir)
+	var u Usage
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		u.Files++
+		u.Bytes += info.Size()
+		if info.Size() > largeThreshold {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				// Fall back to the full path rather than dropping the file from the report
+				rel = path
+			}
+			u.Large = append(u.Large, FileSize{Path: filepath.ToSlash(rel), Bytes: info.Size()})
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return Usage{}, nil
+	}
+	if err != nil {
+		return Usage{}, err
+	}
+
+	sort.Slice(u.Large, func(i, j int) bool { return u.Large[i].Bytes > u.Large[j].Bytes })
+	return u, nil
+}
@@ -0,0 +1,45 @@
+package filemanager
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiskUsage(t *testing.T) {
+	projectDir := t.TempDir()
+	managed := filepath.Join(projectDir, "ai-instructions", "company-instructions")
+	files := map[string]int{
+		"php/coding-standards.md": 100,
+		"php/testing.md":          50,
+		"go/huge.bin":             2000,
+		"go/big.md":               1500,
+	}
+	for name, size := range files {
+		path := filepath.Join(managed, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u, err := DiskUsage(projectDir, "ai-instructions/company-instructions", 1000)
+	if err != nil {
+		t.Fatalf("DiskUsage: %v", err)
+	}
+	if u.Files != 4 || u.Bytes != 3650 {
+		t.Errorf("usage = %d files, %d bytes, want 4 files, 3650 bytes", u.Files, u.Bytes)
+	}
+	want := []FileSize{{Path: "go/huge.bin", Bytes: 2000}, {Path: "go/big.md", Bytes: 1500}}
+	if !reflect.DeepEqual(u.Large, want) {
+		t.Errorf("Large = %v, want %v", u.Large, want)
+	}
+
+	u, err = DiskUsage(projectDir, "missing", 1000)
+	if err != nil || u.Files != 0 {
+		t.Errorf("DiskUsage(missing) = %+v, %v, want empty usage", u, err)
+	}
+}
@@ -3,6 +3,10 @@ package filemanager
 import (
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 )
 
 // VerifyResult contains the results of a verification check.
@@ -14,12 +18,40 @@ type VerifyResult struct {
 }
 
 // VerifyAll verifies all stacks in the instructions directory against expected hashes.
+// Stacks are verified concurrently; the results are sorted by stack ID.
 func VerifyAll(projectDir, instructionsDir string, stacks map[string]StackVerifyInfo) []VerifyResult {
-	var results []VerifyResult
-	for stackID, info := range stacks {
-		result := VerifyStack(projectDir, instructionsDir, stackID, info)
-		results = append(results, result)
+	return verifyAll(projectDir, instructionsDir, stacks, runtime.GOMAXPROCS(0))
+}
+
+// verifyAll verifies stacks with at most workers stacks in flight.
+func verifyAll(projectDir, instructionsDir string, stacks map[string]StackVerifyInfo, workers int) []VerifyResult {
+	ids := make([]string, 0, len(stacks))
+	for id := range stacks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// Each worker writes only the result slots of the indexes it receives
+	results := make([]VerifyResult, len(ids))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(ids)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = VerifyStack(projectDir, instructionsDir, ids[i], stacks[ids[i]])
+			}
+		}()
 	}
+	for i := range ids {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 	return results
 }
 
@@ -31,10 +63,18 @@ type StackVerifyInfo struct {
 }
 
 // VerifyStack verifies a single stack's files exist and the directory hash matches.
+// A stack without files is OK as long as it has no directory, which git doesn't keep
+// when it is empty anyway.
 func VerifyStack(projectDir, instructionsDir, stackID string, info StackVerifyInfo) VerifyResult {
 	result := VerifyResult{Stack: stackID, OK: true}
 	stackDir := filepath.Join(projectDir, instructionsDir, stackID)
 
+	if len(info.Files) == 0 {
+		if _, err := os.Stat(stackDir); os.IsNotExist(err) {
+			return result
+		}
+	}
+
 	// Check each expected file exists
 	for _, f := range info.Files {
 		path := filepath.Join(stackDir, f)
@@ -50,7 +90,7 @@ func VerifyStack(projectDir, instructionsDir, stackID string, info StackVerifyIn
 	}
 
 	// Check directory hash
-	dirHash, err := HashDir(stackDir)
+	dirHash, err := HashDir(stackDir, info.Files...)
 	if err != nil {
 		result.OK = false
 		result.Tampered = append(result.Tampered, "(hash computation failed)")
@@ -74,12 +114,9 @@ func VerifyStack(projectDir, instructionsDir, stackID string, info StackVerifyIn
 			}
 			// Check for extra files not in the expected list
 			entries, _ := os.ReadDir(stackDir)
-			expectedSet := make(map[string]bool)
-			for _, f := range info.Files {
-				expectedSet[f] = true
-			}
+			expectedSet := listedSet(info.Files)
 			for _, e := range entries {
-				if !e.IsDir() && !expectedSet[e.Name()] {
+				if !e.IsDir() && !expectedSet[e.Name()] && !ignoredForHash(e.Name(), expectedSet) {
 					result.Tampered = append(result.Tampered, filepath.Join(instructionsDir, stackID, e.Name())+" (unexpected)")
 				}
 			}
@@ -93,9 +130,13 @@ func VerifyStack(projectDir, instructionsDir, stackID string, info StackVerifyIn
 }
 
 // HashFilesInStack computes per-file hashes for all files in a stack directory.
+// Leftover temp files are skipped, as in HashDir.
 func HashFilesInStack(stackDir string, files []string) (map[string]string, error) {
 	hashes := make(map[string]string, len(files))
 	for _, f := range files {
+		if strings.HasSuffix(f, ".tmp") {
+			continue
+		}
 		h, err := HashFile(filepath.Join(stackDir, f))
 		if err != nil {
 			return nil, err
@@ -104,3 +145,19 @@ func HashFilesInStack(stackDir string, files []string) (map[string]string, error
 	}
 	return hashes, nil
 }
+
+// ReadStackFiles reads the given files from a stack directory, skipping any that don't exist.
+func ReadStackFiles(stackDir string, files []string) (map[string][]byte, error) {
+	contents := make(map[string][]byte, len(files))
+	for _, f := range files {
+		data, err := os.ReadFile(filepath.Join(stackDir, f))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		contents[f] = data
+	}
+	return contents, nil
+}
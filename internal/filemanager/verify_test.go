@@ -1,8 +1,10 @@
 package filemanager
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/cego/ai-instructions/internal/config"
@@ -66,3 +68,90 @@ func TestVerifyStackMissingFiles(t *testing.T) {
 		t.Errorf("Missing = %v, want [testing.md]", result.Missing)
 	}
 }
+
+func TestVerifyStackWithoutFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	// A stack that only pulls in dependencies has no directory
+	result := VerifyStack(dir, config.DefaultInstructionsDir, "backend", StackVerifyInfo{})
+	if !result.OK {
+		t.Errorf("VerifyStack without files should be OK, missing=%v tampered=%v", result.Missing, result.Tampered)
+	}
+
+	// Files appearing in it are still reported
+	stackDir := filepath.Join(dir, config.DefaultInstructionsDir, "backend")
+	os.MkdirAll(stackDir, 0755)
+	os.WriteFile(filepath.Join(stackDir, "extra.md"), []byte("extra"), 0644)
+	if result := VerifyStack(dir, config.DefaultInstructionsDir, "backend", StackVerifyInfo{}); result.OK {
+		t.Error("VerifyStack should fail for files in a stack without files")
+	}
+}
+
+// writeStacks creates n intact stacks of files files each and returns their verify info.
+func writeStacks(tb testing.TB, dir string, n, files int) map[string]StackVerifyInfo {
+	tb.Helper()
+	stacks := make(map[string]StackVerifyInfo, n)
+	for s := 0; s < n; s++ {
+		id := fmt.Sprintf("stack-%02d", s)
+		stackDir := filepath.Join(dir, config.DefaultInstructionsDir, id)
+		if err := os.MkdirAll(stackDir, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		info := StackVerifyInfo{FileHashes: make(map[string]string)}
+		for f := 0; f < files; f++ {
+			name := fmt.Sprintf("file-%02d.md", f)
+			if err := os.WriteFile(filepath.Join(stackDir, name), []byte(strings.Repeat(id+name, 512)), 0644); err != nil {
+				tb.Fatal(err)
+			}
+			info.Files = append(info.Files, name)
+		}
+		hash, err := HashDir(stackDir)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		info.Hash = hash
+		stacks[id] = info
+	}
+	return stacks
+}
+
+func TestVerifyAll(t *testing.T) {
+	dir := t.TempDir()
+	stacks := writeStacks(t, dir, 20, 3)
+	if err := os.Remove(filepath.Join(dir, config.DefaultInstructionsDir, "stack-07", "file-01.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	results := VerifyAll(dir, config.DefaultInstructionsDir, stacks)
+
+	if len(results) != len(stacks) {
+		t.Fatalf("got %d results, want %d", len(results), len(stacks))
+	}
+	for i, r := range results {
+		if want := fmt.Sprintf("stack-%02d", i); r.Stack != want {
+			t.Errorf("results[%d].Stack = %q, want %q", i, r.Stack, want)
+		}
+		if wantOK := r.Stack != "stack-07"; r.OK != wantOK {
+			t.Errorf("%s OK = %v, want %v", r.Stack, r.OK, wantOK)
+		}
+	}
+	if got := results[7].Missing; len(got) != 1 || got[0] != "file-01.md" {
+		t.Errorf("stack-07 Missing = %v, want [file-01.md]", got)
+	}
+}
+
+func BenchmarkVerifyAll(b *testing.B) {
+	dir := b.TempDir()
+	stacks := writeStacks(b, dir, 40, 10)
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			verifyAll(dir, config.DefaultInstructionsDir, stacks, 1)
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			VerifyAll(dir, config.DefaultInstructionsDir, stacks)
+		}
+	})
+}
@@ -1,9 +1,11 @@
 package injector
 
 // CursorConfig returns the FileConfig for .cursorrules.
+// Cursor treats the file as plain text, so it uses #-style markers.
 func CursorConfig(files []string) FileConfig {
 	return FileConfig{
 		Filename: ".cursorrules",
 		Files:    files,
+		Markers:  HashMarkers(),
 	}
 }
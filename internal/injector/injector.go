@@ -1,40 +1,171 @@
 package injector
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/cego/ai-instructions/internal/config"
 )
 
 const (
 	MarkerStart = "<!-- AI-INSTRUCTIONS:START — managed by ai-instructions, do not edit -->"
 	MarkerEnd   = "<!-- AI-INSTRUCTIONS:END -->"
+
+	HashMarkerStart = "# AI-INSTRUCTIONS:START — managed by ai-instructions, do not edit"
+	HashMarkerEnd   = "# AI-INSTRUCTIONS:END"
 )
 
+// Markers delimit the managed block within a target file.
+type Markers struct {
+	Start string
+	End   string
+}
+
+// DefaultMarkers returns the HTML-comment markers, which render invisibly in Markdown.
+func DefaultMarkers() Markers {
+	return Markers{Start: MarkerStart, End: MarkerEnd}
+}
+
+// HashMarkers returns #-comment markers for plain-text target files.
+func HashMarkers() Markers {
+	return Markers{Start: HashMarkerStart, End: HashMarkerEnd}
+}
+
 // FileConfig describes which files to inject into and what content to include.
 type FileConfig struct {
-	Filename string
-	Files    []string // relative paths like "ai-instructions/php/coding-standards.md"
+	Filename  string
+	Files     []string  // relative paths like "ai-instructions/php/coding-standards.md"
+	Skip      bool      // leave the file untouched (opted out of injection)
+	Markers   Markers   // zero value means DefaultMarkers
+	Placement string    // config.PlacementPrepend or config.PlacementAppend; empty means prepend
+	Text      BlockText // empty fields mean the default text
+	// Inline maps paths in Files to the content the block embeds instead of referencing them.
+	Inline map[string]string
+}
+
+// BlockText is the wording around the file list of a managed block.
+type BlockText struct {
+	Heading string
+	Footer  string
+}
+
+const (
+	defaultHeading = "# Company AI Instructions"
+	defaultFooter  = "These are mandatory company standards. Follow them strictly."
+)
+
+// withDefaults fills in the default heading and footer where none is set.
+func (t BlockText) withDefaults() BlockText {
+	if t.Heading == "" {
+		t.Heading = defaultHeading
+	}
+	if t.Footer == "" {
+		t.Footer = defaultFooter
+	}
+	return t
+}
+
+// markers returns the effective markers for the file.
+func (c FileConfig) markers() Markers {
+	if c.Markers.Start == "" || c.Markers.End == "" {
+		return DefaultMarkers()
+	}
+	return c.Markers
 }
 
 // InjectAll injects managed blocks into all target files.
-func InjectAll(projectDir string, stacks []string, configs []FileConfig, instructionsDir string) error {
+// Returns the names of files that were written; files already up to date are left untouched.
+// Every file is read and rendered before any is written, and if a write fails the files
+// already written are restored, so the targets are updated together or not at all.
+func InjectAll(projectDir string, stacks []string, configs []FileConfig, instructionsDir string) ([]string, error) {
+	var pending []fileUpdate
 	for _, cfg := range configs {
-		block := BuildBlock(stacks, cfg.Files, instructionsDir)
-		if err := injectIntoFile(filepath.Join(projectDir, cfg.Filename), block); err != nil {
-			return fmt.Errorf("injecting into %s: %w", cfg.Filename, err)
+		if cfg.Skip {
+			continue
+		}
+		m := cfg.markers()
+		block := buildBlock(stacks, cfg.Files, cfg.Inline, instructionsDir, m, cfg.Text)
+		u, err := renderFile(filepath.Join(projectDir, cfg.Filename), block, m, cfg.Placement)
+		if err != nil {
+			return nil, fmt.Errorf("injecting into %s: %w", cfg.Filename, err)
+		}
+		// Leave identical files alone so their mtime doesn't change
+		if u.content != u.original {
+			u.filename = cfg.Filename
+			pending = append(pending, u)
 		}
 	}
-	return nil
+
+	var written []string
+	for i, u := range pending {
+		if err := atomicWrite(u.path, u.content); err != nil {
+			err = fmt.Errorf("injecting into %s: %w", u.filename, err)
+			for _, done := range pending[:i] {
+				if restoreErr := done.restore(); restoreErr != nil {
+					err = errors.Join(err, fmt.Errorf("restoring %s: %w", done.filename, restoreErr))
+				}
+			}
+			return nil, err
+		}
+		written = append(written, u.filename)
+	}
+	return written, nil
 }
 
-// VerifyAll checks that all target files contain the managed block.
-func VerifyAll(projectDir string, configs []FileConfig) []VerifyResult {
+// fileUpdate is the new content of a target file, with what it replaces.
+type fileUpdate struct {
+	filename string
+	path     string
+	original string
+	existed  bool
+	content  string
+}
+
+// restore puts back the file's original content, or removes it if it was created.
+func (u fileUpdate) restore() error {
+	if !u.existed {
+		if err := os.Remove(u.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return atomicWrite(u.path, u.original)
+}
+
+// StripAll removes the managed block from all target files, leaving surrounding content intact.
+// Files left empty are deleted. Returns the names of files that were changed.
+func StripAll(projectDir string, configs []FileConfig) ([]string, error) {
+	var changed []string
+	for _, cfg := range configs {
+		if cfg.Skip {
+			continue
+		}
+		ok, err := stripFile(filepath.Join(projectDir, cfg.Filename), cfg.markers())
+		if err != nil {
+			return changed, fmt.Errorf("stripping %s: %w", cfg.Filename, err)
+		}
+		if ok {
+			changed = append(changed, cfg.Filename)
+		}
+	}
+	return changed, nil
+}
+
+// VerifyAll checks that all target files contain the managed block InjectAll would write
+// for the same arguments.
+func VerifyAll(projectDir string, stacks []string, configs []FileConfig, instructionsDir string) []VerifyResult {
 	var results []VerifyResult
 	for _, cfg := range configs {
+		if cfg.Skip {
+			results = append(results, VerifyResult{Filename: cfg.Filename, Skipped: true})
+			continue
+		}
 		path := filepath.Join(projectDir, cfg.Filename)
-		result := VerifyFile(path, cfg.Filename)
+		m := cfg.markers()
+		result := VerifyFile(path, cfg.Filename, buildBlock(stacks, cfg.Files, cfg.Inline, instructionsDir, m, cfg.Text), m)
 		results = append(results, result)
 	}
 	return results
@@ -45,75 +176,314 @@ type VerifyResult struct {
 	Filename string
 	HasBlock bool
 	Exists   bool
+	Skipped  bool
+	// Damaged is set when the managed block contains merge-conflict markers.
+	Damaged bool
+	// Stale is set when the managed block differs from the expected block, because it was
+	// edited or the stacks changed without it being injected again.
+	Stale bool
 }
 
-// VerifyFile checks if a file contains the managed block markers.
-func VerifyFile(path, filename string) VerifyResult {
+// VerifyFile checks if a file contains the managed block markers, whether a merge left
+// conflict markers inside the block, and whether the block matches block.
+func VerifyFile(path, filename, block string, m Markers) VerifyResult {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return VerifyResult{Filename: filename, HasBlock: false, Exists: false}
 	}
 	content := string(data)
-	hasStart := strings.Contains(content, MarkerStart)
-	hasEnd := strings.Contains(content, MarkerEnd)
-	return VerifyResult{Filename: filename, HasBlock: hasStart && hasEnd, Exists: true}
+	hasStart := strings.Contains(content, m.Start)
+	hasEnd := strings.Contains(content, m.End)
+	if m != DefaultMarkers() && !hasStart && !hasEnd {
+		// A block written with the default markers before this file had its own is
+		// still managed; the next inject migrates it, so it is only out of date
+		legacy := DefaultMarkers()
+		if strings.Contains(content, legacy.Start) && strings.Contains(content, legacy.End) {
+			result := VerifyResult{Filename: filename, HasBlock: true, Exists: true, Stale: true}
+			if start, end, ok := conflictedSpan(content, legacy); ok {
+				result.Damaged = hasConflictMarkers(content[start:end])
+			}
+			return result
+		}
+	}
+	result := VerifyResult{Filename: filename, HasBlock: hasStart && hasEnd, Exists: true}
+	if start, end, ok := conflictedSpan(content, m); ok {
+		result.Damaged = hasConflictMarkers(content[start:end])
+	}
+	if result.HasBlock && !result.Damaged {
+		actual, ok := blockSpan(content, m)
+		// A checkout with CRLF line endings still holds the same block
+		result.Stale = !ok || strings.ReplaceAll(actual, "\r\n", "\n") != block
+	}
+	return result
+}
+
+// blockSpan returns the first block in content, from its start marker to its end marker.
+func blockSpan(content string, m Markers) (string, bool) {
+	start := strings.Index(content, m.Start)
+	if start < 0 {
+		return "", false
+	}
+	end := strings.Index(content[start:], m.End)
+	if end < 0 {
+		return "", false
+	}
+	return content[start : start+end+len(m.End)], true
+}
+
+// conflictedSpan returns the span from the first start marker to the end of the last
+// end marker. A merge can duplicate the markers, so this covers every copy of the block.
+func conflictedSpan(content string, m Markers) (start, end int, ok bool) {
+	start = strings.Index(content, m.Start)
+	end = strings.LastIndex(content, m.End)
+	if start < 0 || end < start {
+		return 0, 0, false
+	}
+	return start, end + len(m.End), true
+}
+
+// widenToConflict extends a block span over the conflict start line directly above it and the
+// conflict end line directly below it, as left when a merge conflicted on the whole block.
+func widenToConflict(content string, start, end int) (int, int) {
+	if before := strings.TrimSuffix(content[:start], "\n"); len(before) < start {
+		lineStart := strings.LastIndex(before, "\n") + 1
+		if strings.HasPrefix(before[lineStart:], "<<<<<<<") {
+			start = lineStart
+		}
+	}
+	if after := content[end:]; strings.HasPrefix(after, "\n") {
+		line, _, _ := strings.Cut(after[1:], "\n")
+		if strings.HasPrefix(line, ">>>>>>>") {
+			end += 1 + len(line)
+		}
+	}
+	return start, end
+}
+
+// hasConflictMarkers reports whether s contains a line git writes around a merge conflict.
+func hasConflictMarkers(s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "=======" ||
+			strings.HasPrefix(line, "<<<<<<<") ||
+			strings.HasPrefix(line, "|||||||") ||
+			strings.HasPrefix(line, ">>>>>>>") {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildBlock generates the managed content block with the default wording.
+// Without files, it only names the stacks.
+func BuildBlock(stacks []string, files []string, instructionsDir string, m Markers) string {
+	return BuildBlockText(stacks, files, instructionsDir, m, BlockText{})
 }
 
-// BuildBlock generates the managed content block.
-func BuildBlock(stacks []string, files []string, instructionsDir string) string {
+// BuildBlockText generates the managed content block like BuildBlock, with the heading
+// and footer taken from text where it sets them.
+func BuildBlockText(stacks []string, files []string, instructionsDir string, m Markers, text BlockText) string {
+	return buildBlock(stacks, files, nil, instructionsDir, m, text)
+}
+
+// buildBlock generates the managed content block, embedding the content of the files in
+// inline instead of listing them. Content holding a marker would end the block early, and
+// content with a line like a conflict marker, such as a setext heading underline, would
+// make the block look conflicted, so such files stay listed.
+func buildBlock(stacks []string, files []string, inline map[string]string, instructionsDir string, m Markers, text BlockText) string {
+	text = text.withDefaults()
 	var b strings.Builder
 
-	b.WriteString(MarkerStart)
+	b.WriteString(m.Start)
 	b.WriteString("\n")
-	b.WriteString("# Company AI Instructions\n\n")
+	b.WriteString(strings.TrimRight(text.Heading, "\n") + "\n\n")
+	if len(files) == 0 {
+		// Only stacks without files, or none targeting this tool, are installed
+		b.WriteString(fmt.Sprintf("This project uses the following instruction stacks: %s\n", strings.Join(stacks, ", ")))
+		b.WriteString("None of them provide instruction files for this tool.\n")
+		b.WriteString(m.End)
+		return b.String()
+	}
 	b.WriteString("If any instruction file is missing or inaccessible, stop and ask for it before proceeding.\n\n")
 	b.WriteString(fmt.Sprintf("This project uses the following instruction stacks: %s\n\n", strings.Join(stacks, ", ")))
-	b.WriteString(fmt.Sprintf("Read and follow ALL instruction files in the `%s/` folder:\n", instructionsDir))
 
+	var listed, embedded []string
 	for _, f := range files {
-		b.WriteString(fmt.Sprintf("- %s\n", f))
+		content, ok := inline[f]
+		if ok && !strings.Contains(content, m.Start) && !strings.Contains(content, m.End) && !hasConflictMarkers(content) {
+			embedded = append(embedded, f)
+		} else {
+			listed = append(listed, f)
+		}
 	}
 
-	b.WriteString("\nThese are mandatory company standards. Follow them strictly.\n")
-	b.WriteString(MarkerEnd)
+	if len(listed) > 0 {
+		b.WriteString(fmt.Sprintf("Read and follow ALL instruction files in the `%s/` folder:\n", instructionsDir))
+		for _, f := range listed {
+			b.WriteString(fmt.Sprintf("- %s\n", f))
+		}
+	}
+	for i, f := range embedded {
+		if i > 0 || len(listed) > 0 {
+			b.WriteString("\n")
+		}
+		fence := codeFence(inline[f])
+		b.WriteString(fmt.Sprintf("Follow these instructions from %s:\n\n", f))
+		b.WriteString(fence + "markdown\n")
+		b.WriteString(strings.TrimRight(inline[f], "\n") + "\n")
+		b.WriteString(fence + "\n")
+	}
+
+	b.WriteString("\n" + strings.TrimRight(text.Footer, "\n") + "\n")
+	b.WriteString(m.End)
 
 	return b.String()
 }
 
-// injectIntoFile creates or updates the managed block in a file.
-func injectIntoFile(path, block string) error {
+// codeFence returns a backtick fence longer than any backtick run in content, so fences
+// inside the content don't close it.
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// renderFile works out the content of a file with the managed block injected, without
+// writing it. The content is unchanged from the original if the block is already current.
+func renderFile(path, block string, m Markers, placement string) (fileUpdate, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// File doesn't exist — create with just the block
-			return atomicWrite(path, block+"\n")
+			return fileUpdate{path: path, content: block + "\n"}, nil
 		}
-		return err
+		return fileUpdate{}, err
 	}
 
 	content := string(data)
 
-	startIdx := strings.Index(content, MarkerStart)
-	endIdx := strings.Index(content, MarkerEnd)
+	// Migrate a block written with the default markers before this file had its own
+	if m != DefaultMarkers() && !strings.Contains(content, m.Start) && !strings.Contains(content, m.End) {
+		if stripped, ok := removeBlock(content, DefaultMarkers()); ok {
+			content = strings.TrimLeft(stripped, "\n")
+		}
+	}
 
 	var newContent string
-	if startIdx >= 0 && endIdx >= 0 && endIdx > startIdx {
-		// Both markers found in correct order — replace between them (inclusive)
-		endIdx += len(MarkerEnd)
-		newContent = content[:startIdx] + block + content[endIdx:]
-	} else if startIdx >= 0 || endIdx >= 0 {
-		// Malformed: one marker without the other — strip the broken marker and prepend
-		cleaned := content
-		cleaned = strings.Replace(cleaned, MarkerStart, "", 1)
-		cleaned = strings.Replace(cleaned, MarkerEnd, "", 1)
-		cleaned = strings.TrimLeft(cleaned, "\n")
-		newContent = block + "\n\n" + cleaned
+	if start, end, ok := conflictedSpan(content, m); ok && hasConflictMarkers(content[start:end]) {
+		// A merge tangled conflict markers into the block — replace every copy of it
+		start, end = widenToConflict(content, start, end)
+		newContent = content[:start] + block + content[end:]
+	} else if strings.Contains(content, m.Start) || strings.Contains(content, m.End) {
+		// Replace the first well-formed block. Further blocks and stray markers are
+		// dropped, so repeated injects converge on a single block whatever the damage.
+		cleaned, at := removeMarkers(content, m)
+		if at >= 0 {
+			newContent = cleaned[:at] + block + cleaned[at:]
+		} else {
+			newContent = insertBlock(cleaned, block, placement)
+		}
 	} else {
-		// No markers at all — prepend block above existing content
-		newContent = block + "\n\n" + content
+		// No markers at all — insert block relative to existing content
+		newContent = insertBlock(content, block, placement)
+	}
+
+	return fileUpdate{path: path, original: string(data), existed: true, content: newContent}, nil
+}
+
+// stripFile removes the managed block from a file, deleting the file if nothing else remains.
+func stripFile(path string, m Markers) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	content, ok := removeBlock(string(data), m)
+	if m != DefaultMarkers() {
+		var legacyOK bool
+		content, legacyOK = removeBlock(content, DefaultMarkers())
+		ok = ok || legacyOK
+	}
+	if !ok {
+		return false, nil
+	}
+
+	content = strings.TrimRight(content, "\n")
+	if strings.TrimSpace(content) == "" {
+		return true, os.Remove(path)
 	}
+	return true, atomicWrite(path, content+"\n")
+}
+
+// insertBlock places a new block above or below existing content.
+func insertBlock(content, block, placement string) string {
+	if placement == config.PlacementAppend {
+		trimmed := strings.TrimRight(content, "\n")
+		if trimmed == "" {
+			return block + "\n"
+		}
+		return trimmed + "\n\n" + block + "\n"
+	}
+	return block + "\n\n" + strings.TrimLeft(content, "\n")
+}
+
+// removeBlock removes the managed block span (and the blank lines that follow it) from content.
+// Returns false if no well-formed block is present.
+func removeBlock(content string, m Markers) (string, bool) {
+	startIdx := strings.Index(content, m.Start)
+	endIdx := strings.Index(content, m.End)
+	if startIdx < 0 || endIdx < 0 || endIdx < startIdx {
+		return content, false
+	}
+	endIdx += len(m.End)
+	return content[:startIdx] + strings.TrimLeft(content[endIdx:], "\n"), true
+}
+
+// removeMarkers removes every well-formed block (start marker up to the next end marker)
+// and every unmatched marker from content. at is the position of the first removed block
+// in the result, or -1 if only unmatched markers were found.
+func removeMarkers(content string, m Markers) (cleaned string, at int) {
+	at = -1
+	for {
+		start := strings.Index(content, m.Start)
+		end := strings.Index(content, m.End)
+		switch {
+		case start < 0 && end < 0:
+			return content, at
+		case start < 0 || (end >= 0 && end < start):
+			// End marker without a start before it
+			content = removeLine(content, end, len(m.End))
+		default:
+			rest := strings.Index(content[start+len(m.Start):], m.End)
+			if rest < 0 {
+				// Start marker without an end after it
+				content = removeLine(content, start, len(m.Start))
+				continue
+			}
+			blockEnd := start + len(m.Start) + rest + len(m.End)
+			if at < 0 {
+				content = content[:start] + content[blockEnd:]
+				at = start
+			} else {
+				content = content[:start] + strings.TrimLeft(content[blockEnd:], "\n")
+			}
+		}
+	}
+}
 
-	return atomicWrite(path, newContent)
+// removeLine removes the n bytes at i from content, with the newline that follows them.
+func removeLine(content string, i, n int) string {
+	return content[:i] + strings.TrimPrefix(content[i+n:], "\n")
 }
 
 // atomicWrite writes content to a file using a temp file and rename.
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cego/ai-instructions/internal/config"
 )
@@ -15,6 +16,7 @@ func TestBuildBlock(t *testing.T) {
 		[]string{"php", "laravel"},
 		[]string{instrDir + "/php/coding-standards.md", instrDir + "/laravel/conventions.md"},
 		instrDir,
+		DefaultMarkers(),
 	)
 
 	if !strings.Contains(block, MarkerStart) {
@@ -34,12 +36,58 @@ func TestBuildBlock(t *testing.T) {
 	}
 }
 
+func TestBuildBlockText(t *testing.T) {
+	instrDir := config.DefaultInstructionsDir
+	files := []string{instrDir + "/php/coding-standards.md"}
+	text := BlockText{
+		Heading: "# Acme Engineering Guidelines",
+		Footer:  "See https://policy.example.com/ai for the policy behind these files.",
+	}
+
+	block := BuildBlockText([]string{"php"}, files, instrDir, DefaultMarkers(), text)
+	if !strings.HasPrefix(block, MarkerStart+"\n"+text.Heading+"\n\n") {
+		t.Errorf("block should start with the custom heading:\n%s", block)
+	}
+	if !strings.HasSuffix(block, "\n\n"+text.Footer+"\n"+MarkerEnd) {
+		t.Errorf("block should end with the custom footer:\n%s", block)
+	}
+	if strings.Contains(block, "Company AI Instructions") || strings.Contains(block, "mandatory company standards") {
+		t.Errorf("block should not contain the default text:\n%s", block)
+	}
+
+	// The file list is generated the same way
+	def := BuildBlock([]string{"php"}, files, instrDir, DefaultMarkers())
+	list := func(b string) string { return b[strings.Index(b, "If any"):strings.LastIndex(b, "\n\n")] }
+	if list(block) != list(def) {
+		t.Errorf("file list differs from the default block:\n%s\nvs\n%s", list(block), list(def))
+	}
+
+	// An empty BlockText is the default wording
+	if got := BuildBlockText([]string{"php"}, files, instrDir, DefaultMarkers(), BlockText{}); got != def {
+		t.Errorf("empty BlockText = \n%s\nwant\n%s", got, def)
+	}
+}
+
+func TestBuildBlockWithoutFiles(t *testing.T) {
+	block := BuildBlock([]string{"backend"}, nil, config.DefaultInstructionsDir, DefaultMarkers())
+
+	if !strings.Contains(block, "stacks: backend") {
+		t.Error("block should list stacks")
+	}
+	if strings.Contains(block, "Read and follow") || strings.Contains(block, "\n- ") {
+		t.Errorf("block without files should not list any:\n%s", block)
+	}
+	if !strings.HasPrefix(block, MarkerStart) || !strings.HasSuffix(block, MarkerEnd) {
+		t.Errorf("block should be wrapped in markers:\n%s", block)
+	}
+}
+
 func TestInjectNewFile(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "CLAUDE.md")
 
-	block := BuildBlock([]string{"php"}, []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}, config.DefaultInstructionsDir)
-	err := injectIntoFile(path, block)
+	block := BuildBlock([]string{"php"}, []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}, config.DefaultInstructionsDir, DefaultMarkers())
+	_, err := injectIntoFile(path, block, DefaultMarkers(), config.PlacementPrepend)
 	if err != nil {
 		t.Fatalf("injectIntoFile() error: %v", err)
 	}
@@ -65,8 +113,8 @@ func TestInjectPrependExisting(t *testing.T) {
 	existing := "# My Project\n\nSome existing content.\n"
 	os.WriteFile(path, []byte(existing), 0644)
 
-	block := BuildBlock([]string{"php"}, []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}, config.DefaultInstructionsDir)
-	err := injectIntoFile(path, block)
+	block := BuildBlock([]string{"php"}, []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}, config.DefaultInstructionsDir, DefaultMarkers())
+	_, err := injectIntoFile(path, block, DefaultMarkers(), config.PlacementPrepend)
 	if err != nil {
 		t.Fatalf("injectIntoFile() error: %v", err)
 	}
@@ -98,8 +146,8 @@ func TestInjectUpdateBlock(t *testing.T) {
 	block := BuildBlock([]string{"php", "laravel"}, []string{
 		config.DefaultInstructionsDir + "/php/coding-standards.md",
 		config.DefaultInstructionsDir + "/laravel/conventions.md",
-	}, config.DefaultInstructionsDir)
-	err := injectIntoFile(path, block)
+	}, config.DefaultInstructionsDir, DefaultMarkers())
+	_, err := injectIntoFile(path, block, DefaultMarkers(), config.PlacementPrepend)
 	if err != nil {
 		t.Fatalf("injectIntoFile() error: %v", err)
 	}
@@ -127,11 +175,11 @@ func TestInjectIdempotent(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "CLAUDE.md")
 
-	block := BuildBlock([]string{"php"}, []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}, config.DefaultInstructionsDir)
+	block := BuildBlock([]string{"php"}, []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}, config.DefaultInstructionsDir, DefaultMarkers())
 
 	// Inject twice
-	injectIntoFile(path, block)
-	injectIntoFile(path, block)
+	injectIntoFile(path, block, DefaultMarkers(), config.PlacementPrepend)
+	injectIntoFile(path, block, DefaultMarkers(), config.PlacementPrepend)
 
 	data, _ := os.ReadFile(path)
 	content := string(data)
@@ -147,11 +195,51 @@ func TestInjectIdempotent(t *testing.T) {
 	}
 }
 
+func TestInjectAllSkipsUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	configs := []FileConfig{ClaudeConfig([]string{"php/a.md"}), AgentsConfig([]string{"php/a.md"})}
+
+	written, err := InjectAll(dir, []string{"php"}, configs, config.DefaultInstructionsDir)
+	if err != nil {
+		t.Fatalf("InjectAll() error: %v", err)
+	}
+	if len(written) != 2 {
+		t.Fatalf("first InjectAll wrote %v, want both files", written)
+	}
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range []string{"CLAUDE.md", "AGENTS.md"} {
+		if err := os.Chtimes(filepath.Join(dir, name), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the file whose block changes is rewritten
+	configs[1] = AgentsConfig([]string{"php/a.md", "php/b.md"})
+	written, err = InjectAll(dir, []string{"php"}, configs, config.DefaultInstructionsDir)
+	if err != nil {
+		t.Fatalf("InjectAll() error: %v", err)
+	}
+	if len(written) != 1 || written[0] != "AGENTS.md" {
+		t.Errorf("second InjectAll wrote %v, want [AGENTS.md]", written)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "CLAUDE.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Errorf("CLAUDE.md mtime = %v, want untouched %v", info.ModTime(), past)
+	}
+}
+
 func TestVerifyFile(t *testing.T) {
 	dir := t.TempDir()
 
+	block := MarkerStart + "\ncontent\n" + MarkerEnd
+
 	// File doesn't exist
-	result := VerifyFile(filepath.Join(dir, "CLAUDE.md"), "CLAUDE.md")
+	result := VerifyFile(filepath.Join(dir, "CLAUDE.md"), "CLAUDE.md", block, DefaultMarkers())
 	if result.HasBlock || result.Exists {
 		t.Error("non-existent file should have HasBlock=false, Exists=false")
 	}
@@ -159,7 +247,7 @@ func TestVerifyFile(t *testing.T) {
 	// File exists but no markers
 	path := filepath.Join(dir, "CLAUDE.md")
 	os.WriteFile(path, []byte("# My Project\n"), 0644)
-	result = VerifyFile(path, "CLAUDE.md")
+	result = VerifyFile(path, "CLAUDE.md", block, DefaultMarkers())
 	if result.HasBlock {
 		t.Error("file without markers should have HasBlock=false")
 	}
@@ -168,12 +256,178 @@ func TestVerifyFile(t *testing.T) {
 	}
 
 	// File exists with markers
-	content := MarkerStart + "\ncontent\n" + MarkerEnd
-	os.WriteFile(path, []byte(content), 0644)
-	result = VerifyFile(path, "CLAUDE.md")
+	os.WriteFile(path, []byte("# My Project\n\n"+block+"\n"), 0644)
+	result = VerifyFile(path, "CLAUDE.md", block, DefaultMarkers())
 	if !result.HasBlock {
 		t.Error("file with markers should have HasBlock=true")
 	}
+	if result.Stale {
+		t.Error("file with the expected block should not be stale")
+	}
+}
+
+func TestVerifyFileStale(t *testing.T) {
+	block := BuildBlock([]string{"php", "laravel"}, []string{"ai/php/rules.md", "ai/laravel/rules.md"}, "ai", DefaultMarkers())
+
+	tests := []struct {
+		name      string
+		content   string
+		wantStale bool
+	}{
+		{name: "current", content: "# My Project\n\n" + block + "\n", wantStale: false},
+		{name: "crlf line endings", content: strings.ReplaceAll(block, "\n", "\r\n") + "\r\n", wantStale: false},
+		{name: "stack added without injecting", content: BuildBlock([]string{"php"}, []string{"ai/php/rules.md"}, "ai", DefaultMarkers()), wantStale: true},
+		{name: "edited inside block", content: strings.Replace(block, "strictly", "loosely", 1), wantStale: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "CLAUDE.md")
+			os.WriteFile(path, []byte(tt.content), 0644)
+
+			result := VerifyFile(path, "CLAUDE.md", block, DefaultMarkers())
+			if !result.HasBlock {
+				t.Fatal("HasBlock = false, want true")
+			}
+			if result.Stale != tt.wantStale {
+				t.Errorf("Stale = %v, want %v", result.Stale, tt.wantStale)
+			}
+		})
+	}
+}
+
+// conflictedBlock is a managed block after two branches synced different stacks and were merged.
+const conflictedBlock = "# My Project\n\n" + MarkerStart + "\n" +
+	"<<<<<<< HEAD\n" +
+	"This project uses the following instruction stacks: php\n" +
+	"=======\n" +
+	"This project uses the following instruction stacks: php, laravel\n" +
+	">>>>>>> feature\n" +
+	MarkerEnd + "\n\nFooter\n"
+
+func TestVerifyFileConflictMarkers(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantDamaged bool
+	}{
+		{name: "conflict inside block", content: conflictedBlock, wantDamaged: true},
+		{
+			name: "duplicated block",
+			content: "<<<<<<< HEAD\n" + MarkerStart + "\nphp\n" + MarkerEnd + "\n=======\n" +
+				MarkerStart + "\nphp, laravel\n" + MarkerEnd + "\n>>>>>>> feature\n",
+			wantDamaged: true,
+		},
+		{name: "conflict outside block", content: MarkerStart + "\nphp\n" + MarkerEnd + "\n<<<<<<< HEAD\nmine\n=======\ntheirs\n>>>>>>> feature\n", wantDamaged: false},
+		{name: "clean block", content: MarkerStart + "\nphp\n" + MarkerEnd + "\n", wantDamaged: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "CLAUDE.md")
+			os.WriteFile(path, []byte(tt.content), 0644)
+
+			result := VerifyFile(path, "CLAUDE.md", "", DefaultMarkers())
+			if !result.HasBlock {
+				t.Error("HasBlock = false, want true")
+			}
+			if result.Damaged != tt.wantDamaged {
+				t.Errorf("Damaged = %v, want %v", result.Damaged, tt.wantDamaged)
+			}
+		})
+	}
+}
+
+func TestInjectRepairsConflictedBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "conflict inside block", content: conflictedBlock},
+		{
+			name: "duplicated block",
+			content: "# My Project\n\n<<<<<<< HEAD\n" + MarkerStart + "\nphp\n" + MarkerEnd + "\n=======\n" +
+				MarkerStart + "\nphp, laravel\n" + MarkerEnd + "\n>>>>>>> feature\n\nFooter\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "CLAUDE.md")
+			os.WriteFile(path, []byte(tt.content), 0644)
+
+			_, err := InjectAll(dir, []string{"php", "laravel"}, []FileConfig{ClaudeConfig([]string{"a.md"})}, config.DefaultInstructionsDir)
+			if err != nil {
+				t.Fatalf("InjectAll: %v", err)
+			}
+
+			data, _ := os.ReadFile(path)
+			content := string(data)
+			if hasConflictMarkers(content) {
+				t.Errorf("conflict markers remain:\n%s", content)
+			}
+			if strings.Count(content, MarkerStart) != 1 || strings.Count(content, MarkerEnd) != 1 {
+				t.Errorf("want exactly one block:\n%s", content)
+			}
+			if !strings.HasPrefix(content, "# My Project\n\n") || !strings.HasSuffix(content, "\n\nFooter\n") {
+				t.Errorf("surrounding content not preserved:\n%s", content)
+			}
+		})
+	}
+}
+
+func TestInjectRepairsStrayMarkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "start only", content: "# My Project\n" + MarkerStart + "\nold\n\nFooter\n"},
+		{name: "end only", content: "# My Project\nold\n" + MarkerEnd + "\n\nFooter\n"},
+		{name: "end before start", content: "# My Project\n" + MarkerEnd + "\n" + MarkerStart + "\n\nFooter\n"},
+		{name: "two starts one end", content: "# My Project\n\n" + MarkerStart + "\nold\n" + MarkerStart + "\nstale copy\n" + MarkerEnd + "\n\nFooter\n"},
+		{name: "two ends one start", content: "# My Project\n\n" + MarkerStart + "\nold\n" + MarkerEnd + "\n" + MarkerEnd + "\n\nFooter\n"},
+		{name: "stray start after block", content: "# My Project\n\n" + MarkerStart + "\nold\n" + MarkerEnd + "\n\nFooter\n" + MarkerStart + "\n"},
+		{name: "two blocks", content: "# My Project\n\n" + MarkerStart + "\nold\n" + MarkerEnd + "\n\nFooter\n\n" + MarkerStart + "\nstale copy\n" + MarkerEnd + "\n"},
+	}
+
+	block := BuildBlock([]string{"php"}, []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}, config.DefaultInstructionsDir, DefaultMarkers())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "CLAUDE.md")
+			os.WriteFile(path, []byte(tt.content), 0644)
+
+			if _, err := injectIntoFile(path, block, DefaultMarkers(), config.PlacementPrepend); err != nil {
+				t.Fatalf("injectIntoFile() error: %v", err)
+			}
+			first, _ := os.ReadFile(path)
+			content := string(first)
+
+			if strings.Count(content, MarkerStart) != 1 || strings.Count(content, MarkerEnd) != 1 {
+				t.Errorf("want exactly one block:\n%s", content)
+			}
+			if strings.Contains(content, "stale copy") {
+				t.Errorf("content of a duplicate block remains:\n%s", content)
+			}
+			if !strings.Contains(content, "# My Project") || !strings.Contains(content, "Footer") {
+				t.Errorf("surrounding content not preserved:\n%s", content)
+			}
+			if start, end := strings.Index(content, MarkerStart), strings.Index(content, MarkerEnd); end < start {
+				t.Errorf("markers out of order:\n%s", content)
+			}
+
+			// Repeated injects leave the repaired file alone
+			changed, err := injectIntoFile(path, block, DefaultMarkers(), config.PlacementPrepend)
+			if err != nil {
+				t.Fatalf("injectIntoFile() error: %v", err)
+			}
+			if changed {
+				second, _ := os.ReadFile(path)
+				t.Errorf("second inject changed the file:\n%s\n---\n%s", first, second)
+			}
+		})
+	}
 }
 
 func TestInjectAll(t *testing.T) {
@@ -185,7 +439,7 @@ func TestInjectAll(t *testing.T) {
 		CursorConfig([]string{config.DefaultInstructionsDir + "/php/coding-standards.md"}),
 	}
 
-	err := InjectAll(dir, []string{"php"}, configs, config.DefaultInstructionsDir)
+	_, err := InjectAll(dir, []string{"php"}, configs, config.DefaultInstructionsDir)
 	if err != nil {
 		t.Fatalf("InjectAll() error: %v", err)
 	}
@@ -198,3 +452,335 @@ func TestInjectAll(t *testing.T) {
 		}
 	}
 }
+
+func TestInjectAllRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}
+	configs := []FileConfig{ClaudeConfig(files), AgentsConfig(files), CursorConfig(files)}
+
+	original := "# My Project\n"
+	os.WriteFile(filepath.Join(dir, "CLAUDE.md"), []byte(original), 0644)
+	// A directory where the temporary file goes makes the last write fail
+	os.Mkdir(filepath.Join(dir, ".cursorrules.tmp"), 0755)
+
+	written, err := InjectAll(dir, []string{"php"}, configs, config.DefaultInstructionsDir)
+	if err == nil {
+		t.Fatal("InjectAll() should fail when a target can't be written")
+	}
+	if !strings.Contains(err.Error(), ".cursorrules") {
+		t.Errorf("error = %v, want it to name .cursorrules", err)
+	}
+	if len(written) != 0 {
+		t.Errorf("written = %v, want none", written)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "CLAUDE.md"))
+	if string(data) != original {
+		t.Errorf("CLAUDE.md not restored:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "AGENTS.md")); !os.IsNotExist(err) {
+		t.Error("AGENTS.md created by the failed injection should be removed")
+	}
+}
+
+func TestInjectAllSkipsOptedOutFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "CLAUDE.md")
+
+	handWritten := "# Hand-written project instructions\n"
+	os.WriteFile(path, []byte(handWritten), 0644)
+
+	files := []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}
+	claude := ClaudeConfig(files)
+	claude.Skip = true
+	configs := []FileConfig{claude, AgentsConfig(files)}
+
+	if _, err := InjectAll(dir, []string{"php"}, configs, config.DefaultInstructionsDir); err != nil {
+		t.Fatalf("InjectAll() error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != handWritten {
+		t.Errorf("skipped file was modified: %q", string(data))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "AGENTS.md")); err != nil {
+		t.Error("AGENTS.md should still be injected")
+	}
+
+	results := VerifyAll(dir, []string{"php"}, configs, config.DefaultInstructionsDir)
+	if !results[0].Skipped || results[0].HasBlock {
+		t.Errorf("CLAUDE.md result = %+v, want Skipped", results[0])
+	}
+	if results[1].Skipped || !results[1].HasBlock || results[1].Stale {
+		t.Errorf("AGENTS.md result = %+v, want HasBlock", results[1])
+	}
+}
+
+func TestInjectCustomMarkers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".cursorrules")
+
+	existing := "Always answer in English.\n"
+	os.WriteFile(path, []byte(existing), 0644)
+
+	files := []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}
+	if _, err := InjectAll(dir, []string{"php"}, []FileConfig{CursorConfig(files)}, config.DefaultInstructionsDir); err != nil {
+		t.Fatalf("InjectAll() error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	content := string(data)
+	if !strings.HasPrefix(content, HashMarkerStart) {
+		t.Error("block should start with the hash marker")
+	}
+	if strings.Contains(content, MarkerStart) || strings.Contains(content, MarkerEnd) {
+		t.Error("HTML markers should not be written to a hash-marker file")
+	}
+	if !strings.Contains(content, existing) {
+		t.Error("existing content should be preserved")
+	}
+
+	block := BuildBlock([]string{"php"}, files, config.DefaultInstructionsDir, HashMarkers())
+	if r := VerifyFile(path, ".cursorrules", block, HashMarkers()); !r.HasBlock || r.Stale {
+		t.Errorf("VerifyFile() with hash markers = %+v, want the current block", r)
+	}
+	if r := VerifyFile(path, ".cursorrules", block, DefaultMarkers()); r.HasBlock {
+		t.Error("VerifyFile() with default markers should not find the block")
+	}
+}
+
+func TestInjectMigratesDefaultMarkers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".cursorrules")
+
+	legacy := MarkerStart + "\nold content\n" + MarkerEnd + "\n\nAlways answer in English.\n"
+	os.WriteFile(path, []byte(legacy), 0644)
+
+	files := []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}
+	if _, err := InjectAll(dir, []string{"php"}, []FileConfig{CursorConfig(files)}, config.DefaultInstructionsDir); err != nil {
+		t.Fatalf("InjectAll() error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	content := string(data)
+	if strings.Contains(content, MarkerStart) || strings.Contains(content, "old content") {
+		t.Error("legacy HTML-marker block should be replaced")
+	}
+	if strings.Count(content, HashMarkerStart) != 1 {
+		t.Errorf("hash start marker count = %d, want 1", strings.Count(content, HashMarkerStart))
+	}
+	if !strings.Contains(content, "Always answer in English.") {
+		t.Error("user content should be preserved")
+	}
+}
+
+func TestVerifyDefaultMarkersStale(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".cursorrules")
+	os.WriteFile(path, []byte(MarkerStart+"\nold content\n"+MarkerEnd+"\n"), 0644)
+
+	files := []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}
+	configs := []FileConfig{CursorConfig(files)}
+	results := VerifyAll(dir, []string{"php"}, configs, config.DefaultInstructionsDir)
+	if len(results) != 1 || !results[0].HasBlock || !results[0].Stale {
+		t.Fatalf("VerifyAll() = %+v, want a stale block", results)
+	}
+
+	if _, err := InjectAll(dir, []string{"php"}, configs, config.DefaultInstructionsDir); err != nil {
+		t.Fatalf("InjectAll() error: %v", err)
+	}
+	results = VerifyAll(dir, []string{"php"}, configs, config.DefaultInstructionsDir)
+	if len(results) != 1 || !results[0].HasBlock || results[0].Stale {
+		t.Errorf("VerifyAll() after migrating = %+v, want a current block", results)
+	}
+}
+
+func TestInjectPlacement(t *testing.T) {
+	block := BuildBlock([]string{"php"}, []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}, config.DefaultInstructionsDir, DefaultMarkers())
+
+	tests := []struct {
+		name       string
+		existing   string
+		placement  string
+		wantPrefix string
+		wantSuffix string
+	}{
+		{
+			name:       "prepend above header",
+			existing:   "# My Project\n",
+			placement:  config.PlacementPrepend,
+			wantPrefix: MarkerStart,
+			wantSuffix: "# My Project\n",
+		},
+		{
+			name:       "append below header",
+			existing:   "# My Project\n\nShort intro.\n",
+			placement:  config.PlacementAppend,
+			wantPrefix: "# My Project\n\nShort intro.\n\n" + MarkerStart,
+			wantSuffix: MarkerEnd + "\n",
+		},
+		{
+			name:       "append recovers malformed single marker",
+			existing:   "# My Project\n" + MarkerStart + "\n",
+			placement:  config.PlacementAppend,
+			wantPrefix: "# My Project\n\n" + MarkerStart,
+			wantSuffix: MarkerEnd + "\n",
+		},
+		{
+			name:       "append updates existing block in place",
+			existing:   MarkerStart + "\nold\n" + MarkerEnd + "\n\n# My Project\n",
+			placement:  config.PlacementAppend,
+			wantPrefix: MarkerStart,
+			wantSuffix: "# My Project\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "CLAUDE.md")
+			os.WriteFile(path, []byte(tt.existing), 0644)
+
+			// Inject twice to confirm idempotency
+			for i := 0; i < 2; i++ {
+				if _, err := injectIntoFile(path, block, DefaultMarkers(), tt.placement); err != nil {
+					t.Fatalf("injectIntoFile() error: %v", err)
+				}
+			}
+
+			data, _ := os.ReadFile(path)
+			content := string(data)
+			if !strings.HasPrefix(content, tt.wantPrefix) {
+				t.Errorf("content should start with %q, got:\n%s", tt.wantPrefix, content)
+			}
+			if !strings.HasSuffix(content, tt.wantSuffix) {
+				t.Errorf("content should end with %q, got:\n%s", tt.wantSuffix, content)
+			}
+			if strings.Count(content, MarkerStart) != 1 || strings.Count(content, MarkerEnd) != 1 {
+				t.Errorf("expected exactly one marker pair, got:\n%s", content)
+			}
+		})
+	}
+}
+
+func TestStripAll(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{config.DefaultInstructionsDir + "/php/coding-standards.md"}
+	configs := []FileConfig{ClaudeConfig(files), AgentsConfig(files), CursorConfig(files)}
+
+	os.WriteFile(filepath.Join(dir, "CLAUDE.md"), []byte("# My Project\n"), 0644)
+	if _, err := InjectAll(dir, []string{"php"}, configs, config.DefaultInstructionsDir); err != nil {
+		t.Fatalf("InjectAll() error: %v", err)
+	}
+
+	changed, err := StripAll(dir, configs)
+	if err != nil {
+		t.Fatalf("StripAll() error: %v", err)
+	}
+	if len(changed) != 3 {
+		t.Errorf("changed = %v, want all 3 files", changed)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "CLAUDE.md"))
+	if err != nil {
+		t.Fatalf("CLAUDE.md with user content should remain: %v", err)
+	}
+	if string(data) != "# My Project\n" {
+		t.Errorf("CLAUDE.md = %q, want only user content", string(data))
+	}
+
+	for _, name := range []string{"AGENTS.md", ".cursorrules"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should be deleted when left empty", name)
+		}
+	}
+
+	// Stripping again is a no-op
+	changed, err = StripAll(dir, configs)
+	if err != nil {
+		t.Fatalf("second StripAll() error: %v", err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("second StripAll() changed = %v, want none", changed)
+	}
+}
+
+func TestBuildBlockInline(t *testing.T) {
+	const dir = "ai"
+	tests := []struct {
+		name    string
+		files   []string
+		inline  map[string]string
+		want    []string
+		wantNot []string
+	}{
+		{
+			name:   "inlined next to referenced",
+			files:  []string{"ai/php/critical.md", "ai/php/rules.md"},
+			inline: map[string]string{"ai/php/critical.md": "Never commit secrets.\n"},
+			want: []string{
+				"Read and follow ALL instruction files in the `ai/` folder:\n- ai/php/rules.md\n\n",
+				"Follow these instructions from ai/php/critical.md:\n\n```markdown\nNever commit secrets.\n```\n",
+			},
+			wantNot: []string{"- ai/php/critical.md"},
+		},
+		{
+			name:    "only inlined",
+			files:   []string{"ai/php/critical.md"},
+			inline:  map[string]string{"ai/php/critical.md": "Never commit secrets."},
+			want:    []string{"Follow these instructions from ai/php/critical.md:\n\n```markdown\nNever commit secrets.\n```\n\n" + defaultFooter},
+			wantNot: []string{"Read and follow ALL"},
+		},
+		{
+			name:   "content with a fence",
+			files:  []string{"ai/php/critical.md"},
+			inline: map[string]string{"ai/php/critical.md": "Use:\n```php\ndeclare(strict_types=1);\n```\n"},
+			want:   []string{"````markdown\nUse:\n```php\ndeclare(strict_types=1);\n```\n````\n"},
+		},
+		{
+			name:    "content with a marker stays referenced",
+			files:   []string{"ai/php/critical.md"},
+			inline:  map[string]string{"ai/php/critical.md": "Keep " + MarkerEnd + " intact."},
+			want:    []string{"- ai/php/critical.md\n"},
+			wantNot: []string{"Follow these instructions"},
+		},
+		{
+			name:    "setext heading stays referenced",
+			files:   []string{"ai/php/critical.md"},
+			inline:  map[string]string{"ai/php/critical.md": "Secrets\n=======\n\nNever commit them."},
+			want:    []string{"- ai/php/critical.md\n"},
+			wantNot: []string{"Follow these instructions"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := buildBlock([]string{"php"}, tt.files, tt.inline, dir, DefaultMarkers(), BlockText{})
+			for _, want := range tt.want {
+				if !strings.Contains(block, want) {
+					t.Errorf("block should contain %q:\n%s", want, block)
+				}
+			}
+			for _, unwanted := range tt.wantNot {
+				if strings.Contains(block, unwanted) {
+					t.Errorf("block should not contain %q:\n%s", unwanted, block)
+				}
+			}
+		})
+	}
+
+	// Without inline content the block is the plain one
+	files := []string{"ai/php/rules.md"}
+	if got, want := buildBlock([]string{"php"}, files, nil, dir, DefaultMarkers(), BlockText{}), BuildBlock([]string{"php"}, files, dir, DefaultMarkers()); got != want {
+		t.Errorf("block without inline =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// injectIntoFile renders and writes the managed block into a single file, as InjectAll does
+// for each target, and reports whether the file changed.
+func injectIntoFile(path, block string, m Markers, placement string) (bool, error) {
+	u, err := renderFile(path, block, m, placement)
+	if err != nil || u.content == u.original {
+		return false, err
+	}
+	return true, atomicWrite(path, u.content)
+}
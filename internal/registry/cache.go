@@ -10,7 +10,14 @@ type Cache struct {
 	mu        sync.RWMutex
 	ttl       time.Duration
 	registry  *cacheEntry[*Registry]
-	manifests map[string]*cacheEntry[*StackManifest]
+	manifests map[manifestKey]*cacheEntry[*StackManifest]
+}
+
+// manifestKey identifies a manifest by stack and the ref it was fetched from,
+// so different versions of a stack are cached independently.
+type manifestKey struct {
+	stackID string
+	ref     string
 }
 
 type cacheEntry[T any] struct {
@@ -22,7 +29,7 @@ type cacheEntry[T any] struct {
 func NewCache(ttl time.Duration) *Cache {
 	return &Cache{
 		ttl:       ttl,
-		manifests: make(map[string]*cacheEntry[*StackManifest]),
+		manifests: make(map[manifestKey]*cacheEntry[*StackManifest]),
 	}
 }
 
@@ -46,22 +53,22 @@ func (c *Cache) SetRegistry(reg *Registry) {
 	}
 }
 
-// GetManifest returns a cached stack manifest if still valid.
-func (c *Cache) GetManifest(stackID string) (*StackManifest, bool) {
+// GetManifest returns a cached stack manifest for a ref if still valid.
+func (c *Cache) GetManifest(stackID, ref string) (*StackManifest, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	entry, ok := c.manifests[stackID]
+	entry, ok := c.manifests[manifestKey{stackID, ref}]
 	if !ok || time.Now().After(entry.expiresAt) {
 		return nil, false
 	}
 	return entry.value, true
 }
 
-// SetManifest caches a stack manifest.
-func (c *Cache) SetManifest(stackID string, m *StackManifest) {
+// SetManifest caches a stack manifest fetched from a ref.
+func (c *Cache) SetManifest(stackID, ref string, m *StackManifest) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.manifests[stackID] = &cacheEntry[*StackManifest]{
+	c.manifests[manifestKey{stackID, ref}] = &cacheEntry[*StackManifest]{
 		value:     m,
 		expiresAt: time.Now().Add(c.ttl),
 	}
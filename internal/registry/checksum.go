@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// registryChecksumPath is published next to registry.json, in sha256sum format.
+const registryChecksumPath = "company-instructions/registry.json.sha256"
+
+// ChecksumError indicates registry.json doesn't match its published checksum.
+type ChecksumError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("registry.json checksum mismatch: expected sha256 %s, got %s", e.Expected, e.Actual)
+}
+
+// WithRegistryChecksum verifies registry.json against registry.json.sha256 before it is
+// trusted. A missing or unreadable checksum fails the fetch, like a mismatch does.
+func WithRegistryChecksum() Option {
+	return func(c *Client) { c.checksum = true }
+}
+
+// verifyRegistryChecksum fetches the published checksum and compares it with data.
+func (c *Client) verifyRegistryChecksum(ctx context.Context, data []byte) error {
+	published, err := c.get(ctx, c.fileURL(registryChecksumPath), expectAny)
+	if err != nil {
+		return fmt.Errorf("fetching registry checksum: %w", err)
+	}
+	expected, err := parseChecksum(published)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return &ChecksumError{Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+// parseChecksum reads the hex digest from sha256sum output ("<hex>  registry.json")
+// or a file holding only the digest.
+func parseChecksum(data []byte) (string, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("registry checksum file is empty")
+	}
+	digest := strings.ToLower(strings.TrimPrefix(fields[0], "sha256:"))
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != sha256.Size*2 {
+		return "", fmt.Errorf("registry checksum file does not contain a sha256 digest")
+	}
+	return digest, nil
+}
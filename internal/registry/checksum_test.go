@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryChecksum(t *testing.T) {
+	registryJSON := `{"version": 1, "stacks": {"php": {"name": "PHP", "version": "1.0.0", "category": "language"}}}`
+	sum := sha256.Sum256([]byte(registryJSON))
+	digest := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name         string
+		checksum     string // "" serves no checksum file
+		wantErr      bool
+		wantMismatch bool
+	}{
+		{name: "sha256sum format", checksum: digest + "  registry.json\n"},
+		{name: "bare digest", checksum: strings.ToUpper(digest)},
+		{name: "prefixed digest", checksum: "sha256:" + digest},
+		{name: "mismatch", checksum: strings.Repeat("0", 64), wantErr: true, wantMismatch: true},
+		{name: "missing", wantErr: true},
+		{name: "not a digest", checksum: "not-a-digest", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasSuffix(r.URL.Path, "registry.json"):
+					w.Write([]byte(registryJSON))
+				case strings.HasSuffix(r.URL.Path, "registry.json.sha256") && tt.checksum != "":
+					w.Write([]byte(tt.checksum))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+
+			client := NewClient(WithBaseURL(server.URL), WithHTTPClient(server.Client()), WithRegistryChecksum())
+			reg, err := client.FetchRegistry(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchRegistry error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var checksumErr *ChecksumError
+			if errors.As(err, &checksumErr) != tt.wantMismatch {
+				t.Errorf("FetchRegistry error = %v, want ChecksumError %v", err, tt.wantMismatch)
+			}
+			if !tt.wantErr && reg.Stacks["php"].Version != "1.0.0" {
+				t.Errorf("php version = %q, want 1.0.0", reg.Stacks["php"].Version)
+			}
+		})
+	}
+}
@@ -1,41 +1,132 @@
 package registry
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
 const maxResponseSize = 10 << 20 // 10 MB
 
+// maxArchiveSize bounds a downloaded stack archive, matching the bound on its extracted files.
+const maxArchiveSize = 100 << 20 // 100 MB
+
+// defaultTimeout bounds each HTTP request unless WithTimeout says otherwise.
+const defaultTimeout = 30 * time.Second
+
+// expect is the kind of response body a request expects.
+type expect int
+
+const (
+	expectAny     expect = iota // raw stack files, taken as served
+	expectJSON                  // registry.json, manifests and API responses
+	expectArchive               // stack archives, rejected rather than truncated when too large
+)
+
+// ErrOffline is returned for every request of a client created WithOffline.
+var ErrOffline = errors.New("offline mode: registry not contacted")
+
+// HTTPStatusError is returned when the registry answers with a status other than 200.
+type HTTPStatusError struct {
+	Code int
+	URL  string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.Code, e.URL)
+}
+
+// IsNotFound reports whether err is a 404 from the registry, usually because the
+// registry URL or branch is wrong.
+func IsNotFound(err error) bool {
+	var statusErr *HTTPStatusError
+	return errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound
+}
+
+// InvalidResponseError is returned when the registry answers with something other than the
+// JSON asked for, such as a login page, or with JSON that isn't a valid registry. Like a 404,
+// it usually means the registry URL or branch is wrong.
+type InvalidResponseError struct {
+	Err error
+}
+
+func (e *InvalidResponseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidResponseError) Unwrap() error {
+	return e.Err
+}
+
+// IsInvalidResponse reports whether err is an InvalidResponseError.
+func IsInvalidResponse(err error) bool {
+	var invalidErr *InvalidResponseError
+	return errors.As(err, &invalidErr)
+}
+
+// IsUnauthorized reports whether the registry rejected the request's credentials,
+// with a 401 or a 403.
+func IsUnauthorized(err error) bool {
+	var statusErr *HTTPStatusError
+	return errors.As(err, &statusErr) &&
+		(statusErr.Code == http.StatusUnauthorized || statusErr.Code == http.StatusForbidden)
+}
+
 // Option configures a Client.
 type Option func(*Client)
 
 // Client fetches data from the registry.
 type Client struct {
-	baseURL     string // direct base URL for simple path concatenation (testing)
-	gitlabHost  string // e.g. https://gitlab.cego.dk
-	projectPath string // e.g. cego/ai-marketplace
-	branch      string // e.g. master or feature/branch
+	baseURL     string            // direct base URL for simple path concatenation (testing)
+	localDir    string            // registry checkout read by WithLocalDir
+	gitlabHost  string            // e.g. https://gitlab.cego.dk
+	projectPath string            // e.g. cego/ai-marketplace
+	projectID   string            // numeric project ID set by WithProjectID, used instead of projectPath
+	branch      string            // e.g. master or feature/branch
+	branches    map[string]string // stack ID → branch overriding branch for that stack
 	token       string
+	credentials CredentialFunc // consulted when token is empty
+	credMu      sync.Mutex
+	credCache   map[string]string // host → looked-up token
 	httpClient  *http.Client
 	cache       *Cache
+	offline     bool
+	checksum    bool // verify registry.json against its checksum, set by WithRegistryChecksum
+
+	timeout *time.Duration // set by WithTimeout; nil keeps defaultTimeout
+
+	logf  func(format string, args ...any)                 // set by WithLogger
+	sleep func(ctx context.Context, d time.Duration) error // waits before a retry
+
+	layers []*Client          // set by WithLayers; the client then reads only from these
+	owners map[string]*Client // stack ID → layer providing it, filled by FetchRegistry
 }
 
 // NewClient creates a new registry client.
 func NewClient(opts ...Option) *Client {
 	c := &Client{
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		httpClient: &http.Client{Timeout: defaultTimeout},
 		cache:      NewCache(5 * time.Minute),
+		logf:       func(string, ...any) {},
+		sleep:      sleepContext,
 	}
 	for _, opt := range opts {
 		opt(c)
 	}
+	if c.timeout != nil {
+		// Copy, so a client passed to WithHTTPClient isn't changed
+		hc := *c.httpClient
+		hc.Timeout = *c.timeout
+		c.httpClient = &hc
+	}
 	return c
 }
 
@@ -46,6 +137,18 @@ func WithBaseURL(baseURL string) Option {
 	return func(c *Client) { c.baseURL = strings.TrimRight(baseURL, "/") }
 }
 
+// WithLocalDir reads the registry from a directory on disk, laid out like the registry
+// repository, instead of over the network. Registry authors use it to check a checkout.
+func WithLocalDir(dir string) Option {
+	return func(c *Client) {
+		transport := &http.Transport{}
+		transport.RegisterProtocol("file", http.NewFileTransport(http.Dir(dir)))
+		c.baseURL = "file://"
+		c.localDir = dir
+		c.httpClient = &http.Client{Transport: transport}
+	}
+}
+
 // WithProjectURL parses a GitLab project URL into host and project path components
 // for constructing GitLab API URLs that handle branches with slashes correctly.
 func WithProjectURL(projectURL string) Option {
@@ -59,16 +162,59 @@ func WithProjectURL(projectURL string) Option {
 	}
 }
 
+// WithProjectID addresses a GitLab project by its numeric ID on host instead of by its
+// path, for setups where the path form of the API fails, such as deeply nested groups.
+// It replaces WithProjectURL and WithBranch.
+func WithProjectID(host, id, branch string) Option {
+	return func(c *Client) {
+		c.gitlabHost = strings.TrimRight(host, "/")
+		c.projectID = id
+		c.branch = branch
+	}
+}
+
+// project returns how API URLs identify the project: its ID when set, otherwise its path.
+func (c *Client) project() string {
+	if c.projectID != "" {
+		return c.projectID
+	}
+	return c.projectPath
+}
+
 // WithBranch sets the git branch/ref to fetch files from.
 func WithBranch(branch string) Option {
 	return func(c *Client) { c.branch = branch }
 }
 
+// WithStackBranches fetches the manifests and files of the given stacks from another
+// branch than the registry's. registry.json itself is always read from the registry branch.
+func WithStackBranches(branches map[string]string) Option {
+	return func(c *Client) { c.branches = branches }
+}
+
+// StackBranch returns the branch a stack is fetched from when it is overridden
+// by WithStackBranches, or "".
+func (c *Client) StackBranch(stackID string) string {
+	return c.branches[stackID]
+}
+
 // WithToken sets the auth token.
 func WithToken(token string) Option {
 	return func(c *Client) { c.token = token }
 }
 
+// WithOffline makes every request fail with ErrOffline instead of touching the network.
+func WithOffline() Option {
+	return func(c *Client) { c.offline = true }
+}
+
+// WithTimeout sets the timeout of each HTTP request, replacing the default of 30 seconds,
+// also for a client given to WithHTTPClient. Zero means no timeout. The operation as a
+// whole is bounded by the context passed to each call.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.timeout = &d }
+}
+
 // WithHTTPClient sets a custom HTTP client (useful for testing).
 func WithHTTPClient(hc *http.Client) Option {
 	return func(c *Client) { c.httpClient = hc }
@@ -78,46 +224,144 @@ func WithHTTPClient(hc *http.Client) Option {
 // If baseURL is set (testing), it uses simple concatenation.
 // Otherwise it uses the GitLab API endpoint where the branch is a query parameter.
 func (c *Client) fileURL(filePath string) string {
+	return c.fileURLAt(filePath, c.branch)
+}
+
+// stackRef returns the ref a stack is fetched from: its branch override, or the registry branch.
+func (c *Client) stackRef(stackID string) string {
+	if b := c.branches[stackID]; b != "" {
+		return b
+	}
+	return c.branch
+}
+
+// stackFileURL builds the URL for a file of a stack, honoring the stack's branch override.
+func (c *Client) stackFileURL(stackID, filename string) string {
+	return c.fileURLAt(fmt.Sprintf("company-instructions/%s/%s", stackID, filename), c.stackRef(stackID))
+}
+
+// fileURLAt builds the URL for a file on the given branch. With a base URL the branch is
+// passed as the ref query parameter, as the GitLab API takes it.
+func (c *Client) fileURLAt(filePath, branch string) string {
 	if c.baseURL != "" {
-		return c.baseURL + "/" + filePath
+		if branch == "" {
+			return c.baseURL + "/" + filePath
+		}
+		return c.baseURL + "/" + filePath + "?ref=" + url.QueryEscape(branch)
 	}
 	return fmt.Sprintf("%s/api/v4/projects/%s/repository/files/%s/raw?ref=%s",
 		c.gitlabHost,
-		url.PathEscape(c.projectPath),
+		url.PathEscape(c.project()),
 		url.PathEscape(filePath),
-		url.QueryEscape(c.branch),
+		url.QueryEscape(branch),
 	)
 }
 
+// registryHost returns the host, with port if any, that requests to the registry go to.
+func (c *Client) registryHost() string {
+	base := c.gitlabHost
+	if c.baseURL != "" {
+		base = c.baseURL
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
 // FetchRegistry fetches and parses registry.json.
 func (c *Client) FetchRegistry(ctx context.Context) (*Registry, error) {
 	if cached, ok := c.cache.GetRegistry(); ok {
 		return cached, nil
 	}
 
+	if len(c.layers) > 0 {
+		reg, err := c.fetchLayeredRegistry(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.cache.SetRegistry(reg)
+		return reg, nil
+	}
+
 	fileURL := c.fileURL("company-instructions/registry.json")
-	data, err := c.get(ctx, fileURL)
+	data, err := c.get(ctx, fileURL, expectJSON)
 	if err != nil {
 		return nil, fmt.Errorf("fetching registry: %w", err)
 	}
+	if c.checksum {
+		if err := c.verifyRegistryChecksum(ctx, data); err != nil {
+			return nil, err
+		}
+	}
 
 	var reg Registry
 	if err := json.Unmarshal(data, &reg); err != nil {
-		return nil, fmt.Errorf("parsing registry: %w", err)
+		return nil, &InvalidResponseError{Err: fmt.Errorf("parsing registry: %w", err)}
+	}
+	if err := ValidateRegistry(&reg); err != nil {
+		return nil, &InvalidResponseError{Err: fmt.Errorf("invalid registry: %w", err)}
 	}
 
 	c.cache.SetRegistry(&reg)
 	return &reg, nil
 }
 
-// FetchStackManifest fetches and parses a stack's stack.json.
+// DefaultBranch asks the GitLab project API for the registry project's default branch.
+// Registries that aren't on GitLab have no default branch to ask for.
+func (c *Client) DefaultBranch(ctx context.Context) (string, error) {
+	if c.gitlabHost == "" || c.baseURL != "" || c.localDir != "" {
+		return "", fmt.Errorf("the default branch can only be looked up for a GitLab registry")
+	}
+
+	projectURL := fmt.Sprintf("%s/api/v4/projects/%s", c.gitlabHost, url.PathEscape(c.project()))
+	data, err := c.get(ctx, projectURL, expectJSON)
+	if err != nil {
+		return "", fmt.Errorf("fetching project: %w", err)
+	}
+	var project struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := json.Unmarshal(data, &project); err != nil {
+		return "", fmt.Errorf("parsing project: %w", err)
+	}
+	if project.DefaultBranch == "" {
+		return "", fmt.Errorf("project %s has no default branch", c.project())
+	}
+	return project.DefaultBranch, nil
+}
+
+// FetchStackManifest fetches and parses a stack's stack.json from the stack's branch.
 func (c *Client) FetchStackManifest(ctx context.Context, stackID string) (*StackManifest, error) {
-	if cached, ok := c.cache.GetManifest(stackID); ok {
+	return c.FetchStackManifestAt(ctx, stackID, "")
+}
+
+// FetchStackManifestAt fetches and parses a stack's stack.json at a git ref, such as a
+// release tag. An empty ref uses the stack's branch. Glob entries in the file list are
+// expanded against the stack directory at that ref. Manifests are cached per ref.
+func (c *Client) FetchStackManifestAt(ctx context.Context, stackID, ref string) (*StackManifest, error) {
+	if err := ValidatePathComponent(stackID, "stack ID"); err != nil {
+		return nil, err
+	}
+
+	if len(c.layers) > 0 {
+		layer, err := c.owner(ctx, stackID)
+		if err != nil {
+			return nil, err
+		}
+		return layer.FetchStackManifestAt(ctx, stackID, ref)
+	}
+
+	if ref == "" {
+		ref = c.stackRef(stackID)
+	}
+	if cached, ok := c.cache.GetManifest(stackID, ref); ok {
 		return cached, nil
 	}
 
-	fileURL := c.fileURL(fmt.Sprintf("company-instructions/%s/stack.json", stackID))
-	data, err := c.get(ctx, fileURL)
+	fileURL := c.fileURLAt(fmt.Sprintf("company-instructions/%s/stack.json", stackID), ref)
+	data, err := c.get(ctx, fileURL, expectJSON)
 	if err != nil {
 		return nil, fmt.Errorf("fetching stack manifest for %s: %w", stackID, err)
 	}
@@ -126,46 +370,177 @@ func (c *Client) FetchStackManifest(ctx context.Context, stackID string) (*Stack
 	if err := json.Unmarshal(data, &manifest); err != nil {
 		return nil, fmt.Errorf("parsing stack manifest for %s: %w", stackID, err)
 	}
+	manifest.Files, err = c.expandFiles(ctx, stackID, ref, manifest.Files)
+	if err != nil {
+		return nil, err
+	}
 
-	c.cache.SetManifest(stackID, &manifest)
+	c.cache.SetManifest(stackID, ref, &manifest)
 	return &manifest, nil
 }
 
 // DownloadFile downloads a single file from a stack.
 func (c *Client) DownloadFile(ctx context.Context, stackID, filename string) ([]byte, error) {
-	fileURL := c.fileURL(fmt.Sprintf("company-instructions/%s/%s", stackID, filename))
-	return c.get(ctx, fileURL)
+	f, err := c.DownloadFileIfChanged(ctx, stackID, filename, "")
+	if err != nil {
+		return nil, err
+	}
+	return f.Data, nil
+}
+
+// DownloadArchive downloads a stack's archive from archiveURL, the manifest's archive_url.
+// A relative archiveURL is fetched like a file of the stack.
+func (c *Client) DownloadArchive(ctx context.Context, stackID, archiveURL string) ([]byte, error) {
+	if err := ValidatePathComponent(stackID, "stack ID"); err != nil {
+		return nil, err
+	}
+
+	if len(c.layers) > 0 {
+		layer, err := c.owner(ctx, stackID)
+		if err != nil {
+			return nil, err
+		}
+		return layer.DownloadArchive(ctx, stackID, archiveURL)
+	}
+
+	u, err := url.Parse(archiveURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive URL %q: %w", archiveURL, err)
+	}
+	fileURL := archiveURL
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http":
+		// Another host only gets a plain http request if it is the registry itself
+		if u.Host != c.registryHost() {
+			return nil, fmt.Errorf("invalid archive URL %q: must use https outside the registry host", archiveURL)
+		}
+	case u.Scheme == "" && u.Host == "":
+		if err := ValidatePathComponent(archiveURL, "archive"); err != nil {
+			return nil, err
+		}
+		fileURL = c.stackFileURL(stackID, archiveURL)
+	default:
+		return nil, fmt.Errorf("invalid archive URL %q: must be http(s) or a path in the stack", archiveURL)
+	}
+	return c.get(ctx, fileURL, expectArchive)
 }
 
-func (c *Client) get(ctx context.Context, url string) ([]byte, error) {
+// FileResponse is a downloaded stack file.
+type FileResponse struct {
+	Data []byte
+	// ETag is the entity tag the registry sent for the file, if any.
+	ETag string
+	// NotModified is set when the file still matches the ETag passed in; Data is then empty.
+	NotModified bool
+}
+
+// DownloadFileIfChanged downloads a single file from a stack unless it still matches etag.
+// An empty etag always downloads the file.
+func (c *Client) DownloadFileIfChanged(ctx context.Context, stackID, filename, etag string) (*FileResponse, error) {
+	if err := ValidatePathComponent(stackID, "stack ID"); err != nil {
+		return nil, err
+	}
+	if err := ValidatePathComponent(filename, "filename"); err != nil {
+		return nil, err
+	}
+
+	if len(c.layers) > 0 {
+		layer, err := c.owner(ctx, stackID)
+		if err != nil {
+			return nil, err
+		}
+		return layer.DownloadFileIfChanged(ctx, stackID, filename, etag)
+	}
+	fileURL := c.stackFileURL(stackID, filename)
+	return c.fetch(ctx, fileURL, etag, expectAny)
+}
+
+func (c *Client) get(ctx context.Context, url string, want expect) ([]byte, error) {
+	f, err := c.fetch(ctx, url, "", want)
+	if err != nil {
+		return nil, err
+	}
+	return f.Data, nil
+}
+
+// fetch requests url, conditionally on etag when it is set. A response expected to be
+// JSON is rejected if it is served as HTML or doesn't parse, which catches login and
+// proxy error pages served with status 200.
+func (c *Client) fetch(ctx context.Context, url, etag string, want expect) (*FileResponse, error) {
+	if c.offline {
+		return nil, ErrOffline
+	}
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
 
-	if c.token != "" {
-		req.Header.Set("PRIVATE-TOKEN", c.token)
+	// Credentials are only sent to the registry, never to a host a manifest points at
+	if req.URL.Host == c.registryHost() {
+		token, err := c.tokenFor(ctx, req.URL.Hostname())
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("PRIVATE-TOKEN", token)
+		}
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && etag != "" {
+		return &FileResponse{ETag: etag, NotModified: true}, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, url)
+		return nil, &HTTPStatusError{Code: resp.StatusCode, URL: url}
 	}
 
-	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	body := io.Reader(resp.Body)
+	// The transport only decompresses when it asked for gzip itself; some servers send it anyway
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing response from %s: %w", url, err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	if want == expectArchive {
+		// A truncated archive would fail to extract with a misleading error, so read one
+		// byte past the limit to tell a full archive from one that is too large
+		data, err := io.ReadAll(io.LimitReader(body, maxArchiveSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("reading archive from %s: %w", url, err)
+		}
+		if len(data) > maxArchiveSize {
+			return nil, fmt.Errorf("archive from %s exceeds %d MB", url, maxArchiveSize>>20)
+		}
+		return &FileResponse{Data: data, ETag: resp.Header.Get("ETag")}, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxResponseSize))
 	if err != nil {
 		return nil, fmt.Errorf("reading response from %s: %w", url, err)
 	}
 
-	ct := resp.Header.Get("Content-Type")
-	if strings.Contains(ct, "text/html") {
-		return nil, fmt.Errorf("received HTML response from %s (expected JSON); check the registry URL and branch", url)
+	if want == expectJSON {
+		if strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+			return nil, &InvalidResponseError{Err: fmt.Errorf("received HTML response from %s (expected JSON); check the registry URL and branch", url)}
+		}
+		if !json.Valid(data) {
+			return nil, &InvalidResponseError{Err: fmt.Errorf("received invalid JSON from %s; check the registry URL and branch", url)}
+		}
 	}
 
-	return data, nil
+	return &FileResponse{Data: data, ETag: resp.Header.Get("ETag")}, nil
 }
@@ -1,14 +1,21 @@
 package registry
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func setupTestServer(t *testing.T) *httptest.Server {
@@ -142,19 +149,131 @@ func TestAuthToken(t *testing.T) {
 }
 
 func TestHTTPError(t *testing.T) {
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "not found", 404)
-	}))
-	defer server.Close()
+	tests := []struct {
+		name         string
+		status       int
+		wantAuth     bool
+		wantNotFound bool
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, wantAuth: true},
+		{name: "forbidden", status: http.StatusForbidden, wantAuth: true},
+		{name: "not found", status: http.StatusNotFound, wantNotFound: true},
+		{name: "server error", status: http.StatusInternalServerError},
+	}
 
-	client := NewClient(
-		WithBaseURL(server.URL),
-		WithHTTPClient(server.Client()),
-	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, http.StatusText(tt.status), tt.status)
+			}))
+			defer server.Close()
+
+			client := NewClient(
+				WithBaseURL(server.URL),
+				WithHTTPClient(server.Client()),
+			)
+
+			_, err := client.FetchRegistry(context.Background())
+			if err == nil {
+				t.Fatalf("should return error for %d", tt.status)
+			}
+			// Wrapping keeps the status recoverable
+			err = fmt.Errorf("fetching: %w", err)
+			if want := fmt.Sprintf("HTTP %d: ", tt.status); !strings.Contains(err.Error(), want) {
+				t.Errorf("error = %q, want it to contain %q", err, want)
+			}
+
+			var statusErr *HTTPStatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("errors.As(HTTPStatusError) = false for %v", err)
+			}
+			if statusErr.Code != tt.status || !strings.HasSuffix(statusErr.URL, "registry.json") {
+				t.Errorf("HTTPStatusError = %+v, want code %d for registry.json", statusErr, tt.status)
+			}
+			if got := IsUnauthorized(err); got != tt.wantAuth {
+				t.Errorf("IsUnauthorized() = %v, want %v", got, tt.wantAuth)
+			}
+			if got := IsNotFound(err); got != tt.wantNotFound {
+				t.Errorf("IsNotFound() = %v, want %v", got, tt.wantNotFound)
+			}
+		})
+	}
+}
 
-	_, err := client.FetchRegistry(context.Background())
-	if err == nil {
-		t.Error("should return error for 404")
+func TestContentTypeChecks(t *testing.T) {
+	const registryJSON = `{"version": 1, "stacks": {"php": {"name": "PHP", "version": "1.0.0", "category": "language"}}}`
+	const loginPage = "<html><body>Sign in</body></html>"
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		download    bool // DownloadFile instead of FetchRegistry
+		wantErr     string
+	}{
+		{name: "json without content type", body: registryJSON},
+		{name: "json served as text", contentType: "text/plain", body: registryJSON},
+		{name: "html registry", contentType: "text/html; charset=utf-8", body: loginPage, wantErr: "HTML response"},
+		{name: "html body without content type", body: loginPage, wantErr: "invalid JSON"},
+		{name: "html body served as json", contentType: "application/json", body: loginPage, wantErr: "invalid JSON"},
+		{name: "html file download", contentType: "text/html", body: loginPage, download: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Without a header, net/http would sniff one from the body
+				w.Header()["Content-Type"] = nil
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			client := NewClient(WithBaseURL(server.URL), WithHTTPClient(server.Client()))
+
+			var err error
+			if tt.download {
+				_, err = client.DownloadFile(context.Background(), "php", "page.html")
+			} else {
+				_, err = client.FetchRegistry(context.Background())
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	custom := &http.Client{Timeout: time.Minute}
+
+	tests := []struct {
+		name string
+		opts []Option
+		want time.Duration
+	}{
+		{name: "default", want: defaultTimeout},
+		{name: "set", opts: []Option{WithTimeout(5 * time.Second)}, want: 5 * time.Second},
+		{name: "zero disables", opts: []Option{WithTimeout(0)}, want: 0},
+		{name: "custom client kept", opts: []Option{WithHTTPClient(custom)}, want: time.Minute},
+		{name: "applies to custom client", opts: []Option{WithTimeout(time.Second), WithHTTPClient(custom)}, want: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(tt.opts...)
+			if c.httpClient.Timeout != tt.want {
+				t.Errorf("Timeout = %v, want %v", c.httpClient.Timeout, tt.want)
+			}
+		})
+	}
+	if custom.Timeout != time.Minute {
+		t.Errorf("WithTimeout changed the client passed to WithHTTPClient: Timeout = %v", custom.Timeout)
 	}
 }
 
@@ -179,3 +298,430 @@ func TestResponseSizeLimit(t *testing.T) {
 		t.Errorf("response size = %d, want <= %d", len(data), maxResponseSize)
 	}
 }
+
+func TestGzipResponse(t *testing.T) {
+	gzipped := func(s string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(s))
+		gz.Close()
+		return buf.Bytes()
+	}
+	registryJSON := gzipped(`{"version": 1, "stacks": {"php": {"name": "PHP", "version": "1.0.0", "category": "language"}}}`)
+	oversized := gzipped(strings.Repeat("x", maxResponseSize+1024))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Sent regardless of Accept-Encoding, as some GitLab setups do
+		w.Header().Set("Content-Encoding", "gzip")
+		if strings.HasSuffix(r.URL.Path, "registry.json") {
+			w.Write(registryJSON)
+			return
+		}
+		w.Write(oversized)
+	}))
+	defer server.Close()
+
+	// Without transport compression the client sees the encoded body itself
+	httpClient := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	client := NewClient(WithBaseURL(server.URL), WithHTTPClient(httpClient))
+
+	reg, err := client.FetchRegistry(context.Background())
+	if err != nil {
+		t.Fatalf("FetchRegistry: %v", err)
+	}
+	if reg.Stacks["php"].Version != "1.0.0" {
+		t.Errorf("php version = %q, want 1.0.0", reg.Stacks["php"].Version)
+	}
+
+	data, err := client.DownloadFile(context.Background(), "php", "huge.md")
+	if err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	if len(data) != maxResponseSize {
+		t.Errorf("decompressed size = %d, want limit %d", len(data), maxResponseSize)
+	}
+}
+
+func TestDownloadArchive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("archive at " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	client := NewClient(
+		WithBaseURL(server.URL),
+		WithHTTPClient(server.Client()),
+	)
+
+	tests := []struct {
+		name       string
+		archiveURL string
+		want       string
+		wantErr    string
+	}{
+		{name: "relative", archiveURL: "stack.tar.gz", want: "archive at /company-instructions/php/stack.tar.gz"},
+		{name: "absolute", archiveURL: server.URL + "/releases/php.tar.gz", want: "archive at /releases/php.tar.gz"},
+		{name: "parent dir", archiveURL: "../other/stack.tar.gz", wantErr: "invalid archive"},
+		{name: "file scheme", archiveURL: "file:///etc/passwd", wantErr: "invalid archive URL"},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := client.DownloadArchive(ctx, "php", tt.archiveURL)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("DownloadArchive() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadArchive() error: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("DownloadArchive() = %q, want %q", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestArchiveSizeLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr string
+	}{
+		{name: "above the response limit", size: maxResponseSize + 1024},
+		{name: "at the archive limit", size: maxArchiveSize},
+		{name: "oversized", size: maxArchiveSize + 1, wantErr: "exceeds 100 MB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				chunk := make([]byte, 1<<20)
+				for left := tt.size; left > 0; left -= len(chunk) {
+					if _, err := w.Write(chunk[:min(left, len(chunk))]); err != nil {
+						return
+					}
+				}
+			}))
+			defer server.Close()
+
+			client := NewClient(WithBaseURL(server.URL), WithHTTPClient(server.Client()))
+			data, err := client.DownloadArchive(context.Background(), "php", "stack.tar.gz")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("DownloadArchive() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadArchive() error: %v", err)
+			}
+			if len(data) != tt.size {
+				t.Errorf("archive size = %d, want %d", len(data), tt.size)
+			}
+		})
+	}
+}
+
+func TestDownloadArchiveCredentials(t *testing.T) {
+	var registryToken, foreignToken string
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryToken = r.Header.Get("PRIVATE-TOKEN")
+		w.Write([]byte("registry archive"))
+	}))
+	defer registry.Close()
+	foreign := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		foreignToken = r.Header.Get("PRIVATE-TOKEN")
+		w.Write([]byte("foreign archive"))
+	}))
+	defer foreign.Close()
+
+	client := NewClient(
+		WithBaseURL(registry.URL),
+		WithHTTPClient(foreign.Client()),
+		WithToken("secret"),
+	)
+	ctx := context.Background()
+
+	if _, err := client.DownloadArchive(ctx, "php", registry.URL+"/releases/php.tar.gz"); err != nil {
+		t.Fatalf("DownloadArchive(registry) error: %v", err)
+	}
+	if registryToken != "secret" {
+		t.Errorf("registry PRIVATE-TOKEN = %q, want the token", registryToken)
+	}
+
+	if _, err := client.DownloadArchive(ctx, "php", foreign.URL+"/php.tar.gz"); err != nil {
+		t.Fatalf("DownloadArchive(foreign) error: %v", err)
+	}
+	if foreignToken != "" {
+		t.Errorf("foreign host PRIVATE-TOKEN = %q, want none", foreignToken)
+	}
+
+	plain := "http://" + strings.TrimPrefix(foreign.URL, "https://") + "/php.tar.gz"
+	if _, err := client.DownloadArchive(ctx, "php", plain); err == nil || !strings.Contains(err.Error(), "must use https") {
+		t.Errorf("DownloadArchive(plain http foreign) error = %v, want https required", err)
+	}
+}
+
+func TestPathTraversal(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("malicious content"))
+	}))
+	defer server.Close()
+
+	client := NewClient(
+		WithBaseURL(server.URL),
+		WithHTTPClient(server.Client()),
+	)
+
+	tests := []struct {
+		name     string
+		stackID  string
+		filename string
+		wantErr  string
+	}{
+		{name: "stack ID with path traversal", stackID: "../../etc", filename: "passwd", wantErr: "invalid stack ID"},
+		{name: "stack ID with parent dir", stackID: "..", filename: "file.md", wantErr: "invalid stack ID"},
+		{name: "filename with path traversal", stackID: "php", filename: "../../../.bashrc", wantErr: "invalid filename"},
+		{name: "filename with parent dir", stackID: "php", filename: "../secret.md", wantErr: "invalid filename"},
+		{name: "empty stack ID", stackID: "", filename: "file.md", wantErr: "empty stack ID"},
+		{name: "empty filename", stackID: "php", filename: "", wantErr: "empty filename"},
+		{name: "absolute stack ID", stackID: "/etc", filename: "passwd", wantErr: "invalid stack ID"},
+		{name: "absolute filename", stackID: "php", filename: "/etc/passwd", wantErr: "invalid filename"},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.DownloadFile(ctx, tt.stackID, tt.filename)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("DownloadFile() error = %v, want containing %q", err, tt.wantErr)
+			}
+
+			if tt.wantErr == "invalid stack ID" || tt.wantErr == "empty stack ID" {
+				_, err := client.FetchStackManifest(ctx, tt.stackID)
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("FetchStackManifest() error = %v, want containing %q", err, tt.wantErr)
+				}
+			}
+		})
+	}
+
+	if requests != 0 {
+		t.Errorf("made %d requests, invalid paths should be rejected before any URL is built", requests)
+	}
+}
+
+func TestValidateRegistry(t *testing.T) {
+	valid := StackMeta{Name: "PHP", Version: "1.0.0", Category: "language"}
+
+	tests := []struct {
+		name    string
+		reg     Registry
+		wantErr string
+	}{
+		{name: "valid", reg: Registry{Version: 1, Stacks: map[string]StackMeta{"php": valid}}},
+		{name: "empty stacks", reg: Registry{Version: 1, Stacks: map[string]StackMeta{}}},
+		{name: "future version", reg: Registry{Version: 2, Stacks: map[string]StackMeta{}}, wantErr: "registry version 2 not supported by this CLI, please upgrade"},
+		{name: "missing version", reg: Registry{Stacks: map[string]StackMeta{}}, wantErr: "registry version 0 not supported"},
+		{name: "nil stacks", reg: Registry{Version: 1}, wantErr: "registry has no stacks"},
+		{
+			name:    "malformed entry",
+			reg:     Registry{Version: 1, Stacks: map[string]StackMeta{"php": valid, "go": {Version: "1.0.0"}}},
+			wantErr: "stack go is missing name, category",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRegistry(&tt.reg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateRegistry() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateRegistry() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultBranch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/cego%2Finstructions" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 42, "default_branch": "main"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithProjectURL(server.URL+"/cego/instructions"), WithHTTPClient(server.Client()))
+	branch, err := client.DefaultBranch(context.Background())
+	if err != nil {
+		t.Fatalf("DefaultBranch() error: %v", err)
+	}
+	if branch != "main" {
+		t.Errorf("DefaultBranch() = %q, want main", branch)
+	}
+
+	plain := NewClient(WithBaseURL(server.URL), WithHTTPClient(server.Client()))
+	if _, err := plain.DefaultBranch(context.Background()); err == nil {
+		t.Error("DefaultBranch() should fail for a registry that isn't on GitLab")
+	}
+}
+
+func TestWithProjectID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/1234/repository/files/company-instructions%2Fregistry.json/raw" || r.URL.Query().Get("ref") != "main" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"version": 1, "stacks": {}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithProjectID(server.URL+"/", "1234", "main"), WithHTTPClient(server.Client()))
+	if _, err := client.FetchRegistry(context.Background()); err != nil {
+		t.Fatalf("FetchRegistry() error: %v", err)
+	}
+	if got, want := client.Source(), server.URL+" (project 1234)"; got != want {
+		t.Errorf("Source() = %q, want %q", got, want)
+	}
+}
+
+func TestFetchRegistryUnsupportedVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version": 3, "stacks": {}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL), WithHTTPClient(server.Client()))
+	_, err := client.FetchRegistry(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "please upgrade") {
+		t.Errorf("FetchRegistry() = %v, want unsupported version error", err)
+	}
+}
+
+func TestStackBranches(t *testing.T) {
+	refs := make(map[string]string) // requested file → ref
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.URL.EscapedPath(), "/")
+		file, _ := url.PathUnescape(parts[len(parts)-2])
+		refs[file] = r.URL.Query().Get("ref")
+		switch {
+		case strings.HasSuffix(file, "registry.json"):
+			w.Write([]byte(`{"version": 1, "stacks": {}}`))
+		case strings.HasSuffix(file, "stack.json"):
+			w.Write([]byte(`{"name": "Stack", "version": "1.0.0", "files": ["a.md"]}`))
+		default:
+			w.Write([]byte("content"))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(
+		WithProjectURL(server.URL+"/cego/instructions"),
+		WithBranch("master"),
+		WithStackBranches(map[string]string{"laravel": "feature/x"}),
+		WithHTTPClient(server.Client()),
+	)
+	ctx := context.Background()
+	if _, err := client.FetchRegistry(ctx); err != nil {
+		t.Fatalf("FetchRegistry: %v", err)
+	}
+	for _, stack := range []string{"php", "laravel"} {
+		if _, err := client.FetchStackManifest(ctx, stack); err != nil {
+			t.Fatalf("FetchStackManifest(%s): %v", stack, err)
+		}
+		if _, err := client.DownloadFile(ctx, stack, "a.md"); err != nil {
+			t.Fatalf("DownloadFile(%s): %v", stack, err)
+		}
+	}
+
+	want := map[string]string{
+		"company-instructions/registry.json":      "master",
+		"company-instructions/php/stack.json":     "master",
+		"company-instructions/php/a.md":           "master",
+		"company-instructions/laravel/stack.json": "feature/x",
+		"company-instructions/laravel/a.md":       "feature/x",
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("requested refs = %v, want %v", refs, want)
+	}
+	if got := client.StackBranch("laravel"); got != "feature/x" {
+		t.Errorf("StackBranch(laravel) = %q, want feature/x", got)
+	}
+}
+
+func TestOffline(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL), WithHTTPClient(server.Client()), WithOffline())
+	if _, err := client.FetchRegistry(context.Background()); !errors.Is(err, ErrOffline) {
+		t.Errorf("FetchRegistry() = %v, want ErrOffline", err)
+	}
+	if _, err := client.DownloadFile(context.Background(), "php", "a.md"); !errors.Is(err, ErrOffline) {
+		t.Errorf("DownloadFile() = %v, want ErrOffline", err)
+	}
+	if requests != 0 {
+		t.Errorf("offline client made %d requests", requests)
+	}
+}
+
+func TestFetchStackManifestAtCachesPerRef(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		version := strings.TrimPrefix(r.URL.Query().Get("ref"), "v")
+		fmt.Fprintf(w, `{"name": "Laravel", "version": %q, "files": ["a.md"]}`, version)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{name: "project URL", opt: WithProjectURL(server.URL + "/cego/instructions")},
+		{name: "base URL", opt: WithBaseURL(server.URL)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			client := NewClient(tt.opt, WithBranch("v1.5.0"), WithHTTPClient(server.Client()))
+			ctx := context.Background()
+
+			for round := 0; round < 2; round++ {
+				for _, ref := range []string{"v1.4.0", "v1.5.0"} {
+					m, err := client.FetchStackManifestAt(ctx, "laravel", ref)
+					if err != nil {
+						t.Fatalf("FetchStackManifestAt(%s): %v", ref, err)
+					}
+					if want := strings.TrimPrefix(ref, "v"); m.Version != want {
+						t.Errorf("FetchStackManifestAt(%s) version = %s, want %s", ref, m.Version, want)
+					}
+				}
+			}
+			// The registry branch shares the cache entry of the same ref
+			if m, err := client.FetchStackManifest(ctx, "laravel"); err != nil || m.Version != "1.5.0" {
+				t.Errorf("FetchStackManifest() = %+v, %v, want version 1.5.0", m, err)
+			}
+			if requests != 2 {
+				t.Errorf("requests = %d, want 2 (one per ref)", requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CredentialFunc looks up the token to send to a registry host.
+// It returns an empty token if it has none for the host.
+type CredentialFunc func(ctx context.Context, host string) (string, error)
+
+// WithCredentials looks up a token with fn when no explicit token is set.
+// The lookup happens on the first request and is reused afterwards.
+func WithCredentials(fn CredentialFunc) Option {
+	return func(c *Client) { c.credentials = fn }
+}
+
+// WithCredentialsFromNetrc reads the token from the password of the registry host's
+// entry in the netrc file ($NETRC, or ~/.netrc).
+func WithCredentialsFromNetrc() Option {
+	return WithCredentials(func(ctx context.Context, host string) (string, error) {
+		path := os.Getenv("NETRC")
+		if path == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("locating netrc: %w", err)
+			}
+			path = filepath.Join(home, ".netrc")
+		}
+		return netrcPassword(path, host)
+	})
+}
+
+// WithCredentialsFromGit asks the git credential helper configured for the registry host
+// for its password. git is run with terminal prompts disabled.
+func WithCredentialsFromGit() Option {
+	return WithCredentials(gitCredential)
+}
+
+// tokenFor returns the explicit token, or the one the credential lookup finds for host.
+func (c *Client) tokenFor(ctx context.Context, host string) (string, error) {
+	if c.token != "" || c.credentials == nil {
+		return c.token, nil
+	}
+
+	c.credMu.Lock()
+	defer c.credMu.Unlock()
+	if token, ok := c.credCache[host]; ok {
+		return token, nil
+	}
+	token, err := c.credentials(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("looking up credentials for %s: %w", host, err)
+	}
+	if c.credCache == nil {
+		c.credCache = make(map[string]string)
+	}
+	c.credCache[host] = token
+	return token, nil
+}
+
+// netrcPassword returns the password of the netrc entry for host, falling back to the
+// default entry. A missing file yields an empty password.
+func netrcPassword(path, host string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("reading netrc: %w", err)
+	}
+
+	tokens := netrcTokens(string(data))
+	var entry string // host of the current entry, "" for default
+	var inEntry bool
+	passwords := make(map[string]string)
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			i++
+			if i < len(tokens) {
+				entry, inEntry = tokens[i], true
+			}
+		case "default":
+			entry, inEntry = "", true
+		case "password":
+			i++
+			if i < len(tokens) && inEntry {
+				if _, seen := passwords[entry]; !seen {
+					passwords[entry] = tokens[i]
+				}
+			}
+		case "login", "account":
+			i++
+		}
+	}
+
+	if password, ok := passwords[host]; ok {
+		return password, nil
+	}
+	return passwords[""], nil
+}
+
+// netrcTokens splits netrc content into tokens, dropping macdef bodies,
+// which run until the next blank line.
+func netrcTokens(content string) []string {
+	var tokens []string
+	inMacro := false
+	for _, line := range strings.Split(content, "\n") {
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			if f == "macdef" {
+				inMacro = true
+				fields = fields[:i]
+				break
+			}
+		}
+		tokens = append(tokens, fields...)
+	}
+	return tokens
+}
+
+// gitCredential runs `git credential fill` for host and returns the password it reports.
+func gitCredential(ctx context.Context, host string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=https\nhost=%s\n\n", host))
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git credential fill: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseCredentialOutput(out), nil
+}
+
+// parseCredentialOutput extracts the password from git credential key=value output.
+func parseCredentialOutput(out []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), "="); ok && key == "password" {
+			return value
+		}
+	}
+	return ""
+}
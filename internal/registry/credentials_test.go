@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNetrcPassword(t *testing.T) {
+	content := `# team registry
+machine gitlab.example.com login oauth2 password glpat-team
+machine other.example.com
+  login me
+  password other-secret
+macdef init
+  password not-a-token
+
+default login anon password fallback
+`
+	path := filepath.Join(t.TempDir(), ".netrc")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "gitlab.example.com", want: "glpat-team"},
+		{host: "other.example.com", want: "other-secret"},
+		{host: "unknown.example.com", want: "fallback"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got, err := netrcPassword(path, tt.host)
+			if err != nil {
+				t.Fatalf("netrcPassword() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("netrcPassword(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+
+	if got, err := netrcPassword(filepath.Join(t.TempDir(), "missing"), "gitlab.example.com"); err != nil || got != "" {
+		t.Errorf("missing netrc = %q, %v; want empty, nil", got, err)
+	}
+}
+
+func TestCredentialPrecedence(t *testing.T) {
+	var gotToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotToken = r.Header.Get("PRIVATE-TOKEN")
+		w.Write([]byte(`{"version": 1, "stacks": {}}`))
+	}))
+	defer server.Close()
+
+	netrc := filepath.Join(t.TempDir(), ".netrc")
+	if err := os.WriteFile(netrc, []byte("machine 127.0.0.1 password from-netrc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", netrc)
+
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{name: "netrc", opts: []Option{WithCredentialsFromNetrc()}, want: "from-netrc"},
+		{name: "explicit token wins", opts: []Option{WithToken("explicit"), WithCredentialsFromNetrc()}, want: "explicit"},
+		{
+			name: "lookup without entry",
+			opts: []Option{WithCredentials(func(context.Context, string) (string, error) { return "", nil })},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotToken = ""
+			opts := append([]Option{WithBaseURL(server.URL), WithHTTPClient(server.Client())}, tt.opts...)
+			if _, err := NewClient(opts...).FetchRegistry(context.Background()); err != nil {
+				t.Fatalf("FetchRegistry() error: %v", err)
+			}
+			if gotToken != tt.want {
+				t.Errorf("PRIVATE-TOKEN = %q, want %q", gotToken, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetrcWithoutHome(t *testing.T) {
+	t.Setenv("NETRC", "")
+	t.Setenv("HOME", "")
+
+	client := NewClient(WithBaseURL("https://gitlab.example.com"), WithCredentialsFromNetrc())
+	if _, err := client.tokenFor(context.Background(), "gitlab.example.com"); err == nil || !strings.Contains(err.Error(), "locating netrc") {
+		t.Errorf("tokenFor() error = %v, want a locating netrc error", err)
+	}
+}
+
+func TestParseCredentialOutput(t *testing.T) {
+	out := []byte("protocol=https\nhost=gitlab.example.com\nusername=me\npassword=glpat-xyz\n")
+	if got := parseCredentialOutput(out); got != "glpat-xyz" {
+		t.Errorf("parseCredentialOutput() = %q, want %q", got, "glpat-xyz")
+	}
+	if got := parseCredentialOutput([]byte("host=x\n")); got != "" {
+		t.Errorf("parseCredentialOutput() without password = %q, want empty", got)
+	}
+}
@@ -0,0 +1,144 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// treePageSize is the page size requested from the GitLab repository tree API.
+const treePageSize = 100
+
+// treeEntry is an item of the GitLab repository tree API response.
+type treeEntry struct {
+	Type string `json:"type"` // "blob" or "tree"
+	Path string `json:"path"`
+}
+
+// isGlob reports whether a manifest file entry is a glob pattern.
+func isGlob(entry string) bool {
+	return strings.ContainsAny(entry, "*?[")
+}
+
+// expandFiles replaces the glob entries of a stack's file list with the stack files
+// they match, in sorted order. Literal entries are kept as is; duplicates are dropped.
+// The stack directory is only listed when the list contains a glob.
+func (c *Client) expandFiles(ctx context.Context, stackID, ref string, files []string) ([]string, error) {
+	hasGlob := false
+	for _, f := range files {
+		if isGlob(f) {
+			hasGlob = true
+			break
+		}
+	}
+	if !hasGlob {
+		return files, nil
+	}
+
+	available, err := c.listStackFiles(ctx, stackID, ref)
+	if err != nil {
+		return nil, fmt.Errorf("listing files of %s: %w", stackID, err)
+	}
+
+	var expanded []string
+	seen := make(map[string]bool)
+	add := func(f string) {
+		if !seen[f] {
+			seen[f] = true
+			expanded = append(expanded, f)
+		}
+	}
+	for _, entry := range files {
+		if !isGlob(entry) {
+			add(entry)
+			continue
+		}
+		var matched []string
+		for _, f := range available {
+			ok, err := path.Match(entry, f)
+			if err != nil {
+				return nil, fmt.Errorf("stack %s: invalid file pattern %q: %w", stackID, entry, err)
+			}
+			if ok && f != "stack.json" {
+				matched = append(matched, f)
+			}
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("stack %s: file pattern %q matches no files", stackID, entry)
+		}
+		sort.Strings(matched)
+		for _, f := range matched {
+			add(f)
+		}
+	}
+	return expanded, nil
+}
+
+// listStackFiles returns the paths of all files in a stack directory, relative to it
+// and slash-separated. Registries read over plain HTTP can't be listed.
+func (c *Client) listStackFiles(ctx context.Context, stackID, ref string) ([]string, error) {
+	dir := "company-instructions/" + stackID
+	switch {
+	case c.localDir != "":
+		return listLocalFiles(filepath.Join(c.localDir, filepath.FromSlash(dir)))
+	case c.gitlabHost != "":
+		return c.listTreeFiles(ctx, dir, ref)
+	default:
+		return nil, fmt.Errorf("file patterns need a GitLab or local registry")
+	}
+}
+
+// listLocalFiles walks dir and returns the files below it.
+func listLocalFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// listTreeFiles lists the files below dir through the GitLab repository tree API,
+// following pages until a short one is returned.
+func (c *Client) listTreeFiles(ctx context.Context, dir, ref string) ([]string, error) {
+	var files []string
+	for page := 1; ; page++ {
+		treeURL := fmt.Sprintf("%s/api/v4/projects/%s/repository/tree?path=%s&ref=%s&recursive=true&per_page=%d&page=%d",
+			c.gitlabHost,
+			url.PathEscape(c.project()),
+			url.QueryEscape(dir),
+			url.QueryEscape(ref),
+			treePageSize,
+			page,
+		)
+		data, err := c.get(ctx, treeURL, expectJSON)
+		if err != nil {
+			return nil, err
+		}
+		var entries []treeEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("parsing repository tree: %w", err)
+		}
+		for _, e := range entries {
+			if rel, ok := strings.CutPrefix(e.Path, dir+"/"); ok && e.Type == "blob" {
+				files = append(files, rel)
+			}
+		}
+		if len(entries) < treePageSize {
+			return files, nil
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const globManifest = `{"name":"PHP","version":"1.0.0","files":["README.md","docs/*.md","*.md"]}`
+
+var globStackFiles = []string{"README.md", "rules.md", "docs/a.md", "docs/b.md", "docs/notes.txt"}
+
+func TestExpandFilesLocalDir(t *testing.T) {
+	dir := t.TempDir()
+	stackDir := filepath.Join(dir, "company-instructions", "php")
+	for _, f := range append(globStackFiles, "stack.json") {
+		path := filepath.Join(stackDir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := "content"
+		if f == "stack.json" {
+			content = globManifest
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := NewClient(WithLocalDir(dir))
+	manifest, err := client.FetchStackManifest(context.Background(), "php")
+	if err != nil {
+		t.Fatalf("FetchStackManifest: %v", err)
+	}
+	want := []string{"README.md", "docs/a.md", "docs/b.md", "rules.md"}
+	if !reflect.DeepEqual(manifest.Files, want) {
+		t.Errorf("Files = %v, want %v", manifest.Files, want)
+	}
+}
+
+func TestExpandFilesGitLabTree(t *testing.T) {
+	var entries []treeEntry
+	entries = append(entries, treeEntry{Type: "tree", Path: "company-instructions/php/docs"})
+	for _, f := range append(globStackFiles, "stack.json") {
+		entries = append(entries, treeEntry{Type: "blob", Path: "company-instructions/php/" + f})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/repository/tree"):
+			if got := r.URL.Query().Get("path"); got != "company-instructions/php" {
+				t.Errorf("tree path = %q", got)
+			}
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			start := min((page-1)*treePageSize, len(entries))
+			end := min(start+treePageSize, len(entries))
+			json.NewEncoder(w).Encode(entries[start:end])
+		case strings.Contains(r.URL.EscapedPath(), "stack.json"):
+			fmt.Fprint(w, globManifest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(WithProjectURL(server.URL+"/cego/instructions"), WithBranch("master"), WithHTTPClient(server.Client()))
+	manifest, err := client.FetchStackManifest(context.Background(), "php")
+	if err != nil {
+		t.Fatalf("FetchStackManifest: %v", err)
+	}
+	want := []string{"README.md", "docs/a.md", "docs/b.md", "rules.md"}
+	if !reflect.DeepEqual(manifest.Files, want) {
+		t.Errorf("Files = %v, want %v", manifest.Files, want)
+	}
+}
+
+func TestExpandFilesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		wantErr string
+	}{
+		{name: "no match", files: []string{"*.txt"}, wantErr: "matches no files"},
+		{name: "bad pattern", files: []string{"[.md"}, wantErr: "invalid file pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			stackDir := filepath.Join(dir, "company-instructions", "php")
+			os.MkdirAll(stackDir, 0755)
+			os.WriteFile(filepath.Join(stackDir, "rules.md"), []byte("rules"), 0644)
+
+			client := NewClient(WithLocalDir(dir))
+			_, err := client.expandFiles(context.Background(), "php", "", tt.files)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expandFiles error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Registries served over plain HTTP can't be listed
+	client := NewClient(WithBaseURL("http://registry.invalid"))
+	if _, err := client.expandFiles(context.Background(), "php", "", []string{"*.md"}); err == nil {
+		t.Error("expandFiles should fail without a listable registry")
+	}
+}
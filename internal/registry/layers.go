@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// WithLayers composes the client from several registries, in increasing precedence.
+// FetchRegistry merges their stacks, with later registries overriding earlier ones on
+// ID collision, and stack manifests and files are fetched from the registry that owns the stack.
+func WithLayers(layers ...*Client) Option {
+	return func(c *Client) { c.layers = append(c.layers, layers...) }
+}
+
+// Source identifies the registry a client reads from.
+func (c *Client) Source() string {
+	if c.baseURL != "" {
+		return c.baseURL
+	}
+	if c.projectID != "" {
+		return fmt.Sprintf("%s (project %s)", c.gitlabHost, c.projectID)
+	}
+	return c.gitlabHost + "/" + c.projectPath
+}
+
+// fetchLayeredRegistry fetches every layer and merges their stacks.
+func (c *Client) fetchLayeredRegistry(ctx context.Context) (*Registry, error) {
+	merged := &Registry{Stacks: make(map[string]StackMeta)}
+	owners := make(map[string]*Client)
+
+	for _, layer := range c.layers {
+		reg, err := layer.FetchRegistry(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", layer.Source(), err)
+		}
+		if merged.Version == 0 {
+			merged.Version = reg.Version
+		}
+		if reg.GeneratedAt > merged.GeneratedAt {
+			merged.GeneratedAt = reg.GeneratedAt
+		}
+
+		ids := make([]string, 0, len(reg.Stacks))
+		for id := range reg.Stacks {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if prev, ok := owners[id]; ok {
+				merged.Overrides = append(merged.Overrides, StackOverride{
+					Stack:      id,
+					Overridden: prev.Source(),
+					By:         layer.Source(),
+				})
+			}
+			merged.Stacks[id] = reg.Stacks[id]
+			owners[id] = layer
+		}
+	}
+
+	c.owners = owners
+	return merged, nil
+}
+
+// owner returns the layer that provides a stack.
+func (c *Client) owner(ctx context.Context, stackID string) (*Client, error) {
+	if c.owners == nil {
+		if _, err := c.FetchRegistry(ctx); err != nil {
+			return nil, err
+		}
+	}
+	layer, ok := c.owners[stackID]
+	if !ok {
+		return nil, fmt.Errorf("stack %s not found in any registry", stackID)
+	}
+	return layer, nil
+}
@@ -0,0 +1,98 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newStaticServer serves fixed paths under /company-instructions/.
+func newStaticServer(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.Error(w, "not found", 404)
+			return
+		}
+		w.Write([]byte(data))
+	}))
+}
+
+func TestLayeredRegistry(t *testing.T) {
+	company := newStaticServer(t, map[string]string{
+		"/company-instructions/registry.json": `{"version":1,"stacks":{
+			"php":{"name":"PHP","category":"language","version":"1.0.0"},
+			"go":{"name":"Go","category":"language","version":"1.0.0"}}}`,
+		"/company-instructions/php/stack.json": `{"name":"PHP","version":"1.0.0","files":["a.md"]}`,
+		"/company-instructions/php/a.md":       "company php",
+		"/company-instructions/go/stack.json":  `{"name":"Go","version":"1.0.0","files":["a.md"]}`,
+		"/company-instructions/go/a.md":        "company go",
+	})
+	defer company.Close()
+
+	team := newStaticServer(t, map[string]string{
+		"/company-instructions/registry.json": `{"version":1,"stacks":{
+			"php":{"name":"PHP","category":"language","version":"2.0.0"},
+			"team":{"name":"Team","category":"language","version":"1.0.0","depends":["go"]}}}`,
+		"/company-instructions/php/stack.json":  `{"name":"PHP (team)","version":"2.0.0","files":["a.md"]}`,
+		"/company-instructions/php/a.md":        "team php",
+		"/company-instructions/team/stack.json": `{"name":"Team","version":"1.0.0","files":["a.md"]}`,
+		"/company-instructions/team/a.md":       "team rules",
+	})
+	defer team.Close()
+
+	client := NewClient(WithLayers(
+		NewClient(WithBaseURL(company.URL), WithHTTPClient(company.Client())),
+		NewClient(WithBaseURL(team.URL), WithHTTPClient(team.Client())),
+	))
+
+	ctx := context.Background()
+	reg, err := client.FetchRegistry(ctx)
+	if err != nil {
+		t.Fatalf("FetchRegistry() error: %v", err)
+	}
+
+	if len(reg.Stacks) != 3 {
+		t.Errorf("merged stacks = %d, want 3", len(reg.Stacks))
+	}
+	if v := reg.Stacks["php"].Version; v != "2.0.0" {
+		t.Errorf("php version = %s, want the team override 2.0.0", v)
+	}
+	if len(reg.Overrides) != 1 || reg.Overrides[0].Stack != "php" || reg.Overrides[0].By != team.URL {
+		t.Errorf("Overrides = %+v, want php overridden by %s", reg.Overrides, team.URL)
+	}
+
+	tests := []struct {
+		stack    string
+		wantName string
+		wantFile string
+	}{
+		{stack: "php", wantName: "PHP (team)", wantFile: "team php"},
+		{stack: "go", wantName: "Go", wantFile: "company go"},
+		{stack: "team", wantName: "Team", wantFile: "team rules"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stack, func(t *testing.T) {
+			manifest, err := client.FetchStackManifest(ctx, tt.stack)
+			if err != nil {
+				t.Fatalf("FetchStackManifest() error: %v", err)
+			}
+			if manifest.Name != tt.wantName {
+				t.Errorf("Name = %q, want %q", manifest.Name, tt.wantName)
+			}
+			data, err := client.DownloadFile(ctx, tt.stack, "a.md")
+			if err != nil {
+				t.Fatalf("DownloadFile() error: %v", err)
+			}
+			if string(data) != tt.wantFile {
+				t.Errorf("file = %q, want %q", data, tt.wantFile)
+			}
+		})
+	}
+
+	if _, err := client.FetchStackManifest(ctx, "missing"); err == nil {
+		t.Error("FetchStackManifest() should fail for a stack no layer provides")
+	}
+}
@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxRateLimitRetries is how often a request answered with 429 is retried.
+	maxRateLimitRetries = 3
+	// maxRetryAfter caps the wait a Retry-After header can ask for.
+	maxRetryAfter = time.Minute
+	// defaultRetryAfter is the wait after a 429 without a usable Retry-After header.
+	defaultRetryAfter = time.Second
+)
+
+// WithLogger sends notices about requests that are delayed, such as by rate limiting, to fn.
+func WithLogger(fn func(format string, args ...any)) Option {
+	return func(c *Client) { c.logf = fn }
+}
+
+// do sends req. When the registry answers 429 Too Many Requests, it waits as long as
+// the Retry-After header asks, capped at maxRetryAfter, and tries again, up to
+// maxRateLimitRetries times. The last response is returned whatever its status.
+func (c *Client) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.httpClient.Do(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt == maxRateLimitRetries {
+			return resp, err
+		}
+		resp.Body.Close()
+
+		wait := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		c.logf("Rate limited by %s, retrying in %s", req.URL.Host, wait)
+		if err := c.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryAfter parses a Retry-After header, either delay seconds or an HTTP date, into
+// the wait from now. Missing or invalid values give defaultRetryAfter.
+func retryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return defaultRetryAfter
+	}
+
+	var wait time.Duration
+	if secs, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(secs) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		wait = at.Sub(now)
+	} else {
+		return defaultRetryAfter
+	}
+
+	switch {
+	case wait < 0:
+		return 0
+	case wait > maxRetryAfter:
+		return maxRetryAfter
+	}
+	return wait
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimitRetry(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "2")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("# PHP"))
+	}))
+	defer server.Close()
+
+	var logged []string
+	client := NewClient(
+		WithBaseURL(server.URL),
+		WithHTTPClient(server.Client()),
+		WithLogger(func(format string, args ...any) { logged = append(logged, fmt.Sprintf(format, args...)) }),
+	)
+	var waits []time.Duration
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	data, err := client.DownloadFile(context.Background(), "php", "coding-standards.md")
+	if err != nil {
+		t.Fatalf("DownloadFile() error: %v", err)
+	}
+	if string(data) != "# PHP" {
+		t.Errorf("DownloadFile() = %q, want the retried response", data)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("requests = %d, want 2", requests.Load())
+	}
+	if len(waits) != 1 || waits[0] != 2*time.Second {
+		t.Errorf("waits = %v, want [2s] from Retry-After", waits)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "Rate limited") || !strings.Contains(logged[0], "2s") {
+		t.Errorf("logged = %q, want a rate limit notice with the wait", logged)
+	}
+}
+
+func TestRateLimitGivesUp(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL), WithHTTPClient(server.Client()))
+	client.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+
+	_, err := client.DownloadFile(context.Background(), "php", "coding-standards.md")
+	if !strings.Contains(fmt.Sprint(err), "HTTP 429") {
+		t.Errorf("DownloadFile() error = %v, want HTTP 429", err)
+	}
+	if want := int32(maxRateLimitRetries + 1); requests.Load() != want {
+		t.Errorf("requests = %d, want %d", requests.Load(), want)
+	}
+}
+
+func TestRateLimitWaitCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL), WithHTTPClient(server.Client()))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.DownloadFile(ctx, "php", "coding-standards.md")
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("DownloadFile() = %v after %s, want the wait cut short by the context", err, time.Since(start))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "seconds", header: "5", want: 5 * time.Second},
+		{name: "http date", header: now.Add(10 * time.Second).Format(http.TimeFormat), want: 10 * time.Second},
+		{name: "date in the past", header: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "capped", header: "3600", want: maxRetryAfter},
+		{name: "missing", header: "", want: defaultRetryAfter},
+		{name: "invalid", header: "soon", want: defaultRetryAfter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.header, now); got != tt.want {
+				t.Errorf("retryAfter(%q) = %s, want %s", tt.header, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,16 @@ type Registry struct {
 	Version     int                  `json:"version"`
 	GeneratedAt string               `json:"generated_at"`
 	Stacks      map[string]StackMeta `json:"stacks"`
+
+	// Overrides lists stacks defined by more than one layered registry (see WithLayers).
+	Overrides []StackOverride `json:"-"`
+}
+
+// StackOverride records a stack ID provided by more than one layered registry.
+type StackOverride struct {
+	Stack      string
+	Overridden string // registry whose definition was replaced
+	By         string // registry that now provides the stack
 }
 
 // StackMeta is the summary of a stack in registry.json.
@@ -15,17 +25,55 @@ type StackMeta struct {
 	Hash        string   `json:"hash"`
 	Category    string   `json:"category"`
 	Depends     []string `json:"depends"`
+	// OptionalDepends are recommended companion stacks that aren't installed automatically.
+	OptionalDepends []string `json:"optional_depends,omitempty"`
+	// ConditionalDepends maps a trigger stack to deps required only when the trigger is
+	// installed too, e.g. "laravel": ["laravel-testing"].
+	ConditionalDepends map[string][]string `json:"conditional_depends,omitempty"`
+	// Owner is the team or person responsible for the stack, and Maintainers who to ask
+	// about its rules. Both are shown by list --verbose.
+	Owner       string   `json:"owner,omitempty"`
+	Maintainers []string `json:"maintainers,omitempty"`
 }
 
 // StackManifest is the full stack.json within a stack folder.
 type StackManifest struct {
-	Name        string         `json:"name"`
-	Version     string         `json:"version"`
-	Description string         `json:"description"`
-	Depends     []string       `json:"depends"`
-	Category    string         `json:"category"`
-	Files       []string       `json:"files"`
-	Tools       ToolsConfig    `json:"tools"`
+	Name            string            `json:"name"`
+	Version         string            `json:"version"`
+	Description     string            `json:"description"`
+	Depends         []string          `json:"depends"`
+	OptionalDepends []string          `json:"optional_depends,omitempty"`
+	Category        string            `json:"category"`
+	Files           []string          `json:"files"`            // may contain globs like "docs/*.md", expanded on fetch
+	Modes           map[string]string `json:"modes,omitempty"`  // filename → octal permissions, e.g. "0755"
+	Hashes          map[string]string `json:"hashes,omitempty"` // filename → expected "sha256:<hex>"
+	Tools           ToolsConfig       `json:"tools"`
+	// ConditionalDepends maps a trigger stack to deps required only when it is installed too.
+	// It must match the registry.json entry, which validate checks.
+	ConditionalDepends map[string][]string `json:"conditional_depends,omitempty"`
+	// FileTools lists the target tools ("claude", "agents", "cursor") of individual files,
+	// overriding Tools for them.
+	FileTools map[string][]string `json:"file_tools,omitempty"`
+	// Locales lists the translated files of each locale, e.g. "da": ["rules.md"] for
+	// da/rules.md in the stack directory. Only one locale's files are downloaded, next to the
+	// shared Files.
+	Locales map[string][]string `json:"locales,omitempty"`
+	// DefaultLocale is the locale whose files stand in for missing translations; "en" if unset.
+	DefaultLocale string `json:"default_locale,omitempty"`
+	// Inline lists files whose content is embedded in the managed blocks instead of referenced,
+	// for tools that don't open linked files. Large files stay referenced.
+	Inline []string `json:"inline,omitempty"`
+	// Templates lists files rendered as Go templates with the project's variables after
+	// download, e.g. {{ .ProjectName }} or {{ .Var "wiki_url" }}.
+	Templates []string `json:"templates,omitempty"`
+	// ArchiveURL points to a .tar.gz of the stack's files, downloaded in one request instead
+	// of file by file. It is a full URL or a path relative to the stack directory.
+	ArchiveURL string `json:"archive_url,omitempty"`
+	// PostInstallMessage is shown to the user after the stack is first installed.
+	PostInstallMessage string `json:"post_install_message,omitempty"`
+	// Owner and Maintainers say who is responsible for the stack, as in registry.json.
+	Owner       string   `json:"owner,omitempty"`
+	Maintainers []string `json:"maintainers,omitempty"`
 }
 
 // ToolsConfig specifies which AI tools a stack targets.
@@ -44,4 +92,3 @@ type ClaudeToolConfig struct {
 type CursorToolConfig struct {
 	IncludeInCursorRules bool `json:"include_in_cursorrules"`
 }
-
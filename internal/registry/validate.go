@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Registry format versions this CLI understands.
+const (
+	MinRegistryVersion = 1
+	MaxRegistryVersion = 1
+)
+
+// ValidatePathComponent rejects stack IDs and filenames that could escape the
+// directory they are meant to address, whether on disk or in a registry URL.
+func ValidatePathComponent(name, label string) error {
+	if name == "" {
+		return fmt.Errorf("empty %s", label)
+	}
+	cleaned := filepath.Clean(name)
+	if cleaned != name || strings.Contains(cleaned, "..") || filepath.IsAbs(cleaned) {
+		return fmt.Errorf("invalid %s: %q", label, name)
+	}
+	return nil
+}
+
+// ValidateRegistry checks that a fetched registry uses a supported format version and
+// that every stack has the fields the CLI depends on.
+func ValidateRegistry(reg *Registry) error {
+	if reg.Version > MaxRegistryVersion {
+		return fmt.Errorf("registry version %d not supported by this CLI, please upgrade", reg.Version)
+	}
+	if reg.Version < MinRegistryVersion {
+		return fmt.Errorf("registry version %d not supported (expected %d to %d)", reg.Version, MinRegistryVersion, MaxRegistryVersion)
+	}
+	if reg.Stacks == nil {
+		return fmt.Errorf("registry has no stacks")
+	}
+
+	ids := make([]string, 0, len(reg.Stacks))
+	for id := range reg.Stacks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		meta := reg.Stacks[id]
+		var missing []string
+		if meta.Name == "" {
+			missing = append(missing, "name")
+		}
+		if meta.Version == "" {
+			missing = append(missing, "version")
+		}
+		if meta.Category == "" {
+			missing = append(missing, "category")
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("stack %s is missing %s", id, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
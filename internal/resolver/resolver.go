@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 )
@@ -10,6 +11,12 @@ import (
 type StackInfo struct {
 	ID      string
 	Depends []string
+	// OptionalDepends are suggested companions. They are never installed automatically,
+	// but are ordered before this stack when the user opts in to them.
+	OptionalDepends []string
+	// ConditionalDepends maps a trigger stack to deps that are only required when the
+	// trigger is part of the resolution too, e.g. "laravel": ["laravel-testing"].
+	ConditionalDepends map[string][]string
 }
 
 // Resolution is the result of dependency resolution.
@@ -19,7 +26,17 @@ type Resolution struct {
 	// Explicit are the stacks directly requested.
 	Explicit map[string]bool
 	// DependencyOf maps transitive deps to the stack that requires them.
+	// When several stacks require the same dep, the lexicographically smallest wins
+	// so the attribution doesn't depend on input or traversal order.
 	DependencyOf map[string]string
+	// Depends maps each resolved stack to the resolved stacks it must come after: its
+	// dependencies, and its optional and conditional ones that are part of the resolution.
+	// Sorted, and absent for stacks without any.
+	Depends map[string][]string
+	// Suggested are optional deps of resolved stacks that aren't installed, sorted.
+	Suggested []string
+	// SuggestedBy maps each suggested stack to the resolved stacks recommending it.
+	SuggestedBy map[string][]string
 }
 
 // CircularDependencyError indicates a cycle in the dependency graph.
@@ -78,31 +95,63 @@ func (r *Resolver) Resolve(explicit []string) (*Resolution, error) {
 		explicitSet[id] = true
 	}
 
+	// addDep records dep as required by stack and returns whether it still has to be visited
+	addDep := func(stack, dep string) (bool, error) {
+		if _, ok := r.stacks[dep]; !ok {
+			return false, &MissingDependencyError{Stack: stack, Dependency: dep}
+		}
+		if !explicitSet[dep] && (dependencyOf[dep] == "" || stack < dependencyOf[dep]) {
+			dependencyOf[dep] = stack
+		}
+		return !needed[dep], nil
+	}
+
 	// BFS to find all transitive dependencies
 	queue := make([]string, len(explicit))
 	copy(queue, explicit)
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
+	for {
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
 
-		if needed[current] {
-			continue
-		}
-		needed[current] = true
+			if needed[current] {
+				continue
+			}
+			needed[current] = true
 
-		info, ok := r.stacks[current]
-		if !ok {
-			return nil, &MissingStackError{Stack: current}
-		}
+			info, ok := r.stacks[current]
+			if !ok {
+				return nil, &MissingStackError{Stack: current}
+			}
 
-		for _, dep := range info.Depends {
-			if _, ok := r.stacks[dep]; !ok {
-				return nil, &MissingDependencyError{Stack: current, Dependency: dep}
+			for _, dep := range info.Depends {
+				if _, err := addDep(current, dep); err != nil {
+					return nil, err
+				}
+				queue = append(queue, dep)
 			}
-			if !explicitSet[dep] && dependencyOf[dep] == "" {
-				dependencyOf[dep] = current
+		}
+
+		// Second pass: activate conditional deps whose trigger is now present. Their own
+		// deps may activate further conditions, so repeat until nothing changes.
+		for _, id := range sortedKeys(needed) {
+			for trigger, deps := range r.stacks[id].ConditionalDepends {
+				if !needed[trigger] {
+					continue
+				}
+				for _, dep := range deps {
+					visit, err := addDep(id, dep)
+					if err != nil {
+						return nil, err
+					}
+					if visit {
+						queue = append(queue, dep)
+					}
+				}
 			}
-			queue = append(queue, dep)
+		}
+		if len(queue) == 0 {
+			break
 		}
 	}
 
@@ -110,16 +159,19 @@ func (r *Resolver) Resolve(explicit []string) (*Resolution, error) {
 	// Build in-degree map restricted to needed stacks
 	inDegree := make(map[string]int)
 	adj := make(map[string][]string) // dep -> dependents
+	depends := make(map[string][]string)
 	for id := range needed {
 		if _, ok := inDegree[id]; !ok {
 			inDegree[id] = 0
 		}
-		for _, dep := range r.stacks[id].Depends {
-			if needed[dep] {
-				adj[dep] = append(adj[dep], id)
-				inDegree[id]++
+		for _, dep := range r.edges(id, needed) {
+			adj[dep] = append(adj[dep], id)
+			inDegree[id]++
+			if !slices.Contains(depends[id], dep) {
+				depends[id] = append(depends[id], dep)
 			}
 		}
+		sort.Strings(depends[id])
 	}
 
 	// Find all nodes with in-degree 0
@@ -150,13 +202,94 @@ func (r *Resolver) Resolve(explicit []string) (*Resolution, error) {
 		return nil, &CircularDependencyError{Cycle: cycle}
 	}
 
+	suggestedBy := make(map[string][]string)
+	for _, id := range order {
+		for _, opt := range r.stacks[id].OptionalDepends {
+			if _, ok := r.stacks[opt]; !ok || needed[opt] {
+				continue
+			}
+			suggestedBy[opt] = append(suggestedBy[opt], id)
+		}
+	}
+	suggested := make([]string, 0, len(suggestedBy))
+	for id := range suggestedBy {
+		suggested = append(suggested, id)
+	}
+	sort.Strings(suggested)
+
 	return &Resolution{
 		Order:        order,
 		Explicit:     explicitSet,
 		DependencyOf: dependencyOf,
+		Depends:      depends,
+		Suggested:    suggested,
+		SuggestedBy:  suggestedBy,
 	}, nil
 }
 
+// edges returns the stacks that must come before id, restricted to the needed set.
+// Optional deps only count once they are part of the resolution, conditional deps once
+// their trigger is.
+func (r *Resolver) edges(id string, needed map[string]bool) []string {
+	info := r.stacks[id]
+	var deps []string
+	for _, dep := range info.Depends {
+		if needed[dep] {
+			deps = append(deps, dep)
+		}
+	}
+	for _, dep := range info.OptionalDepends {
+		if needed[dep] {
+			deps = append(deps, dep)
+		}
+	}
+	for _, trigger := range sortedKeys(info.ConditionalDepends) {
+		if !needed[trigger] {
+			continue
+		}
+		for _, dep := range info.ConditionalDepends[trigger] {
+			if needed[dep] {
+				deps = append(deps, dep)
+			}
+		}
+	}
+	return deps
+}
+
+// loopFrom returns the cycle that closes when the DFS path reaches start again. The path
+// leading up to start isn't part of the cycle and is dropped. The loop is rotated to begin
+// at its smallest stack ID, so it reads the same whichever node the search entered it by,
+// and ends with that ID again.
+func loopFrom(path []string, start string) []string {
+	var loop []string
+	for i, n := range path {
+		if n == start {
+			loop = path[i:]
+			break
+		}
+	}
+	first := 0
+	for i, n := range loop {
+		if n < loop[first] {
+			first = i
+		}
+	}
+	cycle := make([]string, 0, len(loop)+1)
+	cycle = append(cycle, loop[first:]...)
+	cycle = append(cycle, loop[:first]...)
+	return append(cycle, cycle[0])
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // ResolveRemoval determines which stacks become orphans when removing stacks.
 func (r *Resolver) ResolveRemoval(currentExplicit []string, removing []string) (orphans []string) {
 	removingSet := make(map[string]bool)
@@ -210,21 +343,9 @@ func (r *Resolver) findCycle(needed map[string]bool) []string {
 		visited[node] = 1
 		path = append(path, node)
 
-		info := r.stacks[node]
-		for _, dep := range info.Depends {
-			if !needed[dep] {
-				continue
-			}
+		for _, dep := range r.edges(node, needed) {
 			if visited[dep] == 1 {
-				// Found cycle: find where dep appears in path
-				for i, n := range path {
-					if n == dep {
-						cycle := make([]string, len(path[i:])+1)
-						copy(cycle, path[i:])
-						cycle[len(cycle)-1] = dep
-						return cycle
-					}
-				}
+				return loopFrom(path, dep)
 			}
 			if visited[dep] == 0 {
 				if cycle := dfs(dep); cycle != nil {
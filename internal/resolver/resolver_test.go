@@ -2,6 +2,8 @@ package resolver
 
 import (
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -128,6 +130,54 @@ func TestCircularDeps(t *testing.T) {
 	}
 }
 
+func TestCircularDepsMinimalCycle(t *testing.T) {
+	tests := []struct {
+		name   string
+		stacks map[string][]string
+		want   string
+	}{
+		{
+			name: "behind non-cyclic prefix",
+			stacks: map[string][]string{
+				"app": {"lib"},
+				"lib": {"x"},
+				"x":   {"y"},
+				"y":   {"z"},
+				"z":   {"x"},
+			},
+			want: "x → y → z → x",
+		},
+		{
+			name: "entered after smallest node",
+			stacks: map[string][]string{
+				"app": {"m"},
+				"m":   {"k"},
+				"k":   {"n"},
+				"n":   {"m"},
+			},
+			want: "k → n → m → k",
+		},
+		{
+			name:   "self dependency",
+			stacks: map[string][]string{"app": {"lib"}, "lib": {"lib"}},
+			want:   "lib → lib",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewResolver(makeStacks(tt.stacks)).Resolve([]string{"app"})
+			var cycleErr *CircularDependencyError
+			if !errors.As(err, &cycleErr) {
+				t.Fatalf("Resolve() error = %v, want CircularDependencyError", err)
+			}
+			if got := strings.Join(cycleErr.Cycle, " → "); got != tt.want {
+				t.Errorf("Cycle = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestMissingStack(t *testing.T) {
 	stacks := makeStacks(map[string][]string{
 		"php": {},
@@ -209,3 +259,179 @@ func TestRemoveNoOrphans(t *testing.T) {
 		t.Fatalf("orphans len = %d, want 0: %v", len(orphans), orphans)
 	}
 }
+
+func TestDiamondDependencyOfIsDeterministic(t *testing.T) {
+	// web and api both depend on auth and logging; auth also depends on logging
+	stacks := makeStacks(map[string][]string{
+		"logging": {},
+		"auth":    {"logging"},
+		"web":     {"auth", "logging"},
+		"api":     {"logging", "auth"},
+	})
+
+	want := map[string]string{
+		"auth":    "api",
+		"logging": "api",
+	}
+
+	inputs := [][]string{
+		{"web", "api"},
+		{"api", "web"},
+	}
+	for _, explicit := range inputs {
+		for i := 0; i < 20; i++ {
+			res, err := NewResolver(stacks).Resolve(explicit)
+			if err != nil {
+				t.Fatalf("Resolve(%v) error: %v", explicit, err)
+			}
+			for dep, parent := range want {
+				if res.DependencyOf[dep] != parent {
+					t.Fatalf("Resolve(%v) run %d: %s dependency_of = %q, want %q", explicit, i, dep, res.DependencyOf[dep], parent)
+				}
+			}
+		}
+	}
+}
+
+func TestOptionalDepends(t *testing.T) {
+	stacks := map[string]StackInfo{
+		"php":     {ID: "php"},
+		"docker":  {ID: "docker"},
+		"laravel": {ID: "laravel", Depends: []string{"php"}, OptionalDepends: []string{"docker", "unknown"}},
+	}
+
+	r := NewResolver(stacks)
+	res, err := r.Resolve([]string{"laravel"})
+	if err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	if len(res.Order) != 2 {
+		t.Fatalf("Order = %v, optional deps should not be installed", res.Order)
+	}
+	if len(res.Suggested) != 1 || res.Suggested[0] != "docker" {
+		t.Errorf("Suggested = %v, want [docker]", res.Suggested)
+	}
+	if by := res.SuggestedBy["docker"]; len(by) != 1 || by[0] != "laravel" {
+		t.Errorf("SuggestedBy[docker] = %v, want [laravel]", by)
+	}
+
+	// Opting in orders the optional dep before the stack that suggests it
+	res, err = r.Resolve([]string{"laravel", "docker"})
+	if err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	if len(res.Suggested) != 0 {
+		t.Errorf("Suggested = %v, want none once installed", res.Suggested)
+	}
+	pos := make(map[string]int)
+	for i, id := range res.Order {
+		pos[id] = i
+	}
+	if pos["docker"] > pos["laravel"] {
+		t.Errorf("Order = %v, docker should come before laravel", res.Order)
+	}
+}
+
+func TestConditionalDepends(t *testing.T) {
+	stacks := map[string]StackInfo{
+		"php":             {ID: "php", ConditionalDepends: map[string][]string{"laravel": {"laravel-testing"}}},
+		"laravel":         {ID: "laravel", Depends: []string{"php"}},
+		"laravel-testing": {ID: "laravel-testing", Depends: []string{"phpunit"}},
+		"phpunit":         {ID: "phpunit"},
+		"symfony":         {ID: "symfony", Depends: []string{"php"}},
+	}
+
+	tests := []struct {
+		name     string
+		explicit []string
+		want     []string
+	}{
+		{name: "trigger absent", explicit: []string{"php"}, want: []string{"php"}},
+		{name: "other dependent", explicit: []string{"symfony"}, want: []string{"php", "symfony"}},
+		{name: "trigger explicit", explicit: []string{"php", "laravel"}, want: []string{"phpunit", "laravel-testing", "php", "laravel"}},
+		{name: "trigger pulls in declaring stack", explicit: []string{"laravel"}, want: []string{"phpunit", "laravel-testing", "php", "laravel"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := NewResolver(stacks).Resolve(tt.explicit)
+			if err != nil {
+				t.Fatalf("Resolve() error: %v", err)
+			}
+			if strings.Join(res.Order, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Order = %v, want %v", res.Order, tt.want)
+			}
+		})
+	}
+
+	res, err := NewResolver(stacks).Resolve([]string{"laravel"})
+	if err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	if res.DependencyOf["laravel-testing"] != "php" {
+		t.Errorf("laravel-testing dependency_of = %q, want php", res.DependencyOf["laravel-testing"])
+	}
+	if res.DependencyOf["phpunit"] != "laravel-testing" {
+		t.Errorf("phpunit dependency_of = %q, want laravel-testing", res.DependencyOf["phpunit"])
+	}
+}
+
+func TestConditionalDependsChain(t *testing.T) {
+	// An activated conditional dep can itself be the trigger of another
+	stacks := map[string]StackInfo{
+		"a": {ID: "a", ConditionalDepends: map[string][]string{"b": {"c"}}},
+		"b": {ID: "b", ConditionalDepends: map[string][]string{"c": {"d"}}},
+		"c": {ID: "c"},
+		"d": {ID: "d"},
+	}
+
+	res, err := NewResolver(stacks).Resolve([]string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	if got := strings.Join(res.Order, ","); got != "c,a,d,b" {
+		t.Errorf("Order = %v, want [c a d b]", res.Order)
+	}
+}
+
+func TestConditionalDependsMissing(t *testing.T) {
+	stacks := map[string]StackInfo{
+		"php":     {ID: "php", ConditionalDepends: map[string][]string{"laravel": {"unknown"}}},
+		"laravel": {ID: "laravel"},
+	}
+
+	if _, err := NewResolver(stacks).Resolve([]string{"php"}); err != nil {
+		t.Fatalf("Resolve() error without trigger: %v", err)
+	}
+
+	_, err := NewResolver(stacks).Resolve([]string{"php", "laravel"})
+	var missing *MissingDependencyError
+	if !errors.As(err, &missing) {
+		t.Fatalf("Resolve() error = %v, want MissingDependencyError", err)
+	}
+	if missing.Stack != "php" || missing.Dependency != "unknown" {
+		t.Errorf("error = %+v, want php → unknown", missing)
+	}
+}
+
+func TestResolutionDepends(t *testing.T) {
+	stacks := makeStacks(map[string][]string{
+		"php":     {},
+		"laravel": {"php"},
+		"symfony": {"php", "php"},
+		"pest":    {},
+	})
+	stacks["laravel"] = StackInfo{ID: "laravel", Depends: []string{"php"}, OptionalDepends: []string{"pest", "unused"}}
+
+	res, err := NewResolver(stacks).Resolve([]string{"laravel", "symfony", "pest"})
+	if err != nil {
+		t.Fatalf("Resolve() error: %v", err)
+	}
+	want := map[string][]string{
+		"laravel": {"pest", "php"},
+		"symfony": {"php"},
+	}
+	if !reflect.DeepEqual(res.Depends, want) {
+		t.Errorf("Depends = %v, want %v", res.Depends, want)
+	}
+}
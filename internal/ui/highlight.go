@@ -0,0 +1,21 @@
+package ui
+
+import "regexp"
+
+// Highlight returns s with the first case-insensitive occurrence of substr emphasized.
+// With colors disabled, or without a match, s is returned unchanged.
+func (o *Output) Highlight(s, substr string) string {
+	if o.noColor || substr == "" {
+		return s
+	}
+	// Matching on s itself keeps the indexes valid where lowercasing changes byte lengths
+	re, err := regexp.Compile("(?i)" + regexp.QuoteMeta(substr))
+	if err != nil {
+		return s
+	}
+	loc := re.FindStringIndex(s)
+	if loc == nil {
+		return s
+	}
+	return s[:loc[0]] + "\033[1;33m" + s[loc[0]:loc[1]] + "\033[0m" + s[loc[1]:]
+}
@@ -0,0 +1,34 @@
+package ui
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      string
+		substr string
+		want   string
+	}{
+		{name: "match", s: "Laravel conventions", substr: "conv", want: "Laravel \033[1;33mconv\033[0mentions"},
+		{name: "case-insensitive", s: "PHP standards", substr: "php", want: "\033[1;33mPHP\033[0m standards"},
+		{name: "no match", s: "PHP standards", substr: "vue", want: "PHP standards"},
+		{name: "empty substr", s: "PHP standards", substr: "", want: "PHP standards"},
+		{name: "regexp characters", s: "C++ (modern)", substr: "++ (", want: "C\033[1;33m++ (\033[0mmodern)"},
+		{name: "non-ASCII before match", s: "İstanbul PHP", substr: "php", want: "İstanbul \033[1;33mPHP\033[0m"},
+		{name: "non-ASCII match", s: "Ærø rules", substr: "æRØ", want: "\033[1;33mÆrø\033[0m rules"},
+	}
+
+	o := NewOutput()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := o.Highlight(tt.s, tt.substr); got != tt.want {
+				t.Errorf("Highlight(%q, %q) = %q, want %q", tt.s, tt.substr, got, tt.want)
+			}
+		})
+	}
+
+	o.SetNoColor(true)
+	if got := o.Highlight("PHP standards", "php"); got != "PHP standards" {
+		t.Errorf("Highlight() without colors = %q, want it unchanged", got)
+	}
+}
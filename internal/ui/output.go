@@ -4,11 +4,16 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 )
 
 // Output handles styled terminal output.
 type Output struct {
 	noColor bool
+	quiet   bool
+
+	stdinOnce sync.Once
+	answers   chan answer // lines read from stdin by the reader prompts start
 }
 
 // NewOutput creates a new Output instance.
@@ -21,8 +26,17 @@ func (o *Output) SetNoColor(v bool) {
 	o.noColor = v
 }
 
+// SetQuiet suppresses success, info and plain output. Warnings, errors and their
+// details, tables and debug output are still printed.
+func (o *Output) SetQuiet(v bool) {
+	o.quiet = v
+}
+
 // Success prints a success message with a green checkmark.
 func (o *Output) Success(format string, args ...any) {
+	if o.quiet {
+		return
+	}
 	msg := fmt.Sprintf(format, args...)
 	if o.noColor {
 		fmt.Fprintf(os.Stdout, "OK %s\n", msg)
@@ -41,6 +55,12 @@ func (o *Output) Error(format string, args ...any) {
 	}
 }
 
+// ErrorDetail prints a line explaining an error to stderr, without a marker. Like Error, it
+// is printed in quiet mode too.
+func (o *Output) ErrorDetail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
 // Warning prints a warning message with a yellow exclamation.
 func (o *Output) Warning(format string, args ...any) {
 	msg := fmt.Sprintf(format, args...)
@@ -53,11 +73,17 @@ func (o *Output) Warning(format string, args ...any) {
 
 // Info prints an informational message.
 func (o *Output) Info(format string, args ...any) {
+	if o.quiet {
+		return
+	}
 	fmt.Fprintf(os.Stdout, format+"\n", args...)
 }
 
 // Println prints a line to stdout.
 func (o *Output) Println(format string, args ...any) {
+	if o.quiet {
+		return
+	}
 	fmt.Fprintf(os.Stdout, format+"\n", args...)
 }
 
@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const progressBarWidth = 20
+
+// Progress reports determinate progress for a counted task.
+// On a terminal it redraws a single bar; otherwise (CI, pipes, no-color output) it prints
+// one line per step, so no control sequences end up in logs.
+type Progress struct {
+	label string
+	plain bool
+	quiet bool
+	drawn bool
+}
+
+// NewProgress creates a progress indicator for the given label.
+func (o *Output) NewProgress(label string) *Progress {
+	return &Progress{
+		label: label,
+		plain: o.noColor || IsCI() || !isTerminal(os.Stdout),
+		quiet: o.quiet,
+	}
+}
+
+// Update reports that done of total items have completed; item names the last one.
+func (p *Progress) Update(item string, done, total int) {
+	if p.quiet {
+		return
+	}
+	if p.plain {
+		fmt.Fprintf(os.Stdout, "  %s: downloaded %d/%d files (%s)\n", p.label, done, total, item)
+		return
+	}
+
+	filled := 0
+	if total > 0 {
+		filled = done * progressBarWidth / total
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+	fmt.Fprintf(os.Stdout, "\r\033[K  %s [%s] %d/%d files", p.label, bar, done, total)
+	p.drawn = true
+}
+
+// Done finishes the progress line.
+func (p *Progress) Done() {
+	if p.drawn {
+		fmt.Fprintln(os.Stdout)
+		p.drawn = false
+	}
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
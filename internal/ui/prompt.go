@@ -0,0 +1,99 @@
+package ui
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// IsCI reports whether the process is running in a CI environment.
+func IsCI() bool {
+	v := os.Getenv("CI")
+	return v != "" && v != "false"
+}
+
+// IsInteractive reports whether stdin is a terminal and the process isn't running in CI.
+func IsInteractive() bool {
+	if IsCI() {
+		return false
+	}
+	return isTerminal(os.Stdin)
+}
+
+// ErrAborted is returned by prompts when the user cancels (Ctrl-C) before answering.
+var ErrAborted = errors.New("aborted")
+
+// Confirm asks a yes/no question on stdin. Anything other than y/yes is treated as no.
+// Returns ErrAborted if ctx is cancelled while waiting for the answer.
+func (o *Output) Confirm(ctx context.Context, question string) (bool, error) {
+	fmt.Fprintf(os.Stdout, "%s [y/N] ", question)
+	line, err := o.readAnswer(ctx)
+	if err != nil {
+		return false, err
+	}
+	reply := strings.ToLower(strings.TrimSpace(line))
+	return reply == "y" || reply == "yes", nil
+}
+
+// Ask asks a question on stdin and returns the answer, or def if the answer is empty.
+// Returns ErrAborted if ctx is cancelled while waiting for the answer.
+func (o *Output) Ask(ctx context.Context, question, def string) (string, error) {
+	fmt.Fprintf(os.Stdout, "%s [%s] ", question, def)
+	line, err := o.readAnswer(ctx)
+	if err != nil {
+		return "", err
+	}
+	if reply := strings.TrimSpace(line); reply != "" {
+		return reply, nil
+	}
+	return def, nil
+}
+
+// answer is a line read from stdin.
+type answer struct {
+	line string
+	err  error
+}
+
+// readAnswer reads a line from stdin, returning ErrAborted if ctx is cancelled first.
+func (o *Output) readAnswer(ctx context.Context) (string, error) {
+	o.stdinOnce.Do(func() {
+		o.answers = make(chan answer)
+		go readLines(os.Stdin, o.answers)
+	})
+
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(os.Stdout)
+		return "", ErrAborted
+	case a, ok := <-o.answers:
+		if !ok {
+			// stdin was already closed
+			return "", nil
+		}
+		if a.err != nil && !errors.Is(a.err, io.EOF) {
+			return "", fmt.Errorf("reading answer: %w", a.err)
+		}
+		return a.line, nil
+	}
+}
+
+// readLines sends the lines of r to answers until r ends or fails, then closes answers.
+// A read from stdin can't be interrupted, so a single reader per Output owns stdin and
+// stops with it; a prompt cancelled while it waits leaves the next line to the next prompt
+// instead of leaving a goroutine behind.
+func readLines(r io.Reader, answers chan<- answer) {
+	defer close(answers)
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		answers <- answer{line, err}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package ui
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadLines(t *testing.T) {
+	answers := make(chan answer)
+	go readLines(strings.NewReader("yes\nno"), answers)
+
+	var got []answer
+	for a := range answers {
+		got = append(got, a)
+	}
+	if len(got) != 2 || got[0].line != "yes\n" || got[0].err != nil || got[1].line != "no" || got[1].err != io.EOF {
+		t.Errorf("readLines() sent %+v, want both lines, the last with EOF, then close", got)
+	}
+}